@@ -0,0 +1,82 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package analyze provides the analyze subcommand which turns a diagnostic bundle into a report
+package analyze
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/analyzers"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/spf13/cobra"
+)
+
+const (
+	HTMLReportName     = "ddc-report.html"
+	MarkdownReportName = "ddc-report.md"
+)
+
+var OutputDir string
+
+var AnalyzeCmd = &cobra.Command{
+	Use:   "analyze [diag.tgz|dir]",
+	Short: "summarises a diagnostic bundle into an html and markdown report",
+	Long:  `Summarises a diagnostic bundle, either the tarball or a directory it has been extracted to, into ddc-report.html and ddc-report.md covering topology, versions, top errors, gc pauses, queries and pod restarts`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := Execute(args[0], OutputDir); err != nil {
+			simplelog.Errorf("exiting %v", err)
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// Execute analyzes the bundle at source and writes both reports into outDir
+func Execute(source, outDir string) error {
+	b, err := bundle.Open(source)
+	if err != nil {
+		return fmt.Errorf("unable to open bundle %v due to error %w", source, err)
+	}
+	defer b.Close()
+
+	r := report.Run(b, analyzers.Default())
+
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		return fmt.Errorf("unable to create output dir %v due to error %w", outDir, err)
+	}
+	html, err := r.HTML()
+	if err != nil {
+		return err
+	}
+	htmlFile := filepath.Join(outDir, HTMLReportName)
+	if err := os.WriteFile(htmlFile, []byte(html), 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %w", htmlFile, err)
+	}
+	mdFile := filepath.Join(outDir, MarkdownReportName)
+	if err := os.WriteFile(mdFile, []byte(r.Markdown()), 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %w", mdFile, err)
+	}
+	fmt.Printf("reports written to %v and %v\n", htmlFile, mdFile)
+	return nil
+}
+
+func init() {
+	AnalyzeCmd.Flags().StringVarP(&OutputDir, "output-dir", "o", ".", "directory to write ddc-report.html and ddc-report.md to")
+}
@@ -0,0 +1,67 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyze_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+)
+
+func TestExecuteWritesBothReports(t *testing.T) {
+	outDir := t.TempDir()
+	if err := analyze.Execute(filepath.Join("testdata", "bundle"), outDir); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{analyze.HTMLReportName, analyze.MarkdownReportName} {
+		data, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, expected := range []string{"Cluster Topology", "dremio-executor-0", "OOMKilled", "HiveClient"} {
+			if !strings.Contains(string(data), expected) {
+				t.Errorf("expected %v to contain %q", name, expected)
+			}
+		}
+	}
+}
+
+func TestExecuteReadsTarball(t *testing.T) {
+	tgz := filepath.Join(t.TempDir(), "diag.tgz")
+	if err := archive.TarGzDir(filepath.Join("testdata", "bundle"), tgz); err != nil {
+		t.Fatal(err)
+	}
+	outDir := t.TempDir()
+	if err := analyze.Execute(tgz, outDir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(outDir, analyze.MarkdownReportName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "| coord1 | 24.3.2 | abc |") {
+		t.Errorf("expected versions from the tarball in the report but was\n%v", string(data))
+	}
+}
+
+func TestExecuteMissingBundle(t *testing.T) {
+	if err := analyze.Execute(filepath.Join("testdata", "missing"), t.TempDir()); err == nil {
+		t.Error("expected an error for a missing bundle")
+	}
+}
@@ -0,0 +1,33 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package analyzers holds the sections that make up the ddc analyze report
+package analyzers
+
+import (
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+)
+
+// Default is the list of analyzers ddc analyze runs, in report order
+func Default() []report.Analyzer {
+	return []report.Analyzer{
+		&Topology{},
+		&Versions{},
+		&Collections{},
+		&TopErrors{Limit: 25},
+		&GCPauses{LongestLimit: 10},
+		&Queries{SlowestLimit: 10},
+		&PodRestarts{},
+	}
+}
@@ -0,0 +1,141 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzers_test
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/analyzers"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/gclog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/stats"
+)
+
+func openBundle(t *testing.T) *bundle.Bundle {
+	t.Helper()
+	b, err := bundle.Open(filepath.Join("..", "testdata", "bundle"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(b.Close)
+	return b
+}
+
+func analyze(t *testing.T, a report.Analyzer) report.Section {
+	t.Helper()
+	section, err := a.Analyze(openBundle(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return section
+}
+
+func TestTopErrors(t *testing.T) {
+	section := analyze(t, &analyzers.TopErrors{Limit: 1})
+	rows := section.Tables[0].Rows
+	if len(rows) != 1 {
+		t.Fatalf("expected the limit to leave 1 row but was %v", len(rows))
+	}
+	// the coord1 event with a stack trace is fingerprinted separately
+	expected := []string{"3", "ERROR", "c.d.e.store.hive.HiveClient", "", "Unable to connect to metastore at #.#.#.#:#", "", "2024-01-01 11:00:01", "2024-01-01 11:00:01", "coord1, exec1"}
+	if !reflect.DeepEqual(rows[0], expected) {
+		t.Errorf("expected %v but was %v", expected, rows[0])
+	}
+}
+
+func TestGCPauses(t *testing.T) {
+	section := analyze(t, &analyzers.GCPauses{LongestLimit: 2})
+	expected := [][]string{
+		{"coord1", "3", "20.0", "1500.0", "1500.0", "1530.0", "1", "0", "225.6", "3000", "4096"},
+		{"exec1", "2", "30.0", "2000.0", "2000.0", "2030.0", "1", "0", "780.0", "3000", "4096"},
+	}
+	if !reflect.DeepEqual(section.Tables[0].Rows, expected) {
+		t.Errorf("expected %v but was %v", expected, section.Tables[0].Rows)
+	}
+	longest := section.Tables[1].Rows
+	if len(longest) != 2 || longest[0][0] != "exec1" || longest[0][2] != "Full" || longest[1][0] != "coord1" {
+		t.Errorf("expected the full gcs of each node as the longest pauses but was %v", longest)
+	}
+}
+
+func TestQueries(t *testing.T) {
+	section := analyze(t, &analyzers.Queries{SlowestLimit: 2})
+	slowest := section.Tables[len(section.Tables)-1]
+	if len(slowest.Rows) != 2 {
+		t.Fatalf("expected 2 slowest queries but was %v", len(slowest.Rows))
+	}
+	if slowest.Rows[0][0] != "q2" || slowest.Rows[1][0] != "q3" {
+		t.Errorf("expected q2 then q3 but was %v", slowest.Rows)
+	}
+	timings := section.Tables[2].Rows
+	if timings[0][4] != "5000" || timings[1][4] != "50" {
+		t.Errorf("expected the exact max running and planning times but was %v", timings)
+	}
+	// the percentiles come from a histogram, within its accuracy of the running times 100, 300 and 5000
+	if p50, err := strconv.ParseFloat(timings[0][1], 64); err != nil || math.Abs(p50-300) > 300*stats.HistogramAccuracy {
+		t.Errorf("expected a running p50 of about 300 but was %v", timings[0][1])
+	}
+}
+
+func TestPodRestarts(t *testing.T) {
+	section := analyze(t, &analyzers.PodRestarts{})
+	first := section.Tables[0].Rows[0]
+	expected := []string{"dremio-executor-0", "dremio-executor", "3", "OOMKilled", "137", "2024-01-01 10:00:00"}
+	if !reflect.DeepEqual(first, expected) {
+		t.Errorf("expected %v but was %v", expected, first)
+	}
+}
+
+func TestVersionsWarnsOnMixedVersions(t *testing.T) {
+	section := analyze(t, &analyzers.Versions{})
+	if len(section.Notes) != 1 {
+		t.Fatalf("expected a single warning about mixed versions but was %v", section.Notes)
+	}
+}
+
+func TestGCPausesPrefersCollectedSummary(t *testing.T) {
+	ddcDir := filepath.Join(t.TempDir(), "20240101-120000-DDC")
+	nodeDir := filepath.Join(ddcDir, "logs", "node1")
+	if err := os.MkdirAll(nodeDir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(gclog.Summary{Node: "node1", Pauses: 42, MaxPauseMillis: 99})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(nodeDir, gclog.SummaryFileName), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	b, err := bundle.Open(ddcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	section, err := (&analyzers.GCPauses{}).Analyze(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	row := section.Tables[0].Rows[0]
+	if row[1] != "42" || row[4] != "99.0" {
+		t.Errorf("expected the values from %v but was %v", gclog.SummaryFileName, row)
+	}
+}
@@ -0,0 +1,85 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+)
+
+// Collections shows what was enabled, disabled and what failed to transfer according to summary.json
+type Collections struct{}
+
+func (c *Collections) Name() string {
+	return "Collections"
+}
+
+func (c *Collections) Analyze(b *bundle.Bundle) (report.Section, error) {
+	section := report.Section{Title: c.Name()}
+	summary, err := b.Summary()
+	if err != nil {
+		return section, err
+	}
+	section.Notes = append(section.Notes,
+		fmt.Sprintf("collected by %v between %v and %v (%v seconds), %v bytes transferred",
+			summary.DDCVersion, summary.StartTimeUTC.Format("2006-01-02 15:04:05"), summary.EndTimeUTC.Format("2006-01-02 15:04:05"),
+			summary.TotalRuntimeSeconds, summary.TotalBytesCollected))
+	if summary.TLSMode != "" {
+		section.Notes = append(section.Notes, fmt.Sprintf("rest api tls mode: %v", summary.TLSMode))
+	}
+
+	enabled := append([]string{}, summary.CollectionsEnabled...)
+	disabled := append([]string{}, summary.CollectionsDisabled...)
+	sort.Strings(enabled)
+	sort.Strings(disabled)
+	table := report.Table{Title: "Enabled And Disabled", Headers: []string{"Collection", "State"}}
+	for _, e := range enabled {
+		table.Rows = append(table.Rows, []string{e, "enabled"})
+	}
+	for _, d := range disabled {
+		table.Rows = append(table.Rows, []string{d, "disabled"})
+	}
+	section.Tables = append(section.Tables, table)
+
+	if len(summary.CloudProjects) > 0 {
+		projects := report.Table{Title: "Dremio Cloud Projects", Headers: []string{"Project", "Name", "State", "Job Profiles", "Errors"}}
+		for _, p := range summary.CloudProjects {
+			state := "collected"
+			if !p.Success {
+				state = "failed"
+			}
+			projects.Rows = append(projects.Rows, []string{p.ID, p.Name, state, fmt.Sprint(p.JobProfilesCollected), strings.Join(p.Errors, "; ")})
+		}
+		section.Tables = append(section.Tables, projects)
+	}
+
+	failed := report.Table{Title: "Failed Transfers", Headers: []string{"File"}}
+	for _, f := range summary.FailedFiles {
+		failed.Rows = append(failed.Rows, []string{f})
+	}
+	section.Tables = append(section.Tables, failed)
+	if len(summary.SkippedFiles) > 0 {
+		skipped := report.Table{Title: "Skipped Files", Headers: []string{"File"}}
+		for _, f := range summary.SkippedFiles {
+			skipped.Rows = append(skipped.Rows, []string{f})
+		}
+		section.Tables = append(section.Tables, skipped)
+	}
+	return section, nil
+}
@@ -0,0 +1,100 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/logcollect"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/serverlog"
+)
+
+// TopErrors groups the ERROR and WARN events of every server.log by exception and stack,
+// local-collect writes server-log-errors.json for each node and older bundles are parsed here
+type TopErrors struct {
+	Limit int
+}
+
+func (t *TopErrors) Name() string {
+	return "Top Errors"
+}
+
+func formatSeen(fp serverlog.Fingerprint) (string, string) {
+	if fp.FirstSeen.IsZero() {
+		return "", ""
+	}
+	return fp.FirstSeen.UTC().Format("2006-01-02 15:04:05"), fp.LastSeen.UTC().Format("2006-01-02 15:04:05")
+}
+
+func (t *TopErrors) Analyze(b *bundle.Bundle) (report.Section, error) {
+	section := report.Section{Title: t.Name()}
+	nodes, err := b.Nodes("logs")
+	if err != nil {
+		return section, err
+	}
+	all := serverlog.NewAggregator(serverlog.MustDefaultPattern(), serverlog.DefaultFrames)
+	var linesRead int
+	for _, n := range nodes {
+		data, err := os.ReadFile(filepath.Clean(b.Path("logs", n, serverlog.SummaryFileName)))
+		if err == nil {
+			var summary serverlog.Summary
+			if err := json.Unmarshal(data, &summary); err != nil {
+				section.Notes = append(section.Notes, fmt.Sprintf("unable to read %v for node %v: %v", serverlog.SummaryFileName, n, err))
+				continue
+			}
+			linesRead += summary.LinesRead
+			all.Merge(summary.Fingerprints)
+			continue
+		}
+		files, err := b.Files("logs", n, "server*.log*")
+		if err != nil {
+			return section, err
+		}
+		nodeAggregator := serverlog.NewAggregator(logcollect.ServerLogPattern(b.Path("configuration", n, "logback.xml")), serverlog.DefaultFrames)
+		for _, f := range files {
+			read, err := nodeAggregator.AddFile(n, f)
+			linesRead += read
+			if err != nil {
+				section.Notes = append(section.Notes, fmt.Sprintf("unable to read %v: %v", f, err))
+			}
+		}
+		all.Merge(nodeAggregator.Results())
+	}
+	results := all.Results()
+	section.Notes = append(section.Notes, fmt.Sprintf("%v server.log lines read, %v distinct errors and warnings", linesRead, len(results)))
+	table := report.Table{Headers: []string{"Count", "Level", "Logger", "Exception", "Message", "Top Frames", "First Seen", "Last Seen", "Nodes"}}
+	for i, fp := range results {
+		if t.Limit > 0 && i >= t.Limit {
+			break
+		}
+		exception := fp.ExceptionClass
+		if fp.RootCause != "" {
+			exception = fmt.Sprintf("%v caused by %v", fp.ExceptionClass, fp.RootCause)
+		}
+		first, last := formatSeen(fp)
+		table.Rows = append(table.Rows, []string{
+			fmt.Sprintf("%v", fp.Count), fp.Level, fp.Logger, exception, fp.Message,
+			strings.Join(fp.Frames, "\n"), first, last, strings.Join(fp.Nodes, ", "),
+		})
+	}
+	section.Tables = append(section.Tables, table)
+	return section, nil
+}
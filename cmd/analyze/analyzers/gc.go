@@ -0,0 +1,123 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/gclog"
+)
+
+// GCPauses summarises the stop the world pauses of each node, local-collect writes a
+// gc-summary.json next to the gc logs and older bundles without one are parsed here
+type GCPauses struct {
+	LongestLimit int
+}
+
+func (g *GCPauses) Name() string {
+	return "GC Pauses"
+}
+
+func (g *GCPauses) summary(b *bundle.Bundle, node string) (gclog.Summary, bool, error) {
+	data, err := os.ReadFile(filepath.Clean(b.Path("logs", node, gclog.SummaryFileName)))
+	if err == nil {
+		var s gclog.Summary
+		if err := json.Unmarshal(data, &s); err != nil {
+			return s, false, fmt.Errorf("unable to read %v: %w", gclog.SummaryFileName, err)
+		}
+		return s, true, nil
+	}
+	if !os.IsNotExist(err) {
+		return gclog.Summary{}, false, err
+	}
+	files, err := b.Files("logs", node, "gc*.log*")
+	if err != nil {
+		return gclog.Summary{}, false, err
+	}
+	if len(files) == 0 {
+		return gclog.Summary{}, false, nil
+	}
+	events, err := gclog.ParseFiles(files)
+	s := gclog.Summarize(node, events, g.LongestLimit)
+	return s, true, err
+}
+
+func (g *GCPauses) Analyze(b *bundle.Bundle) (report.Section, error) {
+	section := report.Section{Title: g.Name()}
+	nodes, err := b.Nodes("logs")
+	if err != nil {
+		return section, err
+	}
+	table := report.Table{Headers: []string{"Node", "Pauses", "p50 ms", "p99 ms", "Max ms", "Total ms", "Full GCs", "To-space Exhausted", "Alloc MB/s", "Max Heap After GC MB", "Heap MB"}}
+	type nodePause struct {
+		node  string
+		event gclog.Event
+	}
+	var longest []nodePause
+	for _, n := range nodes {
+		s, found, err := g.summary(b, n)
+		if err != nil {
+			section.Notes = append(section.Notes, fmt.Sprintf("node %v: %v", n, err))
+		}
+		if !found {
+			continue
+		}
+		table.Rows = append(table.Rows, []string{
+			n,
+			fmt.Sprintf("%v", s.Pauses),
+			fmt.Sprintf("%.1f", s.P50PauseMillis),
+			fmt.Sprintf("%.1f", s.P99PauseMillis),
+			fmt.Sprintf("%.1f", s.MaxPauseMillis),
+			fmt.Sprintf("%.1f", s.TotalPauseMillis),
+			fmt.Sprintf("%v", s.FullGCs),
+			fmt.Sprintf("%v", s.ToSpaceExhausted),
+			fmt.Sprintf("%.1f", s.AllocationRateMBPerSec),
+			fmt.Sprintf("%.0f", s.MaxHeapAfterGCMB),
+			fmt.Sprintf("%.0f", s.MaxHeapTotalMB),
+		})
+		for _, e := range s.LongestPauses {
+			longest = append(longest, nodePause{node: n, event: e})
+		}
+	}
+	section.Tables = append(section.Tables, table)
+
+	sort.SliceStable(longest, func(i, j int) bool {
+		return longest[i].event.PauseMillis > longest[j].event.PauseMillis
+	})
+	if g.LongestLimit > 0 && len(longest) > g.LongestLimit {
+		longest = longest[:g.LongestLimit]
+	}
+	longestTable := report.Table{Title: "Longest Pauses", Headers: []string{"Node", "Time", "Type", "Cause", "Pause ms", "Heap Before MB", "Heap After MB"}}
+	for _, p := range longest {
+		ts := fmt.Sprintf("uptime %.3fs", p.event.UptimeSeconds)
+		if !p.event.Time.IsZero() {
+			ts = p.event.Time.UTC().Format("2006-01-02 15:04:05.000")
+		}
+		longestTable.Rows = append(longestTable.Rows, []string{
+			p.node, ts, p.event.Type, p.event.Cause,
+			fmt.Sprintf("%.1f", p.event.PauseMillis),
+			fmt.Sprintf("%.0f", p.event.HeapBeforeMB),
+			fmt.Sprintf("%.0f", p.event.HeapAfterMB),
+		})
+	}
+	section.Tables = append(section.Tables, longestTable)
+	return section, nil
+}
@@ -0,0 +1,85 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// PodRestarts lists the container restarts recorded in the collected kubernetes pods.json
+type PodRestarts struct{}
+
+func (p *PodRestarts) Name() string {
+	return "Kubernetes Pod Restarts"
+}
+
+func (p *PodRestarts) Analyze(b *bundle.Bundle) (report.Section, error) {
+	section := report.Section{Title: p.Name()}
+	data, err := os.ReadFile(filepath.Clean(b.Path("kubernetes", "pods.json")))
+	if err != nil {
+		if os.IsNotExist(err) {
+			section.Notes = append(section.Notes, "no kubernetes/pods.json in the bundle, this is not a kubernetes collection")
+			return section, nil
+		}
+		return section, err
+	}
+	var pods corev1.PodList
+	if err := json.Unmarshal(data, &pods); err != nil {
+		return section, fmt.Errorf("unable to read pods.json: %w", err)
+	}
+	type restart struct {
+		pod       string
+		container string
+		status    corev1.ContainerStatus
+	}
+	var restarts []restart
+	for _, pod := range pods.Items {
+		statuses := append(append([]corev1.ContainerStatus{}, pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, s := range statuses {
+			restarts = append(restarts, restart{pod: pod.Name, container: s.Name, status: s})
+		}
+	}
+	sort.SliceStable(restarts, func(i, j int) bool {
+		if restarts[i].status.RestartCount == restarts[j].status.RestartCount {
+			return restarts[i].pod < restarts[j].pod
+		}
+		return restarts[i].status.RestartCount > restarts[j].status.RestartCount
+	})
+	var total int32
+	table := report.Table{Headers: []string{"Pod", "Container", "Restarts", "Last Termination Reason", "Exit Code", "Finished"}}
+	for _, r := range restarts {
+		total += r.status.RestartCount
+		reason, exitCode, finished := "", "", ""
+		if t := r.status.LastTerminationState.Terminated; t != nil {
+			reason = t.Reason
+			exitCode = fmt.Sprintf("%v", t.ExitCode)
+			if !t.FinishedAt.IsZero() {
+				finished = t.FinishedAt.UTC().Format("2006-01-02 15:04:05")
+			}
+		}
+		table.Rows = append(table.Rows, []string{r.pod, r.container, fmt.Sprintf("%v", r.status.RestartCount), reason, exitCode, finished})
+	}
+	section.Notes = append(section.Notes, fmt.Sprintf("%v pods, %v container restarts in total", len(pods.Items), total))
+	section.Tables = append(section.Tables, table)
+	return section, nil
+}
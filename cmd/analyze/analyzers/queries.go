@@ -0,0 +1,130 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzers
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/queriesjson"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/stats"
+)
+
+// Queries summarises the queries.json files collected from the coordinators
+type Queries struct {
+	SlowestLimit int
+}
+
+func (q *Queries) Name() string {
+	return "Queries"
+}
+
+func countTable(title, header string, counts map[string]int) report.Table {
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] == counts[keys[j]] {
+			return keys[i] < keys[j]
+		}
+		return counts[keys[i]] > counts[keys[j]]
+	})
+	table := report.Table{Title: title, Headers: []string{header, "Queries"}}
+	for _, k := range keys {
+		table.Rows = append(table.Rows, []string{k, fmt.Sprintf("%v", counts[k])})
+	}
+	return table
+}
+
+func (q *Queries) Analyze(b *bundle.Bundle) (report.Section, error) {
+	section := report.Section{Title: q.Name()}
+	nodes, err := b.Nodes("queries")
+	if err != nil {
+		return section, err
+	}
+	outcomes := make(map[string]int)
+	queryTypes := make(map[string]int)
+	// the timings of every query of the bundle could be millions of values, histograms keep them in fixed memory
+	runningTimes := stats.NewHistogram()
+	planningTimes := stats.NewHistogram()
+	var first, last float64
+	queries := 0
+	slowest := queriesjson.NewTopK(q.SlowestLimit, queriesjson.ByRunningTime)
+	for _, n := range nodes {
+		files, err := b.Files("queries", n, "queries*.json*")
+		if err != nil {
+			return section, err
+		}
+		for _, f := range files {
+			_, err := queriesjson.StreamFile(f, func(r queriesjson.QueriesRow) {
+				if queries == 0 || r.Start < first {
+					first = r.Start
+				}
+				if queries == 0 || r.Start > last {
+					last = r.Start
+				}
+				queries++
+				outcomes[r.Outcome]++
+				queryTypes[r.QueryType]++
+				runningTimes.Add(r.RunningTime)
+				planningTimes.Add(r.PlanningTime)
+				slowest.Add(r)
+			})
+			if err != nil {
+				section.Notes = append(section.Notes, fmt.Sprintf("unable to read %v: %v", f, err))
+			}
+		}
+	}
+	if queries == 0 {
+		section.Notes = append(section.Notes, "no queries.json found in the bundle")
+		return section, nil
+	}
+	section.Notes = append(section.Notes, fmt.Sprintf("%v queries between %v and %v", queries,
+		time.UnixMilli(int64(first)).UTC().Format(time.RFC3339), time.UnixMilli(int64(last)).UTC().Format(time.RFC3339)))
+
+	section.Tables = append(section.Tables,
+		countTable("By Outcome", "Outcome", outcomes),
+		countTable("By Query Type", "Query Type", queryTypes),
+		report.Table{
+			Title:   "Timings",
+			Headers: []string{"Phase", "p50 ms", "p95 ms", "p99 ms", "Max ms"},
+			Rows: [][]string{
+				timingRow("running", runningTimes),
+				timingRow("planning", planningTimes),
+			},
+		},
+	)
+
+	slowTable := report.Table{Title: "Slowest Queries", Headers: []string{"Query ID", "Running ms", "Planning ms", "Query Type", "Outcome"}}
+	for _, r := range slowest.Rows() {
+		slowTable.Rows = append(slowTable.Rows, []string{r.QueryID, fmt.Sprintf("%.0f", r.RunningTime), fmt.Sprintf("%.0f", r.PlanningTime), r.QueryType, r.Outcome})
+	}
+	section.Tables = append(section.Tables, slowTable)
+	return section, nil
+}
+
+func timingRow(name string, times *stats.Histogram) []string {
+	return []string{
+		name,
+		fmt.Sprintf("%.0f", times.Percentile(50)),
+		fmt.Sprintf("%.0f", times.Percentile(95)),
+		fmt.Sprintf("%.0f", times.Percentile(99)),
+		fmt.Sprintf("%.0f", times.Max()),
+	}
+}
@@ -0,0 +1,79 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzers
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+)
+
+// nodeSections are the per node folders written by local-collect
+var nodeSections = []string{"configuration", "logs", "node-info", "queries", "cluster-stats", "job-profiles", "system-tables", "ttop", "wlm", "kvstore", "catalog"}
+
+// Topology lists the hosts ddc was asked to collect from and the nodes that made it into the bundle
+type Topology struct{}
+
+func (t *Topology) Name() string {
+	return "Cluster Topology"
+}
+
+func (t *Topology) Analyze(b *bundle.Bundle) (report.Section, error) {
+	section := report.Section{Title: t.Name()}
+	summary, err := b.Summary()
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return section, err
+		}
+		section.Notes = append(section.Notes, "no summary.json found, only the nodes present in the bundle are listed")
+	} else {
+		section.Notes = append(section.Notes, fmt.Sprintf("%v coordinator(s) and %v executor(s), %v of %v nodes were contacted",
+			len(summary.Coordinators), len(summary.Executors), summary.ClusterInfo.NumberNodesContacted, summary.ClusterInfo.TotalNodesAttempted))
+		hosts := report.Table{Title: "Requested Hosts", Headers: []string{"Host", "Role"}}
+		for _, c := range summary.Coordinators {
+			hosts.Rows = append(hosts.Rows, []string{c, "coordinator"})
+		}
+		for _, e := range summary.Executors {
+			hosts.Rows = append(hosts.Rows, []string{e, "executor"})
+		}
+		section.Tables = append(section.Tables, hosts)
+	}
+
+	found := make(map[string][]string)
+	for _, s := range nodeSections {
+		nodes, err := b.Nodes(s)
+		if err != nil {
+			return section, err
+		}
+		for _, n := range nodes {
+			found[n] = append(found[n], s)
+		}
+	}
+	var names []string
+	for n := range found {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	collected := report.Table{Title: "Nodes In Bundle", Headers: []string{"Node", "Sections"}}
+	for _, n := range names {
+		collected.Rows = append(collected.Rows, []string{n, strings.Join(found[n], ", ")})
+	}
+	section.Tables = append(section.Tables, collected)
+	return section, nil
+}
@@ -0,0 +1,82 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package analyzers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
+)
+
+// Versions reports the Dremio version and cluster id each node wrote to cluster-stats.json
+type Versions struct{}
+
+func (v *Versions) Name() string {
+	return "Dremio Versions"
+}
+
+func (v *Versions) Analyze(b *bundle.Bundle) (report.Section, error) {
+	section := report.Section{Title: v.Name()}
+	nodes, err := b.Nodes("cluster-stats")
+	if err != nil {
+		return section, err
+	}
+	var stats []clusterstats.ClusterStats
+	for _, n := range nodes {
+		data, err := os.ReadFile(filepath.Clean(b.Path("cluster-stats", n, "cluster-stats.json")))
+		if err != nil {
+			section.Notes = append(section.Notes, fmt.Sprintf("node %v has no cluster-stats.json: %v", n, err))
+			continue
+		}
+		var s clusterstats.ClusterStats
+		if err := json.Unmarshal(data, &s); err != nil {
+			section.Notes = append(section.Notes, fmt.Sprintf("node %v has an unreadable cluster-stats.json: %v", n, err))
+			continue
+		}
+		if s.NodeName == "" {
+			s.NodeName = n
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].NodeName < stats[j].NodeName
+	})
+	table := report.Table{Headers: []string{"Node", "Dremio Version", "Cluster ID"}}
+	versions := make(map[string]bool)
+	clusterIDs := make(map[string]bool)
+	for _, s := range stats {
+		table.Rows = append(table.Rows, []string{s.NodeName, s.DremioVersion, s.ClusterID})
+		if s.DremioVersion != "" {
+			versions[s.DremioVersion] = true
+		}
+		if s.ClusterID != "" {
+			clusterIDs[s.ClusterID] = true
+		}
+	}
+	if len(versions) > 1 {
+		section.Notes = append(section.Notes, fmt.Sprintf("WARNING: %v different Dremio versions are running in this cluster", len(versions)))
+	}
+	if len(clusterIDs) > 1 {
+		section.Notes = append(section.Notes, fmt.Sprintf("WARNING: %v different cluster ids found, the bundle may contain nodes from more than one cluster", len(clusterIDs)))
+	}
+	section.Tables = append(section.Tables, table)
+	return section, nil
+}
@@ -0,0 +1,179 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package bundle opens a diagnostic bundle written in the healthcheck layout, either the
+// diag.tgz itself or a directory it has already been extracted to
+package bundle
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/collection"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+type Bundle struct {
+	Source string // what the user passed in
+	Root   string // directory holding summary.json
+	DDCDir string // the <timestamp>-DDC directory with the collected files
+	tmpDir string // set when we had to extract a tarball
+}
+
+// Open reads a diag.tgz (by extracting it to a temp directory) or an extracted directory
+func Open(source string) (*Bundle, error) {
+	fi, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{Source: source}
+	dir := source
+	if !fi.IsDir() {
+		tmpDir, err := os.MkdirTemp("", "ddc-analyze-*")
+		if err != nil {
+			return nil, fmt.Errorf("unable to make temp dir to extract %v: %w", source, err)
+		}
+		b.tmpDir = tmpDir
+		if err := archive.ExtractTarGz(source, tmpDir); err != nil {
+			b.Close()
+			return nil, fmt.Errorf("unable to extract %v: %w", source, err)
+		}
+		dir = tmpDir
+	}
+	if err := b.locate(dir); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// locate finds the summary.json and the -DDC directory, the directory passed in can be
+// either the top of the bundle or the -DDC directory itself
+func (b *Bundle) locate(dir string) error {
+	dir = filepath.Clean(dir)
+	if strings.HasSuffix(dir, "-DDC") {
+		b.DDCDir = dir
+		b.Root = filepath.Dir(dir)
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	b.Root = dir
+	for _, e := range entries {
+		if e.IsDir() && strings.HasSuffix(e.Name(), "-DDC") {
+			b.DDCDir = filepath.Join(dir, e.Name())
+			return nil
+		}
+	}
+	// no healthcheck directory so this may be a single local-collect tarball
+	b.DDCDir = dir
+	return nil
+}
+
+// Close removes anything we extracted
+func (b *Bundle) Close() {
+	if b.tmpDir == "" {
+		return
+	}
+	if err := os.RemoveAll(b.tmpDir); err != nil {
+		simplelog.Warningf("unable to remove %v: %v", b.tmpDir, err)
+	}
+}
+
+// Path joins elem onto the -DDC directory
+func (b *Bundle) Path(elem ...string) string {
+	return filepath.Join(append([]string{b.DDCDir}, elem...)...)
+}
+
+// Summary reads the summary.json written by ddc at the end of the collection
+func (b *Bundle) Summary() (collection.SummaryInfo, error) {
+	var summary collection.SummaryInfo
+	data, err := os.ReadFile(filepath.Join(b.Root, "summary.json"))
+	if err != nil {
+		return summary, err
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return summary, fmt.Errorf("unable to read summary.json: %w", err)
+	}
+	return summary, nil
+}
+
+// Nodes lists the per node directories for a section such as logs or queries, sorted by name
+func (b *Bundle) Nodes(section string) ([]string, error) {
+	entries, err := os.ReadDir(b.Path(section))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+	var nodes []string
+	for _, e := range entries {
+		if e.IsDir() {
+			nodes = append(nodes, e.Name())
+		}
+	}
+	sort.Strings(nodes)
+	return nodes, nil
+}
+
+// Files returns the files in section/node matching the glob pattern, sorted by name
+func (b *Bundle) Files(section, node, pattern string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(b.Path(section, node), pattern))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g gzipFile) Close() error {
+	if err := g.Reader.Close(); err != nil {
+		simplelog.Debugf("optional close of gzip reader for %v failed %v", g.f.Name(), err)
+	}
+	return g.f.Close()
+}
+
+// OpenFile opens a file from the bundle decompressing it when it ends with .gz
+func OpenFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Clean(name))
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		if closeErr := f.Close(); closeErr != nil {
+			simplelog.Debugf("optional close of %v failed %v", name, closeErr)
+		}
+		return nil, fmt.Errorf("unable to read gzip file %v: %w", name, err)
+	}
+	return gzipFile{Reader: gz, f: f}, nil
+}
@@ -0,0 +1,51 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bundle_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+)
+
+func TestOpenDDCDirectory(t *testing.T) {
+	b, err := bundle.Open(filepath.Join("..", "testdata", "bundle", "20240101-120000-DDC"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	summary, err := b.Summary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.DDCVersion != "dev" {
+		t.Errorf("expected summary.json to be found above the -DDC dir but read %#v", summary)
+	}
+	nodes, err := b.Nodes("logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nodes) != 2 || nodes[0] != "coord1" || nodes[1] != "exec1" {
+		t.Errorf("unexpected nodes %v", nodes)
+	}
+	missing, err := b.Nodes("heap-dumps")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("expected no nodes for a missing section but was %v", missing)
+	}
+}
@@ -0,0 +1,112 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+	"time"
+)
+
+func escapeMarkdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// Markdown renders the report using github flavoured markdown tables
+func (r Report) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# DDC Analysis Report\n\n")
+	fmt.Fprintf(&b, "* source: `%v`\n* generated: %v\n\n", r.Source, r.Generated.Format(time.RFC3339))
+	for _, s := range r.Sections {
+		fmt.Fprintf(&b, "## %v\n\n", s.Title)
+		for _, n := range s.Notes {
+			fmt.Fprintf(&b, "%v\n\n", n)
+		}
+		for _, t := range s.Tables {
+			if t.Title != "" {
+				fmt.Fprintf(&b, "### %v\n\n", t.Title)
+			}
+			if len(t.Rows) == 0 {
+				fmt.Fprintf(&b, "_none found_\n\n")
+				continue
+			}
+			var headers []string
+			var divider []string
+			for _, h := range t.Headers {
+				headers = append(headers, escapeMarkdownCell(h))
+				divider = append(divider, "---")
+			}
+			fmt.Fprintf(&b, "| %v |\n", strings.Join(headers, " | "))
+			fmt.Fprintf(&b, "| %v |\n", strings.Join(divider, " | "))
+			for _, row := range t.Rows {
+				var cells []string
+				for _, c := range row {
+					cells = append(cells, escapeMarkdownCell(c))
+				}
+				fmt.Fprintf(&b, "| %v |\n", strings.Join(cells, " | "))
+			}
+			fmt.Fprintln(&b)
+		}
+	}
+	return b.String()
+}
+
+// everything is inlined so the html file can be attached to a ticket and opened anywhere
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>DDC Analysis Report</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { border-bottom: 2px solid #31a6c7; padding-bottom: .3em; }
+h2 { margin-top: 2em; border-bottom: 1px solid #ddd; }
+nav li { display: inline; margin-right: 1em; }
+table { border-collapse: collapse; margin: 1em 0; font-size: 0.9em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f6f8; }
+tr:nth-child(even) td { background: #fafafa; }
+td { max-width: 60em; overflow-wrap: anywhere; }
+.meta { color: #666; }
+</style>
+</head>
+<body>
+<h1>DDC Analysis Report</h1>
+<p class="meta">source: <code>{{.Source}}</code><br>generated: {{.Generated.Format "2006-01-02T15:04:05Z07:00"}}</p>
+<nav><ul>{{range $i, $s := .Sections}}<li><a href="#section-{{$i}}">{{$s.Title}}</a></li>{{end}}</ul></nav>
+{{range $i, $s := .Sections}}
+<h2 id="section-{{$i}}">{{$s.Title}}</h2>
+{{range $s.Notes}}<p>{{.}}</p>
+{{end}}{{range $s.Tables}}{{if .Title}}<h3>{{.Title}}</h3>{{end}}
+{{if .Rows}}<table>
+<tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>{{else}}<p><em>none found</em></p>{{end}}
+{{end}}{{end}}
+</body>
+</html>
+`))
+
+// HTML renders the report as a single self-contained html page
+func (r Report) HTML() (string, error) {
+	var b bytes.Buffer
+	if err := htmlTemplate.Execute(&b, r); err != nil {
+		return "", fmt.Errorf("unable to render html report: %w", err)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,74 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package report runs the analyzers over a bundle and renders the results as markdown and html
+package report
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// Analyzer produces one section of the report, add a new implementation to
+// analyzers.Default to have it show up in ddc analyze
+type Analyzer interface {
+	Name() string
+	Analyze(b *bundle.Bundle) (Section, error)
+}
+
+type Table struct {
+	Title   string
+	Headers []string
+	Rows    [][]string
+}
+
+type Section struct {
+	Title  string
+	Notes  []string
+	Tables []Table
+}
+
+type Report struct {
+	Source    string
+	Generated time.Time
+	Sections  []Section
+}
+
+// Run executes each analyzer in order, an analyzer that fails still gets a section
+// explaining why so the rest of the report is usable
+func Run(b *bundle.Bundle, analyzers []Analyzer) Report {
+	r := Report{
+		Source:    b.Source,
+		Generated: time.Now().UTC(),
+	}
+	for _, a := range analyzers {
+		simplelog.Debugf("running analyzer %v", a.Name())
+		section, err := a.Analyze(b)
+		if err != nil {
+			simplelog.Errorf("analyzer %v failed: %v", a.Name(), err)
+			section = Section{
+				Title: a.Name(),
+				Notes: []string{fmt.Sprintf("unable to analyze: %v", err)},
+			}
+		}
+		if section.Title == "" {
+			section.Title = a.Name()
+		}
+		r.Sections = append(r.Sections, section)
+	}
+	return r
+}
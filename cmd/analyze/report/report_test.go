@@ -0,0 +1,70 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package report_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/bundle"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze/report"
+)
+
+type fakeAnalyzer struct {
+	section report.Section
+	err     error
+}
+
+func (f fakeAnalyzer) Name() string {
+	return "fake"
+}
+
+func (f fakeAnalyzer) Analyze(_ *bundle.Bundle) (report.Section, error) {
+	return f.section, f.err
+}
+
+func TestRunKeepsFailedAnalyzers(t *testing.T) {
+	r := report.Run(&bundle.Bundle{Source: "diag.tgz"}, []report.Analyzer{
+		fakeAnalyzer{err: errors.New("boom")},
+		fakeAnalyzer{section: report.Section{Notes: []string{"ok"}}},
+	})
+	if len(r.Sections) != 2 {
+		t.Fatalf("expected 2 sections but was %v", len(r.Sections))
+	}
+	if r.Sections[0].Notes[0] != "unable to analyze: boom" {
+		t.Errorf("unexpected note %v", r.Sections[0].Notes[0])
+	}
+	if r.Sections[1].Title != "fake" {
+		t.Errorf("expected the analyzer name as the default title but was %v", r.Sections[1].Title)
+	}
+}
+
+func TestRenderEscapes(t *testing.T) {
+	r := report.Report{Sections: []report.Section{{
+		Title:  "Errors",
+		Tables: []report.Table{{Headers: []string{"Message"}, Rows: [][]string{{"a | b <script>"}}}},
+	}}}
+	if md := r.Markdown(); !strings.Contains(md, `| a \| b <script> |`) {
+		t.Errorf("expected the pipe to be escaped in\n%v", md)
+	}
+	html, err := r.HTML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(html, "<script>") {
+		t.Errorf("expected the cell to be html escaped in\n%v", html)
+	}
+}
@@ -0,0 +1,160 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// apicollect provides all the methods that collect via the API, this is a substantial part of the activities of DDC so it gets it's own package
+package apicollect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// the files of the catalog inventory
+const (
+	SourcesFile        = "sources.json"
+	CatalogSummaryFile = "catalog-summary.json"
+)
+
+// CatalogSummary counts what the top level of the catalog holds
+type CatalogSummary struct {
+	Sources       int            `json:"sources"`
+	SourcesByType map[string]int `json:"sourcesByType"`
+	// FailedSources could not be read, they are missing from sources.json
+	FailedSources   []string           `json:"failedSources,omitempty"`
+	Spaces          []CatalogContainer `json:"spaces"`
+	HomeFolders     int                `json:"homeFolders"`
+	HomeFolderItems int                `json:"homeFolderItems"`
+	// MaskedValues is how many credentials were masked in sources.json
+	MaskedValues int `json:"maskedValues"`
+}
+
+// CatalogContainer is a space and the number of entries at its top level
+type CatalogContainer struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Children int    `json:"children"`
+	Error    string `json:"error,omitempty"`
+}
+
+// noAdminRights is true when the api refused the PAT, reading the config of every source needs an admin
+func noAdminRights(err error) bool {
+	var httpErr *restclient.HTTPError
+	return errors.As(err, &httpErr) && (httpErr.StatusCode == http.StatusUnauthorized || httpErr.StatusCode == http.StatusForbidden)
+}
+
+// RunCollectCatalog walks the top level of the catalog and writes every source with its type, config and
+// metadata refresh policies to sources.json with the credentials masked, and the number of sources, spaces
+// and home folders to catalog-summary.json. Nothing is written when the PAT has no admin rights
+func RunCollectCatalog(c *conf.CollectConf) error {
+	client := c.DremioClient()
+	entries, err := client.Catalog()
+	if err != nil {
+		if noAdminRights(err) {
+			return fmt.Errorf("the catalog inventory needs a PAT with admin rights: %w", err)
+		}
+		return fmt.Errorf("unable to list the catalog due to error %w", err)
+	}
+	summary := CatalogSummary{SourcesByType: map[string]int{}, Spaces: []CatalogContainer{}}
+	sources := []map[string]interface{}{}
+	for _, entry := range entries {
+		name := strings.Join(entry.Path, ".")
+		switch entry.ContainerType {
+		case "SOURCE":
+			source, err := catalogEntity(client, entry.ID)
+			if err != nil {
+				if noAdminRights(err) {
+					return fmt.Errorf("the catalog inventory needs a PAT with admin rights: %w", err)
+				}
+				simplelog.Errorf("unable to read source %v due to error %v", name, err)
+				summary.FailedSources = append(summary.FailedSources, name)
+				continue
+			}
+			// the children are the datasets and folders of the source, the inventory is about its settings
+			delete(source, "children")
+			summary.MaskedValues += masking.MaskCatalogEntity(source)
+			sourceType, _ := source["type"].(string)
+			summary.SourcesByType[sourceType]++
+			summary.Sources++
+			sources = append(sources, source)
+		case "SPACE":
+			space := CatalogContainer{ID: entry.ID, Name: name}
+			children, err := catalogChildren(client, entry.ID)
+			if err != nil {
+				simplelog.Warningf("unable to read space %v due to error %v", name, err)
+				space.Error = err.Error()
+			}
+			space.Children = children
+			summary.Spaces = append(summary.Spaces, space)
+		case "HOME":
+			summary.HomeFolders++
+			children, err := catalogChildren(client, entry.ID)
+			if err != nil {
+				simplelog.Warningf("unable to read home folder %v due to error %v", name, err)
+			}
+			summary.HomeFolderItems += children
+		}
+	}
+	if err := writeCatalogJSON(filepath.Join(c.CatalogOutDir(), SourcesFile), sources); err != nil {
+		return err
+	}
+	simplelog.Infof("inventoried %v sources, %v spaces and %v home folders, %v credentials were masked", summary.Sources, len(summary.Spaces), summary.HomeFolders, summary.MaskedValues)
+	return writeCatalogJSON(filepath.Join(c.CatalogOutDir(), CatalogSummaryFile), summary)
+}
+
+// catalogEntity decodes a catalog entity keeping numbers such as the refresh periods as they were returned
+func catalogEntity(client restclient.Client, id string) (map[string]interface{}, error) {
+	item, err := client.CatalogItem(id)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(item))
+	decoder.UseNumber()
+	var entity map[string]interface{}
+	if err := decoder.Decode(&entity); err != nil {
+		return nil, fmt.Errorf("unable to decode catalog entity %v due to error %v", id, err)
+	}
+	return entity, nil
+}
+
+// catalogChildren is the number of entries at the top level of a space or home folder
+func catalogChildren(client restclient.Client, id string) (int, error) {
+	entity, err := catalogEntity(client, id)
+	if err != nil {
+		return 0, err
+	}
+	children, _ := entity["children"].([]interface{})
+	return len(children), nil
+}
+
+func writeCatalogJSON(file string, v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode %v due to error %v", filepath.Base(file), err)
+	}
+	if err := os.WriteFile(filepath.Clean(file), b, 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", file, err)
+	}
+	return nil
+}
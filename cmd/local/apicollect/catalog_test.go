@@ -0,0 +1,143 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apicollect_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/apicollect"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+)
+
+// catalogClient is a catalog with an S3 and a postgres source, a space and two home folders
+type catalogClient struct {
+	restclient.Client
+	forbidden bool
+}
+
+func (f catalogClient) Catalog() ([]restclient.CatalogEntry, error) {
+	return []restclient.CatalogEntry{
+		{ID: "s3", Path: []string{"lake"}, Type: "CONTAINER", ContainerType: "SOURCE"},
+		{ID: "pg", Path: []string{"crm"}, Type: "CONTAINER", ContainerType: "SOURCE"},
+		{ID: "space", Path: []string{"marketing"}, Type: "CONTAINER", ContainerType: "SPACE"},
+		{ID: "home1", Path: []string{"@dremio"}, Type: "CONTAINER", ContainerType: "HOME"},
+		{ID: "home2", Path: []string{"@analyst"}, Type: "CONTAINER", ContainerType: "HOME"},
+	}, nil
+}
+
+func (f catalogClient) CatalogItem(id string) (json.RawMessage, error) {
+	if f.forbidden {
+		return nil, &restclient.HTTPError{Method: "GET", URL: "/api/v3/catalog/" + id, StatusCode: http.StatusForbidden, Status: "403 Forbidden"}
+	}
+	switch id {
+	case "s3":
+		return json.RawMessage(`{"entityType": "source", "id": "s3", "name": "lake", "type": "S3",
+"config": {"accessKey": "AKIAEXAMPLE", "accessSecret": "s3cr3t", "secure": true,
+  "propertyList": [{"name": "fs.s3a.endpoint", "value": "minio:9000"}, {"name": "fs.s3a.secret.key", "value": "other-secret"}]},
+"metadataPolicy": {"namesRefreshMs": 3600000, "datasetRefreshAfterMs": 3600000, "authTTLMs": 86400000},
+"children": [{"id": "c1"}, {"id": "c2"}]}`), nil
+	case "pg":
+		return json.RawMessage(`{"entityType": "source", "id": "pg", "name": "crm", "type": "POSTGRES",
+"config": {"hostname": "db", "username": "dremio", "password": "hunter2", "authenticationType": "MASTER"},
+"metadataPolicy": {"namesRefreshMs": 3600000}}`), nil
+	case "space":
+		return json.RawMessage(`{"entityType": "space", "id": "space", "name": "marketing", "children": [{"id": "v1"}, {"id": "v2"}, {"id": "v3"}]}`), nil
+	case "home1":
+		return json.RawMessage(`{"entityType": "home", "id": "home1", "children": [{"id": "f1"}]}`), nil
+	default:
+		return json.RawMessage(`{"entityType": "home", "id": "home2"}`), nil
+	}
+}
+
+func TestRunCollectCatalog(t *testing.T) {
+	c := kvConf(t)
+	c.SetDremioClient(catalogClient{})
+	if err := os.MkdirAll(c.CatalogOutDir(), 0700); err != nil {
+		t.Fatalf("unable to create catalog dir due to error %v", err)
+	}
+	if err := apicollect.RunCollectCatalog(c); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	b, err := os.ReadFile(filepath.Join(c.CatalogOutDir(), apicollect.SourcesFile))
+	if err != nil {
+		t.Fatalf("missing sources %v", err)
+	}
+	for _, secret := range []string{"AKIAEXAMPLE", "s3cr3t", "other-secret", "hunter2"} {
+		if strings.Contains(string(b), secret) {
+			t.Errorf("expected %v to be masked in %s", secret, b)
+		}
+	}
+	for _, kept := range []string{"minio:9000", "fs.s3a.secret.key", `"authenticationType": "MASTER"`, `"namesRefreshMs": 3600000`} {
+		if !strings.Contains(string(b), kept) {
+			t.Errorf("expected %v to be kept in %s", kept, b)
+		}
+	}
+	var sources []map[string]interface{}
+	if err := json.Unmarshal(b, &sources); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(sources) != 2 {
+		t.Fatalf("expected 2 sources but was %v", len(sources))
+	}
+	if _, ok := sources[0]["children"]; ok {
+		t.Error("expected the children of the source to be left out")
+	}
+
+	b, err = os.ReadFile(filepath.Join(c.CatalogOutDir(), apicollect.CatalogSummaryFile))
+	if err != nil {
+		t.Fatalf("missing summary %v", err)
+	}
+	var summary apicollect.CatalogSummary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if summary.Sources != 2 || summary.SourcesByType["S3"] != 1 || summary.SourcesByType["POSTGRES"] != 1 {
+		t.Errorf("unexpected sources %+v", summary)
+	}
+	if len(summary.Spaces) != 1 || summary.Spaces[0].Name != "marketing" || summary.Spaces[0].Children != 3 {
+		t.Errorf("unexpected spaces %+v", summary.Spaces)
+	}
+	if summary.HomeFolders != 2 || summary.HomeFolderItems != 1 {
+		t.Errorf("unexpected home folders %+v", summary)
+	}
+	if summary.MaskedValues != 4 {
+		t.Errorf("expected 4 masked values but was %v", summary.MaskedValues)
+	}
+}
+
+func TestRunCollectCatalogWithoutAdminRights(t *testing.T) {
+	c := kvConf(t)
+	c.SetDremioClient(catalogClient{forbidden: true})
+	if err := os.MkdirAll(c.CatalogOutDir(), 0700); err != nil {
+		t.Fatalf("unable to create catalog dir due to error %v", err)
+	}
+	err := apicollect.RunCollectCatalog(c)
+	if err == nil || !strings.Contains(err.Error(), "admin rights") {
+		t.Fatalf("expected an admin rights error but was %v", err)
+	}
+	entries, err := os.ReadDir(c.CatalogOutDir())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected nothing to be written but was %v", entries)
+	}
+}
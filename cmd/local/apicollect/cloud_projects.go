@@ -0,0 +1,144 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// apicollect provides all the methods that collect via the API, this is a substantial part of the activities of DDC so it gets it's own package
+package apicollect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// OrganizationDir names the folders of the organization tables, they are the same from every project so
+// they are exported once
+const OrganizationDir = "organization"
+
+// RunCollectCloudProjects collects the engines, rules, system tables and job profiles of each project of
+// dremio-cloud-project-ids into folders named after the project id, exports the organization tables once
+// and records how each project went in cloud-projects.json
+func RunCollectCloudProjects(c *conf.CollectConf) error {
+	projects, err := cloudProjects(c)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
+		return errors.New("the PAT cannot see any Dremio Cloud project")
+	}
+	var orgExports, projectExports []conf.SQLExport
+	for _, e := range c.SQLExports() {
+		if strings.HasPrefix(strings.ToLower(e.Name), "sys.organization.") {
+			orgExports = append(orgExports, e)
+		} else {
+			projectExports = append(projectExports, e)
+		}
+	}
+	if c.CollectSystemTablesExport() && len(orgExports) > 0 {
+		// the organization tables are queried through the first project
+		org := c.ForCloudProject(projects[0].ID, OrganizationDir, orgExports)
+		if err := os.MkdirAll(org.SystemTablesOutDir(), 0750); err != nil {
+			return fmt.Errorf("unable to create the organization system-tables directory due to error %v", err)
+		}
+		if err := RunCollectDremioSystemTables(org); err != nil {
+			simplelog.Errorf("unable to export the organization tables: %v", err)
+		}
+	}
+	results := make([]clusterstats.CloudProject, 0, len(projects))
+	for _, p := range projects {
+		result := collectCloudProject(c, p, projectExports)
+		if result.Success {
+			simplelog.Infof("collected Dremio Cloud project %v (%v)", p.ID, p.Name)
+		} else {
+			simplelog.Errorf("collection of Dremio Cloud project %v (%v) failed: %v", p.ID, p.Name, strings.Join(result.Errors, "; "))
+		}
+		results = append(results, result)
+	}
+	b, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("unable to encode %v due to error %v", clusterstats.CloudProjectsFile, err)
+	}
+	return os.WriteFile(filepath.Join(c.OutputDir(), clusterstats.CloudProjectsFile), b, 0600)
+}
+
+// cloudProjects resolves dremio-cloud-project-ids against the project listing, the listing only adds
+// the names of configured projects so they are still collected when it fails
+func cloudProjects(c *conf.CollectConf) ([]restclient.Project, error) {
+	ids := c.DremioCloudProjectIDs()
+	listed, err := c.DremioClient().Projects()
+	if len(ids) == 1 && ids[0] == conf.AllCloudProjects {
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the Dremio Cloud projects due to error %v", err)
+		}
+		return listed, nil
+	}
+	if err != nil {
+		simplelog.Warningf("unable to list the Dremio Cloud projects, the project names will be missing: %v", err)
+	}
+	names := make(map[string]string, len(listed))
+	for _, p := range listed {
+		names[p.ID] = p.Name
+	}
+	projects := make([]restclient.Project, 0, len(ids))
+	for _, id := range ids {
+		projects = append(projects, restclient.Project{ID: id, Name: names[id]})
+	}
+	return projects, nil
+}
+
+// collectCloudProject runs the rest api collections of one project, a failed collection does not stop the others
+func collectCloudProject(c *conf.CollectConf, project restclient.Project, exports []conf.SQLExport) clusterstats.CloudProject {
+	result := clusterstats.CloudProject{ID: project.ID, Name: project.Name}
+	p := c.ForCloudProject(project.ID, project.ID, exports)
+	for _, dir := range []string{p.WLMOutDir(), p.SystemTablesOutDir(), p.JobProfilesOutDir(), p.CatalogOutDir()} {
+		if err := os.MkdirAll(dir, 0750); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("unable to create directory %v due to error %v", dir, err))
+			return result
+		}
+	}
+	if c.CollectWLM() {
+		if err := RunCollectWLM(p); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("wlm: %v", err))
+		}
+	}
+	if c.CollectSystemTablesExport() && len(exports) > 0 {
+		if err := RunCollectDremioSystemTables(p); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("system tables: %v", err))
+		}
+	}
+	if c.CollectCatalog() {
+		if err := RunCollectCatalog(p); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("catalog: %v", err))
+		}
+	}
+	// job profiles are picked from the project.history.jobs export of the project
+	if c.CollectJobProfiles() {
+		tried, collected, err := GetNumberOfJobProfilesCollected(p)
+		result.JobProfilesCollected = collected
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("job profiles: %v", err))
+		} else if collected < tried {
+			result.Errors = append(result.Errors, fmt.Sprintf("job profiles: %v of %v failed to download", tried-collected, tried))
+		}
+	}
+	result.Success = len(result.Errors) == 0
+	return result
+}
@@ -0,0 +1,207 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apicollect
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collects"
+)
+
+// cloudAPI is an organization with the projects p1 and p2, the engines of p2 cannot be read
+type cloudAPI struct {
+	mu        sync.Mutex
+	sqlByJob  map[string]string
+	queries   []string
+	downloads []string
+}
+
+// cloudProjectClient is the client of one project of the cloudAPI
+type cloudProjectClient struct {
+	restclient.Client
+	api     *cloudAPI
+	project string
+}
+
+func (f cloudProjectClient) Projects() ([]restclient.Project, error) {
+	return []restclient.Project{{ID: "p1", Name: "sales"}, {ID: "p2", Name: "finance"}}, nil
+}
+
+func (f cloudProjectClient) ForProject(projectID string) restclient.Client {
+	return cloudProjectClient{api: f.api, project: projectID}
+}
+
+func (f cloudProjectClient) SubmitSQL(sql string) (string, error) {
+	f.api.mu.Lock()
+	defer f.api.mu.Unlock()
+	id := fmt.Sprintf("%v-job%v", f.project, len(f.api.sqlByJob))
+	f.api.sqlByJob[id] = sql
+	f.api.queries = append(f.api.queries, f.project+": "+sql)
+	return id, nil
+}
+
+func (f cloudProjectClient) JobStatus(string) (restclient.JobStatus, error) {
+	return restclient.JobStatus{JobState: "COMPLETED"}, nil
+}
+
+func (f cloudProjectClient) JobResults(jobID string, offset, _ int) (restclient.JobResults, error) {
+	f.api.mu.Lock()
+	sql := f.api.sqlByJob[jobID]
+	f.api.mu.Unlock()
+	results := restclient.JobResults{Schema: json.RawMessage(`[{"name":"job_id","type":{"name":"VARCHAR"}}]`)}
+	if offset == 0 && strings.Contains(sql, "project.history.jobs") {
+		row := fmt.Sprintf(`{"job_id":"%v-failed","status":"FAILED","query_type":"UI_RUN","submitted_epoch":1700000000000,"final_state_epoch":1700000005000}`, f.project)
+		results.RowCount = 1
+		results.Rows = []json.RawMessage{json.RawMessage(row)}
+	}
+	return results, nil
+}
+
+func (f cloudProjectClient) WLM() ([]restclient.WLMObject, error) {
+	if f.project == "p2" {
+		return nil, errors.New("403 Forbidden")
+	}
+	return []restclient.WLMObject{{Name: "engines", Body: json.RawMessage(`[]`)}, {Name: "rules", Body: json.RawMessage(`[]`)}}, nil
+}
+
+func (f cloudProjectClient) Catalog() ([]restclient.CatalogEntry, error) {
+	return []restclient.CatalogEntry{}, nil
+}
+
+func (f cloudProjectClient) DownloadJobProfile(jobID string, w io.Writer) error {
+	f.api.mu.Lock()
+	f.api.downloads = append(f.api.downloads, f.project+": "+jobID)
+	f.api.mu.Unlock()
+	_, err := io.WriteString(w, "PK")
+	return err
+}
+
+func cloudConf(t *testing.T, projectIDs string) *conf.CollectConf {
+	// the token is checked against the project listing when the configuration is read
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(server.Close)
+	ddcYaml := filepath.Join(t.TempDir(), "ddc.yaml")
+	if err := os.WriteFile(ddcYaml, []byte(fmt.Sprintf(`
+is-dremio-cloud: true
+dremio-endpoint: %v
+dremio-pat-token: my-pat-token
+dremio-cloud-project-ids: %v
+node-name: node1
+tmp-output-dir: %v
+`, server.URL, projectIDs, strings.ReplaceAll(t.TempDir(), "\\", "\\\\"))), 0600); err != nil {
+		t.Fatalf("missing conf file %v", err)
+	}
+	c, err := conf.ReadConf(make(map[string]string), ddcYaml, collects.StandardCollection)
+	if err != nil {
+		t.Fatalf("unable to read conf %v", err)
+	}
+	return c
+}
+
+func TestRunCollectCloudProjectsCollectsEachProject(t *testing.T) {
+	c := cloudConf(t, "[all]")
+	api := &cloudAPI{sqlByJob: map[string]string{}}
+	c.SetDremioClient(cloudProjectClient{api: api})
+	if err := RunCollectCloudProjects(c); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for _, expected := range []string{
+		filepath.Join("system-tables", OrganizationDir, "sys.organization.usage.ndjson"),
+		filepath.Join("system-tables", "p1", "sys.project.history.jobs.ndjson"),
+		filepath.Join("system-tables", "p2", "sys.project.history.jobs.ndjson"),
+		filepath.Join("system-tables", "p2", "sys.project.history.events.ndjson"),
+		filepath.Join("wlm", "p1", "engines.json"),
+		filepath.Join("job-profiles", "p1", "p1-failed.zip"),
+		filepath.Join("job-profiles", "p2", "p2-failed.zip"),
+	} {
+		if _, err := os.Stat(filepath.Join(c.OutputDir(), expected)); err != nil {
+			t.Errorf("expected %v: %v", expected, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(c.OutputDir(), "system-tables", "p1", "sys.organization.usage.ndjson")); err == nil {
+		t.Error("expected the organization tables to be exported once and not per project")
+	}
+	organizationQueries := 0
+	for _, q := range api.queries {
+		if strings.Contains(q, "organization.usage") {
+			organizationQueries++
+		}
+	}
+	if organizationQueries != 1 {
+		t.Errorf("expected sys.organization.usage to be queried once but was %v times", organizationQueries)
+	}
+	// each profile is downloaded from its own project
+	downloads := strings.Join(api.downloads, ",")
+	if !strings.Contains(downloads, "p1: p1-failed") || !strings.Contains(downloads, "p2: p2-failed") {
+		t.Errorf("unexpected downloads %v", api.downloads)
+	}
+
+	b, err := os.ReadFile(filepath.Join(c.OutputDir(), clusterstats.CloudProjectsFile))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var projects []clusterstats.CloudProject
+	if err := json.Unmarshal(b, &projects); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(projects) != 2 {
+		t.Fatalf("expected 2 projects but was %v", projects)
+	}
+	if !projects[0].Success || projects[0].Name != "sales" || projects[0].JobProfilesCollected != 1 {
+		t.Errorf("expected p1 to be collected but was %+v", projects[0])
+	}
+	if projects[1].Success || len(projects[1].Errors) != 1 || !strings.Contains(projects[1].Errors[0], "403 Forbidden") {
+		t.Errorf("expected the wlm of p2 to fail but was %+v", projects[1])
+	}
+}
+
+func TestRunCollectCloudProjectsOnlyCollectsTheListedProjects(t *testing.T) {
+	c := cloudConf(t, "[p2, unknown]")
+	api := &cloudAPI{sqlByJob: map[string]string{}}
+	c.SetDremioClient(cloudProjectClient{api: api})
+	if err := RunCollectCloudProjects(c); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(c.OutputDir(), "system-tables", "p1")); err == nil {
+		t.Error("expected p1 not to be collected")
+	}
+	b, err := os.ReadFile(filepath.Join(c.OutputDir(), clusterstats.CloudProjectsFile))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var projects []clusterstats.CloudProject
+	if err := json.Unmarshal(b, &projects); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(projects) != 2 || projects[0].ID != "p2" || projects[0].Name != "finance" || projects[1].ID != "unknown" || projects[1].Name != "" {
+		t.Errorf("unexpected projects %+v", projects)
+	}
+}
@@ -17,46 +17,86 @@ package apicollect
 
 import (
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/queriesjson"
-	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/threading"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
 func GetNumberOfJobProfilesCollected(c *conf.CollectConf) (tried, collected int, err error) {
+	tried, collected, _, err = collectJobProfiles(c, nil)
+	return tried, collected, err
+}
+
+// collectJobProfiles selects and downloads the job profiles, when workload is set it is given every
+// queries.json row that is read and summarized is true once all of them were
+func collectJobProfiles(c *conf.CollectConf, workload *queriesjson.WorkloadAccumulator) (tried, collected int, summarized bool, err error) {
 	var files []fs.DirEntry
-	var queriesrows []queriesjson.QueriesRow
 
 	files, err = os.ReadDir(c.SystemTablesOutDir())
 	if err != nil {
-		return 0, 0, err
+		return 0, 0, false, err
 	}
 	jobhistoryjsons := []string{}
 	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".ndjson") {
+			// the schema and parquet files of the exports are next to the rows
+			continue
+		}
 		if strings.Contains(file.Name(), "project.history.jobs") || strings.Contains(file.Name(), "jobs_recent") {
 			jobhistoryjsons = append(jobhistoryjsons, path.Join(c.SystemTablesOutDir(), file.Name()))
 		}
 	}
 
+	var selectors []*queriesjson.Selector
+	for _, config := range c.JobProfileSelectors() {
+		s, err := queriesjson.NewSelector(config)
+		if err != nil {
+			return 0, 0, false, err
+		}
+		selectors = append(selectors, s)
+	}
+	selector := queriesjson.NewProfileSelector(queriesjson.ProfileLimits{
+		SlowPlanning: c.JobProfilesNumSlowPlanning(),
+		SlowExec:     c.JobProfilesNumSlowExec(),
+		HighCost:     c.JobProfilesNumHighQueryCost(),
+		RecentErrors: c.JobProfilesNumRecentErrors(),
+		Sampling:     c.JobProfilesSampling(),
+		BucketSize:   c.JobProfilesSamplingBucket(),
+		Buckets:      samplingBuckets(c),
+	}, selectors...)
+	add := selector.Add
+	if window := c.Window(); window.IsSet() {
+		add = func(row queriesjson.QueriesRow) {
+			if window.ContainsMillis(int64(row.Start)) {
+				selector.Add(row)
+			}
+		}
+	}
 	if len(jobhistoryjsons) == 0 {
 
-		// Attempt to read job history from queries.json, if not Dremio Cloud
-		if !c.IsDremioCloud() {
+		// Attempt to read job history from queries.json, if not Dremio Cloud or ddc api-collect
+		if !c.IsDremioCloud() && !c.APIOnly() {
 			files, err = os.ReadDir(c.QueriesOutDir())
 			if err != nil {
-				return 0, 0, err
+				return 0, 0, false, err
 			}
 			queriesjsons := []string{}
 			for _, file := range files {
+				// the workload summary is written to the same folder
+				if !strings.HasPrefix(file.Name(), "queries") {
+					continue
+				}
 				queriesjsons = append(queriesjsons, path.Join(c.QueriesOutDir(), file.Name()))
 			}
 
@@ -65,32 +105,37 @@ func GetNumberOfJobProfilesCollected(c *conf.CollectConf) (tried, collected int,
 				return
 			}
 
-			queriesrows = queriesjson.CollectQueriesJSON(queriesjsons)
+			if workload != nil {
+				// the workload summary is made in the same pass so the history is read once
+				selectorAdd := add
+				add = func(row queriesjson.QueriesRow) {
+					workload.Add(row)
+					selectorAdd(row)
+				}
+			}
+			queriesjson.CollectQueriesJSON(queriesjsons, c.NumberThreads(), add)
+			summarized = workload != nil
 		} else {
 			simplelog.Warning("no valid records or jobs.json files found. Therefore, we are skipping collection of Job Profiles")
 			return
 		}
 	} else {
-		queriesrows = queriesjson.CollectJobHistoryJSON(jobhistoryjsons)
+		queriesjson.CollectJobHistoryJSON(jobhistoryjsons, c.NumberThreads(), add)
 	}
 
+	simplelog.Debugf("searched %v jobs for %v slow planning, %v slow execution, %v high cost and %v recent error job profiles and %v selectors", selector.Rows(), c.JobProfilesNumSlowPlanning(), c.JobProfilesNumSlowExec(), c.JobProfilesNumHighQueryCost(), c.JobProfilesNumRecentErrors(), len(selectors))
+	selected := selector.Selected()
+	manifest := make(map[string]*JobProfileManifestEntry, len(selected))
 	profilesToCollect := map[string]string{}
-
-	simplelog.Debugf("searching job history for %v of jobProfilesNumSlowPlanning", c.JobProfilesNumSlowPlanning())
-	slowplanqueriesrows := queriesjson.GetSlowPlanningJobs(queriesrows, c.JobProfilesNumSlowPlanning())
-	queriesjson.AddRowsToSet(slowplanqueriesrows, profilesToCollect)
-
-	simplelog.Debugf("searching job history for %v of jobProfilesNumSlowExec", c.JobProfilesNumSlowExec())
-	slowexecqueriesrows := queriesjson.GetSlowExecJobs(queriesrows, c.JobProfilesNumSlowExec())
-	queriesjson.AddRowsToSet(slowexecqueriesrows, profilesToCollect)
-
-	simplelog.Debugf("searching job history for profiles %v of jobProfilesNumHighQueryCost", c.JobProfilesNumHighQueryCost())
-	highcostqueriesrows := queriesjson.GetHighCostJobs(queriesrows, c.JobProfilesNumHighQueryCost())
-	queriesjson.AddRowsToSet(highcostqueriesrows, profilesToCollect)
-
-	simplelog.Debugf("searching job history for %v of jobProfilesNumRecentErrors", c.JobProfilesNumRecentErrors())
-	errorqueriesrows := queriesjson.GetRecentErrorJobs(queriesrows, c.JobProfilesNumRecentErrors())
-	queriesjson.AddRowsToSet(errorqueriesrows, profilesToCollect)
+	for _, p := range selected {
+		profilesToCollect[p.JobID] = ""
+		manifest[p.JobID] = newManifestEntry(p)
+	}
+	defer func() {
+		if err := WriteJobProfilesManifest(c.JobProfilesOutDir(), manifest); err != nil {
+			simplelog.Errorf("unable to write job profiles manifest: %v", err)
+		}
+	}()
 
 	tried = len(profilesToCollect)
 	var m sync.Mutex
@@ -99,7 +144,7 @@ func GetNumberOfJobProfilesCollected(c *conf.CollectConf) (tried, collected int,
 		simplelog.Debugf("Downloading %v job profiles...", len(profilesToCollect))
 		downloadThreadPool, err := threading.NewThreadPoolWithJobQueue(c.NumberThreads(), len(profilesToCollect), 10, false, true)
 		if err != nil {
-			return 0, 0, fmt.Errorf("invalid thread pool: %w", err)
+			return 0, 0, summarized, fmt.Errorf("invalid thread pool: %w", err)
 		}
 		for key := range profilesToCollect {
 			//because we are looping
@@ -108,13 +153,15 @@ func GetNumberOfJobProfilesCollected(c *conf.CollectConf) (tried, collected int,
 				Name: keyToDownload,
 				Process: func() error {
 					err := DownloadJobProfile(c, keyToDownload)
+					m.Lock()
+					defer m.Unlock()
 					if err != nil {
 						simplelog.Errorf("unable to download %v, err: %v", keyToDownload, err) // Print instead of Error
+						manifest[keyToDownload].Error = err.Error()
 						return nil
 					}
-					m.Lock()
+					manifest[keyToDownload].Downloaded = true
 					collected++
-					m.Unlock()
 					return nil
 				}})
 		}
@@ -128,44 +175,61 @@ func GetNumberOfJobProfilesCollected(c *conf.CollectConf) (tried, collected int,
 		simplelog.Info("No job profiles to collect exiting...")
 		fmt.Println("JOB FAILED - JOB PROFILES COLLECTION - no profiles to collect")
 	}
-	return tried, collected, nil
+	return tried, collected, summarized, nil
 }
 
-func RunCollectJobProfiles(c *conf.CollectConf) error {
+// samplingBuckets is how many sampling buckets the searched history covers, that is the --since and
+// --until window when since is set and the queries.json retention otherwise
+func samplingBuckets(c *conf.CollectConf) int {
+	bucket := c.JobProfilesSamplingBucket()
+	if bucket <= 0 {
+		return 1
+	}
+	span := time.Duration(c.DremioQueriesJSONNumDays()) * 24 * time.Hour
+	if window := c.Window(); !window.Since.IsZero() {
+		until := window.Until
+		if until.IsZero() {
+			until = time.Now()
+		}
+		span = until.Sub(window.Since)
+	}
+	return int((span + bucket - 1) / bucket)
+}
+
+// RunCollectJobProfiles downloads the selected job profiles, when workload is set it is given every
+// queries.json row read to select them and true is returned so the caller does not read them again
+func RunCollectJobProfiles(c *conf.CollectConf, workload *queriesjson.WorkloadAccumulator) (bool, error) {
 	simplelog.Info("Collecting Job Profiles...")
-	tried, collected, err := GetNumberOfJobProfilesCollected(c)
+	tried, collected, summarized, err := collectJobProfiles(c, workload)
 	if err != nil {
-		return err
+		return summarized, err
 	}
 	simplelog.Debugf("After eliminating duplicates we attempted to collect %v profiles", tried)
 	simplelog.Infof("Downloaded %v job profiles", collected)
-	return nil
+	return summarized, nil
 }
 
 func DownloadJobProfile(c *conf.CollectConf, jobid string) error {
-	var url, apipath string
-	if !c.IsDremioCloud() {
-		apipath = "/apiv2/support/" + jobid + "/download"
-		url = c.DremioEndpoint() + apipath
-	} else {
-		apipath = "/ui/projects/" + c.DremioCloudProjectID() + "/support/" + jobid + "/download"
-		url = c.DremioCloudAppEndpoint() + apipath
-	}
-	filename := jobid + ".zip"
-	headers := map[string]string{"Accept": "application/octet-stream"}
-	body, err := restclient.APIRequest(url, c.DremioPATToken(), "POST", headers)
-	if err != nil {
-		return err
-	}
-	sb := string(body)
-	jobProfileFile := path.Clean(path.Join(c.JobProfilesOutDir(), filename))
-	file, err := os.Create(path.Clean(jobProfileFile))
+	return downloadToFile(c.JobProfilesOutDir(), jobid+".zip", func(w io.Writer) error {
+		return c.DremioClient().DownloadJobProfile(jobid, w)
+	})
+}
+
+// downloadToFile streams a download into dir/filename, the file is removed when the download fails
+func downloadToFile(dir, filename string, download func(w io.Writer) error) error {
+	outFile := filepath.Clean(filepath.Join(dir, filename))
+	file, err := os.Create(outFile)
 	if err != nil {
 		return fmt.Errorf("unable to create file %s due to error %v", filename, err)
 	}
-	defer ddcio.EnsureClose(filepath.Clean(jobProfileFile), file.Close)
-	_, err = fmt.Fprint(file, sb)
-	if err != nil {
+	if err := download(file); err != nil {
+		ddcio.EnsureClose(outFile, file.Close)
+		if removeErr := os.Remove(outFile); removeErr != nil {
+			simplelog.Warningf("unable to remove incomplete file %v due to error %v", outFile, removeErr)
+		}
+		return err
+	}
+	if err := file.Close(); err != nil {
 		return fmt.Errorf("unable to create file %s due to error %v", filename, err)
 	}
 	return nil
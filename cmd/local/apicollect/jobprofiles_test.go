@@ -15,16 +15,19 @@
 package apicollect_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/apicollect"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/queriesjson"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/collects"
 )
 
@@ -109,14 +112,24 @@ dremio-endpoint: %v
 	if tried != 3 {
 		t.Errorf("tried was supposed to be 3 but got %v", tried)
 	}
+	// the workload summary is made from the same pass over queries.json
+	workload := queriesjson.NewWorkloadAccumulator()
+	summarized, err := apicollect.RunCollectJobProfiles(c, workload)
+	if err != nil {
+		t.Fatalf("failed running job profile collection\n%v", err)
+	}
+	if !summarized || workload.Summary().Queries != 3 {
+		t.Errorf("expected the 3 queries to be summarized but was %v with %v queries", summarized, workload.Summary().Queries)
+	}
 
-	if err := os.WriteFile(filepath.Join(sysTableDir, "sys.jobs_recent.json"), []byte(`
-{"rows": [
-	{"job_id": "Query1", "status": "FAILED", "query_type": "REST", "submitted_epoch_millis": 1713968783248,	"planning_start_epoch_millis": 0, "execution_start_epoch_millis": 0, "final_state_epoch_millis": 1713968783250, "planner_estimated_cost": 2.8234000035E5},
-	{"job_id": "Query2", "status": "COMPLETED", "query_type": "REST", "submitted_epoch_millis": 1714033458006, "planning_start_epoch_millis": 1714033458008, "execution_start_epoch_millis": 1714033458042, "final_state_epoch_millis": 1714033458061, "planner_estimated_cost": 3.8154000035E9}
-]}
+	if err := os.WriteFile(filepath.Join(sysTableDir, "sys.jobs_recent.ndjson"), []byte(`{"job_id":"Query1","status":"FAILED","query_type":"REST","submitted_epoch_millis":1713968783248,"planning_start_epoch_millis":0,"execution_start_epoch_millis":0,"final_state_epoch_millis":1713968783250,"planner_estimated_cost":2.8234000035E5}
+{"job_id":"Query2","status":"COMPLETED","query_type":"REST","submitted_epoch_millis":1714033458006,"planning_start_epoch_millis":1714033458008,"execution_start_epoch_millis":1714033458042,"final_state_epoch_millis":1714033458061,"planner_estimated_cost":3.8154000035E9}
 `), 0600); err != nil {
-		t.Fatalf("unable to write sys.jobs_recent.json %v", err)
+		t.Fatalf("unable to write sys.jobs_recent.ndjson %v", err)
+	}
+	// the schema next to the rows is not job history
+	if err := os.WriteFile(filepath.Join(sysTableDir, "sys.jobs_recent.schema.json"), []byte(`[{"name":"job_id","type":{"name":"VARCHAR"}}]`), 0600); err != nil {
+		t.Fatalf("unable to write sys.jobs_recent.schema.json %v", err)
 	}
 
 	// Get number of profiles to collect based on sys.jobs_recent
@@ -130,4 +143,96 @@ dremio-endpoint: %v
 	if tried != 2 {
 		t.Errorf("tried was supposed to be 2 but got %v", tried)
 	}
+	// queries.json is not read when the job history comes from the system tables
+	if summarized, err := apicollect.RunCollectJobProfiles(c, queriesjson.NewWorkloadAccumulator()); err != nil || summarized {
+		t.Errorf("expected queries.json not to be summarized but was %v %v", summarized, err)
+	}
+}
+
+func TestGetNumberOfJobProfilesCollectedWithSelectors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write([]byte{0x12, 0x34}); err != nil {
+			t.Errorf("unexpected error writing response %v", err)
+		}
+	}))
+	defer server.Close()
+
+	confDir := t.TempDir()
+	tmpDir := t.TempDir()
+	for _, d := range []string{"system-tables", "queries", "job-profiles"} {
+		if err := os.MkdirAll(filepath.Join(tmpDir, d, "node1"), 0700); err != nil {
+			t.Fatalf("cant make %v dir %v", d, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, "queries", "node1", "queries.json"), []byte(`
+{"queryId":"refresh1","start":1704103200000,"outcome":"COMPLETED","queryType":"METADATA_REFRESH","queryCost":1,"planningTime":0,"runningTime":10,"username":"system"}
+{"queryId":"refresh2","start":1704106800000,"outcome":"COMPLETED","queryType":"METADATA_REFRESH","queryCost":1,"planningTime":0,"runningTime":10,"username":"system"}
+{"queryId":"etl1","start":1704103200000,"outcome":"COMPLETED","queryType":"ODBC","queryCost":5,"planningTime":1,"runningTime":50,"username":"etl","queryText":"MERGE INTO sales"}
+{"queryId":"etl2","start":1704103300000,"outcome":"COMPLETED","queryType":"ODBC","queryCost":5,"planningTime":1,"runningTime":500,"username":"etl","queryText":"SELECT 1"}
+`), 0600); err != nil {
+		t.Fatalf("unable to write queries.json %v", err)
+	}
+
+	ddcYaml := filepath.Join(confDir, "ddc.yaml")
+	if err := os.WriteFile(ddcYaml, []byte(fmt.Sprintf(`
+dremio-log-dir: %v
+dremio-conf-dir: %v
+number-job-profiles: 1
+dremio-pat-token: my-pat-token
+node-name: node1
+tmp-output-dir: %v
+dremio-endpoint: %v
+job-profile-selectors:
+  - name: refreshes
+    quota: 1
+    query-types: [metadata_refresh]
+  - name: etl-merges
+    quota: 5
+    users: [etl]
+    sql-pattern: "(?i)^merge"
+    since: "2024-01-01T00:00:00Z"
+  - name: escalation
+    job-ids: [explicit1]
+`, LogDir(), ConfDir(), strings.ReplaceAll(tmpDir, "\\", "\\\\"), server.URL)), 0600); err != nil {
+		t.Fatalf("missing conf file %v", err)
+	}
+	c, err := conf.ReadConf(make(map[string]string), ddcYaml, collects.StandardCollection)
+	if err != nil {
+		t.Fatalf("unable to read conf %v", err)
+	}
+
+	tried, collected, err := apicollect.GetNumberOfJobProfilesCollected(c)
+	if err != nil {
+		t.Fatalf("failed running job profile collection %v", err)
+	}
+	// etl2 is the slowest, refresh2 the most recent refresh, etl1 the merge and explicit1 asked for
+	if tried != 4 || collected != 4 {
+		t.Errorf("expected 4 profiles tried and collected but was %v and %v", tried, collected)
+	}
+
+	b, err := os.ReadFile(filepath.Join(c.JobProfilesOutDir(), apicollect.JobProfilesManifestFileName))
+	if err != nil {
+		t.Fatalf("expected a manifest %v", err)
+	}
+	var manifest []apicollect.JobProfileManifestEntry
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	reasons := make(map[string]string)
+	for _, e := range manifest {
+		if !e.Downloaded {
+			t.Errorf("expected %v to be downloaded", e.JobID)
+		}
+		reasons[e.JobID] = strings.Join(e.Reasons, ",")
+	}
+	expected := map[string]string{
+		"etl1":      "selector:etl-merges",
+		"etl2":      "slow-exec",
+		"explicit1": "selector:escalation",
+		"refresh2":  "selector:refreshes",
+	}
+	if !reflect.DeepEqual(reasons, expected) {
+		t.Errorf("expected reasons %v but was %v", expected, reasons)
+	}
 }
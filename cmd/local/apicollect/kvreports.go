@@ -17,35 +17,16 @@ package apicollect
 
 import (
 	"fmt"
-	"os"
-	"path"
-	"path/filepath"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
-	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
-	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
 func RunCollectKvReport(c *conf.CollectConf) error {
 	filename := "kvstore-report.zip"
-	apipath := "/apiv2/kvstore/report"
-	url := c.DremioEndpoint() + apipath
-	headers := map[string]string{"Accept": "application/octet-stream"}
-	body, err := restclient.APIRequest(url, c.DremioPATToken(), "GET", headers)
+	err := downloadToFile(c.KVstoreOutDir(), filename, c.DremioClient().KVStoreReport)
 	if err != nil {
-		return fmt.Errorf("unable to retrieve KV store report from %s due to error %v", url, err)
-	}
-	sb := string(body)
-	kvStoreReportFile := path.Join(c.KVstoreOutDir(), filename)
-	file, err := os.Create(path.Clean(kvStoreReportFile))
-	if err != nil {
-		return fmt.Errorf("unable to create file %s due to error %v", filename, err)
-	}
-	defer ddcio.EnsureClose(filepath.Clean(kvStoreReportFile), file.Close)
-	_, err = fmt.Fprint(file, sb)
-	if err != nil {
-		return fmt.Errorf("unable to create file %s due to error %v", filename, err)
+		return fmt.Errorf("unable to retrieve KV store report due to error %v", err)
 	}
 	simplelog.Debugf("SUCCESS - Created " + filename)
 	return nil
@@ -13,3 +13,80 @@
 // limitations under the License.
 
 package apicollect_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/apicollect"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collects"
+)
+
+// failingKVClient writes part of the report before the connection drops
+type failingKVClient struct {
+	restclient.Client
+}
+
+func (f failingKVClient) KVStoreReport(w io.Writer) error {
+	if _, err := io.WriteString(w, "PK partial"); err != nil {
+		return err
+	}
+	return errors.New("connection reset by peer")
+}
+
+func kvConf(t *testing.T) *conf.CollectConf {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/apiv2/login":
+			fmt.Fprint(w, `{"token": "fake_token"}`)
+		case "/apiv2/kvstore/report":
+			fmt.Fprint(w, "PK report")
+		default:
+			http.Error(w, "Not Found", http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	c, err := conf.ReadConf(make(map[string]string), filepath.Join(setupConfigDir(t, server.URL), "ddc.yaml"), collects.StandardCollection)
+	if err != nil {
+		t.Fatalf("unable to read conf due to error %v", err)
+	}
+	if err := os.MkdirAll(c.KVstoreOutDir(), 0700); err != nil {
+		t.Fatalf("unable to create kvstore dir due to error %v", err)
+	}
+	return c
+}
+
+func TestRunCollectKvReport(t *testing.T) {
+	c := kvConf(t)
+	if err := apicollect.RunCollectKvReport(c); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(c.KVstoreOutDir(), "kvstore-report.zip"))
+	if err != nil {
+		t.Fatalf("missing report %v", err)
+	}
+	if string(b) != "PK report" {
+		t.Errorf("unexpected report %q", b)
+	}
+}
+
+func TestRunCollectKvReportRemovesAPartialReport(t *testing.T) {
+	c := kvConf(t)
+	c.SetDremioClient(failingKVClient{})
+	err := apicollect.RunCollectKvReport(c)
+	if err == nil {
+		t.Fatal("expected the failed download to be reported")
+	}
+	if _, err := os.Stat(filepath.Join(c.KVstoreOutDir(), "kvstore-report.zip")); !os.IsNotExist(err) {
+		t.Errorf("expected the partial report to be removed but stat returned %v", err)
+	}
+}
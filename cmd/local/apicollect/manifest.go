@@ -0,0 +1,84 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package apicollect
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/queriesjson"
+)
+
+// JobProfilesManifestFileName is written next to the downloaded job profiles
+const JobProfilesManifestFileName = "job-profiles-manifest.json"
+
+// JobProfileManifestEntry records why a job profile was picked and whether it was downloaded
+type JobProfileManifestEntry struct {
+	JobID          string     `json:"jobId"`
+	Reasons        []string   `json:"reasons"`
+	Downloaded     bool       `json:"downloaded"`
+	Error          string     `json:"error,omitempty"`
+	Start          *time.Time `json:"start,omitempty"`
+	Username       string     `json:"username,omitempty"`
+	QueueName      string     `json:"queueName,omitempty"`
+	QueryType      string     `json:"queryType,omitempty"`
+	Outcome        string     `json:"outcome,omitempty"`
+	RunningMillis  float64    `json:"runningMillis,omitempty"`
+	PlanningMillis float64    `json:"planningMillis,omitempty"`
+	QueryCost      float64    `json:"queryCost,omitempty"`
+}
+
+func newManifestEntry(p queriesjson.SelectedProfile) *JobProfileManifestEntry {
+	entry := &JobProfileManifestEntry{
+		JobID:          p.JobID,
+		Reasons:        p.Reasons,
+		Username:       p.Row.Username,
+		QueueName:      p.Row.QueueName,
+		QueryType:      p.Row.QueryType,
+		Outcome:        p.Row.Outcome,
+		RunningMillis:  p.Row.RunningTime,
+		PlanningMillis: p.Row.PlanningTime,
+		QueryCost:      p.Row.QueryCost,
+	}
+	if p.Row.Start > 0 {
+		start := time.UnixMilli(int64(p.Row.Start)).UTC()
+		entry.Start = &start
+	}
+	return entry
+}
+
+// WriteJobProfilesManifest writes the manifest ordered by job id into outDir
+func WriteJobProfilesManifest(outDir string, manifest map[string]*JobProfileManifestEntry) error {
+	entries := make([]*JobProfileManifestEntry, 0, len(manifest))
+	for _, e := range manifest {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].JobID < entries[j].JobID
+	})
+	b, err := json.MarshalIndent(entries, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to marshal job profiles manifest due to error %v", err)
+	}
+	manifestFile := filepath.Join(outDir, JobProfilesManifestFileName)
+	if err := os.WriteFile(manifestFile, b, 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", manifestFile, err)
+	}
+	return nil
+}
@@ -16,180 +16,180 @@
 package apicollect
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"path"
-	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
-	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/threading"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/timewindow"
 )
 
+// RunCollectDremioSystemTables submits up to system-tables-export-threads export queries at a time, a failed
+// export is logged and does not stop the others, the exports that failed are listed in the error
 func RunCollectDremioSystemTables(c *conf.CollectConf) error {
 	simplelog.Debugf("Collecting results from Export System Tables...")
-	var systables []string
-	if !c.IsDremioCloud() {
-		systables = c.Systemtables()
-	} else {
-		systables = c.SystemtablesDremioCloud()
+	client := c.DremioClient()
+	exports := c.SQLExports()
+	if len(exports) == 0 {
+		return nil
 	}
-
-	for _, systable := range systables {
-		err := downloadSysTable(c, systable)
-		if err != nil {
-			simplelog.Errorf("%v", err) // Print instead of Error
-		}
-
+	threadPool, err := threading.NewThreadPoolWithJobQueue(c.SystemTablesExportThreads(), len(exports), 5, false, false)
+	if err != nil {
+		return fmt.Errorf("invalid thread pool: %w", err)
+	}
+	var m sync.Mutex
+	var failed []string
+	for _, export := range exports {
+		// because we are looping
+		exportToDownload := export
+		threadPool.AddJob(threading.Job{
+			Name: "SYSTEM TABLE " + exportToDownload.Name,
+			Process: func() error {
+				err := downloadSysTable(c, client, exportToDownload)
+				if err != nil {
+					m.Lock()
+					failed = append(failed, exportToDownload.Name)
+					m.Unlock()
+				}
+				return err
+			},
+		})
+	}
+	if err := threadPool.ProcessAndWait(); err != nil {
+		return err
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		return fmt.Errorf("%v of %v exports failed: %v", len(failed), len(exports), strings.Join(failed, ", "))
 	}
-
 	return nil
 }
 
-func downloadSysTable(c *conf.CollectConf, systable string) error {
-	tablerowlimit := strconv.Itoa(c.SystemTablesRowLimit())
+// timeWhereClause limits a time column, such as submitted_ts of the job history, to the --since and
+// --until window when set and otherwise to the number of days of queries.json
+func timeWhereClause(column string, window timewindow.Window, numDays int) string {
+	if !window.IsSet() {
+		return " WHERE " + column + " > DATE_SUB(CAST(NOW() AS DATE), CAST(" + strconv.Itoa(numDays) + " AS INTERVAL DAY))"
+	}
+	// the timestamps of the system tables are in UTC
+	const layout = "2006-01-02 15:04:05.000"
+	var conditions []string
+	if !window.Since.IsZero() {
+		conditions = append(conditions, column+" >= TIMESTAMP '"+window.Since.UTC().Format(layout)+"'")
+	}
+	if !window.Until.IsZero() {
+		conditions = append(conditions, column+" <= TIMESTAMP '"+window.Until.UTC().Format(layout)+"'")
+	}
+	return " WHERE " + strings.Join(conditions, " AND ")
+}
 
-	headers := map[string]string{"Content-Type": "application/json"}
-	var joburl, sqlurl, jobresultsurl string
-	if !c.IsDremioCloud() {
-		sqlurl = c.DremioEndpoint() + "/api/v3/sql"
-		joburl = c.DremioEndpoint() + "/api/v3/job/"
-	} else {
-		sqlurl = c.DremioEndpoint() + "/v0/projects/" + c.DremioCloudProjectID() + "/sql"
-		joburl = c.DremioEndpoint() + "/v0/projects/" + c.DremioCloudProjectID() + "/job/"
+// exportSQL adds the time filter or the row limit to the sql of an export
+func exportSQL(export conf.SQLExport, window timewindow.Window, numDays int) string {
+	if export.TimeColumn != "" {
+		// the rows are limited while the results are read so the newest are kept
+		return export.SQL + timeWhereClause(export.TimeColumn, window, numDays) + " ORDER BY " + export.TimeColumn + " DESC"
 	}
+	return export.SQL + " LIMIT " + strconv.Itoa(export.RowLimit)
+}
 
-	sql := "SELECT * FROM sys." + systable
-	// job history is limited by the number of days, all other sys tables are limited by the number of rows
-	if strings.Contains(systable, "project.history.jobs") || strings.Contains(systable, "jobs_recent") {
-		daylimit := strconv.Itoa(c.DremioQueriesJSONNumDays())
-		sql += " WHERE submitted_ts > DATE_SUB(CAST(NOW() AS DATE), CAST(" + daylimit + " AS INTERVAL DAY))"
-		sql += " ORDER BY submitted_ts DESC"
-		simplelog.Debugf("Collecting sys." + systable + " (Limit: Last " + daylimit + " days)")
+func downloadSysTable(c *conf.CollectConf, client restclient.Client, export conf.SQLExport) error {
+	sql := exportSQL(export, c.Window(), c.DremioQueriesJSONNumDays())
+	if export.TimeColumn != "" {
+		simplelog.Debugf("Collecting %v (Limit: %v rows by %v)", export.Name, export.RowLimit, export.TimeColumn)
 	} else {
-		sql += " LIMIT " + tablerowlimit
-		simplelog.Debugf("Collecting sys." + systable + " (Limit: " + tablerowlimit + " rows)")
+		simplelog.Debugf("Collecting %v (Limit: %v rows)", export.Name, export.RowLimit)
 	}
 	simplelog.Debugf(sql)
-	sqlbody := "{\"sql\": \"" + sql + "\"}"
-
-	jobid, err := restclient.PostQuery(sqlurl, c.DremioPATToken(), headers, sqlbody)
+	jobid, err := client.SubmitSQL(sql)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to submit the sql of %v due to error %v", export.Name, err)
 	}
-	jobstateurl := joburl + jobid
-	err = checkJobState(c, jobstateurl, headers)
+	err = checkJobState(client, jobid)
 	if err != nil {
-		return fmt.Errorf("unable to retrieve sys.%v due to error %v", systable, err)
+		return fmt.Errorf("unable to retrieve %v due to error %v", export.Name, err)
 	}
-	jobresultsurl = joburl + jobid + "/results"
 	simplelog.Debugf("Retrieving job results ...")
-	err = retrieveJobResults(c, jobresultsurl, headers, systable)
+	err = retrieveJobResults(c, client, jobid, export)
 	if err != nil {
 		return fmt.Errorf("unable to retrieve job results due to error %v", err)
 	}
 	return nil
 }
 
-func checkJobState(c *conf.CollectConf, jobstateurl string, headers map[string]string) error {
+func checkJobState(client restclient.Client, jobid string) error {
 	sleepms := 200 // Consider moving to config
 	jobstate := "RUNNING"
 	for jobstate != "COMPLETED" {
 		time.Sleep(time.Duration(sleepms) * time.Millisecond)
-		body, err := restclient.APIRequest(jobstateurl, c.DremioPATToken(), "GET", headers)
-		if err != nil {
-			return fmt.Errorf("unable to retrieve job state from %s due to error %v", jobstateurl, err)
-		}
-		dat := make(map[string]interface{})
-		err = json.Unmarshal(body, &dat)
+		status, err := client.JobStatus(jobid)
 		if err != nil {
-			return fmt.Errorf("unable to unmarshall JSON response - %w", err)
-		}
-		if val, ok := dat["jobState"]; ok {
-			jobstate, ok = val.(string)
-			if !ok {
-				return fmt.Errorf("returned field 'jobState' does not have expected type string")
-			}
-		} else {
-			return fmt.Errorf("returned json does not contain required field 'jobState'")
+			return fmt.Errorf("unable to retrieve job state of %s due to error %v", jobid, err)
 		}
+		jobstate = status.JobState
 		simplelog.Debugf("job state: %s", jobstate)
-		if jobstate == "FAILED" || jobstate == "CANCELED" || jobstate == "CANCELLATION_REQUESTED" || jobstate == "INVALID_STATE" {
-			return fmt.Errorf("unable to retrieve job results - job state: " + jobstate)
+		if status.Failed() {
+			if status.ErrorMessage != "" {
+				return fmt.Errorf("unable to retrieve job results - job state: %v - %v", jobstate, status.ErrorMessage)
+			}
+			return fmt.Errorf("unable to retrieve job results - job state: %v", jobstate)
 		}
 	}
 	return nil
 }
 
-func retrieveJobResults(c *conf.CollectConf, jobresultsurl string, headers map[string]string, systable string) error {
+func retrieveJobResults(c *conf.CollectConf, client restclient.Client, jobid string, export conf.SQLExport) (err error) {
 	apilimit := 500 // Consider moving to config
-	tablerowlimit := c.SystemTablesRowLimit()
+	tablerowlimit := export.RowLimit
 
-	offset := 0
-
-	for {
-		urlsuffix := "?offset=" + strconv.Itoa(offset) + "&limit=" + strconv.Itoa(apilimit)
-		resultsurl := jobresultsurl + urlsuffix
-		body, err := restclient.APIRequest(resultsurl, c.DremioPATToken(), "GET", headers)
-		if err != nil {
-			return fmt.Errorf("unable to retrieve job results from %s due to error %v", resultsurl, err)
+	out, err := newTableExport(c.SystemTablesOutDir(), export.Name, c.SystemTablesParquet())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("unable to write the results of %v due to error %v", export.Name, closeErr)
 		}
+	}()
 
-		dat := make(map[string]interface{})
-		err = json.Unmarshal(body, &dat)
-		var rowcount float64
-		if err != nil {
-			return fmt.Errorf("unable to unmarshall JSON response - %w", err)
-		}
-		if val, ok := dat["rowCount"]; ok {
-			rowcount, ok = val.(float64)
-			if !ok {
-				rowcount = 0
-				simplelog.Warningf("returned field 'rowCount' does not have expected type float64")
-			}
-		} else {
-			rowcount = 0
-			simplelog.Warningf("returned json does not contain expected field 'rowCount'")
-		}
-		sb := string(body)
-		filename := getSystemTableName(systable, urlsuffix)
-		systemTableFile := path.Join(c.SystemTablesOutDir(), filename)
-		simplelog.Debugf("Creating " + filename + " ...")
-		file, err := os.Create(path.Clean(systemTableFile))
+	offset := 0
+	for {
+		limit := min(apilimit, tablerowlimit-offset)
+		page, err := client.JobResults(jobid, offset, limit)
 		if err != nil {
-			return fmt.Errorf("unable to create file %v due to error %v", filename, err)
+			return fmt.Errorf("unable to retrieve job results of %s at offset %v due to error %v", jobid, offset, err)
 		}
-		defer ddcio.EnsureClose(filepath.Clean(systemTableFile), file.Close)
-		_, err = fmt.Fprint(file, sb)
-		if err != nil {
-			return fmt.Errorf("unable to create file %s due to error %v", filename, err)
+		if err := out.AddPage(page, limit); err != nil {
+			return err
 		}
-		simplelog.Debugf("SUCCESS - Created " + filename)
 
-		offset = offset + apilimit
-		if offset > int(rowcount) || offset >= tablerowlimit {
-			if offset >= tablerowlimit {
-				simplelog.Warningf("table results have been limited to %v records", tablerowlimit)
-			}
+		offset += limit
+		if offset >= page.RowCount || len(page.Rows) == 0 {
+			break
+		}
+		if offset >= tablerowlimit {
+			simplelog.Warningf("%v results have been limited to %v records", export.Name, tablerowlimit)
 			break
 		}
 	}
-
+	simplelog.Debugf("SUCCESS - wrote %v rows of %v to %v.ndjson", out.rows, export.Name, out.base)
 	return nil
 }
 
-func getSystemTableName(systable, urlsuffix string) string {
-	filename := strings.Join([]string{"sys.", systable, urlsuffix, ".json"}, "")
+// exportFileBase is the name of the files of an export without the extension
+func exportFileBase(name string) string {
 	// the ? will not work on windows
-	filename = strings.Replace(filename, "?", "_", -1)
+	filename := strings.Replace(name, "?", "_", -1)
 	// the = will not work on windows
 	filename = strings.Replace(filename, "=", "_", -1)
 	// go ahead and remove & because it will look weird by itself in the file name
 	filename = strings.Replace(filename, "&", "_", -1)
-	return strings.Replace(filename, "\\\"", "", -1)
+	filename = strings.Replace(filename, "\\\"", "", -1)
+	// tables added in ddc.yaml may be quoted without the escaping
+	return strings.Replace(filename, "\"", "", -1)
 }
@@ -15,44 +15,226 @@
 // apicollect provides all the methods that collect via the API, this is a substantial part of the activities of DDC so it gets it's own package
 package apicollect
 
-import "testing"
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
 
-func TestSysTableNameWithNoEscapableCharacters(t *testing.T) {
-	urlsuffix := ""
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collects"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/timewindow"
+)
 
-	name := getSystemTableName("thing", urlsuffix)
-	expected := "sys.thing.json"
+func TestSysTableNameWithNoEscapableCharacters(t *testing.T) {
+	name := exportFileBase("sys.thing")
+	expected := "sys.thing"
 	if name != expected {
 		t.Errorf("expected %v but was %v", expected, name)
 	}
 }
 
 func TestSysTableNameWithBackslashAndDoubleQuotes(t *testing.T) {
-	urlsuffix := ""
-
-	name := getSystemTableName("\\\"thing\\\"", urlsuffix)
-	expected := "sys.thing.json"
+	name := exportFileBase("sys.\\\"thing\\\"")
+	expected := "sys.thing"
 	if name != expected {
 		t.Errorf("expected %v but was %v", expected, name)
 	}
 }
 
-func TestSysTableNameWithQuestionMarkAndEqualsCharacters(t *testing.T) {
-	urlsuffix := "?offset=0"
-
-	name := getSystemTableName("thing", urlsuffix)
-	expected := "sys.thing_offset_0.json"
+func TestSysTableNameWithAllEscapableCharacters(t *testing.T) {
+	name := exportFileBase("sys.\"tables\"?a=b&c")
+	expected := "sys.tables_a_b_c"
 	if name != expected {
 		t.Errorf("expected %v but was %v", expected, name)
 	}
 }
 
-func TestSysTableNameWithAllEscapableCharacters(t *testing.T) {
-	urlsuffix := "?offset=0&limit=500"
+func TestJobHistoryWhereClauseWithoutWindowUsesNumDays(t *testing.T) {
+	clause := timeWhereClause("submitted_ts", timewindow.Window{}, 7)
+	expected := " WHERE submitted_ts > DATE_SUB(CAST(NOW() AS DATE), CAST(7 AS INTERVAL DAY))"
+	if clause != expected {
+		t.Errorf("expected %v but was %v", expected, clause)
+	}
+}
+
+func TestJobHistoryWhereClauseWithWindow(t *testing.T) {
+	window, err := timewindow.Parse("2024-01-02T14:05:00+01:00", "2024-01-02 15:00")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	clause := timeWhereClause("submitted_ts", window, 7)
+	expected := " WHERE submitted_ts >= TIMESTAMP '2024-01-02 13:05:00.000' AND submitted_ts <= TIMESTAMP '2024-01-02 15:00:00.000'"
+	if clause != expected {
+		t.Errorf("expected %v but was %v", expected, clause)
+	}
+	window, err = timewindow.Parse("", "2024-01-02")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	clause = timeWhereClause("submitted_ts", window, 7)
+	expected = " WHERE submitted_ts <= TIMESTAMP '2024-01-02 00:00:00.000'"
+	if clause != expected {
+		t.Errorf("expected %v but was %v", expected, clause)
+	}
+}
+
+func TestExportSQL(t *testing.T) {
+	limited := conf.SQLExport{Name: "sys.options", SQL: "SELECT * FROM sys.options", RowLimit: 1000}
+	if sql := exportSQL(limited, timewindow.Window{}, 7); sql != "SELECT * FROM sys.options LIMIT 1000" {
+		t.Errorf("unexpected sql %v", sql)
+	}
+	window, err := timewindow.Parse("2024-01-02", "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	filtered := conf.SQLExport{Name: "refreshes", SQL: "SELECT * FROM (SELECT * FROM sys.refreshes\n) AS ddc_export", RowLimit: 10, TimeColumn: "start_time"}
+	expected := "SELECT * FROM (SELECT * FROM sys.refreshes\n) AS ddc_export WHERE start_time >= TIMESTAMP '2024-01-02 00:00:00.000' ORDER BY start_time DESC"
+	if sql := exportSQL(filtered, window, 7); sql != expected {
+		t.Errorf("expected %v but was %v", expected, sql)
+	}
+}
 
-	name := getSystemTableName("\\\"tables\\\"", urlsuffix)
-	expected := "sys.tables_offset_0_limit_500.json"
+func TestExportFileNameOfCustomSQL(t *testing.T) {
+	name := exportFileBase("non-default-options")
+	expected := "non-default-options"
 	if name != expected {
 		t.Errorf("expected %v but was %v", expected, name)
 	}
 }
+
+// resultsServer answers the sql, job state and job results apis, every export has 700 rows
+func resultsServer(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	jobs := 0
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var response any
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v3/sql":
+			mu.Lock()
+			jobs++
+			response = map[string]string{"id": "job" + strconv.Itoa(jobs)}
+			mu.Unlock()
+		case strings.HasSuffix(r.URL.Path, "/results"):
+			offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			rows := []map[string]any{}
+			for i := offset; i < offset+limit && i < 700; i++ {
+				rows = append(rows, map[string]any{"name": "row-" + strconv.Itoa(i), "n": i, "ts": "2024-01-02 03:04:05.678"})
+			}
+			response = map[string]any{
+				"rowCount": 700,
+				"schema": []map[string]any{
+					{"name": "name", "type": map[string]string{"name": "VARCHAR"}},
+					{"name": "n", "type": map[string]string{"name": "BIGINT"}},
+					{"name": "ts", "type": map[string]string{"name": "TIMESTAMP"}},
+				},
+				"rows": rows,
+			}
+		case strings.HasPrefix(r.URL.Path, "/api/v3/job/"):
+			response = map[string]string{"jobState": "COMPLETED"}
+		case r.URL.Path == "/apiv2/login":
+			// the credentials are checked when the configuration is read
+			response = map[string]string{}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// the results api indents its json
+		b, err := json.MarshalIndent(response, "", "    ")
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		if _, err := w.Write(b); err != nil {
+			t.Errorf("unexpected error writing response %v", err)
+		}
+	}))
+}
+
+func TestRunCollectDremioSystemTablesWritesOneFilePerTable(t *testing.T) {
+	server := resultsServer(t)
+	defer server.Close()
+
+	tmpDir := t.TempDir()
+	ddcYaml := filepath.Join(t.TempDir(), "ddc.yaml")
+	if err := os.WriteFile(ddcYaml, []byte(fmt.Sprintf(`
+dremio-log-dir: testdata/logs
+dremio-conf-dir: testdata/logs
+dremio-pat-token: my-pat-token
+node-name: node1
+tmp-output-dir: %v
+dremio-endpoint: %v
+system-tables-row-limit: 600
+system-tables-export-threads: 8
+system-tables-parquet: true
+system-tables-custom-sql:
+  - name: non-default-options
+    sql: SELECT * FROM sys.options WHERE status <> 'DEFAULT'
+    row-limit: 10
+`, strings.ReplaceAll(tmpDir, "\\", "\\\\"), server.URL)), 0600); err != nil {
+		t.Fatalf("missing conf file %v", err)
+	}
+	c, err := conf.ReadConf(make(map[string]string), ddcYaml, collects.StandardCollection)
+	if err != nil {
+		t.Fatalf("unable to read conf %v", err)
+	}
+	if err := os.MkdirAll(c.SystemTablesOutDir(), 0700); err != nil {
+		t.Fatalf("unable to make system tables dir %v", err)
+	}
+	if err := RunCollectDremioSystemTables(c); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for _, export := range c.SQLExports() {
+		base := filepath.Join(c.SystemTablesOutDir(), exportFileBase(export.Name))
+		expectedRows := min(export.RowLimit, 700)
+		f, err := os.Open(base + ".ndjson")
+		if err != nil {
+			t.Fatalf("missing ndjson of %v: %v", export.Name, err)
+		}
+		scanner := bufio.NewScanner(f)
+		lines := 0
+		for scanner.Scan() {
+			if lines == 0 && scanner.Text() != `{"n":0,"name":"row-0","ts":"2024-01-02 03:04:05.678"}` {
+				t.Errorf("unexpected first row of %v: %v", export.Name, scanner.Text())
+			}
+			lines++
+		}
+		if err := f.Close(); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+		if lines != expectedRows {
+			t.Errorf("expected %v rows in %v but was %v", expectedRows, export.Name, lines)
+		}
+		var schema []schemaField
+		b, err := os.ReadFile(base + ".schema.json")
+		if err != nil {
+			t.Fatalf("missing schema of %v: %v", export.Name, err)
+		}
+		if err := json.Unmarshal(b, &schema); err != nil || len(schema) != 3 || schema[2].Type.Name != "TIMESTAMP" {
+			t.Errorf("unexpected schema of %v: %s", export.Name, b)
+		}
+		pq, err := os.ReadFile(base + ".parquet")
+		if err != nil {
+			t.Fatalf("missing parquet of %v: %v", export.Name, err)
+		}
+		if !bytes.HasPrefix(pq, []byte("PAR1")) || !bytes.HasSuffix(pq, []byte("PAR1")) {
+			t.Errorf("%v.parquet is not a parquet file", export.Name)
+		}
+	}
+	entries, err := os.ReadDir(c.SystemTablesOutDir())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(entries) != 3*len(c.SQLExports()) {
+		t.Errorf("expected an ndjson, schema and parquet file per export but found %v files for %v exports", len(entries), len(c.SQLExports()))
+	}
+}
@@ -0,0 +1,353 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// apicollect provides all the methods that collect via the API, this is a substantial part of the activities of DDC so it gets it's own package
+package apicollect
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/parquet"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// schemaField is a column of the schema of the job results
+type schemaField struct {
+	Name string `json:"name"`
+	Type struct {
+		Name string `json:"name"`
+	} `json:"type"`
+}
+
+// tableExport streams the pages of the results of an export into <name>.ndjson with one row per line,
+// the schema of the first page is written to <name>.schema.json and with parquet enabled the rows are
+// also written to <name>.parquet
+type tableExport struct {
+	dir         string
+	base        string
+	withParquet bool
+
+	file    *os.File
+	ndjson  *bufio.Writer
+	columns []parquet.Column
+	pqFile  *os.File
+	pqBuf   *bufio.Writer
+	pq      *parquet.Writer
+	rows    int
+	// badValues counts the values that did not match the type of their parquet column and were written as null
+	badValues int
+}
+
+func newTableExport(dir, name string, withParquet bool) (*tableExport, error) {
+	t := &tableExport{dir: dir, base: exportFileBase(name), withParquet: withParquet}
+	fileName := filepath.Join(dir, t.base+".ndjson")
+	file, err := os.Create(filepath.Clean(fileName))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create file %v due to error %v", fileName, err)
+	}
+	t.file = file
+	t.ndjson = bufio.NewWriterSize(file, 64*1024)
+	return t, nil
+}
+
+// AddPage writes the rows of a page, only the first limit rows are kept
+func (t *tableExport) AddPage(page restclient.JobResults, limit int) error {
+	if t.columns == nil {
+		if err := t.writeSchema(page.Schema); err != nil {
+			return err
+		}
+	}
+	rows := page.Rows
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	var line bytes.Buffer
+	for _, row := range rows {
+		line.Reset()
+		// the results are indented, every row has to be on its own line
+		if err := json.Compact(&line, row); err != nil {
+			return fmt.Errorf("invalid row in %v due to error %v", t.base, err)
+		}
+		line.WriteByte('\n')
+		if _, err := t.ndjson.Write(line.Bytes()); err != nil {
+			return fmt.Errorf("unable to write %v.ndjson due to error %v", t.base, err)
+		}
+		if t.pq != nil {
+			if err := t.writeParquetRow(row); err != nil {
+				return err
+			}
+		}
+		t.rows++
+	}
+	return nil
+}
+
+// writeSchema stores the schema of the first page and starts the parquet file with its columns
+func (t *tableExport) writeSchema(schema json.RawMessage) error {
+	t.columns = []parquet.Column{}
+	if len(schema) == 0 {
+		simplelog.Warningf("the results of %v have no schema", t.base)
+		return nil
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, schema, "", "  "); err != nil {
+		return fmt.Errorf("invalid schema for %v due to error %v", t.base, err)
+	}
+	schemaFile := filepath.Join(t.dir, t.base+".schema.json")
+	if err := os.WriteFile(filepath.Clean(schemaFile), indented.Bytes(), 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", schemaFile, err)
+	}
+	if !t.withParquet {
+		return nil
+	}
+	return t.startParquet(schema)
+}
+
+// startParquet creates <name>.parquet with the columns of the schema
+func (t *tableExport) startParquet(schema json.RawMessage) error {
+	var fields []schemaField
+	if err := json.Unmarshal(schema, &fields); err != nil {
+		return fmt.Errorf("unable to read the schema of %v due to error %v", t.base, err)
+	}
+	for _, f := range fields {
+		t.columns = append(t.columns, parquet.Column{Name: f.Name, Type: parquetType(f.Type.Name)})
+	}
+	if len(t.columns) == 0 {
+		simplelog.Warningf("the schema of %v has no columns so no parquet file is written", t.base)
+		return nil
+	}
+	pqFileName := filepath.Join(t.dir, t.base+".parquet")
+	pqFile, err := os.Create(filepath.Clean(pqFileName))
+	if err != nil {
+		return fmt.Errorf("unable to create file %v due to error %v", pqFileName, err)
+	}
+	pqBuf := bufio.NewWriterSize(pqFile, 64*1024)
+	pq, err := parquet.NewWriter(pqBuf, t.columns)
+	if err != nil {
+		ddcio.EnsureClose(pqFileName, pqFile.Close)
+		return fmt.Errorf("unable to write %v due to error %v", pqFileName, err)
+	}
+	t.pqFile = pqFile
+	t.pqBuf = pqBuf
+	t.pq = pq
+	return nil
+}
+
+// parquetType maps the sql types of the job results to parquet columns, anything else is kept as text
+func parquetType(sqlType string) parquet.Type {
+	switch strings.ToUpper(sqlType) {
+	case "INTEGER", "INT", "SMALLINT", "TINYINT":
+		return parquet.Int32
+	case "BIGINT":
+		return parquet.Int64
+	case "FLOAT":
+		return parquet.Float
+	case "DOUBLE", "DECIMAL":
+		return parquet.Double
+	case "BOOLEAN":
+		return parquet.Boolean
+	case "TIMESTAMP":
+		return parquet.TimestampMillis
+	case "DATE":
+		return parquet.Date
+	default:
+		return parquet.String
+	}
+}
+
+func (t *tableExport) writeParquetRow(raw json.RawMessage) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var row map[string]any
+	if err := decoder.Decode(&row); err != nil {
+		return fmt.Errorf("invalid row in %v due to error %v", t.base, err)
+	}
+	values := make([]any, len(t.columns))
+	for i, col := range t.columns {
+		v, ok := row[col.Name]
+		if !ok || v == nil {
+			continue
+		}
+		value, err := parquetValue(col.Type, v)
+		if err != nil {
+			t.badValues++
+			continue
+		}
+		values[i] = value
+	}
+	if err := t.pq.Write(values); err != nil {
+		return fmt.Errorf("unable to write %v.parquet due to error %v", t.base, err)
+	}
+	return nil
+}
+
+// timestampLayouts are the formats the job results use for timestamps and dates
+var timestampLayouts = []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano, "2006-01-02"}
+
+// parquetValue converts a value decoded with UseNumber to the go type the parquet column takes
+func parquetValue(t parquet.Type, v any) (any, error) {
+	switch t {
+	case parquet.String:
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+		// lists and structs are kept as their json
+		b, err := json.Marshal(v)
+		return string(b), err
+	case parquet.Int32, parquet.Int64, parquet.Float, parquet.Double:
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a number", v)
+		}
+		switch t {
+		case parquet.Int32:
+			i, err := n.Int64()
+			if err != nil {
+				return nil, err
+			}
+			if i < math.MinInt32 || i > math.MaxInt32 {
+				return nil, fmt.Errorf("%v does not fit in an INTEGER column", i)
+			}
+			return int32(i), nil
+		case parquet.Int64:
+			return n.Int64()
+		case parquet.Float:
+			f, err := n.Float64()
+			return float32(f), err
+		default:
+			return n.Float64()
+		}
+	case parquet.Boolean:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a boolean", v)
+		}
+		return b, nil
+	case parquet.TimestampMillis, parquet.Date:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v is not a timestamp", v)
+		}
+		for _, layout := range timestampLayouts {
+			if ts, err := time.Parse(layout, s); err == nil {
+				return ts, nil
+			}
+		}
+		return nil, fmt.Errorf("%v is not a timestamp", s)
+	}
+	return nil, fmt.Errorf("unsupported column type %v", t)
+}
+
+// Close flushes and closes the ndjson and parquet files
+func (t *tableExport) Close() error {
+	var errs []error
+	if err := t.ndjson.Flush(); err != nil {
+		errs = append(errs, err)
+	}
+	if err := t.file.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, t.closeParquet()...)
+	return errors.Join(errs...)
+}
+
+// RewriteParquet writes <name>.parquet again from <name>.ndjson and <name>.schema.json after the rows of the
+// ndjson file were changed, such as by sql anonymization or redaction, so both files hold the same values.
+// Without a parquet file there is nothing to do, a parquet file that cannot be written again is removed
+// rather than left with the old values
+func RewriteParquet(ndjsonFile string) error {
+	dir := filepath.Dir(ndjsonFile)
+	base := strings.TrimSuffix(filepath.Base(ndjsonFile), ".ndjson")
+	pqFileName := filepath.Join(dir, base+".parquet")
+	if _, err := os.Stat(pqFileName); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := rewriteParquet(dir, base, ndjsonFile); err != nil {
+		if rmErr := os.Remove(pqFileName); rmErr != nil && !os.IsNotExist(rmErr) {
+			return fmt.Errorf("unable to remove %v due to error %v after %w", pqFileName, rmErr, err)
+		}
+		return fmt.Errorf("removed %v as it could not be written again: %w", pqFileName, err)
+	}
+	return nil
+}
+
+func rewriteParquet(dir, base, ndjsonFile string) error {
+	f, err := os.Open(filepath.Clean(ndjsonFile))
+	if err != nil {
+		return err
+	}
+	defer ddcio.EnsureClose(ndjsonFile, f.Close)
+	schema, err := os.ReadFile(filepath.Join(dir, base+".schema.json"))
+	if err != nil {
+		return err
+	}
+	t := &tableExport{dir: dir, base: base, withParquet: true}
+	if err := t.startParquet(schema); err != nil {
+		return err
+	}
+	if t.pq == nil {
+		return fmt.Errorf("the schema of %v has no columns", base)
+	}
+	reader := bufio.NewReaderSize(f, 64*1024)
+	for {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			if err := t.writeParquetRow(line); err != nil {
+				return errors.Join(err, errors.Join(t.closeParquet()...))
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return errors.Join(readErr, errors.Join(t.closeParquet()...))
+		}
+	}
+	return errors.Join(t.closeParquet()...)
+}
+
+// closeParquet finishes the parquet file when there is one
+func (t *tableExport) closeParquet() []error {
+	var errs []error
+	if t.pq != nil {
+		if t.badValues > 0 {
+			simplelog.Warningf("%v values of %v did not match the type of their column and are null in the parquet file", t.badValues, t.base)
+		}
+		if err := t.pq.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := t.pqBuf.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+		if err := t.pqFile.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,233 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// apicollect provides all the methods that collect via the API, this is a substantial part of the activities of DDC so it gets it's own package
+package apicollect
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	pq "github.com/parquet-go/parquet-go"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/parquet"
+)
+
+func TestParquetValue(t *testing.T) {
+	cases := []struct {
+		typ      parquet.Type
+		value    any
+		expected any
+	}{
+		{parquet.String, "abc", "abc"},
+		{parquet.String, []any{"a", json.Number("1")}, `["a",1]`},
+		{parquet.Int32, json.Number("42"), int32(42)},
+		{parquet.Int64, json.Number("1714033458006"), int64(1714033458006)},
+		{parquet.Float, json.Number("1.5"), float32(1.5)},
+		{parquet.Double, json.Number("3.8154000035E9"), 3.8154000035e9},
+		{parquet.Boolean, true, true},
+		{parquet.TimestampMillis, "2024-04-25 08:24:18.006", time.Date(2024, 4, 25, 8, 24, 18, 6000000, time.UTC)},
+		{parquet.Date, "2024-04-25", time.Date(2024, 4, 25, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, c := range cases {
+		actual, err := parquetValue(c.typ, c.value)
+		if err != nil {
+			t.Errorf("unexpected error converting %v: %v", c.value, err)
+			continue
+		}
+		if ts, ok := c.expected.(time.Time); ok {
+			if !ts.Equal(actual.(time.Time)) {
+				t.Errorf("expected %v but was %v", ts, actual)
+			}
+		} else if actual != c.expected {
+			t.Errorf("expected %#v but was %#v", c.expected, actual)
+		}
+	}
+	for _, bad := range []struct {
+		typ   parquet.Type
+		value any
+	}{{parquet.Int64, "1"}, {parquet.Int64, json.Number("1.5")}, {parquet.Int32, json.Number("2147483648")}, {parquet.Int32, json.Number("-2147483649")}, {parquet.Boolean, "true"}, {parquet.TimestampMillis, "yesterday"}} {
+		if _, err := parquetValue(bad.typ, bad.value); err == nil {
+			t.Errorf("expected %v to be rejected for %v", bad.value, bad.typ)
+		}
+	}
+}
+
+func TestTableExportWithoutSchemaOrParquet(t *testing.T) {
+	dir := t.TempDir()
+	out, err := newTableExport(dir, `sys."options"`, false)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	page := restclient.JobResults{RowCount: 3, Rows: []json.RawMessage{
+		json.RawMessage("{\n  \"name\": \"a\"\n}"),
+		json.RawMessage(`{"name": "b"}`),
+		json.RawMessage(`{"name": "c"}`),
+	}}
+	if err := out.AddPage(page, 2); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "sys.options.ndjson"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := "{\"name\":\"a\"}\n{\"name\":\"b\"}\n"; string(b) != expected {
+		t.Errorf("expected %q but was %q", expected, b)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the ndjson without a schema but found %v files", len(entries))
+	}
+}
+
+func TestTableExportParquetCanBeRead(t *testing.T) {
+	dir := t.TempDir()
+	out, err := newTableExport(dir, "sys.jobs_recent", true)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	page := restclient.JobResults{
+		RowCount: 2,
+		Schema:   json.RawMessage(`[{"name":"job_id","type":{"name":"VARCHAR"}},{"name":"rows","type":{"name":"INTEGER"}},{"name":"submitted_ts","type":{"name":"TIMESTAMP"}}]`),
+		Rows: []json.RawMessage{
+			json.RawMessage(`{"job_id":"1","rows":42,"submitted_ts":"2024-04-25 08:24:18.006"}`),
+			json.RawMessage(`{"job_id":"2","rows":2147483648,"submitted_ts":"2024-04-25 08:24:19.000"}`),
+		},
+	}
+	if err := out.AddPage(page, 10); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if out.badValues != 1 {
+		t.Errorf("expected the row count that does not fit an INTEGER to be a bad value but was %v", out.badValues)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rows := readParquet(t, filepath.Join(dir, "sys.jobs_recent.parquet"))
+	expected := []map[string]any{
+		{"job_id": "1", "rows": int32(42), "submitted_ts": time.Date(2024, 4, 25, 8, 24, 18, 6000000, time.UTC).UnixMilli()},
+		{"job_id": "2", "rows": nil, "submitted_ts": time.Date(2024, 4, 25, 8, 24, 19, 0, time.UTC).UnixMilli()},
+	}
+	if !reflect.DeepEqual(expected, rows) {
+		t.Errorf("expected %v but was %v", expected, rows)
+	}
+}
+
+func TestRewriteParquet(t *testing.T) {
+	dir := t.TempDir()
+	out, err := newTableExport(dir, "sys.jobs_recent", true)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	page := restclient.JobResults{
+		RowCount: 1,
+		Schema:   json.RawMessage(`[{"name":"job_id","type":{"name":"VARCHAR"}},{"name":"query","type":{"name":"VARCHAR"}}]`),
+		Rows:     []json.RawMessage{json.RawMessage(`{"job_id":"1","query":"SELECT * FROM t WHERE name = 'bob'"}`)},
+	}
+	if err := out.AddPage(page, 10); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := out.Close(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the ndjson file is changed after the export, e.g. when the sql is anonymized
+	ndjson := filepath.Join(dir, "sys.jobs_recent.ndjson")
+	changed := `{"job_id":"1","query":"SELECT * FROM t WHERE name = '<STRING>'","queryFingerprint":"abc"}` + "\n"
+	if err := os.WriteFile(ndjson, []byte(changed), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := RewriteParquet(ndjson); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rows := readParquet(t, filepath.Join(dir, "sys.jobs_recent.parquet"))
+	expected := []map[string]any{{"job_id": "1", "query": "SELECT * FROM t WHERE name = '<STRING>'"}}
+	if !reflect.DeepEqual(expected, rows) {
+		t.Errorf("expected %v but was %v", expected, rows)
+	}
+
+	// without its schema the parquet file cannot be written again and is removed
+	if err := os.Remove(filepath.Join(dir, "sys.jobs_recent.schema.json")); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := RewriteParquet(ndjson); err == nil {
+		t.Error("expected an error without a schema")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sys.jobs_recent.parquet")); !os.IsNotExist(err) {
+		t.Errorf("expected the parquet file to be removed but was %v", err)
+	}
+	// there is nothing to do without a parquet file
+	if err := RewriteParquet(ndjson); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+// readParquet reads a parquet file with the parquet-go reader, every row is a map of column name to value
+func readParquet(t *testing.T, fileName string) []map[string]any {
+	t.Helper()
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	f, err := pq.OpenFile(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("unable to open %v: %v", fileName, err)
+	}
+	fields := f.Schema().Fields()
+	reader := pq.NewReader(f)
+	defer reader.Close()
+	var rows []map[string]any
+	buf := make([]pq.Row, 1)
+	for {
+		n, err := reader.ReadRows(buf)
+		if n == 1 {
+			row := map[string]any{}
+			for i, v := range buf[0] {
+				var value any
+				switch {
+				case v.IsNull():
+				case v.Kind() == pq.ByteArray:
+					value = string(v.ByteArray())
+				case v.Kind() == pq.Int32:
+					value = v.Int32()
+				case v.Kind() == pq.Int64:
+					value = v.Int64()
+				default:
+					value = v.String()
+				}
+				row[fields[i].Name()] = value
+			}
+			rows = append(rows, row)
+		}
+		if errors.Is(err, io.EOF) {
+			return rows
+		}
+		if err != nil {
+			t.Fatalf("unable to read %v: %v", fileName, err)
+		}
+	}
+}
@@ -22,8 +22,6 @@ import (
 	"path/filepath"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
-	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
-	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
@@ -36,63 +34,30 @@ func RunCollectWLM(c *conf.CollectConf) error {
 		return errors.New("config pointer is nil")
 	}
 
-	// Define the API objects (queues and rules) to be fetched
-	var apiobjects [][]string
-	if !c.IsDremioCloud() {
-		apiobjects = [][]string{
-			{"/api/v3/wlm/queue", "queues.json"},
-			{"/api/v3/wlm/rule", "rules.json"},
-			{"/apiv2/provision/clusters", "awse_engines.json"},
-		}
-	} else {
-		apiobjects = [][]string{
-			{"/v0/projects/" + c.DremioCloudProjectID() + "/engines", "engines.json"},
-			{"/v0/projects/" + c.DremioCloudProjectID() + "/rules", "rules.json"},
-		}
-	}
+	// Fetch the API objects, queues and rules or engines and rules on Dremio Cloud
+	apiobjects, err := c.DremioClient().WLM()
 
-	// Iterate over each API object
+	// Write the objects fetched before a failed request too
 	for _, apiobject := range apiobjects {
-		apipath := apiobject[0]
-		filename := apiobject[1]
-
-		// Create the URL for the API request
-		url := c.DremioEndpoint() + apipath
-		headers := map[string]string{"Content-Type": "application/json"}
-
-		// Make a GET request to the respective API endpoint
-		body, err := restclient.APIRequest(url, c.DremioPATToken(), "GET", headers)
-
-		// Log and return if there was an error with the API request
-		if err != nil {
-			return fmt.Errorf("unable to retrieve WLM from %s due to error %v", url, err)
-		}
+		filename := apiobject.Name + ".json"
 
 		// Prepare the output directory and filename
-		sb := string(body)
 		wlmFile := filepath.Join(c.WLMOutDir(), filename)
 
-		// Create a new file in the output directory
-		file, err := os.Create(filepath.Clean(wlmFile))
-		// Log and return if there was an error with file creation
-		if err != nil {
-			return fmt.Errorf("unable to create file %s due to error %v", filename, err)
-		}
-
-		defer ddcio.EnsureClose(filepath.Clean(wlmFile), file.Close)
-
-		// Write the API response into the newly created file
-		_, err = fmt.Fprint(file, sb)
-
-		// Log and return if there was an error with writing to the file
-		if err != nil {
-			return fmt.Errorf("unable to write to file %s due to error %v", filename, err)
+		// Write the API response into a new file in the output directory
+		if writeErr := os.WriteFile(filepath.Clean(wlmFile), apiobject.Body, 0600); writeErr != nil {
+			return fmt.Errorf("unable to write to file %s due to error %v", filename, writeErr)
 		}
 
 		// Log a success message upon successful creation of the file
 		simplelog.Debugf("SUCCESS - Created " + filename)
 	}
 
+	// Log and return if there was an error with the API request
+	if err != nil {
+		return fmt.Errorf("unable to retrieve WLM due to error %v", err)
+	}
+
 	// Return nil if the entire operation completes successfully
 	return nil
 }
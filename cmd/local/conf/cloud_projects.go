@@ -0,0 +1,86 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// AllCloudProjects in dremio-cloud-project-ids collects every project the PAT can see
+const AllCloudProjects = "all"
+
+// cloudProjectID keeps the ids safe to use as folder names
+var cloudProjectID = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+
+// GetCloudProjectIDs reads dremio-cloud-project-ids, a yaml list or the comma separated string of the
+// command line flag
+func GetCloudProjectIDs(confData map[string]interface{}) ([]string, error) {
+	var values []string
+	switch v := confData[KeyDremioCloudProjectIDs].(type) {
+	case nil:
+	case string:
+		values = strings.Split(v, ",")
+	case []interface{}:
+		for _, id := range v {
+			values = append(values, fmt.Sprint(id))
+		}
+	default:
+		return nil, fmt.Errorf("%v must be a list of project ids or %v", KeyDremioCloudProjectIDs, AllCloudProjects)
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range values {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		if !cloudProjectID.MatchString(id) {
+			return nil, fmt.Errorf("%v has an invalid project id '%v'", KeyDremioCloudProjectIDs, id)
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	if seen[AllCloudProjects] && len(ids) > 1 {
+		return nil, fmt.Errorf("%v is either %v or a list of project ids", KeyDremioCloudProjectIDs, AllCloudProjects)
+	}
+	return ids, nil
+}
+
+// DremioCloudProjectIDs are the projects of dremio-cloud-project-ids, AllCloudProjects alone means every project
+func (c *CollectConf) DremioCloudProjectIDs() []string {
+	return c.dremioCloudProjectIDs
+}
+
+// CollectsCloudProjects is true when the projects of dremio-cloud-project-ids are collected instead of the
+// single dremio-cloud-project-id
+func (c *CollectConf) CollectsCloudProjects() bool {
+	return c.isDremioCloud && len(c.dremioCloudProjectIDs) > 0
+}
+
+// ForCloudProject is a copy of the configuration that exports the queries of exports from another project
+// of the organization, the files of the project go to folders named dirName instead of the node name
+func (c *CollectConf) ForCloudProject(projectID, dirName string, exports []SQLExport) *CollectConf {
+	p := *c
+	p.dremioCloudProjectID = projectID
+	p.dremioCloudProjectIDs = nil
+	p.nodeName = dirName
+	p.sqlExports = exports
+	if c.dremioClient != nil {
+		p.dremioClient = c.dremioClient.ForProject(projectID)
+	}
+	return &p
+}
@@ -0,0 +1,63 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+)
+
+func TestGetCloudProjectIDs(t *testing.T) {
+	tests := []struct {
+		confData map[string]interface{}
+		expected []string
+	}{
+		{map[string]interface{}{}, nil},
+		{parseSelectors(t, "dremio-cloud-project-ids: [p1, p2, p1]\n"), []string{"p1", "p2"}},
+		{parseSelectors(t, "dremio-cloud-project-ids: [all]\n"), []string{"all"}},
+		// the command line flag is comma separated
+		{map[string]interface{}{conf.KeyDremioCloudProjectIDs: "p1, p2,"}, []string{"p1", "p2"}},
+		{map[string]interface{}{conf.KeyDremioCloudProjectIDs: "all"}, []string{"all"}},
+	}
+	for _, tt := range tests {
+		ids, err := conf.GetCloudProjectIDs(tt.confData)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if !reflect.DeepEqual(tt.expected, ids) {
+			t.Errorf("expected %v for %v but was %v", tt.expected, tt.confData, ids)
+		}
+	}
+}
+
+func TestGetCloudProjectIDsInvalid(t *testing.T) {
+	tests := []struct {
+		doc      string
+		expected string
+	}{
+		{"dremio-cloud-project-ids: [all, p1]\n", "either all or a list"},
+		{"dremio-cloud-project-ids: [../p1]\n", "invalid project id"},
+		{"dremio-cloud-project-ids: {p1: true}\n", "must be a list"},
+	}
+	for _, tt := range tests {
+		_, err := conf.GetCloudProjectIDs(parseSelectors(t, tt.doc))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected an error containing '%v' for %q but was %v", tt.expected, tt.doc, err)
+		}
+	}
+}
@@ -16,10 +16,10 @@
 package conf
 
 import (
-	"bufio"
 	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -29,11 +29,15 @@ import (
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf/autodetect"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/queriesjson"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/collects"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/dirs"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/hocon"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/redaction"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/timewindow"
 	"github.com/google/uuid"
 	"github.com/spf13/cast"
 )
@@ -45,6 +49,14 @@ func GetString(confData map[string]interface{}, key string) string {
 	return ""
 }
 
+// getTimeString is GetString for time values, yaml decodes an unquoted timestamp into a time.Time
+func getTimeString(confData map[string]interface{}, key string) string {
+	if t, ok := confData[key].(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return GetString(confData, key)
+}
+
 func GetInt(confData map[string]interface{}, key string) int {
 	if v, ok := confData[key]; ok {
 		return cast.ToInt(v)
@@ -64,6 +76,81 @@ func SanitiseURL(url string) string {
 	return strings.TrimSuffix(url, "/")
 }
 
+// restNetworkConfig reads the tls and proxy settings of the rest api
+func restNetworkConfig(confData map[string]interface{}) restclient.Config {
+	return restclient.Config{
+		Endpoint:         GetString(confData, KeyDremioEndpoint),
+		AllowInsecureSSL: GetBool(confData, KeyAllowInsecureSSL),
+		CAFile:           GetString(confData, KeyDremioCAFile),
+		ClientCertFile:   GetString(confData, KeyDremioClientCertFile),
+		ClientKeyFile:    GetString(confData, KeyDremioClientKeyFile),
+		ProxyURL:         GetString(confData, KeyRestHTTPSProxy),
+		NoProxy:          GetString(confData, KeyRestNoProxy),
+	}
+}
+
+// TLSMode is how the rest api calls of a ddc.yaml with its defaults set check the certificate of the dremio-endpoint
+func TLSMode(confData map[string]interface{}) string {
+	return restNetworkConfig(confData).TLSMode()
+}
+
+// nodeCollectionKeys are the collections that read the files, processes and os of a dremio node
+var nodeCollectionKeys = []string{
+	KeyCollectAccelerationLog,
+	KeyCollectAccessLog,
+	KeyCollectAuditLog,
+	KeyCollectDremioConfiguration,
+	KeyCollectDiskUsage,
+	KeyCollectGCLogs,
+	KeyCollectJFR,
+	KeyCollectJStack,
+	KeyCollectJVMFlags,
+	KeyCollectMetaRefreshLog,
+	KeyCollectOSConfig,
+	KeyCollectQueriesJSON,
+	KeyCollectReflectionLog,
+	KeyCollectServerLogs,
+	KeyCollectTtop,
+	KeyCaptureHeapDump,
+}
+
+// IsSecretKey is true for the keys whose values are never logged, the proxy url can hold a user and password
+func IsSecretKey(key string) bool {
+	return key == KeyDremioPatToken || key == KeyDremioPassword || key == KeyRestHTTPSProxy
+}
+
+// ReadStdIn reads the password or the PAT piped to standard in, key is KeyDremioPassword or
+// KeyDremioPatToken. Only the trailing new line is removed from a password, spaces are valid in a password
+func ReadStdIn(stdin io.Reader, key string) (string, error) {
+	b, err := io.ReadAll(stdin)
+	if err != nil {
+		return "", fmt.Errorf("unable to read %v from standard in due to error %v", key, err)
+	}
+	if key == KeyDremioPassword {
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// StdInPiped is true when something was piped to standard in, without a flag asking for a password it is a PAT
+func StdInPiped() (bool, error) {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false, err
+	}
+	return fi.Size() > 0, nil
+}
+
+// ReadPasswordFile reads the password from the first line of a file
+func ReadPasswordFile(passwordFile string) (string, error) {
+	b, err := os.ReadFile(filepath.Clean(passwordFile))
+	if err != nil {
+		return "", fmt.Errorf("unable to read %v due to error %v", KeyDremioPasswordFile, err)
+	}
+	password, _, _ := strings.Cut(string(b), "\n")
+	return strings.TrimSuffix(password, "\r"), nil
+}
+
 type CollectConf struct {
 	// flags that are configurable by env or configuration
 	disableFreeSpaceCheck      bool
@@ -75,6 +162,7 @@ type CollectConf struct {
 	dremioEndpoint             string
 	dremioUsername             string
 	dremioPATToken             string
+	dremioPassword             string
 	dremioRocksDBDir           string
 	numberJobProfilesToCollect int
 	dremioPIDDetection         bool
@@ -84,7 +172,9 @@ type CollectConf struct {
 	collectJVMFlags            bool
 	captureHeapDump            bool
 	isDremioCloud              bool
+	apiOnly                    bool
 	dremioCloudProjectID       string
+	dremioCloudProjectIDs      []string
 	dremioCloudAppEndpoint     string
 
 	// advanced variables settable by configuration or environment variable
@@ -102,10 +192,16 @@ type CollectConf struct {
 	jobProfilesNumHighQueryCost int
 	jobProfilesNumSlowPlanning  int
 	jobProfilesNumRecentErrors  int
+	jobProfileSelectors         []queriesjson.SelectorConfig
+	jobProfilesSampling         string
+	jobProfilesSamplingBucket   time.Duration
+	window                      timewindow.Window
 	allowInsecureSSL            bool
+	restNetwork                 restclient.Config
 	collectJFR                  bool
 	collectJStack               bool
 	collectKVStoreReport        bool
+	collectCatalog              bool
 	collectServerLogs           bool
 	collectMetaRefreshLogs      bool
 	collectQueriesJSON          bool
@@ -120,45 +216,43 @@ type CollectConf struct {
 	collectWLM                  bool
 	nodeName                    string
 	restHTTPTimeout             int
+	restHTTPRetries             int
 	minFreeSpaceCheckGB         int
+	compressionThreads          int
 
 	// variables
-	systemtables            []string
-	systemtablesdremiocloud []string
-	dremioPID               int
+	systemtables               []string
+	systemtablesdremiocloud    []string
+	sqlExports                 []SQLExport
+	systemTablesExportThreads  int
+	systemTablesParquet        bool
+	dremioPID                  int
+	dremioHome                 string
+	redactionRules             []redaction.Rule
+	anonymizeSQL               bool
+	anonymizeSQLHashTableNames bool
+	dremioClient               restclient.Client
 }
 
 func ValidateAPICredentials(c *CollectConf) error {
 	simplelog.Debugf("Validating REST API user credentials...")
-	var url string
-	if !c.IsDremioCloud() {
-		url = c.DremioEndpoint() + "/apiv2/login"
-	} else {
-		url = c.DremioEndpoint() + "/v0/projects/" + c.DremioCloudProjectID()
-	}
-	headers := map[string]string{"Content-Type": "application/json"}
-	_, err := restclient.APIRequest(url, c.DremioPATToken(), "GET", headers)
-	return err
+	return c.DremioClient().ValidateCredentials()
 }
 
 func DetectRocksDB(dremioHome string, dremioConfDir string) string {
 	dremioConfFile := filepath.Join(dremioConfDir, "dremio.conf")
-	content, err := os.ReadFile(filepath.Clean(dremioConfFile))
+	confValues, err := resolveDremioConf(dremioConfFile, dremioHome)
 	if err != nil {
 		simplelog.Errorf("configuration directory incorrect : %v", err)
 	}
-	confValues, err := parseAndResolveConfig(string(content), dremioHome)
-	if err != nil {
-		simplelog.Errorf("configuration directory incorrect : %v", err)
+	//searching rocksdb, dremio defaults paths.db to ${paths.local}/db and paths.local to ${DREMIO_HOME}/data
+	if value, ok := hocon.Lookup(confValues, "paths.db"); ok {
+		return fmt.Sprint(value)
 	}
-	//searching rocksdb
-	var rocksDBDir string
-	if value, ok := confValues["db"]; ok {
-		rocksDBDir = value
-	} else {
-		rocksDBDir = filepath.Join(dremioHome, "data", "db")
+	if value, ok := hocon.Lookup(confValues, "paths.local"); ok {
+		return filepath.Join(fmt.Sprint(value), "db")
 	}
-	return rocksDBDir
+	return filepath.Join(dremioHome, "data", "db")
 }
 
 func SystemTableList() []string {
@@ -193,7 +287,7 @@ func SystemTableList() []string {
 
 func LogConfData(confData map[string]string) {
 	for k, v := range confData {
-		if k == KeyDremioPatToken && v != "" {
+		if IsSecretKey(k) && v != "" {
 			simplelog.Debugf("conf key '%v':'REDACTED'", k)
 		} else {
 			simplelog.Debugf("conf key '%v':'%v'", k, v)
@@ -214,6 +308,13 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 	}
 
 	SetViperDefaults(confData, hostName, defaultCaptureSeconds, collectionMode)
+	if GetBool(confData, KeyAPIOnly) {
+		// ddc api-collect runs away from the cluster, there is no dremio process, log or configuration to read
+		for _, key := range nodeCollectionKeys {
+			confData[key] = false
+		}
+		confData[KeyDremioPidDetection] = false
+	}
 	c := &CollectConf{}
 	c.systemtables = SystemTableList()
 	c.systemtablesdremiocloud = []string{
@@ -230,12 +331,12 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 		"project.reflections",
 		"project.\\\"tables\\\"",
 		"project.views",
-		// "project.history.events",
+		"project.history.events",
 		"project.history.jobs",
 	}
 
 	for k, v := range confData {
-		if k == KeyDremioPatToken && v != "" {
+		if IsSecretKey(k) && v != "" {
 			simplelog.Debugf("conf key '%v':'REDACTED'", k)
 		} else {
 			simplelog.Debugf("conf key '%v':'%v'", k, v)
@@ -248,8 +349,16 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 	// simplelog.InitLogger(verbose)
 	// we use dremio cloud option here to know if we should validate the log and conf dirs or not
 	c.isDremioCloud = GetBool(confData, KeyIsDremioCloud)
+	c.apiOnly = GetBool(confData, KeyAPIOnly)
 	c.dremioPIDDetection = GetBool(confData, KeyDremioPidDetection)
 	c.dremioCloudProjectID = GetString(confData, KeyDremioCloudProjectID)
+	c.dremioCloudProjectIDs, err = GetCloudProjectIDs(confData)
+	if err != nil {
+		return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v", err)
+	}
+	if len(c.dremioCloudProjectIDs) > 0 && !c.isDremioCloud {
+		return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v is only used with %v", KeyDremioCloudProjectIDs, KeyIsDremioCloud)
+	}
 	c.collectAccelerationLogs = GetBool(confData, KeyCollectAccelerationLog)
 	c.collectAccessLogs = GetBool(confData, KeyCollectAccessLog)
 	c.collectAuditLogs = GetBool(confData, KeyCollectAuditLog)
@@ -295,6 +404,17 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 		c.outputDir = filepath.Join(c.tarballOutDir, getOutputDir(time.Now()))
 	}
 
+	c.window, err = timewindow.Parse(getTimeString(confData, KeySince), getTimeString(confData, KeyUntil))
+	if err != nil {
+		return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v", err)
+	}
+	if c.window.IsSet() {
+		simplelog.Infof("limiting the collection to %v", c.window)
+	}
+	c.redactionRules, err = GetRedactionRules(confData)
+	if err != nil {
+		return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v", err)
+	}
 	c.dremioLogsNumDays = GetInt(confData, KeyDremioLogsNumDays)
 	c.dremioQueriesJSONNumDays = GetInt(confData, KeyDremioQueriesJSONNumDays)
 	c.dremioGCFilePattern = GetString(confData, KeyDremioGCFilePattern)
@@ -306,11 +426,21 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 	c.dremioUsername = GetString(confData, KeyDremioUsername)
 	c.disableFreeSpaceCheck = GetBool(confData, KeyDisableFreeSpaceCheck)
 	c.minFreeSpaceCheckGB = GetInt(confData, KeyMinFreeSpaceGB)
+	c.compressionThreads = GetInt(confData, KeyCompressionThreads)
+	c.anonymizeSQL = GetBool(confData, KeyAnonymizeSQL)
+	c.anonymizeSQLHashTableNames = GetBool(confData, KeyAnonymizeSQLHashTableNames)
 	c.disableRESTAPI = GetBool(confData, KeyDisableRESTAPI)
 
 	c.dremioPATToken = GetString(confData, KeyDremioPatToken)
-	if c.dremioPATToken == "" && collectionMode == collects.HealthCheckCollection && !c.disableRESTAPI {
-		return &CollectConf{}, errors.New("INVALID CONFIGURATION: the pat is not set and --collect health-check mode requires one")
+	c.dremioPassword = GetString(confData, KeyDremioPassword)
+	if passwordFile := GetString(confData, KeyDremioPasswordFile); !c.disableRESTAPI && c.dremioPATToken == "" && c.dremioPassword == "" && passwordFile != "" {
+		c.dremioPassword, err = ReadPasswordFile(passwordFile)
+		if err != nil {
+			return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v", err)
+		}
+	}
+	if !c.HasRESTCredentials() && collectionMode == collects.HealthCheckCollection && !c.disableRESTAPI {
+		return &CollectConf{}, errors.New("INVALID CONFIGURATION: neither the pat nor a password is set and --collect health-check mode requires one")
 	}
 	c.collectDremioConfiguration = GetBool(confData, KeyCollectDremioConfiguration)
 	c.numberJobProfilesToCollect = GetInt(confData, KeyNumberJobProfiles)
@@ -359,8 +489,8 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 	c.collectJFR = GetBool(confData, KeyCollectJFR) && dremioPIDIsValid
 	c.collectJStack = GetBool(confData, KeyCollectJStack) && dremioPIDIsValid
 
-	//we do not want to validate configuration of logs for dremio cloud
-	if !c.isDremioCloud {
+	//we do not want to validate configuration of logs for dremio cloud or a collection that only calls the rest api
+	if !c.isDremioCloud && !c.apiOnly {
 		var detectedConfig DremioConfig
 		capturesATypeOfLog := c.collectServerLogs || c.collectAccelerationLogs || c.collectAccessLogs || c.collectAuditLogs || c.collectMetaRefreshLogs || c.collectReflectionLogs
 		if capturesATypeOfLog {
@@ -376,6 +506,7 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 					simplelog.Infof("configured values retrieved from ps output: %v:%v, %v:%v", KeyDremioLogDir, detectedConfig.LogDir, KeyCollectDremioConfiguration, detectedConfig.ConfDir)
 					c.dremioLogDir = detectedConfig.LogDir
 					c.dremioConfDir = detectedConfig.ConfDir
+					c.dremioHome = detectedConfig.Home
 				}
 			} else {
 				consoleprint.ErrorPrint("AUTODETECTION DISABLED: will rely on ddc.yaml configuration as the ddc user does not have permissions to the dremio process consider using --sudo-user to resolve this")
@@ -478,8 +609,14 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 
 	c.dremioEndpoint = GetString(confData, KeyDremioEndpoint)
 	if c.isDremioCloud {
-		if len(c.dremioCloudProjectID) != 36 {
-			simplelog.Warningf("dremio cloud project id is expected to have 36 characters - the following provided id may be incorrect: %v", c.dremioCloudProjectID)
+		projectIDs := c.dremioCloudProjectIDs
+		if len(projectIDs) == 0 {
+			projectIDs = []string{c.dremioCloudProjectID}
+		}
+		for _, projectID := range projectIDs {
+			if projectID != AllCloudProjects && len(projectID) != 36 {
+				simplelog.Warningf("dremio cloud project id is expected to have 36 characters - the following provided id may be incorrect: %v", projectID)
+			}
 		}
 		if strings.Contains(c.dremioEndpoint, "eu.dremio.cloud") {
 			c.dremioEndpoint = "https://api.eu.dremio.cloud"
@@ -493,20 +630,28 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 	}
 
 	c.allowInsecureSSL = GetBool(confData, KeyAllowInsecureSSL)
+	c.restNetwork = restNetworkConfig(confData)
+	c.restNetwork.Endpoint = c.dremioEndpoint
 	c.restHTTPTimeout = GetInt(confData, KeyRestHTTPTimeout)
+	c.restHTTPRetries = GetInt(confData, KeyRestHTTPRetries)
 	// collect rest apis
-	disableRESTAPI := c.disableRESTAPI || c.dremioPATToken == ""
+	disableRESTAPI := c.disableRESTAPI || !c.HasRESTCredentials()
+	if disableRESTAPI && c.apiOnly {
+		return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v needs the rest api enabled and either the pat or a password set", KeyAPIOnly)
+	}
 	if disableRESTAPI {
-		simplelog.Debugf("disabling all Workload Manager, System Table, KV Store, and Job Profile collection since the --dremio-pat-token is not set")
+		simplelog.Debugf("disabling all Workload Manager, System Table, KV Store, and Job Profile collection since neither the --dremio-pat-token nor a password is set")
 		c.numberJobProfilesToCollect = 0
 		c.jobProfilesNumHighQueryCost = 0
 		c.jobProfilesNumSlowExec = 0
 		c.jobProfilesNumRecentErrors = 0
 		c.jobProfilesNumSlowPlanning = 0
+		c.jobProfileSelectors = nil
 		c.collectWLM = false
 		c.collectSystemTablesExport = false
 		c.systemTablesRowLimit = 0
 		c.collectKVStoreReport = false
+		c.collectCatalog = false
 	} else {
 		numberJobProfilesToCollect, jobProfilesNumHighQueryCost, jobProfilesNumSlowExec, jobProfilesNumRecentErrors, jobProfilesNumSlowPlanning := CalculateJobProfileSettingsWithViperConfig(c)
 		c.numberJobProfilesToCollect = numberJobProfilesToCollect
@@ -514,11 +659,65 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 		c.jobProfilesNumSlowExec = jobProfilesNumSlowExec
 		c.jobProfilesNumRecentErrors = jobProfilesNumRecentErrors
 		c.jobProfilesNumSlowPlanning = jobProfilesNumSlowPlanning
+		jobProfileSelectors, err := GetJobProfileSelectors(confData)
+		if err != nil {
+			return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v", err)
+		}
+		c.jobProfileSelectors = jobProfileSelectors
+		c.jobProfilesSampling = GetString(confData, KeyJobProfilesSampling)
+		if c.jobProfilesSampling != queriesjson.SamplingGlobal && c.jobProfilesSampling != queriesjson.SamplingStratified {
+			return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v must be %v or %v but was '%v'", KeyJobProfilesSampling, queriesjson.SamplingGlobal, queriesjson.SamplingStratified, c.jobProfilesSampling)
+		}
+		switch bucket := GetString(confData, KeyJobProfilesSamplingBucket); bucket {
+		case "hour":
+			c.jobProfilesSamplingBucket = time.Hour
+		case "day":
+			c.jobProfilesSamplingBucket = 24 * time.Hour
+		default:
+			return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v must be hour or day but was '%v'", KeyJobProfilesSamplingBucket, bucket)
+		}
 		c.collectWLM = GetBool(confData, KeyCollectWLM)
 		c.collectSystemTablesExport = GetBool(confData, KeyCollectSystemTablesExport)
 		c.systemTablesRowLimit = GetInt(confData, KeySystemTablesRowLimit)
+		defaultTables := c.systemtables
+		if c.isDremioCloud {
+			defaultTables = c.systemtablesdremiocloud
+		}
+		c.sqlExports, err = GetSQLExports(confData, defaultTables, c.systemTablesRowLimit)
+		if err != nil {
+			return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v", err)
+		}
+		if c.apiOnly && c.CollectJobProfiles() && (!c.collectSystemTablesExport || !c.exportsJobHistory()) {
+			simplelog.Warningf("without a node to read queries.json from, job profiles are picked from sys.jobs_recent, which is not exported, so no job profiles will be collected")
+		}
+		c.systemTablesExportThreads = GetInt(confData, KeySystemTablesExportThreads)
+		if c.systemTablesExportThreads < 1 {
+			return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v must be at least 1 but was %v", KeySystemTablesExportThreads, c.systemTablesExportThreads)
+		}
+		c.systemTablesParquet = GetBool(confData, KeySystemTablesParquet)
 		c.collectKVStoreReport = GetBool(confData, KeyCollectKVStoreReport)
-		restclient.InitClient(c.allowInsecureSSL, c.restHTTPTimeout)
+		c.collectCatalog = GetBool(confData, KeyCollectCatalog)
+		c.dremioClient, err = restclient.NewClient(restclient.Config{
+			Endpoint:         c.dremioEndpoint,
+			AppEndpoint:      c.dremioCloudAppEndpoint,
+			IsCloud:          c.isDremioCloud,
+			ProjectID:        c.dremioCloudProjectID,
+			Token:            c.dremioPATToken,
+			Username:         c.dremioUsername,
+			Password:         c.dremioPassword,
+			AllowInsecureSSL: c.allowInsecureSSL,
+			CAFile:           c.restNetwork.CAFile,
+			ClientCertFile:   c.restNetwork.ClientCertFile,
+			ClientKeyFile:    c.restNetwork.ClientKeyFile,
+			ProxyURL:         c.restNetwork.ProxyURL,
+			NoProxy:          c.restNetwork.NoProxy,
+			Timeout:          time.Duration(c.restHTTPTimeout) * time.Second,
+			Retries:          c.restHTTPRetries,
+		})
+		if err != nil {
+			return &CollectConf{}, fmt.Errorf("INVALID CONFIGURATION: %v", err)
+		}
+		simplelog.Debugf("rest api tls mode: %v", c.TLSMode())
 		//validate rest api configuration
 		if err := ValidateAPICredentials(c); err != nil {
 			return &CollectConf{}, fmt.Errorf("CRITICAL ERROR invalid Dremio API configuration: (url: %v, user: %v) %v", c.dremioEndpoint, c.dremioUsername, err)
@@ -545,50 +744,20 @@ func ReadConf(overrides map[string]string, ddcYamlLoc, collectionMode string) (*
 	return c, nil
 }
 
-// parseAndResolveConfig parses the dremio.conf content and resolves placeholders based on the provided DREMIO_HOME.
-func parseAndResolveConfig(confContent, dremioHome string) (map[string]string, error) {
-	scanner := bufio.NewScanner(strings.NewReader(confContent))
-	config := make(map[string]string)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		// Replace DREMIO_HOME placeholder
-
-		line = strings.ReplaceAll(line, "${DREMIO_HOME}", dremioHome)
-		trimmedLine := strings.TrimSpace(line)
-
-		// Skip empty lines and comments
-		if trimmedLine == "" || strings.HasPrefix(trimmedLine, "#") {
-			continue
-		}
-
-		parts := strings.SplitN(trimmedLine, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-
-		key := strings.TrimSpace(parts[0])
-		value := strings.Trim(parts[1], " ,\"'")
-
-		// Store in map
-		config[key] = value
-	}
-
-	if err := scanner.Err(); err != nil {
+// resolveDremioConf reads dremio.conf with its includes and substitutions resolved, DREMIO_HOME is set to dremioHome
+func resolveDremioConf(dremioConfFile, dremioHome string) (map[string]interface{}, error) {
+	doc, err := hocon.ParseFile(dremioConfFile)
+	if err != nil {
 		return nil, err
 	}
-	local := ""
-	for key, value := range config {
-		if strings.Contains("local", key) || strings.Contains("path.local", key) {
-			local = value
-			break
-		}
+	confValues, unresolved, err := doc.Resolve(map[string]string{"DREMIO_HOME": dremioHome})
+	if err != nil {
+		return nil, err
 	}
-	for key, value := range config {
-		config[key] = strings.ReplaceAll(value, "${paths.local}", local)
+	if len(unresolved) > 0 {
+		simplelog.Warningf("unable to resolve %v in %v", strings.Join(unresolved, ", "), dremioConfFile)
 	}
-
-	return config, nil
+	return confValues, nil
 }
 
 // DremioConfig represents the configuration details for Dremio.
@@ -735,6 +904,11 @@ func (c *CollectConf) CollectKVStoreReport() bool {
 	return c.collectKVStoreReport
 }
 
+// CollectCatalog is true when the sources, spaces and home folders of the catalog are inventoried
+func (c *CollectConf) CollectCatalog() bool {
+	return c.collectCatalog
+}
+
 func (c *CollectConf) Systemtables() []string {
 	return c.systemtables
 }
@@ -743,6 +917,21 @@ func (c *CollectConf) SystemtablesDremioCloud() []string {
 	return c.systemtablesdremiocloud
 }
 
+// SQLExports are the system tables and custom queries to export, nil when the rest api is disabled
+func (c *CollectConf) SQLExports() []SQLExport {
+	return c.sqlExports
+}
+
+// SystemTablesExportThreads is the number of system table queries submitted at the same time
+func (c *CollectConf) SystemTablesExportThreads() int {
+	return c.systemTablesExportThreads
+}
+
+// SystemTablesParquet writes a parquet file next to the ndjson of each system table
+func (c *CollectConf) SystemTablesParquet() bool {
+	return c.systemTablesParquet
+}
+
 func (c *CollectConf) CollectServerLogs() bool {
 	return c.collectServerLogs
 }
@@ -802,6 +991,10 @@ func (c *CollectConf) ClusterStatsOutDir() string {
 
 func (c *CollectConf) WLMOutDir() string { return filepath.Join(c.outputDir, "wlm", c.nodeName) }
 
+func (c *CollectConf) CatalogOutDir() string {
+	return filepath.Join(c.outputDir, "catalog", c.nodeName)
+}
+
 // works on all nodes but includes node name in file name
 func (c *CollectConf) JFROutDir() string { return filepath.Join(c.outputDir, "jfr") }
 
@@ -828,10 +1021,25 @@ func (c *CollectConf) DremioPATToken() string {
 	return c.dremioPATToken
 }
 
+// HasRESTCredentials is true when there is a personal access token or a password to log in with
+func (c *CollectConf) HasRESTCredentials() bool {
+	return c.dremioPATToken != "" || c.dremioPassword != ""
+}
+
+// UsesPasswordLogin is true when the REST api is called with a session of dremio-username instead of a PAT
+func (c *CollectConf) UsesPasswordLogin() bool {
+	return c.dremioPATToken == "" && c.dremioPassword != ""
+}
+
 func (c *CollectConf) IsDremioCloud() bool {
 	return c.isDremioCloud
 }
 
+// APIOnly is true when only the rest api of a remote dremio-endpoint is collected, as ddc api-collect does
+func (c *CollectConf) APIOnly() bool {
+	return c.apiOnly
+}
+
 func (c *CollectConf) DremioCloudProjectID() string {
 	return c.dremioCloudProjectID
 }
@@ -872,6 +1080,29 @@ func (c *CollectConf) JobProfilesNumRecentErrors() int {
 	return c.jobProfilesNumRecentErrors
 }
 
+func (c *CollectConf) JobProfileSelectors() []queriesjson.SelectorConfig {
+	return c.jobProfileSelectors
+}
+
+// Window is the --since and --until range, when set it replaces the day counts for logs and queries
+func (c *CollectConf) Window() timewindow.Window {
+	return c.window
+}
+
+func (c *CollectConf) JobProfilesSampling() string {
+	return c.jobProfilesSampling
+}
+
+func (c *CollectConf) JobProfilesSamplingBucket() time.Duration {
+	return c.jobProfilesSamplingBucket
+}
+
+// CollectJobProfiles is true when any job profile is going to be picked, either by number-job-profiles
+// or by one of the job-profile-selectors
+func (c *CollectConf) CollectJobProfiles() bool {
+	return c.numberJobProfilesToCollect > 0 || len(c.jobProfileSelectors) > 0
+}
+
 func (c *CollectConf) DremioPID() int {
 	return c.dremioPID
 }
@@ -880,6 +1111,26 @@ func (c *CollectConf) DremioPIDDetection() bool {
 	return c.dremioPIDDetection
 }
 
+// AnonymizeSQL replaces the literals of the sql in queries.json and the job profiles before archiving
+func (c *CollectConf) AnonymizeSQL() bool {
+	return c.anonymizeSQL
+}
+
+// AnonymizeSQLHashTableNames also replaces the table names of the anonymized sql with hashes
+func (c *CollectConf) AnonymizeSQLHashTableNames() bool {
+	return c.anonymizeSQLHashTableNames
+}
+
+// RedactionRules are applied to every collected file before it is archived
+func (c *CollectConf) RedactionRules() []redaction.Rule {
+	return c.redactionRules
+}
+
+// DremioHome is the DREMIO_HOME of the dremio process, empty when it was not detected
+func (c *CollectConf) DremioHome() string {
+	return c.dremioHome
+}
+
 func (c *CollectConf) DremioConfDir() string {
 	return c.dremioConfDir
 }
@@ -928,6 +1179,25 @@ func (c *CollectConf) RestHTTPTimeout() int {
 	return c.restHTTPTimeout
 }
 
+func (c *CollectConf) RestHTTPRetries() int {
+	return c.restHTTPRetries
+}
+
+// TLSMode is how the rest api calls check the certificate of the dremio-endpoint, see restclient.Config.TLSMode
+func (c *CollectConf) TLSMode() string {
+	return c.restNetwork.TLSMode()
+}
+
+// DremioClient is the client of the REST api, it is only set when the REST api collection is enabled
+func (c *CollectConf) DremioClient() restclient.Client {
+	return c.dremioClient
+}
+
+// SetDremioClient replaces the client of the REST api, tests use it to collect from a fake api
+func (c *CollectConf) SetDremioClient(client restclient.Client) {
+	c.dremioClient = client
+}
+
 func (c *CollectConf) DremioRocksDBDir() string {
 	return c.dremioRocksDBDir
 }
@@ -935,3 +1205,7 @@ func (c *CollectConf) DremioRocksDBDir() string {
 func (c *CollectConf) MinFreeSpaceGB() int {
 	return c.minFreeSpaceCheckGB
 }
+
+func (c *CollectConf) CompressionThreads() int {
+	return c.compressionThreads
+}
@@ -19,6 +19,7 @@ const (
 	// this does not affect the log files which are always debug
 	KeyVerbose                     = "verbose"
 	KeyDisableRESTAPI              = "disable-rest-api"
+	KeyAPIOnly                     = "api-only"
 	KeyCollectAccelerationLog      = "collect-acceleration-log"
 	KeyCollectAccessLog            = "collect-access-log"
 	KeyCollectAuditLog             = "collect-audit-log"
@@ -29,6 +30,8 @@ const (
 	KeyDremioPidDetection          = "dremio-pid-detection"
 	KeyDremioUsername              = "dremio-username"
 	KeyDremioPatToken              = "dremio-pat-token" // #nosec G101
+	KeyDremioPassword              = "dremio-password"  // #nosec G101
+	KeyDremioPasswordFile          = "dremio-password-file"
 	KeyDremioConfDir               = "dremio-conf-dir"
 	KeyDremioRocksdbDir            = "dremio-rocksdb-dir"
 	KeyCollectDremioConfiguration  = "collect-dremio-configuration"
@@ -52,8 +55,14 @@ const (
 	KeyCollectTtop                 = "collect-ttop"
 	KeyCollectSystemTablesExport   = "collect-system-tables-export"
 	KeySystemTablesRowLimit        = "system-tables-row-limit"
+	KeySystemTablesAdd             = "system-tables-add"
+	KeySystemTablesRemove          = "system-tables-remove"
+	KeySystemTablesCustomSQL       = "system-tables-custom-sql"
+	KeySystemTablesExportThreads   = "system-tables-export-threads"
+	KeySystemTablesParquet         = "system-tables-parquet"
 	KeyCollectWLM                  = "collect-wlm"
 	KeyCollectKVStoreReport        = "collect-kvstore-report"
+	KeyCollectCatalog              = "collect-catalog"
 	KeyDremioJStackTimeSeconds     = "dremio-jstack-time-seconds"
 	KeyDremioJFRTimeSeconds        = "dremio-jfr-time-seconds"
 	KeyDremioJStackFreqSeconds     = "dremio-jstack-freq-seconds"
@@ -64,13 +73,29 @@ const (
 	KeyAcceptCollectionConsent     = "accept-collection-consent"
 	KeyIsDremioCloud               = "is-dremio-cloud"
 	KeyDremioCloudProjectID        = "dremio-cloud-project-id"
+	KeyDremioCloudProjectIDs       = "dremio-cloud-project-ids"
 	KeyAllowInsecureSSL            = "allow-insecure-ssl"
+	KeyDremioCAFile                = "dremio-ca-file"
+	KeyDremioClientCertFile        = "dremio-client-cert-file"
+	KeyDremioClientKeyFile         = "dremio-client-key-file"
 	KeyJobProfilesNumHighQueryCost = "job-profiles-num-high-query-cost"
 	KeyJobProfilesNumSlowExec      = "job-profiles-num-slow-exec"
 	KeyJobProfilesNumRecentErrors  = "job-profiles-num-recent-errors"
 	KeyJobProfilesNumSlowPlanning  = "job-profiles-num-slow-planning"
+	KeyJobProfileSelectors         = "job-profile-selectors"
+	KeyJobProfilesSampling         = "job-profiles-sampling"
+	KeyJobProfilesSamplingBucket   = "job-profiles-sampling-bucket"
 	KeyRestHTTPTimeout             = "rest-http-timeout"
+	KeyRestHTTPRetries             = "rest-http-retries"
+	KeyRestHTTPSProxy              = "rest-https-proxy"
+	KeyRestNoProxy                 = "rest-no-proxy"
 	KeyDisableFreeSpaceCheck       = "disable-free-space-check"
 	KeyMinFreeSpaceGB              = "min-free-space-gb"
 	KeyCollectionMode              = "collect"
+	KeyCompressionThreads          = "compression-threads"
+	KeySince                       = "since"
+	KeyUntil                       = "until"
+	KeyRedaction                   = "redaction"
+	KeyAnonymizeSQL                = "anonymize-sql"
+	KeyAnonymizeSQLHashTableNames  = "anonymize-sql-hash-table-names"
 )
@@ -14,7 +14,10 @@
 
 package conf
 
-import "github.com/dremio/dremio-diagnostic-collector/pkg/collects"
+import (
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collects"
+)
 
 func setDefault(confData map[string]interface{}, key string, value interface{}) {
 	// if key is not present go ahead and set it
@@ -43,14 +46,18 @@ func SetViperDefaults(confData map[string]interface{}, hostName string, defaultC
 	}
 	if collectionMode == collects.HealthCheckCollection {
 		setDefault(confData, KeyNumberJobProfiles, 25000)
+		// a health check reads the whole cluster through the rest api so the certificate is verified
+		setDefault(confData, KeyAllowInsecureSSL, false)
 	} else {
 		setDefault(confData, KeyNumberJobProfiles, 20)
+		setDefault(confData, KeyAllowInsecureSSL, true)
 	}
 
 	// set default config
 	setDefault(confData, KeyCollectJStack, false)
 	setDefault(confData, KeyVerbose, "vv")
 	setDefault(confData, KeyDisableRESTAPI, false)
+	setDefault(confData, KeyAPIOnly, false)
 	setDefault(confData, KeyCollectAccelerationLog, false)
 	setDefault(confData, KeyCollectAccessLog, false)
 	setDefault(confData, KeyCollectAuditLog, false)
@@ -60,6 +67,8 @@ func SetViperDefaults(confData map[string]interface{}, hostName string, defaultC
 	setDefault(confData, KeyDremioPidDetection, true)
 	setDefault(confData, KeyDremioUsername, "dremio")
 	setDefault(confData, KeyDremioPatToken, "")
+	setDefault(confData, KeyDremioPassword, "")
+	setDefault(confData, KeyDremioPasswordFile, "")
 	setDefault(confData, KeyDremioConfDir, "/opt/dremio/conf")
 	setDefault(confData, KeyDremioRocksdbDir, "/opt/dremio/data/db")
 	setDefault(confData, KeyCollectDremioConfiguration, true)
@@ -77,8 +86,11 @@ func SetViperDefaults(confData map[string]interface{}, hostName string, defaultC
 	setDefault(confData, KeyCollectGCLogs, true)
 	setDefault(confData, KeyCollectSystemTablesExport, true)
 	setDefault(confData, KeySystemTablesRowLimit, 100000)
+	setDefault(confData, KeySystemTablesExportThreads, 4)
+	setDefault(confData, KeySystemTablesParquet, false)
 	setDefault(confData, KeyCollectWLM, true)
 	setDefault(confData, KeyCollectKVStoreReport, true)
+	setDefault(confData, KeyCollectCatalog, true)
 	setDefault(confData, KeyDremioJStackTimeSeconds, defaultCaptureSeconds)
 	setDefault(confData, KeyDremioJFRTimeSeconds, defaultCaptureSeconds)
 	setDefault(confData, KeyDremioJStackFreqSeconds, 1)
@@ -89,9 +101,20 @@ func SetViperDefaults(confData map[string]interface{}, hostName string, defaultC
 	setDefault(confData, KeyAcceptCollectionConsent, true)
 	setDefault(confData, KeyIsDremioCloud, false)
 	setDefault(confData, KeyDremioCloudProjectID, "")
-	setDefault(confData, KeyAllowInsecureSSL, true)
+	setDefault(confData, KeyDremioCAFile, "")
+	setDefault(confData, KeyDremioClientCertFile, "")
+	setDefault(confData, KeyDremioClientKeyFile, "")
 	setDefault(confData, KeyRestHTTPTimeout, 30)
+	setDefault(confData, KeyRestHTTPRetries, restclient.DefaultRetries)
+	setDefault(confData, KeyRestHTTPSProxy, "")
+	setDefault(confData, KeyRestNoProxy, "")
 	setDefault(confData, KeyDisableFreeSpaceCheck, false)
 	setDefault(confData, KeyMinFreeSpaceGB, 40)
+	setDefault(confData, KeyJobProfilesSampling, "global")
+	setDefault(confData, KeyJobProfilesSamplingBucket, "day")
+	// 0 lets pgzip pick a share of the cpus
+	setDefault(confData, KeyCompressionThreads, 0)
+	setDefault(confData, KeyAnonymizeSQL, false)
+	setDefault(confData, KeyAnonymizeSQLHashTableNames, false)
 
 }
@@ -63,6 +63,8 @@ func TestSetViperDefaultsWithHealthCheck(t *testing.T) {
 		{conf.KeyDremioLogsNumDays, 7},
 		{conf.KeyDremioQueriesJSONNumDays, 30},
 		{conf.KeyDremioGCFilePattern, "gc*.log*"},
+		{conf.KeyJobProfilesSampling, "global"},
+		{conf.KeyJobProfilesSamplingBucket, "day"},
 		{conf.KeyCollectQueriesJSON, true},
 		{conf.KeyCollectServerLogs, true},
 		{conf.KeyCollectMetaRefreshLog, true},
@@ -74,6 +76,7 @@ func TestSetViperDefaultsWithHealthCheck(t *testing.T) {
 		{conf.KeyCollectWLM, true},
 		{conf.KeyCollectTtop, true},
 		{conf.KeyCollectKVStoreReport, true},
+		{conf.KeyCollectCatalog, true},
 		{conf.KeyDremioJStackTimeSeconds, defaultCaptureSeconds},
 		{conf.KeyDremioJFRTimeSeconds, defaultCaptureSeconds},
 		{conf.KeyDremioJStackFreqSeconds, 1},
@@ -82,7 +85,7 @@ func TestSetViperDefaultsWithHealthCheck(t *testing.T) {
 		{conf.KeyDremioGCLogsDir, ""},
 		{conf.KeyNodeName, hostName},
 		{conf.KeyAcceptCollectionConsent, true},
-		{conf.KeyAllowInsecureSSL, true},
+		{conf.KeyAllowInsecureSSL, false},
 	}
 
 	for _, check := range checks {
@@ -122,6 +125,8 @@ func TestSetViperDefaultsQuickCollect(t *testing.T) {
 		{conf.KeyDremioLogsNumDays, 2},
 		{conf.KeyDremioQueriesJSONNumDays, 2},
 		{conf.KeyDremioGCFilePattern, "gc*.log*"},
+		{conf.KeyJobProfilesSampling, "global"},
+		{conf.KeyJobProfilesSamplingBucket, "day"},
 		{conf.KeyCollectQueriesJSON, true},
 		{conf.KeyCollectServerLogs, true},
 		{conf.KeyCollectMetaRefreshLog, true},
@@ -133,6 +138,7 @@ func TestSetViperDefaultsQuickCollect(t *testing.T) {
 		{conf.KeyCollectWLM, true},
 		{conf.KeyCollectTtop, false},
 		{conf.KeyCollectKVStoreReport, true},
+		{conf.KeyCollectCatalog, true},
 		{conf.KeyDremioJStackTimeSeconds, defaultCaptureSeconds},
 		{conf.KeyDremioJFRTimeSeconds, defaultCaptureSeconds},
 		{conf.KeyDremioJStackFreqSeconds, 1},
@@ -181,6 +187,8 @@ func TestSetViperDefaults(t *testing.T) {
 		{conf.KeyDremioLogsNumDays, 7},
 		{conf.KeyDremioQueriesJSONNumDays, 30},
 		{conf.KeyDremioGCFilePattern, "gc*.log*"},
+		{conf.KeyJobProfilesSampling, "global"},
+		{conf.KeyJobProfilesSamplingBucket, "day"},
 		{conf.KeyCollectQueriesJSON, true},
 		{conf.KeyCollectServerLogs, true},
 		{conf.KeyCollectMetaRefreshLog, true},
@@ -192,6 +200,7 @@ func TestSetViperDefaults(t *testing.T) {
 		{conf.KeyCollectWLM, true},
 		{conf.KeyCollectTtop, true},
 		{conf.KeyCollectKVStoreReport, true},
+		{conf.KeyCollectCatalog, true},
 		{conf.KeyDremioJStackTimeSeconds, defaultCaptureSeconds},
 		{conf.KeyDremioJFRTimeSeconds, defaultCaptureSeconds},
 		{conf.KeyDremioJStackFreqSeconds, 1},
@@ -0,0 +1,51 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/queriesjson"
+	"gopkg.in/yaml.v3"
+)
+
+// GetJobProfileSelectors reads the job-profile-selectors list from ddc.yaml and checks every
+// selector compiles so a bad pattern or time is reported before collection starts
+func GetJobProfileSelectors(confData map[string]interface{}) ([]queriesjson.SelectorConfig, error) {
+	var selectors []queriesjson.SelectorConfig
+	v, ok := confData[KeyJobProfileSelectors]
+	if !ok || v == nil {
+		return selectors, nil
+	}
+	// the yaml was already decoded into generic maps so round trip it into the typed config
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return selectors, fmt.Errorf("unable to read %v due to error %v", KeyJobProfileSelectors, err)
+	}
+	if err := yaml.Unmarshal(b, &selectors); err != nil {
+		return selectors, fmt.Errorf("%v must be a list of selectors: %v", KeyJobProfileSelectors, err)
+	}
+	names := make(map[string]bool)
+	for _, s := range selectors {
+		if _, err := queriesjson.NewSelector(s); err != nil {
+			return selectors, err
+		}
+		if names[s.Name] {
+			return selectors, fmt.Errorf("job profile selector '%v' is listed more than once", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return selectors, nil
+}
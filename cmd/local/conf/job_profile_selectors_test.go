@@ -0,0 +1,85 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"gopkg.in/yaml.v3"
+)
+
+func parseSelectors(t *testing.T, doc string) map[string]interface{} {
+	confData := make(map[string]interface{})
+	if err := yaml.Unmarshal([]byte(doc), &confData); err != nil {
+		t.Fatalf("bad test yaml %v", err)
+	}
+	return confData
+}
+
+func TestGetJobProfileSelectors(t *testing.T) {
+	selectors, err := conf.GetJobProfileSelectors(parseSelectors(t, `
+job-profile-selectors:
+  - name: reflections
+    quota: 20
+    order-by: running-time
+    query-types: [REFLECTION]
+  - name: incident
+    quota: 10
+    queues: ["High Cost User Queries"]
+    since: "2024-01-02T14:05:00Z"
+    until: "2024-01-02T14:40:00Z"
+`))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(selectors) != 2 {
+		t.Fatalf("expected 2 selectors but was %v", len(selectors))
+	}
+	if selectors[0].Name != "reflections" || selectors[0].OrderBy != "running-time" || selectors[0].QueryTypes[0] != "REFLECTION" {
+		t.Errorf("unexpected selector %#v", selectors[0])
+	}
+	if selectors[1].Queues[0] != "High Cost User Queries" || selectors[1].Until != "2024-01-02T14:40:00Z" {
+		t.Errorf("unexpected selector %#v", selectors[1])
+	}
+}
+
+func TestGetJobProfileSelectorsNotSet(t *testing.T) {
+	selectors, err := conf.GetJobProfileSelectors(map[string]interface{}{})
+	if err != nil || len(selectors) != 0 {
+		t.Errorf("expected no selectors and no error but was %v %v", selectors, err)
+	}
+}
+
+func TestGetJobProfileSelectorsInvalid(t *testing.T) {
+	tests := []struct {
+		yaml     string
+		expected string
+	}{
+		{"job-profile-selectors:\n  - quota: 1\n", "missing a name"},
+		{"job-profile-selectors:\n  - name: a\n    sql-pattern: \"(\"\n", "invalid sql-pattern"},
+		{"job-profile-selectors:\n  - name: a\n    since: yesterday\n", "invalid since"},
+		{"job-profile-selectors:\n  - name: a\n    order-by: memory\n", "unknown order-by"},
+		{"job-profile-selectors:\n  - name: a\n  - name: a\n", "more than once"},
+		{"job-profile-selectors: everything\n", "must be a list"},
+	}
+	for _, tt := range tests {
+		_, err := conf.GetJobProfileSelectors(parseSelectors(t, tt.yaml))
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected error containing '%v' for %q but was %v", tt.expected, tt.yaml, err)
+		}
+	}
+}
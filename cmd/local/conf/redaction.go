@@ -0,0 +1,44 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/redaction"
+	"gopkg.in/yaml.v3"
+)
+
+// GetRedactionRules reads the redaction list from ddc.yaml and checks every rule compiles so a bad
+// pattern is reported before collection starts
+func GetRedactionRules(confData map[string]interface{}) ([]redaction.Rule, error) {
+	var rules []redaction.Rule
+	v, ok := confData[KeyRedaction]
+	if !ok || v == nil {
+		return rules, nil
+	}
+	// the yaml was already decoded into generic maps so round trip it into the typed config
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return rules, fmt.Errorf("unable to read %v due to error %v", KeyRedaction, err)
+	}
+	if err := yaml.Unmarshal(b, &rules); err != nil {
+		return rules, fmt.Errorf("%v must be a list of rules: %v", KeyRedaction, err)
+	}
+	if _, err := redaction.New(rules); err != nil {
+		return rules, err
+	}
+	return rules, nil
+}
@@ -0,0 +1,180 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SQLExport is a system table or a custom query whose results are exported to the system tables folder
+type SQLExport struct {
+	// Name is the system table, such as jobs or cache.datasets, or the name of a custom query. It names the output files
+	Name string `yaml:"name"`
+	// SQL is the query of a custom query, GetSQLExports sets it to SELECT * FROM sys.<name> for system tables
+	SQL string `yaml:"sql"`
+	// RowLimit caps the rows exported, system-tables-row-limit is used when it is 0
+	RowLimit int `yaml:"row-limit"`
+	// TimeColumn limits the rows to the --since/--until window, or the days of queries.json, and orders them by it
+	TimeColumn string `yaml:"time-column"`
+}
+
+// UnmarshalYAML lets a system table be listed by name alone
+func (e *SQLExport) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&e.Name)
+	}
+	type plain SQLExport
+	return value.Decode((*plain)(e))
+}
+
+// jobHistoryTimeColumn limits the job history tables to the time window instead of a number of rows
+const jobHistoryTimeColumn = "submitted_ts"
+
+var (
+	customExportName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+	systemTableName  = regexp.MustCompile(`^[A-Za-z0-9_."\\]+$`)
+	timeColumnName   = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*|"[^"]+")$`)
+)
+
+// tableKey compares system table names without the sys. prefix or quotes, so "tables", sys.tables and
+// the escaped \"tables\" of SystemTableList are the same table
+func tableKey(name string) string {
+	name = strings.TrimPrefix(strings.TrimSpace(name), "sys.")
+	name = strings.ReplaceAll(name, "\\\"", "")
+	return strings.ToLower(strings.ReplaceAll(name, "\"", ""))
+}
+
+// readExports round trips a list from the already decoded yaml into SQLExports
+func readExports(confData map[string]interface{}, key string) ([]SQLExport, error) {
+	var exports []SQLExport
+	v, ok := confData[key]
+	if !ok || v == nil {
+		return exports, nil
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return exports, fmt.Errorf("unable to read %v due to error %v", key, err)
+	}
+	if err := yaml.Unmarshal(b, &exports); err != nil {
+		return exports, fmt.Errorf("%v must be a list: %v", key, err)
+	}
+	for _, e := range exports {
+		if e.RowLimit < 0 {
+			return exports, fmt.Errorf("%v '%v' has a negative row-limit", key, e.Name)
+		}
+		if e.TimeColumn != "" && !timeColumnName.MatchString(e.TimeColumn) {
+			return exports, fmt.Errorf("%v '%v' has an invalid time-column '%v'", key, e.Name, e.TimeColumn)
+		}
+	}
+	return exports, nil
+}
+
+// GetSQLExports combines the default system tables with system-tables-add, system-tables-remove and
+// system-tables-custom-sql from ddc.yaml into the list of queries to export. The SQL of each is
+// complete apart from the time filter or row limit, custom queries are wrapped so both can be added
+func GetSQLExports(confData map[string]interface{}, defaultTables []string, rowLimit int) ([]SQLExport, error) {
+	added, err := readExports(confData, KeySystemTablesAdd)
+	if err != nil {
+		return nil, err
+	}
+	removed, err := readExports(confData, KeySystemTablesRemove)
+	if err != nil {
+		return nil, err
+	}
+	custom, err := readExports(confData, KeySystemTablesCustomSQL)
+	if err != nil {
+		return nil, err
+	}
+	removedTables := make(map[string]bool)
+	for _, r := range removed {
+		removedTables[tableKey(r.Name)] = true
+	}
+	var tables []SQLExport
+	index := make(map[string]int)
+	for _, name := range defaultTables {
+		e := SQLExport{Name: name}
+		if lower := strings.ToLower(name); strings.Contains(lower, "project.history.jobs") || strings.Contains(lower, "jobs_recent") {
+			e.TimeColumn = jobHistoryTimeColumn
+		}
+		index[tableKey(name)] = len(tables)
+		tables = append(tables, e)
+	}
+	for _, e := range added {
+		if e.SQL != "" {
+			return nil, fmt.Errorf("%v '%v' has sql, custom queries go in %v", KeySystemTablesAdd, e.Name, KeySystemTablesCustomSQL)
+		}
+		e.Name = strings.TrimPrefix(strings.TrimSpace(e.Name), "sys.")
+		if !systemTableName.MatchString(e.Name) {
+			return nil, fmt.Errorf("%v has an invalid system table name '%v'", KeySystemTablesAdd, e.Name)
+		}
+		// listing a default table again changes its row limit or time column
+		if i, ok := index[tableKey(e.Name)]; ok {
+			e.Name = tables[i].Name
+			tables[i] = e
+			continue
+		}
+		index[tableKey(e.Name)] = len(tables)
+		tables = append(tables, e)
+	}
+	var exports []SQLExport
+	names := make(map[string]bool)
+	for _, e := range tables {
+		if removedTables[tableKey(e.Name)] {
+			continue
+		}
+		// the names are escaped for the old json body, the sql itself needs plain quotes
+		e.SQL = "SELECT * FROM sys." + strings.ReplaceAll(e.Name, "\\\"", "\"")
+		e.Name = "sys." + e.Name
+		names[strings.ToLower(e.Name)] = true
+		exports = append(exports, e)
+	}
+	for _, e := range custom {
+		if !customExportName.MatchString(e.Name) {
+			return nil, fmt.Errorf("%v name '%v' may only use letters, digits, '.', '_' and '-'", KeySystemTablesCustomSQL, e.Name)
+		}
+		if strings.HasPrefix(strings.ToLower(e.Name), "sys.") || names[strings.ToLower(e.Name)] {
+			return nil, fmt.Errorf("%v name '%v' is already used", KeySystemTablesCustomSQL, e.Name)
+		}
+		sql := strings.TrimSuffix(strings.TrimSpace(e.SQL), ";")
+		if sql == "" {
+			return nil, fmt.Errorf("%v '%v' has no sql", KeySystemTablesCustomSQL, e.Name)
+		}
+		// on its own line so a trailing -- comment does not swallow the closing parenthesis
+		e.SQL = "SELECT * FROM (" + sql + "\n) AS ddc_export"
+		names[strings.ToLower(e.Name)] = true
+		exports = append(exports, e)
+	}
+	for i := range exports {
+		if exports[i].RowLimit == 0 {
+			exports[i].RowLimit = rowLimit
+		}
+	}
+	return exports, nil
+}
+
+// exportsJobHistory is true when sys.jobs_recent or project.history.jobs is exported, the job profiles
+// are picked from it when there is no queries.json
+func (c *CollectConf) exportsJobHistory() bool {
+	for _, e := range c.sqlExports {
+		if lower := strings.ToLower(e.Name); strings.Contains(lower, "project.history.jobs") || strings.Contains(lower, "jobs_recent") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package conf_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+)
+
+func TestGetSQLExportsDefaults(t *testing.T) {
+	exports, err := conf.GetSQLExports(map[string]interface{}{}, []string{"\\\"tables\\\"", "jobs_recent", "options"}, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []conf.SQLExport{
+		{Name: "sys.\\\"tables\\\"", SQL: `SELECT * FROM sys."tables"`, RowLimit: 1000},
+		{Name: "sys.jobs_recent", SQL: "SELECT * FROM sys.jobs_recent", RowLimit: 1000, TimeColumn: "submitted_ts"},
+		{Name: "sys.options", SQL: "SELECT * FROM sys.options", RowLimit: 1000},
+	}
+	if !reflect.DeepEqual(expected, exports) {
+		t.Errorf("expected %#v but was %#v", expected, exports)
+	}
+}
+
+func TestGetSQLExportsAddRemoveAndCustom(t *testing.T) {
+	exports, err := conf.GetSQLExports(parseSelectors(t, `
+system-tables-add:
+  - cache.datasets
+  - name: sys.options
+    row-limit: 50
+system-tables-remove:
+  - "tables"
+  - sys.jobs_recent
+system-tables-custom-sql:
+  - name: non-default-options
+    sql: SELECT * FROM sys.options WHERE status <> 'DEFAULT';
+    row-limit: 10
+  - name: recent-refreshes
+    sql: SELECT * FROM sys.reflection_refresh_history -- last runs
+    time-column: start_time
+`), []string{"\\\"tables\\\"", "jobs_recent", "options"}, 1000)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []conf.SQLExport{
+		{Name: "sys.options", SQL: "SELECT * FROM sys.options", RowLimit: 50},
+		{Name: "sys.cache.datasets", SQL: "SELECT * FROM sys.cache.datasets", RowLimit: 1000},
+		{Name: "non-default-options", SQL: "SELECT * FROM (SELECT * FROM sys.options WHERE status <> 'DEFAULT'\n) AS ddc_export", RowLimit: 10},
+		{Name: "recent-refreshes", SQL: "SELECT * FROM (SELECT * FROM sys.reflection_refresh_history -- last runs\n) AS ddc_export", RowLimit: 1000, TimeColumn: "start_time"},
+	}
+	if !reflect.DeepEqual(expected, exports) {
+		t.Errorf("expected %#v but was %#v", expected, exports)
+	}
+}
+
+func TestGetSQLExportsInvalid(t *testing.T) {
+	tests := []struct {
+		doc      string
+		expected string
+	}{
+		{"system-tables-custom-sql:\n  - name: bad name\n    sql: SELECT 1\n", "may only use"},
+		{"system-tables-custom-sql:\n  - name: empty\n", "has no sql"},
+		{"system-tables-custom-sql:\n  - name: sys.options\n    sql: SELECT 1\n", "already used"},
+		{"system-tables-custom-sql:\n  - name: twice\n    sql: SELECT 1\n  - name: twice\n    sql: SELECT 2\n", "already used"},
+		{"system-tables-custom-sql:\n  - name: neg\n    sql: SELECT 1\n    row-limit: -1\n", "negative row-limit"},
+		{"system-tables-custom-sql:\n  - name: col\n    sql: SELECT 1\n    time-column: a; DROP\n", "invalid time-column"},
+		{"system-tables-add:\n  - name: x\n    sql: SELECT 1\n", "custom queries go in"},
+		{"system-tables-add:\n  - \"x y\"\n", "invalid system table name"},
+		{"system-tables-add: jobs\n", "must be a list"},
+	}
+	for _, tt := range tests {
+		_, err := conf.GetSQLExports(parseSelectors(t, tt.doc), []string{"options"}, 1000)
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("expected an error containing '%v' for %q but was %v", tt.expected, tt.doc, err)
+		}
+	}
+}
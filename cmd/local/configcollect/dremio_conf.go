@@ -35,6 +35,14 @@ func RunCollectDremioConfig(c *conf.CollectConf) error {
 	if err := masking.RemoveSecretsFromDremioConf(dremioConfDest); err != nil {
 		simplelog.Warningf("UNABLE TO MASK SECRETS in dremio.conf due to error %v", err)
 	}
+	vars := make(map[string]string)
+	if c.DremioHome() != "" {
+		vars["DREMIO_HOME"] = c.DremioHome()
+	}
+	resolvedDest := filepath.Join(c.ConfigurationOutDir(), masking.DremioConfResolvedFileName)
+	if err := masking.WriteResolvedDremioConf(filepath.Join(c.DremioConfDir(), "dremio.conf"), resolvedDest, vars); err != nil {
+		simplelog.Warningf("unable to write %v due to error %v", masking.DremioConfResolvedFileName, err)
+	}
 	err = ddcio.CopyFile(filepath.Join(c.DremioConfDir(), "dremio-env"), filepath.Join(c.ConfigurationOutDir(), "dremio-env"))
 	if err != nil {
 		simplelog.Warningf("unable to copy dremio-env due to error %v", err)
@@ -0,0 +1,151 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configcollect
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// HadoopConfOutDir is the folder of the configuration output the *-site.xml files found outside of the
+// dremio conf dir are copied to, each under its own directory name with the separators replaced
+const HadoopConfOutDir = "hadoop"
+
+// hadoopDirVars are the dremio-env variables naming a directory, or a classpath, that can hold *-site.xml files
+var hadoopDirVars = []string{
+	"HADOOP_CONF_DIR",
+	"HADOOP_HOME",
+	"HIVE_CONF_DIR",
+	"DREMIO_EXTRA_CLASSPATH",
+	"DREMIO_CLASSPATH_USER_FIRST",
+}
+
+// readEnvFile reads the variables set by a shell env file such as dremio-env, $VAR and ${VAR} are
+// expanded with the variables set before them and then the environment
+func readEnvFile(data []byte) map[string]string {
+	vars := make(map[string]string)
+	lookup := func(name string) string {
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return os.Getenv(name)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		name, value, ok := strings.Cut(line, "=")
+		if !ok || strings.ContainsAny(name, " \t$") {
+			continue
+		}
+		if strings.HasPrefix(value, "'") {
+			vars[name] = strings.Trim(value, "'")
+			continue
+		}
+		vars[name] = os.Expand(strings.Trim(value, `"`), lookup)
+	}
+	return vars
+}
+
+// HadoopConfDirs lists the directories referenced by dremio-env that can hold Hadoop configuration, classpath
+// entries that are files or wildcards are skipped
+func HadoopConfDirs(dremioEnv []byte) []string {
+	vars := readEnvFile(dremioEnv)
+	var dirs []string
+	for _, name := range hadoopDirVars {
+		value, ok := vars[name]
+		if !ok || value == "" {
+			continue
+		}
+		for _, entry := range filepath.SplitList(value) {
+			if entry == "" || strings.Contains(entry, "*") {
+				continue
+			}
+			if name == "HADOOP_HOME" {
+				entry = filepath.Join(entry, "etc", "hadoop")
+			}
+			dirs = append(dirs, filepath.Clean(entry))
+		}
+	}
+	return dirs
+}
+
+// collectSiteXML copies the *-site.xml files of dir to outDir and masks their secrets, a copy that
+// cannot be masked is removed
+func collectSiteXML(dir, outDir string) {
+	files, err := filepath.Glob(filepath.Join(dir, "*-site.xml"))
+	if err != nil {
+		simplelog.Warningf("unable to list the *-site.xml files of %v due to error %v", dir, err)
+		return
+	}
+	sort.Strings(files)
+	if len(files) == 0 {
+		return
+	}
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		simplelog.Warningf("unable to create %v due to error %v", outDir, err)
+		return
+	}
+	for _, file := range files {
+		dest := filepath.Join(outDir, filepath.Base(file))
+		if err := ddcio.CopyFile(file, dest); err != nil {
+			simplelog.Warningf("unable to copy %v due to error %v", file, err)
+			continue
+		}
+		if err := masking.RemoveSecretsFromHadoopXML(dest); err != nil {
+			simplelog.Warningf("UNABLE TO MASK SECRETS in %v, it will not be collected due to error %v", file, err)
+			if err := os.Remove(dest); err != nil {
+				simplelog.Errorf("unable to remove unmasked %v due to error %v", dest, err)
+			}
+		}
+	}
+}
+
+// RunCollectHadoopConfig collects the *-site.xml files of the dremio conf dir and of the Hadoop
+// directories referenced by dremio-env with their secrets masked
+func RunCollectHadoopConfig(c *conf.CollectConf) error {
+	simplelog.Debugf("Collecting Hadoop Configuration from %v ...", c.NodeName())
+	confDir := filepath.Clean(c.DremioConfDir())
+	collectSiteXML(confDir, c.ConfigurationOutDir())
+
+	dremioEnv, err := os.ReadFile(filepath.Join(confDir, "dremio-env"))
+	if err != nil {
+		simplelog.Debugf("no dremio-env to find hadoop configuration in due to error %v", err)
+		return nil
+	}
+	seen := map[string]bool{confDir: true}
+	for _, dir := range HadoopConfDirs(dremioEnv) {
+		if seen[dir] {
+			continue
+		}
+		seen[dir] = true
+		outName := strings.Trim(strings.NewReplacer(string(filepath.Separator), "_", ":", "_").Replace(dir), "_")
+		collectSiteXML(dir, filepath.Join(c.ConfigurationOutDir(), HadoopConfOutDir, outName))
+	}
+	simplelog.Debugf("... Collecting Hadoop Configuration from %v COMPLETED", c.NodeName())
+	return nil
+}
@@ -0,0 +1,112 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configcollect_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/configcollect"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/collects"
+)
+
+func TestHadoopConfDirs(t *testing.T) {
+	t.Setenv("DDC_TEST_HADOOP", "/opt/hadoop")
+	dremioEnv := `#HADOOP_CONF_DIR=/commented/out
+export HADOOP_HOME=$DDC_TEST_HADOOP
+HIVE_CONF_DIR="${HADOOP_HOME}/hive-conf"
+DREMIO_EXTRA_CLASSPATH=/opt/extra/conf:/opt/extra/jars/*
+DREMIO_MAX_MEMORY_SIZE_MB=16384
+`
+	expected := []string{
+		filepath.Join("/opt/hadoop", "etc", "hadoop"),
+		filepath.Join("/opt/hadoop", "hive-conf"),
+		filepath.Join("/opt/extra", "conf"),
+	}
+	if actual := configcollect.HadoopConfDirs([]byte(dremioEnv)); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected %v but was %v", expected, actual)
+	}
+}
+
+func TestCollectsHadoopSiteXMLWithSecretsMasked(t *testing.T) {
+	outDir := filepath.Join(t.TempDir(), "ddc-out")
+	confDir := t.TempDir()
+	hadoopDir := t.TempDir()
+	siteXML := `<configuration>
+  <property>
+    <name>fs.s3a.secret.key</name>
+    <value>hidemeplease</value>
+  </property>
+  <property>
+    <name>fs.s3a.endpoint</name>
+    <value>s3.us-west-2.amazonaws.com</value>
+  </property>
+</configuration>
+`
+	files := map[string]string{
+		filepath.Join(confDir, "core-site.xml"):     siteXML,
+		filepath.Join(confDir, "dremio-env"):        fmt.Sprintf("export HADOOP_CONF_DIR=%v\n", hadoopDir),
+		filepath.Join(hadoopDir, "hive-site.xml"):   siteXML,
+		filepath.Join(hadoopDir, "broken-site.xml"): "<configuration><property><name>a.password</name><value>hidemeplease",
+		filepath.Join(hadoopDir, "hadoop-env.sh"):   "export JAVA_HOME=/usr/lib/jvm",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ddcYaml := filepath.Join(t.TempDir(), "ddc.yaml")
+	if err := os.WriteFile(ddcYaml, []byte(fmt.Sprintf(`
+dremio-log-dir: %v
+tmp-output-dir: %v
+dremio-conf-dir: %v
+node-name: node1
+`, filepath.Join("testdata", "logs"),
+		strings.ReplaceAll(outDir, "\\", "\\\\"),
+		strings.ReplaceAll(confDir, "\\", "\\\\"))), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := conf.ReadConf(make(map[string]string), ddcYaml, collects.StandardCollection)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configcollect.RunCollectHadoopConfig(c); err != nil {
+		t.Fatal(err)
+	}
+
+	hadoopOut := filepath.Join(c.ConfigurationOutDir(), configcollect.HadoopConfOutDir, strings.Trim(strings.ReplaceAll(hadoopDir, string(filepath.Separator), "_"), "_"))
+	for _, collected := range []string{filepath.Join(c.ConfigurationOutDir(), "core-site.xml"), filepath.Join(hadoopOut, "hive-site.xml")} {
+		text, err := os.ReadFile(collected)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(text), "hidemeplease") {
+			t.Errorf("expected the secret to be masked in %v", string(text))
+		}
+		if !strings.Contains(string(text), "<value>s3.us-west-2.amazonaws.com</value>") {
+			t.Errorf("expected the endpoint to be kept in %v", string(text))
+		}
+	}
+	for _, skipped := range []string{filepath.Join(hadoopOut, "broken-site.xml"), filepath.Join(hadoopOut, "hadoop-env.sh")} {
+		if _, err := os.Stat(skipped); err == nil {
+			t.Errorf("expected %v to not be collected", skipped)
+		}
+	}
+}
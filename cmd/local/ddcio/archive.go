@@ -16,12 +16,12 @@
 package ddcio
 
 import (
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 	"path"
 
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pgzip"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
@@ -46,13 +46,16 @@ func GzipFile(src, dst string) error {
 		}
 	}()
 
-	gzipWriter := gzip.NewWriter(destFile)
-	defer gzipWriter.Close()
-
+	gzipWriter := pgzip.NewWriter(destFile)
 	_, err = io.Copy(gzipWriter, sourceFile)
 	if err != nil {
+		if closeErr := gzipWriter.Close(); closeErr != nil {
+			simplelog.Debugf("optional close of gzip writer for %v failed %v", dst, closeErr)
+		}
 		return fmt.Errorf("unable to create gzip due to error %v", err)
 	}
-
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("unable to finish gzip %v due to error %v", dst, err)
+	}
 	return nil
 }
@@ -21,7 +21,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -38,11 +37,15 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/jvmcollect"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/logcollect"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/nodeinfocollect"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/queriesjson"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/dirs"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pgzip"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/redaction"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/sqlanon"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/validation"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
@@ -51,11 +54,16 @@ import (
 )
 
 var ddcYamlLoc, collectionMode, pid string
-var patStdIn bool
+var patStdIn, passwordStdIn, promptPassword bool
 
 func createAllDirs(c *conf.CollectConf) error {
 	var perms fs.FileMode = 0750
 	if !c.IsDremioCloud() {
+		if err := os.MkdirAll(c.KVstoreOutDir(), perms); err != nil {
+			return fmt.Errorf("unable to create kvstore directory due to error %v", err)
+		}
+	}
+	if !c.IsDremioCloud() && !c.APIOnly() {
 		if err := os.MkdirAll(c.ConfigurationOutDir(), perms); err != nil {
 			return fmt.Errorf("unable to create configuration directory %v due to error %v", c.ConfigurationOutDir(), err)
 		}
@@ -71,9 +79,6 @@ func createAllDirs(c *conf.CollectConf) error {
 		if err := os.MkdirAll(c.KubernetesOutDir(), perms); err != nil {
 			return fmt.Errorf("unable to create kubernetes directory due to error %v", err)
 		}
-		if err := os.MkdirAll(c.KVstoreOutDir(), perms); err != nil {
-			return fmt.Errorf("unable to create kvstore directory due to error %v", err)
-		}
 		if err := os.MkdirAll(c.LogsOutDir(), perms); err != nil {
 			return fmt.Errorf("unable to create logs directory due to error %v", err)
 		}
@@ -88,6 +93,10 @@ func createAllDirs(c *conf.CollectConf) error {
 		}
 	}
 
+	// each Dremio Cloud project gets its own folders when they are collected
+	if c.CollectsCloudProjects() {
+		return nil
+	}
 	if err := os.MkdirAll(c.ClusterStatsOutDir(), perms); err != nil {
 		return fmt.Errorf("unable to create cluster-stats directory due to error %v", err)
 	}
@@ -100,6 +109,9 @@ func createAllDirs(c *conf.CollectConf) error {
 	if err := os.MkdirAll(c.JobProfilesOutDir(), perms); err != nil {
 		return fmt.Errorf("unable to create job-profiles directory due to error %v", err)
 	}
+	if err := os.MkdirAll(c.CatalogOutDir(), perms); err != nil {
+		return fmt.Errorf("unable to create catalog directory due to error %v", err)
+	}
 	return nil
 }
 
@@ -126,18 +138,29 @@ func collect(c *conf.CollectConf) error {
 		}
 	}
 
-	// rest call so we move it the front in case the token expires
-	if !c.CollectWLM() {
-		simplelog.Debug("Skipping Workload Manager report collection")
+	if c.CollectsCloudProjects() {
+		// the engines, rules, system tables and job profiles are collected project by project
+		t.AddJob(wrapConfigJob("DREMIO CLOUD PROJECTS COLLECTION", apicollect.RunCollectCloudProjects))
 	} else {
-		t.AddJob(wrapConfigJob("WLM COLLECTION", apicollect.RunCollectWLM))
-	}
+		// rest call so we move it the front in case the token expires
+		if !c.CollectWLM() {
+			simplelog.Debug("Skipping Workload Manager report collection")
+		} else {
+			t.AddJob(wrapConfigJob("WLM COLLECTION", apicollect.RunCollectWLM))
+		}
 
-	// rest call so we move it the front in case the token expires
-	if !c.CollectSystemTablesExport() {
-		simplelog.Debug("Skipping system tables collection")
-	} else {
-		t.AddJob(wrapConfigJob("SYSTEM TABLE COLLECTION", apicollect.RunCollectDremioSystemTables))
+		// rest call so we move it the front in case the token expires
+		if !c.CollectSystemTablesExport() {
+			simplelog.Debug("Skipping system tables collection")
+		} else {
+			t.AddJob(wrapConfigJob("SYSTEM TABLE COLLECTION", apicollect.RunCollectDremioSystemTables))
+		}
+
+		if !c.CollectCatalog() {
+			simplelog.Debug("Skipping catalog collection")
+		} else {
+			t.AddJob(wrapConfigJob("CATALOG COLLECTION", apicollect.RunCollectCatalog))
+		}
 	}
 
 	if !c.IsDremioCloud() {
@@ -147,7 +170,10 @@ func collect(c *conf.CollectConf) error {
 		} else {
 			t.AddJob(wrapConfigJob("KV STORE COLLECTION", apicollect.RunCollectKvReport))
 		}
+	}
 
+	// ddc api-collect runs away from the nodes so there is nothing else to collect
+	if !c.IsDremioCloud() && !c.APIOnly() {
 		if !c.CollectDiskUsage() {
 			simplelog.Info("Skipping disk usage collection")
 		} else {
@@ -158,6 +184,7 @@ func collect(c *conf.CollectConf) error {
 			simplelog.Info("Skipping Dremio config collection")
 		} else {
 			t.AddJob(wrapConfigJob("DREMIO CONFIG COLLECTION", configcollect.RunCollectDremioConfig))
+			t.AddJob(wrapConfigJob("HADOOP CONFIG COLLECTION", configcollect.RunCollectHadoopConfig))
 		}
 
 		if !c.CollectOSConfig() {
@@ -169,15 +196,17 @@ func collect(c *conf.CollectConf) error {
 		// log collection
 		logCollector := logcollect.NewLogCollector(
 			c.DremioLogDir(),
+			c.DremioConfDir(),
 			c.LogsOutDir(),
 			c.GcLogsDir(),
 			c.DremioGCFilePattern(),
 			c.QueriesOutDir(),
 			c.DremioQueriesJSONNumDays(),
 			c.DremioLogsNumDays(),
+			c.Window(),
 		)
 
-		if !c.CollectQueriesJSON() && c.NumberJobProfilesToCollect() == 0 {
+		if !c.CollectQueriesJSON() && !c.CollectJobProfiles() {
 			simplelog.Debug("Skipping queries.json collection")
 		} else {
 			if !c.CollectQueriesJSON() {
@@ -197,6 +226,10 @@ func collect(c *conf.CollectConf) error {
 				Name:    "SERVER LOG COLLECTION",
 				Process: logCollector.RunCollectDremioServerLog,
 			})
+			t.AddJob(threading.Job{
+				Name:    "CUSTOM LOG COLLECTION",
+				Process: logCollector.RunCollectCustomLogs,
+			})
 		}
 
 		if !c.CollectGCLogs() {
@@ -287,20 +320,148 @@ func collect(c *conf.CollectConf) error {
 		simplelog.Errorf("thread pool has an error: %v", err)
 	}
 
+	summarizeWorkload := !c.IsDremioCloud() && c.CollectQueriesJSON()
+	var workload *queriesjson.WorkloadAccumulator
+	if summarizeWorkload {
+		workload = queriesjson.NewWorkloadAccumulator()
+	}
+	summarized := false
 	// this has to happen after the queries.json collection so we don't have much choice and have to leave it here
-	if c.NumberJobProfilesToCollect() == 0 {
+	if !c.CollectJobProfiles() || c.CollectsCloudProjects() {
 		simplelog.Debugf("Skipping job profiles collection")
 	} else {
-		if err := apicollect.RunCollectJobProfiles(c); err != nil {
+		var err error
+		if summarized, err = apicollect.RunCollectJobProfiles(c, workload); err != nil {
 			simplelog.Errorf("during job profile collection there was an error: %v", err)
 		}
 	}
-	if err := runCollectClusterStats(c); err != nil {
+	// Dremio Cloud has neither a dremio process nor sys.version to read the version from
+	if c.IsDremioCloud() {
+		simplelog.Debugf("Skipping cluster stats collection on Dremio Cloud")
+	} else if c.APIOnly() {
+		if err := runCollectClusterStatsFromSystemTables(c); err != nil {
+			simplelog.Errorf("unable to collect cluster stats from the system tables: %v", err)
+		}
+	} else if err := runCollectClusterStats(c); err != nil {
 		simplelog.Errorf("during unable to collect cluster stats like cluster ID: %v", err)
 	}
+	// done last so it does not hold up any of the other collections
+	if !c.IsDremioCloud() && c.CollectGCLogs() {
+		if err := logcollect.RunAnalyzeGcLogs(c.LogsOutDir(), c.DremioGCFilePattern(), c.NodeName()); err != nil {
+			simplelog.Errorf("during gc log analysis there was an error: %v", err)
+		}
+	}
+	if !c.IsDremioCloud() && c.CollectServerLogs() {
+		if err := logcollect.RunAnalyzeServerLogs(c.LogsOutDir(), filepath.Join(c.DremioConfDir(), "logback.xml"), c.NodeName()); err != nil {
+			simplelog.Errorf("during server log analysis there was an error: %v", err)
+		}
+	}
+	if summarizeWorkload {
+		var err error
+		if summarized {
+			// the queries.json files were already read when the job profiles were selected
+			err = queriesjson.WriteWorkloadSummary(c.QueriesOutDir(), workload)
+		} else {
+			err = queriesjson.RunWorkloadSummary(c.QueriesOutDir(), c.NumberThreads())
+		}
+		if err != nil {
+			simplelog.Errorf("during queries.json workload summary there was an error: %v", err)
+		}
+	}
+	return nil
+}
+
+// runSQLAnonymization replaces the literals of the sql in queries.json, the job profiles and the system table
+// exports, such as the query column of sys.jobs_recent, a file that cannot be anonymized is removed rather
+// than archived with its literals
+func runSQLAnonymization(c *conf.CollectConf) error {
+	anonymizer := sqlanon.New(sqlanon.Options{HashTableNames: c.AnonymizeSQLHashTableNames()})
+	var files []string
+	// the job profiles and system tables of Dremio Cloud projects are in a folder per project
+	for _, pattern := range []string{
+		filepath.Join(c.QueriesOutDir(), "queries*.json*"),
+		filepath.Join(filepath.Dir(c.JobProfilesOutDir()), "*", "*.zip"),
+		filepath.Join(filepath.Dir(c.SystemTablesOutDir()), "*", "*.ndjson"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return err
+		}
+		files = append(files, matches...)
+	}
+	var total sqlanon.Stats
+	for _, f := range files {
+		stats, err := anonymizer.File(f)
+		if err != nil {
+			simplelog.Errorf("unable to anonymize %v, removing it due to error %v", f, err)
+			if err := os.Remove(f); err != nil {
+				return fmt.Errorf("unable to remove %v that could not be anonymized: %w", f, err)
+			}
+		} else {
+			total.Add(stats)
+		}
+		// the parquet file of an export holds the same rows as its ndjson file
+		if strings.HasSuffix(f, ".ndjson") {
+			if err := apicollect.RewriteParquet(f); err != nil {
+				simplelog.Errorf("unable to anonymize the parquet file of %v: %v", f, err)
+			}
+		}
+	}
+	simplelog.Infof("anonymized %v queries, %v plans and %v dataset paths in %v files, %v lines that were not valid json were dropped", total.Queries, total.Plans, total.Datasets, len(files), total.Dropped)
 	return nil
 }
 
+// runRedaction applies the redaction rules of ddc.yaml to every collected file and writes the report next to them
+func runRedaction(c *conf.CollectConf) error {
+	redactor, err := redaction.New(c.RedactionRules())
+	if err != nil {
+		return err
+	}
+	simplelog.Infof("applying %v redaction rules to %v", len(c.RedactionRules()), c.OutputDir())
+	report, err := redactor.Dir(c.OutputDir(), c.NumberThreads())
+	if err != nil {
+		return err
+	}
+	redactParquet(c.OutputDir(), &report)
+	for _, rule := range report.Rules {
+		simplelog.Infof("redaction rule %v replaced %v matches", rule.Name, rule.Matches)
+	}
+	// named after the node as the reports of every node end up next to each other in the archive
+	return redaction.WriteReport(report, filepath.Join(c.OutputDir(), redaction.NodeReportFileName(c.NodeName())))
+}
+
+// redactParquet writes the parquet files of the system table exports again from their redacted ndjson files,
+// the redactor keeps them as binary and they would otherwise ship the values the rules replaced. A parquet
+// file that cannot be written again is removed and stays in the skipped files of the report
+func redactParquet(outputDir string, report *redaction.Report) {
+	var skipped []redaction.SkippedFile
+	for _, s := range report.Skipped {
+		if s.Reason != redaction.SkippedBinary || !strings.HasSuffix(s.File, ".parquet") {
+			skipped = append(skipped, s)
+			continue
+		}
+		pqFile := filepath.Join(outputDir, filepath.FromSlash(s.File))
+		ndjsonFile := strings.TrimSuffix(pqFile, ".parquet") + ".ndjson"
+		var err error
+		if _, statErr := os.Stat(ndjsonFile); statErr != nil {
+			err = fmt.Errorf("there is no %v to write it from: %v", filepath.Base(ndjsonFile), statErr)
+			if rmErr := os.Remove(pqFile); rmErr != nil {
+				err = fmt.Errorf("%v and it could not be removed: %v", err, rmErr)
+			}
+		} else {
+			err = apicollect.RewriteParquet(ndjsonFile)
+		}
+		if err != nil {
+			simplelog.Errorf("unable to write %v again from the redacted rows: %v", pqFile, err)
+			skipped = append(skipped, redaction.SkippedFile{File: s.File, Reason: fmt.Sprintf("removed as it could not be written again from the redacted rows: %v", err)})
+		}
+	}
+	if skipped == nil {
+		skipped = []redaction.SkippedFile{}
+	}
+	report.Skipped = skipped
+}
+
 func findClusterID(c *conf.CollectConf) (string, error) {
 	startTime := time.Now().Unix()
 	var clusterID string
@@ -463,6 +624,32 @@ func runCollectClusterStats(c *conf.CollectConf) error {
 	return os.WriteFile(filepath.Join(c.ClusterStatsOutDir(), "cluster-stats.json"), b, 0600)
 }
 
+// runCollectClusterStatsFromSystemTables takes the dremio version from the sys.version export as there is
+// no dremio process or rocksdb to read when only the rest api is collected, the cluster id stays empty
+func runCollectClusterStatsFromSystemTables(c *conf.CollectConf) error {
+	versionFile := filepath.Join(c.SystemTablesOutDir(), "sys.version.ndjson")
+	f, err := os.Open(filepath.Clean(versionFile))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(f).Decode(&version); err != nil {
+		return fmt.Errorf("unable to read the version from %v: %w", versionFile, err)
+	}
+	simplelog.Debugf("dremio version %v", version.Version)
+	b, err := json.Marshal(&clusterstats.ClusterStats{
+		DremioVersion: version.Version,
+		NodeName:      c.NodeName(),
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(c.ClusterStatsOutDir(), "cluster-stats.json"), b, 0600)
+}
+
 func runCollectOSConfig(c *conf.CollectConf) error {
 	simplelog.Debug("Collecting OS Information")
 	osInfoFile := filepath.Join(c.NodeInfoOutDir(), "os_info.txt")
@@ -586,23 +773,41 @@ var LocalCollectCmd = &cobra.Command{
 				}
 				//we do not want to log the token
 				simplelog.Debugf("overriding yaml with cli flag %v and value 'REDACTED'", flag.Name)
+			} else if conf.IsSecretKey(flag.Name) {
+				simplelog.Debugf("overriding yaml with cli flag %v and value 'REDACTED'", flag.Name)
+				overrides[flag.Name] = flag.Value.String()
 			} else {
 				simplelog.Debugf("overriding yaml with cli flag %v and value %q", flag.Name, flag.Value.String())
 				overrides[flag.Name] = flag.Value.String()
 			}
 		})
 		if patStdIn {
-			var inputReader io.Reader = cobraCmd.InOrStdin()
-			b, err := io.ReadAll(inputReader)
+			pat, err := conf.ReadStdIn(cobraCmd.InOrStdin(), conf.KeyDremioPatToken)
 			if err != nil {
 				fmt.Printf("\nCRITICAL ERROR: %v\n", err)
 				os.Exit(1)
 			}
-			pat := strings.TrimSpace(string(b[:]))
 			if pat != "" {
 				overrides[conf.KeyDremioPatToken] = pat
 			}
 		}
+		if passwordStdIn {
+			password, err := conf.ReadStdIn(cobraCmd.InOrStdin(), conf.KeyDremioPassword)
+			if err != nil {
+				fmt.Printf("\nCRITICAL ERROR: %v\n", err)
+				os.Exit(1)
+			}
+			if password != "" {
+				overrides[conf.KeyDremioPassword] = password
+			}
+		} else if promptPassword {
+			password, err := masking.PromptForPassword(overrides[conf.KeyDremioUsername])
+			if err != nil {
+				fmt.Printf("unable to get password due to: %v\n", err)
+				os.Exit(1)
+			}
+			overrides[conf.KeyDremioPassword] = password
+		}
 		msg, err := Execute(args, overrides)
 		if err != nil {
 			fmt.Printf("\nCRITICAL ERROR: %v\n", err)
@@ -647,11 +852,40 @@ func Execute(args []string, overrides map[string]string) (string, error) {
 	}
 
 	fmt.Println("looking for logs in: " + c.DremioLogDir())
+	msg, _, err := collectAndArchive(c, startTime)
+	return msg, err
+}
+
+// ExecuteAPIOnly runs only the rest api collections of a ddc.yaml against the dremio-endpoint of the overrides,
+// ddc api-collect uses it to collect from a workstation. It returns the configuration and the node tarball
+func ExecuteAPIOnly(ddcYaml, mode string, overrides map[string]string) (*conf.CollectConf, string, error) {
+	startTime := time.Now().Unix()
+	if err := validation.ValidateCollectMode(mode); err != nil {
+		return nil, "", err
+	}
+	overrides[conf.KeyAPIOnly] = "true"
+	c, err := conf.ReadConf(overrides, ddcYaml, mode)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read configuration %w", err)
+	}
+	msg, tarballName, err := collectAndArchive(c, startTime)
+	if err != nil {
+		return nil, "", err
+	}
+	simplelog.Info(msg)
+	return c, tarballName, nil
+}
+
+// collectAndArchive runs the collections of the configuration and archives them to <node-name>.tar.gz in
+// the tarball-out-dir, it returns a message for the console and the name of the tarball
+func collectAndArchive(c *conf.CollectConf, startTime int64) (string, string, error) {
+	pgzip.SetWorkers(c.CompressionThreads())
+	simplelog.Debugf("using %v compression threads", pgzip.Workers())
 
 	// Run application
 	simplelog.Info("Starting collection...")
 	if err := collect(c); err != nil {
-		return "", fmt.Errorf("unable to collect: %w", err)
+		return "", "", fmt.Errorf("unable to collect: %w", err)
 	}
 
 	logLoc := simplelog.GetLogLoc()
@@ -660,10 +894,20 @@ func Execute(args []string, overrides map[string]string) (string, error) {
 			simplelog.Warningf("unable to copy log to archive due to error %v", err)
 		}
 	}
+	if c.AnonymizeSQL() {
+		if err := runSQLAnonymization(c); err != nil {
+			return "", "", fmt.Errorf("unable to anonymize the collected sql, the archive was not created: %w", err)
+		}
+	}
+	if rules := c.RedactionRules(); len(rules) > 0 {
+		if err := runRedaction(c); err != nil {
+			return "", "", fmt.Errorf("unable to redact the collected files, the archive was not created: %w", err)
+		}
+	}
 	tarballName := filepath.Join(c.TarballOutDir(), c.NodeName()+".tar.gz")
 	simplelog.Debugf("collection complete. Archiving %v to %v...", c.OutputDir(), tarballName)
 	if err := archive.TarGzDir(c.OutputDir(), tarballName); err != nil {
-		return "", fmt.Errorf("unable to compress archive from folder '%v exiting due to error %w", c.OutputDir(), err)
+		return "", "", fmt.Errorf("unable to compress archive from folder '%v exiting due to error %w", c.OutputDir(), err)
 	}
 	if err := os.RemoveAll(c.OutputDir()); err != nil {
 		simplelog.Errorf("unable to remove %v: %v", c.OutputDir(), err)
@@ -673,9 +917,9 @@ func Execute(args []string, overrides map[string]string) (string, error) {
 	fi, err := os.Stat(tarballName)
 	if err != nil {
 		// quickly just supplying tarball name and elapsed
-		return fmt.Sprintf("file %v - %v secs collection", tarballName, endTime-startTime), nil
+		return fmt.Sprintf("file %v - %v secs collection", tarballName, endTime-startTime), tarballName, nil
 	}
-	return fmt.Sprintf("file %v - %v seconds for collection - size %v bytes", tarballName, endTime-startTime, fi.Size()), nil
+	return fmt.Sprintf("file %v - %v seconds for collection - size %v bytes", tarballName, endTime-startTime, fi.Size()), tarballName, nil
 }
 
 func init() {
@@ -689,8 +933,18 @@ func init() {
 		fmt.Printf("unable to mark flag hidden critical error %v", err)
 		os.Exit(1)
 	}
+	LocalCollectCmd.Flags().Int(conf.KeyCompressionThreads, 0, "number of threads used to gzip logs, heap dumps and the final tarball, 0 uses a quarter of the available cpus")
+	LocalCollectCmd.Flags().String(conf.KeySince, "", "only collect logs, queries.json, job history and job profiles from this time on, e.g. 2024-01-02T14:05:00Z, replaces the day counts of ddc.yaml")
+	LocalCollectCmd.Flags().String(conf.KeyUntil, "", "only collect logs, queries.json, job history and job profiles up to this time, e.g. 2024-01-02T14:40:00Z")
+	LocalCollectCmd.Flags().Bool(conf.KeyAnonymizeSQL, false, "replace the string and numeric literals of the sql in queries.json and the job profiles with typed placeholders")
+	LocalCollectCmd.Flags().Bool(conf.KeyAnonymizeSQLHashTableNames, false, "with --anonymize-sql also replace the table names with hashes")
 	LocalCollectCmd.Flags().Bool("allow-insecure-ssl", false, "When true allow insecure ssl certs when doing API calls")
 	LocalCollectCmd.Flags().BoolVar(&patStdIn, "pat-stdin", false, "allows one to pipe the pat to standard in")
+	LocalCollectCmd.Flags().String(conf.KeyDremioUsername, "", "Dremio user that logs in with a password when no pat is set")
+	LocalCollectCmd.Flags().String(conf.KeyDremioPasswordFile, "", "file with the password of --dremio-username on its first line")
+	LocalCollectCmd.Flags().BoolVar(&passwordStdIn, "password-stdin", false, "allows one to pipe the password of --dremio-username to standard in")
+	LocalCollectCmd.Flags().BoolVar(&promptPassword, "prompt-password", false, "prompt for the password of --dremio-username")
+	LocalCollectCmd.Flags().String(conf.KeyDremioCloudProjectIDs, "", "DREMIO CLOUD ONLY: comma separated ids of the projects to collect or 'all' for every project the PAT can see")
 	LocalCollectCmd.Flags().Bool("disable-rest-api", false, "disable all REST API calls, this will disable job profile, WLM, and KVM reports")
 	LocalCollectCmd.Flags().StringVar(&pid, "pid", "", "write a pid")
 	if err := LocalCollectCmd.Flags().MarkHidden("pid"); err != nil {
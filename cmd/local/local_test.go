@@ -16,7 +16,10 @@
 package cmd
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -27,6 +30,9 @@ import (
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/collects"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/parquet"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/redaction"
+	pq "github.com/parquet-go/parquet-go"
 )
 
 func writeConfWithYamlText(tmpOutputDir, yamlTextMinusTmpOutputDir string) string {
@@ -357,3 +363,69 @@ func TestValidateCollectFlag(t *testing.T) {
 		t.Error("collect should fail")
 	}
 }
+
+func TestRedactParquet(t *testing.T) {
+	outputDir := t.TempDir()
+	dir := filepath.Join(outputDir, "system-tables", "node1")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+	write := func(name, text string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(text), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("sys.users.schema.json", `[{"name":"user_name","type":{"name":"VARCHAR"}}]`)
+	write("sys.users.ndjson", `{"user_name":"acme-42"}`+"\n")
+	// a parquet file that lost its ndjson file cannot be written again
+	write("sys.roles.parquet", "PAR1\x00acme-42")
+	var pqFile bytes.Buffer
+	w, err := parquet.NewWriter(&pqFile, []parquet.Column{{Name: "user_name", Type: parquet.String}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]any{"acme-42"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	write("sys.users.parquet", pqFile.String())
+	redactor, err := redaction.New([]redaction.Rule{{Name: "customer", Pattern: `acme-\d+`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := redactor.Dir(outputDir, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	redactParquet(outputDir, &report)
+
+	if len(report.Skipped) != 1 || report.Skipped[0].File != "system-tables/node1/sys.roles.parquet" || !strings.HasPrefix(report.Skipped[0].Reason, "removed") {
+		t.Errorf("expected only sys.roles.parquet to be skipped as removed but was %+v", report.Skipped)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sys.roles.parquet")); !os.IsNotExist(err) {
+		t.Errorf("expected sys.roles.parquet to be removed but was %v", err)
+	}
+	f, err := pq.OpenFile(openBytes(t, filepath.Join(dir, "sys.users.parquet")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := make([]pq.Row, 2)
+	n, err := pq.NewReader(f).ReadRows(rows)
+	if err != nil && !errors.Is(err, io.EOF) {
+		t.Fatal(err)
+	}
+	if n != 1 || string(rows[0][0].ByteArray()) != "<REDACTED_CUSTOMER>" {
+		t.Errorf("expected the parquet file to hold the redacted user but was %v", rows[:n])
+	}
+}
+
+func openBytes(t *testing.T, fileName string) (io.ReaderAt, int64) {
+	t.Helper()
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(b), int64(len(b))
+}
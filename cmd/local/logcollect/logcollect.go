@@ -16,6 +16,7 @@
 package logcollect
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -25,7 +26,11 @@ import (
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/gclog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/logback"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/serverlog"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/timewindow"
 )
 
 type Collector struct {
@@ -36,10 +41,19 @@ type Collector struct {
 	queriesOutDir            string
 	dremioLogsNumDays        int
 	dremioQueriesJSONNumDays int
+	window                   timewindow.Window
+	trimNotes                *trimNotes
+	appenders                []logback.Appender
 }
 
-func NewLogCollector(dremioLogDir, logsOutDir, gcLogsDir, dremioGCFilePattern, queriesOutDir string, dremioQueriesJSONNumDays, dremioLogsNumDays int) *Collector {
+// NewLogCollector sets up log collection, when window is set it replaces the day counts so only
+// the logs covering the window are collected. The file appenders of logback.xml and logback-access.xml
+// in dremioConfDir decide where each log and its archives are found
+func NewLogCollector(dremioLogDir, dremioConfDir, logsOutDir, gcLogsDir, dremioGCFilePattern, queriesOutDir string, dremioQueriesJSONNumDays, dremioLogsNumDays int, window timewindow.Window) *Collector {
 	return &Collector{
+		window:                   window,
+		appenders:                discoverAppenders(dremioConfDir, dremioLogDir),
+		trimNotes:                &trimNotes{byDir: make(map[string][]TrimNote)},
 		dremioLogDir:             dremioLogDir,
 		logsOutDir:               logsOutDir,
 		dremioLogsNumDays:        dremioLogsNumDays,
@@ -53,7 +67,7 @@ func NewLogCollector(dremioLogDir, logsOutDir, gcLogsDir, dremioGCFilePattern, q
 func (l *Collector) RunCollectDremioServerLog() error {
 	simplelog.Debug("Collecting Dremio Server logs ...")
 	var errs []error
-	if err := l.exportArchivedLogs(l.dremioLogDir, "server.log", "server", l.dremioLogsNumDays); err != nil {
+	if err := l.exportArchivedLogs("server.log", "server", l.dremioLogsNumDays, serverlog.MustDefaultPattern()); err != nil {
 		errs = append(errs, fmt.Errorf("trying to archive server logs we got error: %v", err))
 	}
 	simplelog.Debug("... collecting server.out")
@@ -99,7 +113,13 @@ func (l *Collector) RunCollectGcLogs() error {
 				errs = append(errs, fmt.Errorf("while getting file info for %v there was an error: %v", srcPath, err))
 				continue
 			}
-			if f.ModTime().Before(logAgeLimit) {
+			if l.window.IsSet() {
+				// a gc log last written before the window starts has nothing in it
+				if !l.window.Since.IsZero() && f.ModTime().Before(l.window.Since) {
+					simplelog.Debugf("skipping file %v as it was last modified at %v before the window %v", srcPath, f.ModTime(), l.window)
+					continue
+				}
+			} else if f.ModTime().Before(logAgeLimit) {
 				simplelog.Debugf("skipping file %v due to having mode time of %v when logage is %v and current time of collection at %v resulting in all logs being skipped older than %v", srcPath, f.ModTime(), l.dremioLogsNumDays, now, logAgeLimit)
 				continue
 			}
@@ -121,9 +141,120 @@ func (l *Collector) RunCollectGcLogs() error {
 	return nil
 }
 
+// RunAnalyzeGcLogs parses the gc logs already copied to logsOutDir and writes a summary
+// of the pauses and heap usage next to them as gc-summary.json and gc-pauses.csv
+func RunAnalyzeGcLogs(logsOutDir, dremioGCFilePattern, nodeName string) error {
+	simplelog.Debug("Analyzing GC logs ...")
+	entries, err := os.ReadDir(path.Clean(logsOutDir))
+	if err != nil {
+		return fmt.Errorf("error reading directory: %w", err)
+	}
+	var files []string
+	for _, e := range entries {
+		if e.IsDir() || e.Name() == gclog.SummaryFileName || e.Name() == gclog.PausesFileName {
+			continue
+		}
+		matched, err := filepath.Match(dremioGCFilePattern, e.Name())
+		if err != nil {
+			return fmt.Errorf("error matching file pattern %v with error '%v'", dremioGCFilePattern, err)
+		}
+		if matched {
+			files = append(files, filepath.Join(logsOutDir, e.Name()))
+		}
+	}
+	if len(files) == 0 {
+		simplelog.Debugf("no gc logs matching %v in %v to analyze", dremioGCFilePattern, logsOutDir)
+		return nil
+	}
+	events, parseErr := gclog.ParseFiles(files)
+	if parseErr != nil {
+		// still write out what we could read
+		simplelog.Warningf("some gc logs could not be read: %v", parseErr)
+	}
+	summary := gclog.Summarize(nodeName, events, 10)
+	for _, f := range files {
+		summary.Files = append(summary.Files, filepath.Base(f))
+	}
+	b, err := json.MarshalIndent(summary, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to marshal gc summary due to error %v", err)
+	}
+	summaryFile := filepath.Join(logsOutDir, gclog.SummaryFileName)
+	if err := os.WriteFile(summaryFile, b, 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", summaryFile, err)
+	}
+	pausesFile := filepath.Join(logsOutDir, gclog.PausesFileName)
+	w, err := os.Create(filepath.Clean(pausesFile))
+	if err != nil {
+		return fmt.Errorf("unable to create %v due to error %v", pausesFile, err)
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", pausesFile, err)
+		}
+	}()
+	if err := gclog.WriteCSV(w, events); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", pausesFile, err)
+	}
+	simplelog.Debugf("... analyzing GC logs COMPLETED, %v pauses found in %v files", len(events), len(files))
+	return nil
+}
+
+// ServerLogPattern reads the pattern used for server.log from logback.xml, falling back to
+// the pattern Dremio ships with when the file is missing or has no server.log appender
+func ServerLogPattern(logbackXML string) *serverlog.Pattern {
+	data, err := os.ReadFile(filepath.Clean(logbackXML))
+	if err != nil {
+		simplelog.Debugf("using the default server.log pattern as %v could not be read: %v", logbackXML, err)
+		return serverlog.MustDefaultPattern()
+	}
+	pattern, err := serverlog.PatternFromLogback(data)
+	if err != nil || pattern == "" {
+		simplelog.Debugf("using the default server.log pattern as %v has no server.log appender: %v", logbackXML, err)
+		return serverlog.MustDefaultPattern()
+	}
+	p, err := serverlog.CompilePattern(pattern)
+	if err != nil {
+		simplelog.Warningf("using the default server.log pattern: %v", err)
+		return serverlog.MustDefaultPattern()
+	}
+	return p
+}
+
+// RunAnalyzeServerLogs groups the errors and warnings of the server logs already copied to
+// logsOutDir, including the gzipped archives, and writes them to server-log-errors.json
+func RunAnalyzeServerLogs(logsOutDir, logbackXML, nodeName string) error {
+	simplelog.Debug("Analyzing server logs ...")
+	files, err := filepath.Glob(filepath.Join(logsOutDir, "server*.log*"))
+	if err != nil {
+		return fmt.Errorf("unable to list server logs due to error %v", err)
+	}
+	summary := serverlog.Summary{Node: nodeName, Files: []string{}}
+	aggregator := serverlog.NewAggregator(ServerLogPattern(logbackXML), serverlog.DefaultFrames)
+	for _, f := range files {
+		lines, err := aggregator.AddFile(nodeName, f)
+		summary.LinesRead += lines
+		if err != nil {
+			simplelog.Warningf("unable to read all of %v: %v", f, err)
+		}
+		summary.Files = append(summary.Files, filepath.Base(f))
+	}
+	summary.Fingerprints = aggregator.Results()
+	b, err := json.MarshalIndent(summary, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to marshal server log summary due to error %v", err)
+	}
+	summaryFile := filepath.Join(logsOutDir, serverlog.SummaryFileName)
+	if err := os.WriteFile(summaryFile, b, 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", summaryFile, err)
+	}
+	simplelog.Debugf("... analyzing server logs COMPLETED, %v distinct errors and warnings in %v lines", len(summary.Fingerprints), summary.LinesRead)
+	return nil
+}
+
 func (l *Collector) RunCollectMetadataRefreshLogs() error {
 	simplelog.Debug("Collecting metadata refresh logs from Coordinator(s) ...")
-	if err := l.exportArchivedLogs(l.dremioLogDir, "metadata_refresh.log", "metadata_refresh", l.dremioLogsNumDays); err != nil {
+	if err := l.exportArchivedLogs("metadata_refresh.log", "metadata_refresh", l.dremioLogsNumDays, serverlog.MustDefaultPattern()); err != nil {
 		return fmt.Errorf("unable to collect metadata refresh logs due to error %v", err)
 	}
 	simplelog.Debug("... collecting meta data refresh logs from Coordinator(s) COMPLETED")
@@ -132,7 +263,7 @@ func (l *Collector) RunCollectMetadataRefreshLogs() error {
 
 func (l *Collector) RunCollectReflectionLogs() error {
 	simplelog.Debug("Collecting reflection logs from Coordinator(s) ...")
-	if err := l.exportArchivedLogs(l.dremioLogDir, "reflection.log", "reflection", l.dremioLogsNumDays); err != nil {
+	if err := l.exportArchivedLogs("reflection.log", "reflection", l.dremioLogsNumDays, serverlog.MustDefaultPattern()); err != nil {
 		return fmt.Errorf("unable to collect reflection logs due to error %v", err)
 	}
 	simplelog.Debug("... collecting reflection logs from Coordinator(s) COMPLETED")
@@ -142,7 +273,7 @@ func (l *Collector) RunCollectReflectionLogs() error {
 
 func (l *Collector) RunCollectDremioAccessLogs() error {
 	simplelog.Debug("Collecting access logs from Coordinator(s) ...")
-	if err := l.exportArchivedLogs(l.dremioLogDir, "access.log", "access", l.dremioLogsNumDays); err != nil {
+	if err := l.exportArchivedLogs("access.log", "access", l.dremioLogsNumDays, nil); err != nil {
 		return fmt.Errorf("unable to archive access.logs due to error %v", err)
 	}
 	simplelog.Debug("... collecting access logs from Coordinator(s) COMPLETED")
@@ -152,7 +283,7 @@ func (l *Collector) RunCollectDremioAccessLogs() error {
 
 func (l *Collector) RunCollectDremioAuditLogs() error {
 	simplelog.Debug("Collecting audit logs from Coordinator(s) ...")
-	if err := l.exportArchivedLogs(l.dremioLogDir, "audit.json", "audit", l.dremioLogsNumDays); err != nil {
+	if err := l.exportArchivedLogs("audit.json", "audit", l.dremioLogsNumDays, nil); err != nil {
 		return fmt.Errorf("unable to archive audit.json files due to error %v", err)
 	}
 	simplelog.Debug("... collecting audit logs from Coordinator(s) COMPLETED")
@@ -162,7 +293,7 @@ func (l *Collector) RunCollectDremioAuditLogs() error {
 
 func (l *Collector) RunCollectAccelerationLogs() error {
 	simplelog.Debug("Collecting acceleration logs from Coordinator(s) ...")
-	if err := l.exportArchivedLogs(l.dremioLogDir, "acceleration.log", "acceleration", l.dremioLogsNumDays); err != nil {
+	if err := l.exportArchivedLogs("acceleration.log", "acceleration", l.dremioLogsNumDays, serverlog.MustDefaultPattern()); err != nil {
 		return fmt.Errorf("unable to archive acceleration.logs due to error %v", err)
 	}
 	simplelog.Debug("... collecting acceleration logs from Coordinator(s) COMPLETED")
@@ -172,7 +303,7 @@ func (l *Collector) RunCollectAccelerationLogs() error {
 
 func (l *Collector) RunCollectQueriesJSON() error {
 	simplelog.Debug("Collecting queries.json ...")
-	err := l.exportArchivedLogs(l.dremioLogDir, "queries.json", "queries", l.dremioQueriesJSONNumDays)
+	err := l.exportArchivedLogs("queries.json", "queries", l.dremioQueriesJSONNumDays, nil)
 	if err != nil {
 		return fmt.Errorf("failed to export archived logs: %v", err)
 	}
@@ -181,64 +312,71 @@ func (l *Collector) RunCollectQueriesJSON() error {
 	return nil
 }
 
-func (l *Collector) exportArchivedLogs(srcLogDir string, unzippedFile string, logPrefix string, archiveDays int) error {
-	var errs []error
-	src := path.Join(srcLogDir, unzippedFile)
-	var outDir string
+// trimToWindow writes the records of src inside the window to dst, which must end in .gz, and notes
+// what was kept next to it
+func (l *Collector) trimToWindow(src, dst string, pattern *serverlog.Pattern) error {
+	note, err := TrimLog(src, dst, pattern, l.window)
+	if err != nil {
+		return err
+	}
+	simplelog.Debugf("trimmed %v to %v, kept %v of %v lines", src, l.window, note.LinesKept, note.LinesRead)
+	return l.trimNotes.add(filepath.Dir(dst), note)
+}
+
+// exportArchivedLogs copies one of the logs Dremio ships with, see source for where it is looked for
+func (l *Collector) exportArchivedLogs(unzippedFile string, logPrefix string, archiveDays int, defaultPattern *serverlog.Pattern) error {
+	outDir := l.logsOutDir
 	if logPrefix == "queries" {
 		outDir = l.queriesOutDir
-	} else {
-		outDir = l.logsOutDir
 	}
-	unzippedFileDest := path.Join(outDir, unzippedFile)
-	//we must copy before archival to avoid races around the archiving features of logging (which also use gzip)
-	if err := ddcio.CopyFile(path.Clean(src), path.Clean(unzippedFileDest)); err != nil {
-		errs = append(errs, fmt.Errorf("copying of log file %v failed due to error %v", unzippedFile, err))
-	} else {
-		// if this is successful go ahead and gzip it
-		if err := ddcio.GzipFile(path.Clean(unzippedFileDest), path.Clean(unzippedFileDest+".gz")); err != nil {
-			errs = append(errs, fmt.Errorf("archiving of log file %v failed due to error %v", unzippedFile, err))
-		} else {
-			//if we've successfully gzipped the file we can safely delete the source
+	src, err := l.source(unzippedFile, logPrefix, outDir, defaultPattern)
+	if err != nil {
+		return err
+	}
+	return l.exportLog(src, archiveDays)
+}
+
+// exportLog copies the live log and the archives of the days being collected. When a window is set and the
+// log has a logback pattern the logs are trimmed to the records inside the window, otherwise they are copied whole
+func (l *Collector) exportLog(src logSource, archiveDays int) error {
+	var errs []error
+	trim := l.window.IsSet() && src.pattern != nil
+	today := time.Now()
+	if src.live != "" {
+		unzippedFile := filepath.Base(src.live)
+		unzippedFileDest := path.Join(src.outDir, unzippedFile)
+		//we must copy before archival to avoid races around the archiving features of logging (which also use gzip)
+		if !l.window.OverlapsDay(today) {
+			// the live log only holds today, archives are searched below
+			simplelog.Debugf("skipping %v as today is outside the window %v", src.live, l.window)
+		} else if err := ddcio.CopyFile(path.Clean(src.live), path.Clean(unzippedFileDest)); err != nil {
+			errs = append(errs, fmt.Errorf("copying of log file %v failed due to error %v", unzippedFile, err))
+		} else if trim {
+			if err := l.trimToWindow(path.Clean(unzippedFileDest), path.Clean(unzippedFileDest+".gz"), src.pattern); err != nil {
+				errs = append(errs, fmt.Errorf("trimming of log file %v failed due to error %v", unzippedFile, err))
+			}
 			if err := os.Remove(path.Clean(unzippedFileDest)); err != nil {
 				errs = append(errs, fmt.Errorf("cleanup of old log file %v failed due to error %v", unzippedFile, err))
 			}
+		} else {
+			// if this is successful go ahead and gzip it
+			if err := ddcio.GzipFile(path.Clean(unzippedFileDest), path.Clean(unzippedFileDest+".gz")); err != nil {
+				errs = append(errs, fmt.Errorf("archiving of log file %v failed due to error %v", unzippedFile, err))
+			} else {
+				//if we've successfully gzipped the file we can safely delete the source
+				if err := os.Remove(path.Clean(unzippedFileDest)); err != nil {
+					errs = append(errs, fmt.Errorf("cleanup of old log file %v failed due to error %v", unzippedFile, err))
+				}
+			}
 		}
 	}
 
-	today := time.Now()
-	files, err := os.ReadDir(filepath.Join(srcLogDir, "archive"))
-	if err != nil {
-		//no archives to read go ahead and exist as there is nothing to do
-		return fmt.Errorf("unable to read archive folder due to error %v", err)
-	}
-	for i := 0; i <= archiveDays; i++ {
-		processingDate := today.AddDate(0, 0, -i).Format("2006-01-02")
-		//now search files for a match
-		for _, f := range files {
-			if strings.HasPrefix(f.Name(), fmt.Sprintf("%v.%v", logPrefix, processingDate)) {
-				simplelog.Debugf("Copying archive file for %v:%v", processingDate, f.Name())
-				src := filepath.Join(srcLogDir, "archive", f.Name())
-				dst := filepath.Join(outDir, f.Name())
-
-				//we must copy before archival to avoid races around the archiving features of logging (which also use gzip)
-				if err := ddcio.CopyFile(path.Clean(src), path.Clean(dst)); err != nil {
-					errs = append(errs, fmt.Errorf("unable to move file %v to %v due to error %v", src, dst, err))
-					continue
-				}
-				if !strings.HasSuffix(f.Name(), ".gz") {
-					//go ahead and archive the file since it's not already
-					if err := ddcio.GzipFile(path.Clean(dst), path.Clean(dst+".gz")); err != nil {
-						errs = append(errs, fmt.Errorf("unable to archive file %v to %v due to error %v", src, dst, err))
-						continue
-					}
-					//if we've successfully gzipped the file we can safely delete the source (the continue above will guard against executing this)
-					if err := os.Remove(path.Clean(dst)); err != nil {
-						errs = append(errs, fmt.Errorf("cleanup of old log file %v failed due to error %v", unzippedFile, err))
-					}
-
-				}
-			}
+	if src.archives != nil {
+		if _, err := os.Stat(src.archives.Dir()); err != nil {
+			//no archives to read
+			errs = append(errs, fmt.Errorf("unable to read archive folder due to error %v", err))
+		} else if err := l.exportArchives(src, trim, archiveDays, today); err != nil {
+			errs = append(errs, err)
 		}
 	}
 	if len(errs) > 1 {
@@ -248,3 +386,86 @@ func (l *Collector) exportArchivedLogs(srcLogDir string, unzippedFile string, lo
 	}
 	return nil
 }
+
+// archiveName is the name an archive is collected under. Archives rolled into directories named after the
+// date, such as 2024-05-01/server.0.log.gz, would collide by their base name so the directories below dir
+// go in after the first part of the name, server.2024-05-01.0.log.gz, which keeps the log prefix first
+func archiveName(dir, f string) string {
+	rel, err := filepath.Rel(dir, f)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return filepath.Base(f)
+	}
+	relDir, base := filepath.Split(rel)
+	if relDir == "" {
+		return base
+	}
+	tag := strings.ReplaceAll(filepath.ToSlash(filepath.Clean(relDir)), "/", "-")
+	stem, rest, found := strings.Cut(base, ".")
+	if !found {
+		return base + "-" + tag
+	}
+	return stem + "." + tag + "." + rest
+}
+
+// exportArchives copies the archives the rolling policy wrote for the window, or for the last archiveDays days
+// when there is no window. Archives without a date in their name are chosen by their last modification
+func (l *Collector) exportArchives(src logSource, trim bool, archiveDays int, today time.Time) error {
+	candidates, err := src.archives.Glob()
+	if err != nil {
+		return fmt.Errorf("unable to list archives of %v due to error %v", src.name, err)
+	}
+	cutoff := time.Date(today.Year(), today.Month(), today.Day()-archiveDays, 0, 0, 0, 0, time.Local)
+	var errs []error
+	for _, f := range candidates {
+		if f == src.live || !src.archives.Match(f) {
+			continue
+		}
+		start, end, ok := src.archives.Period(f)
+		if !ok {
+			fi, err := os.Stat(f)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("unable to read %v due to error %v", f, err))
+				continue
+			}
+			// the last write is the end of what the file covers
+			start, end = time.Time{}, fi.ModTime()
+		}
+		if l.window.IsSet() {
+			if !l.window.Overlaps(start, end.Add(-time.Nanosecond)) {
+				continue
+			}
+		} else if !end.After(cutoff) {
+			continue
+		}
+		name := archiveName(src.archives.Dir(), f)
+		simplelog.Debugf("Copying archive file for %v:%v", src.name, name)
+		dst := filepath.Join(src.outDir, name)
+		if trim {
+			// archives are read in place, only the records inside the window are written
+			if !strings.HasSuffix(dst, ".gz") {
+				dst += ".gz"
+			}
+			if err := l.trimToWindow(path.Clean(f), path.Clean(dst), src.pattern); err != nil {
+				errs = append(errs, fmt.Errorf("unable to trim file %v to %v due to error %v", f, dst, err))
+			}
+			continue
+		}
+		//we must copy before archival to avoid races around the archiving features of logging (which also use gzip)
+		if err := ddcio.CopyFile(path.Clean(f), path.Clean(dst)); err != nil {
+			errs = append(errs, fmt.Errorf("unable to move file %v to %v due to error %v", f, dst, err))
+			continue
+		}
+		if !strings.HasSuffix(name, ".gz") {
+			//go ahead and archive the file since it's not already
+			if err := ddcio.GzipFile(path.Clean(dst), path.Clean(dst+".gz")); err != nil {
+				errs = append(errs, fmt.Errorf("unable to archive file %v to %v due to error %v", f, dst, err))
+				continue
+			}
+			//if we've successfully gzipped the file we can safely delete the source (the continue above will guard against executing this)
+			if err := os.Remove(path.Clean(dst)); err != nil {
+				errs = append(errs, fmt.Errorf("cleanup of old log file %v failed due to error %v", name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
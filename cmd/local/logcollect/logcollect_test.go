@@ -15,15 +15,22 @@
 package logcollect_test
 
 import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/ddcio"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/logcollect"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/gclog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/serverlog"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/tests"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/timewindow"
 )
 
 func cleanUp(dirs ...string) {
@@ -63,12 +70,14 @@ var setupEnv = func() (destinationDir, logDir string) {
 	}
 	logCollector = *logcollect.NewLogCollector(
 		logDir,
+		"",
 		destinationDir,
 		testGCLogsDir,
 		"gc.*.log*",
 		destinationQueriesJSON,
 		dremioQueriesJSONDays,
 		dremioLogDays,
+		timewindow.Window{},
 	)
 	return destinationDir, logDir
 }
@@ -927,3 +936,321 @@ func TestLogCollect_WhenGCLogsArePresentAndThereAreMoreThanOne(t *testing.T) {
 		})
 	}
 }
+
+func TestRunAnalyzeGcLogs(t *testing.T) {
+	logsOutDir := t.TempDir()
+	if err := ddcio.CopyFile(filepath.Join("..", "..", "..", "pkg", "gclog", "testdata", "gc-unified.log"), filepath.Join(logsOutDir, "gc.0.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := logcollect.RunAnalyzeGcLogs(logsOutDir, "gc*.log*", "node1"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(logsOutDir, gclog.SummaryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary gclog.Summary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Node != "node1" || summary.Pauses != 6 || summary.FullGCs != 1 {
+		t.Errorf("unexpected summary %#v", summary)
+	}
+	if len(summary.Files) != 1 || summary.Files[0] != "gc.0.log" {
+		t.Errorf("expected only the gc log to be read but was %v", summary.Files)
+	}
+	if _, err := os.Stat(filepath.Join(logsOutDir, gclog.PausesFileName)); err != nil {
+		t.Errorf("expected the pauses csv to be written: %v", err)
+	}
+	// running it again must not pick up its own output
+	if err := logcollect.RunAnalyzeGcLogs(logsOutDir, "gc*", "node1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunAnalyzeServerLogs(t *testing.T) {
+	logsOutDir := t.TempDir()
+	serverLog := filepath.Join("..", "..", "..", "pkg", "serverlog", "testdata", "server.log")
+	if err := ddcio.GzipFile(serverLog, filepath.Join(logsOutDir, "server.log.gz")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ddcio.CopyFile(serverLog, filepath.Join(logsOutDir, "server.2024-01-01.0.log")); err != nil {
+		t.Fatal(err)
+	}
+	if err := logcollect.RunAnalyzeServerLogs(logsOutDir, filepath.Join(logsOutDir, "missing-logback.xml"), "node1"); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(logsOutDir, serverlog.SummaryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary serverlog.Summary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Files) != 2 || summary.LinesRead != 42 {
+		t.Errorf("expected both logs to be read but was %#v", summary)
+	}
+	if len(summary.Fingerprints) != 2 || summary.Fingerprints[0].Count != 4 {
+		t.Errorf("unexpected fingerprints %#v", summary.Fingerprints)
+	}
+}
+
+func TestLogCollect_WhenWindowIsSetOnlyArchivesInTheWindowAreCollected(t *testing.T) {
+	destinationDir, testLogDir := setupEnv()
+	defer cleanUp(destinationDir, testLogDir)
+	defer AfterEachLogCollectTest()
+	if err := ddcio.CopyDir(startLogDir, testLogDir); err != nil {
+		t.Fatalf("unexpected error setting up the test directory: %v", err)
+	}
+	if err := ddcio.CopyFile(filepath.Join(testLogDir, "archive", "server.2022-04-30.log.gz"), filepath.Join(testLogDir, "archive", "server.2022-05-02.log.gz")); err != nil {
+		t.Fatalf("unexpected error setting up the test directory: %v", err)
+	}
+	window := timewindow.Window{
+		Since: time.Date(2022, 4, 30, 10, 0, 0, 0, time.Local),
+		Until: time.Date(2022, 4, 30, 12, 0, 0, 0, time.Local),
+	}
+	windowCollector := logcollect.NewLogCollector(testLogDir, "", destinationDir, testGCLogsDir, "gc.*.log*", destinationQueriesJSON, dremioQueriesJSONDays, dremioLogDays, window)
+	if err := windowCollector.RunCollectDremioServerLog(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	tests.Tree(destinationDir)
+	if _, err := os.Stat(filepath.Join(destinationDir, "server.2022-04-30.log.gz")); err != nil {
+		t.Errorf("expected the archive inside the window to be collected: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(destinationDir, "server.2022-05-02.log.gz")); err == nil {
+		t.Error("expected the archive outside the window to be skipped")
+	}
+	if _, err := os.Stat(filepath.Join(destinationDir, "server.log.gz")); err == nil {
+		t.Error("expected the live log to be skipped as today is outside the window")
+	}
+	b, err := os.ReadFile(filepath.Join(destinationDir, logcollect.TrimNotesFileName))
+	if err != nil {
+		t.Fatalf("expected trim notes to be written: %v", err)
+	}
+	var notes []logcollect.TrimNote
+	if err := json.Unmarshal(b, &notes); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(notes) != 1 || notes[0].File != "server.2022-04-30.log.gz" {
+		t.Errorf("expected a single note for server.2022-04-30.log.gz but was %#v", notes)
+	}
+}
+
+func readGzip(t *testing.T, fileName string) string {
+	f, err := os.Open(filepath.Clean(fileName))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return string(b)
+}
+
+func TestTrimLog(t *testing.T) {
+	window := timewindow.Window{
+		Since: time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local),
+		Until: time.Date(2024, 1, 2, 10, 30, 0, 0, time.Local),
+	}
+	src := filepath.Join("testdata", "trim", "server.log")
+	gzSrc := filepath.Join(t.TempDir(), "server.2024-01-02.log.gz")
+	if err := ddcio.GzipFile(src, gzSrc); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := "2024-01-02 10:00:00,000 [main] INFO  c.d.dac.server.DremioServer - first in the window\n" +
+		"2024-01-02 10:15:32,410 [1c2f-foreman] ERROR c.d.exec.work.foreman.AttemptManager - query failed\n" +
+		"java.lang.IllegalStateException: bad state\n" +
+		"\tat com.dremio.exec.work.foreman.AttemptManager.run(AttemptManager.java:120)\n" +
+		"\tat java.lang.Thread.run(Thread.java:750)\n" +
+		"2024-01-02 10:30:00,000 [main] WARN  c.d.dac.server.DremioServer - last in the window\n"
+	for _, source := range []string{src, gzSrc} {
+		dst := filepath.Join(t.TempDir(), "server.log.gz")
+		note, err := logcollect.TrimLog(source, dst, serverlog.MustDefaultPattern(), window)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		actual := readGzip(t, dst)
+		if actual != expected {
+			t.Errorf("expected trimmed log of %v to be\n%q\nbut was\n%q", source, expected, actual)
+		}
+		if note.LinesRead != 13 || note.LinesKept != 6 {
+			t.Errorf("expected 13 lines read and 6 kept but was %v and %v", note.LinesRead, note.LinesKept)
+		}
+		if note.RecordsKept != 3 || note.RecordsDropped != 3 {
+			t.Errorf("expected 3 records kept and 3 dropped but was %v and %v", note.RecordsKept, note.RecordsDropped)
+		}
+		if !note.StoppedEarly {
+			t.Error("expected the log to be read only up to the end of the window")
+		}
+	}
+}
+
+func TestTrimLogKeepsLeadInWithTheFirstRecord(t *testing.T) {
+	window := timewindow.Window{Since: time.Date(2024, 1, 2, 9, 0, 0, 0, time.Local)}
+	dst := filepath.Join(t.TempDir(), "server.log.gz")
+	note, err := logcollect.TrimLog(filepath.Join("testdata", "trim", "server.log"), dst, serverlog.MustDefaultPattern(), window)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if note.LinesKept != note.LinesRead || note.LinesRead != 14 {
+		t.Errorf("expected all 14 lines to be kept but %v of %v were", note.LinesKept, note.LinesRead)
+	}
+	if note.StoppedEarly {
+		t.Error("expected the whole log to be read without an until")
+	}
+}
+
+func TestTrimLogCopiesALogThePatternDoesNotMatch(t *testing.T) {
+	window := timewindow.Window{Since: time.Date(2024, 1, 2, 9, 0, 0, 0, time.Local)}
+	src := filepath.Join(t.TempDir(), "server.log")
+	content := "02/01/2024 10:00:00 INFO custom layout\n02/01/2024 10:00:01 WARN still custom\n"
+	if err := os.WriteFile(src, []byte(content), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	dst := filepath.Join(t.TempDir(), "server.log.gz")
+	note, err := logcollect.TrimLog(src, dst, serverlog.MustDefaultPattern(), window)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if actual := readGzip(t, dst); actual != content {
+		t.Errorf("expected the log to be copied whole but was %q", actual)
+	}
+	if !note.Untrimmed || note.Reason == "" || note.LinesKept != 2 || note.LinesRead != 2 {
+		t.Errorf("expected the note to record the log was not trimmed but was %+v", note)
+	}
+
+	// a long lead in is not held in memory until the end of the log
+	var long strings.Builder
+	for long.Len() <= 2*1024*1024 {
+		long.WriteString("a line of a layout the pattern does not know about\n")
+	}
+	if err := os.WriteFile(src, []byte(long.String()), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	note, err = logcollect.TrimLog(src, dst, serverlog.MustDefaultPattern(), window)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !note.Untrimmed || readGzip(t, dst) != long.String() {
+		t.Errorf("expected the long log to be copied whole but was %+v", note)
+	}
+}
+
+func TestLogCollect_WhenLogbackConfiguresTheLogs(t *testing.T) {
+	logDir := t.TempDir()
+	confDir := t.TempDir()
+	destinationDir := t.TempDir()
+	logback := `<configuration>
+  <appender name="text" class="ch.qos.logback.core.rolling.RollingFileAppender">
+    <file>${dremio.log.path}/server.log</file>
+    <rollingPolicy class="ch.qos.logback.core.rolling.SizeAndTimeBasedRollingPolicy">
+      <fileNamePattern>${dremio.log.path}/rolled/server.%d{yyyy-MM-dd}.%i.log.gz</fileNamePattern>
+    </rollingPolicy>
+    <encoder><pattern>%date{ISO8601} [%thread] %-5level %logger{36} - %msg%n</pattern></encoder>
+  </appender>
+  <appender name="vacuum" class="ch.qos.logback.core.rolling.RollingFileAppender">
+    <file>${dremio.log.path}/vacuum.json</file>
+    <rollingPolicy class="ch.qos.logback.core.rolling.TimeBasedRollingPolicy">
+      <fileNamePattern>${dremio.log.path}/archive/vacuum.%d{yyyy-MM-dd}.json</fileNamePattern>
+    </rollingPolicy>
+    <encoder><pattern>%msg%n</pattern></encoder>
+  </appender>
+</configuration>`
+	if err := os.WriteFile(filepath.Join(confDir, "logback.xml"), []byte(logback), 0600); err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().Format("2006-01-02")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	files := []string{
+		"server.log",
+		filepath.Join("rolled", "server."+yesterday+".0.log.gz"),
+		filepath.Join("rolled", "server."+yesterday+".1.log.gz"),
+		filepath.Join("rolled", "server.2022-04-30.0.log.gz"),
+		"vacuum.json",
+		filepath.Join("archive", "vacuum."+today+".json"),
+		filepath.Join("archive", "vacuum.2022-04-30.json"),
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(logDir, f)), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(logDir, f), []byte(f+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collector := logcollect.NewLogCollector(logDir, confDir, destinationDir, testGCLogsDir, "gc.*.log*", destinationDir, 2, 2, timewindow.Window{})
+	if err := collector.RunCollectDremioServerLog(); err == nil {
+		t.Error("expected an error for the missing server.out")
+	}
+	if err := collector.RunCollectCustomLogs(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	tests.Tree(destinationDir)
+	for _, expected := range []string{"server.log.gz", "server." + yesterday + ".0.log.gz", "server." + yesterday + ".1.log.gz", "vacuum.json.gz", "vacuum." + today + ".json.gz"} {
+		if _, err := os.Stat(filepath.Join(destinationDir, expected)); err != nil {
+			t.Errorf("expected %v to be collected: %v", expected, err)
+		}
+	}
+	for _, unexpected := range []string{"server.2022-04-30.0.log.gz", "vacuum.2022-04-30.json.gz"} {
+		if _, err := os.Stat(filepath.Join(destinationDir, unexpected)); err == nil {
+			t.Errorf("expected %v to be older than the days collected", unexpected)
+		}
+	}
+}
+
+func TestLogCollect_WhenArchivesAreRolledIntoDateDirectories(t *testing.T) {
+	logDir := t.TempDir()
+	confDir := t.TempDir()
+	destinationDir := t.TempDir()
+	logback := `<configuration>
+  <appender name="text" class="ch.qos.logback.core.rolling.RollingFileAppender">
+    <file>${dremio.log.path}/server.log</file>
+    <rollingPolicy class="ch.qos.logback.core.rolling.SizeAndTimeBasedRollingPolicy">
+      <fileNamePattern>${dremio.log.path}/archive/%d{yyyy-MM-dd}/server.%i.log.gz</fileNamePattern>
+    </rollingPolicy>
+    <encoder><pattern>%date{ISO8601} [%thread] %-5level %logger{36} - %msg%n</pattern></encoder>
+  </appender>
+</configuration>`
+	if err := os.WriteFile(filepath.Join(confDir, "logback.xml"), []byte(logback), 0600); err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().Format("2006-01-02")
+	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	files := []string{
+		"server.log",
+		filepath.Join("archive", today, "server.0.log.gz"),
+		filepath.Join("archive", yesterday, "server.0.log.gz"),
+		filepath.Join("archive", yesterday, "server.1.log.gz"),
+	}
+	for _, f := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(logDir, f)), 0750); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(logDir, f), []byte(f+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	collector := logcollect.NewLogCollector(logDir, confDir, destinationDir, testGCLogsDir, "gc.*.log*", destinationDir, 2, 2, timewindow.Window{})
+	if err := collector.RunCollectDremioServerLog(); err == nil {
+		t.Error("expected an error for the missing server.out")
+	}
+	for _, f := range files[1:] {
+		dir, base := filepath.Split(f)
+		expected := strings.Replace(base, "server.", "server."+filepath.Base(dir)+".", 1)
+		b, err := os.ReadFile(filepath.Join(destinationDir, expected))
+		if err != nil {
+			t.Errorf("expected %v to be collected as %v: %v", f, expected, err)
+			continue
+		}
+		if string(b) != f+"\n" {
+			t.Errorf("expected %v to hold '%v' but was '%v'", expected, f, string(b))
+		}
+	}
+}
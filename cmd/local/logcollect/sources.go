@@ -0,0 +1,148 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logcollect
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/logback"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/serverlog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// knownLogs are the files of the logs Dremio ships with, each has its own collection step
+var knownLogs = []string{"server.log", "metadata_refresh.log", "reflection.log", "access.log", "audit.json", "acceleration.log", "queries.json"}
+
+// logSource is a log and the archives it rolls into
+type logSource struct {
+	name string
+	// live is the file being written to, empty when the rolling policy names the active file
+	live string
+	// archives is nil when the log does not roll
+	archives *logback.FileNamePattern
+	// pattern finds the records of the log when trimming it, nil copies the log whole
+	pattern *serverlog.Pattern
+	outDir  string
+}
+
+// discoverAppenders reads the file appenders of logback.xml and logback-access.xml, appenders using
+// variables that are only known to the running process are skipped
+func discoverAppenders(dremioConfDir, dremioLogDir string) []logback.Appender {
+	if dremioConfDir == "" {
+		return nil
+	}
+	vars := map[string]string{logback.LogPathProperty: dremioLogDir}
+	var appenders []logback.Appender
+	for _, name := range []string{"logback.xml", "logback-access.xml"} {
+		found, err := logback.ParseFile(filepath.Join(dremioConfDir, name), vars)
+		if errors.Is(err, os.ErrNotExist) {
+			simplelog.Debugf("no %v in %v, using the default log locations", name, dremioConfDir)
+			continue
+		}
+		if err != nil {
+			simplelog.Warningf("unable to read the appenders of %v, using the default log locations: %v", name, err)
+			continue
+		}
+		for _, a := range found {
+			if len(a.Undefined) > 0 {
+				simplelog.Warningf("skipping appender %v of %v as the variables %v are not defined", a.Name, name, strings.Join(a.Undefined, ", "))
+				continue
+			}
+			simplelog.Debugf("found appender %v writing to '%v' rolled to '%v'", a.Name, a.File, a.FileNamePattern)
+			appenders = append(appenders, a)
+		}
+	}
+	return appenders
+}
+
+// appenderSource describes the log of an appender, the log is only trimmed when its pattern has a level and message
+func appenderSource(a logback.Appender, outDir string) (logSource, error) {
+	src := logSource{name: a.Name, live: a.File, outDir: outDir}
+	if a.File != "" {
+		src.name = filepath.Base(a.File)
+	}
+	if a.FileNamePattern != "" {
+		archives, err := logback.CompileFileNamePattern(a.FileNamePattern)
+		if err != nil {
+			return src, fmt.Errorf("unable to read the rolling policy of appender %v due to error %v", a.Name, err)
+		}
+		src.archives = archives
+	}
+	if a.Pattern != "" {
+		if p, err := serverlog.CompilePattern(a.Pattern); err == nil {
+			src.pattern = p
+		} else {
+			simplelog.Debugf("the %v log will not be trimmed: %v", src.name, err)
+		}
+	}
+	return src, nil
+}
+
+// source finds where a log is written and rolled to from its appender, or from the layout Dremio ships with,
+// file in the log dir and archive/<prefix>.<yyyy-MM-dd>*, when logback.xml has no appender for it
+func (l *Collector) source(file, prefix, outDir string, defaultPattern *serverlog.Pattern) (logSource, error) {
+	if a, ok := logback.FindByFile(l.appenders, file); ok {
+		return appenderSource(a, outDir)
+	}
+	archives, err := logback.CompileFileNamePattern(filepath.Join(l.dremioLogDir, "archive", prefix+".%d{yyyy-MM-dd}*"))
+	if err != nil {
+		return logSource{}, err
+	}
+	return logSource{
+		name:     file,
+		live:     filepath.Join(l.dremioLogDir, file),
+		archives: archives,
+		pattern:  defaultPattern,
+		outDir:   outDir,
+	}, nil
+}
+
+// RunCollectCustomLogs collects the logs of the file appenders in logback.xml and logback-access.xml
+// other than the ones Dremio ships with, following their rolling policy
+func (l *Collector) RunCollectCustomLogs() error {
+	simplelog.Debug("Collecting custom logs ...")
+	var errs []error
+	for _, a := range l.appenders {
+		if a.File != "" && isKnownLog(filepath.Base(a.File)) {
+			continue
+		}
+		src, err := appenderSource(a, l.logsOutDir)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := l.exportLog(src, l.dremioLogsNumDays); err != nil {
+			errs = append(errs, fmt.Errorf("unable to collect the logs of appender %v due to error %v", a.Name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	simplelog.Debug("... collecting custom logs COMPLETED")
+	return nil
+}
+
+func isKnownLog(baseName string) bool {
+	for _, k := range knownLogs {
+		if k == baseName {
+			return true
+		}
+	}
+	return false
+}
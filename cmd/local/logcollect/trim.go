@@ -0,0 +1,261 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logcollect
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pgzip"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/serverlog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/timewindow"
+)
+
+// TrimNotesFileName lists the logs that were cut down to the --since and --until window, it is
+// written next to the trimmed logs
+const TrimNotesFileName = "trimmed-logs.json"
+
+// trimSlack is how far past the end of the window reading continues, threads log slightly out of order
+const trimSlack = time.Minute
+
+// maxLeadIn is how much of the start of a log is held back waiting for its first record, a log with
+// more than that before a line the pattern reads a time from is not in the layout of the pattern
+const maxLeadIn = 1024 * 1024
+
+// errNoRecords is returned by trimLines when the pattern found no record to trim by, nothing was written
+var errNoRecords = errors.New("no line matches the log pattern")
+
+// TrimNote records what was kept of one log when it was trimmed to the window
+type TrimNote struct {
+	File           string `json:"file"`
+	Source         string `json:"source"`
+	Window         string `json:"window"`
+	SourceBytes    int64  `json:"sourceBytes"`
+	LinesRead      int    `json:"linesRead"`
+	LinesKept      int    `json:"linesKept"`
+	RecordsKept    int    `json:"recordsKept"`
+	RecordsDropped int    `json:"recordsDropped"`
+	// StoppedEarly is set when the rest of the log was skipped as it was past the end of the window
+	StoppedEarly bool `json:"stoppedEarly"`
+	// Untrimmed is set when the log was copied whole as the pattern matched none of its records
+	Untrimmed bool   `json:"untrimmed,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// trimNotes gathers the notes of each output directory, logs are collected in parallel
+type trimNotes struct {
+	mu    sync.Mutex
+	byDir map[string][]TrimNote
+}
+
+// add records the note and rewrites the notes file of dir
+func (n *trimNotes) add(dir string, note TrimNote) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	notes := append(n.byDir[dir], note)
+	sort.Slice(notes, func(i, j int) bool {
+		return notes[i].File < notes[j].File
+	})
+	n.byDir[dir] = notes
+	b, err := json.MarshalIndent(notes, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to marshal trim notes due to error %v", err)
+	}
+	notesFile := filepath.Join(dir, TrimNotesFileName)
+	if err := os.WriteFile(notesFile, b, 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", notesFile, err)
+	}
+	return nil
+}
+
+// TrimLog copies the records of the log src, plain or gzipped, that were logged inside the window
+// into the gzip file dst. Stack trace and other continuation lines go with the record they follow,
+// lines before the first record go with that record and records the pattern has no time for are kept
+func TrimLog(src, dst string, pattern *serverlog.Pattern, window timewindow.Window) (TrimNote, error) {
+	note := TrimNote{
+		File:   filepath.Base(dst),
+		Source: filepath.Base(src),
+		Window: window.String(),
+	}
+	f, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return note, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", src, err)
+		}
+	}()
+	if fi, err := f.Stat(); err == nil {
+		note.SourceBytes = fi.Size()
+	}
+	reader, err := logReader(f, src)
+	if err != nil {
+		return note, err
+	}
+	out, err := os.Create(filepath.Clean(dst))
+	if err != nil {
+		return note, err
+	}
+	defer func() {
+		if err := out.Close(); err != nil {
+			simplelog.Errorf("unable to close gzip file %v due to error %v", dst, err)
+		}
+	}()
+	gzipWriter := pgzip.NewWriter(out)
+	w := bufio.NewWriter(gzipWriter)
+	err = trimLines(bufio.NewReader(reader), w, pattern, window, &note)
+	if errors.Is(err, errNoRecords) {
+		// nothing was written yet, rather than losing the log it is copied as it is
+		simplelog.Warningf("unable to trim %v to %v as %v, it is collected whole", src, window, err)
+		note.Untrimmed = true
+		note.Reason = err.Error()
+		note.LinesKept = 0
+		err = copyWholeLog(f, src, w, &note)
+	}
+	if err != nil {
+		if closeErr := gzipWriter.Close(); closeErr != nil {
+			simplelog.Debugf("optional close of gzip writer for %v failed %v", dst, closeErr)
+		}
+		return note, fmt.Errorf("unable to trim %v due to error %v", src, err)
+	}
+	if err := w.Flush(); err != nil {
+		return note, fmt.Errorf("unable to write %v due to error %v", dst, err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return note, fmt.Errorf("unable to finish gzip %v due to error %v", dst, err)
+	}
+	return note, nil
+}
+
+// logReader reads f, the log src, decompressing it when it is gzipped
+func logReader(f *os.File, src string) (io.Reader, error) {
+	if !strings.HasSuffix(src, ".gz") {
+		return f, nil
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read gzip %v due to error %v", src, err)
+	}
+	return gz, nil
+}
+
+// copyWholeLog reads f again from the start and writes all of it to w
+func copyWholeLog(f *os.File, src string, w io.Writer, note *TrimNote) error {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reader, err := logReader(f, src)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(reader)
+	note.LinesRead = 0
+	for {
+		line, readErr := r.ReadString('\n')
+		if line != "" {
+			note.LinesRead++
+			note.LinesKept++
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+		}
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// trimLines writes the records of r inside the window to w, it returns errNoRecords without writing
+// anything when the lines before the first record pass maxLeadIn or no line is a record
+func trimLines(r *bufio.Reader, w io.Writer, pattern *serverlog.Pattern, window timewindow.Window, note *TrimNote) error {
+	var leadIn []string
+	leadInBytes := 0
+	started := false
+	keep := false
+	write := func(line string) error {
+		note.LinesKept++
+		_, err := io.WriteString(w, line)
+		return err
+	}
+	for {
+		line, readErr := r.ReadString('\n')
+		if line != "" {
+			note.LinesRead++
+			if t, ok := pattern.EventTime(strings.TrimRight(line, "\r\n")); ok {
+				if !t.IsZero() && !window.Until.IsZero() && t.After(window.Until.Add(trimSlack)) {
+					note.StoppedEarly = true
+					break
+				}
+				keep = t.IsZero() || window.Contains(t)
+				if keep {
+					note.RecordsKept++
+				} else {
+					note.RecordsDropped++
+				}
+				if !started {
+					started = true
+					for _, l := range leadIn {
+						if keep {
+							if err := write(l); err != nil {
+								return err
+							}
+						}
+					}
+					leadIn = nil
+				}
+				if keep {
+					if err := write(line); err != nil {
+						return err
+					}
+				}
+			} else if !started {
+				leadInBytes += len(line)
+				if leadInBytes > maxLeadIn {
+					return fmt.Errorf("%w in the first %v bytes", errNoRecords, maxLeadIn)
+				}
+				leadIn = append(leadIn, line)
+			} else if keep {
+				if err := write(line); err != nil {
+					return err
+				}
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+	if !started && note.LinesRead > 0 {
+		return errNoRecords
+	}
+	return nil
+}
@@ -17,70 +17,75 @@ package queriesjson
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path"
-	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/strutils"
 )
 
+type ExecutionNode struct {
+	NodeID     string `json:"nodeId"`
+	Hostname   string `json:"hostname"`
+	MaxMemUsed int64  `json:"maxMemUsed"`
+}
+
+// QueriesRow is one line of queries.json, the lists that are rarely needed are kept as raw json
 type QueriesRow struct {
-	QueryID string `json:"queryId"`
-	// Context       string `json:"context"`
-	QueryText string  `json:"queryText"`
-	Start     float64 `json:"start"`
-	// Finish        int64  `json:"finish"`
-	Outcome string `json:"outcome"`
-	// OutcomeReason string `json:"outcomeReason"`
-	// Username      string `json:"username"`
-	// InputRecords  int    `json:"inputRecords"`
-	// InputBytes    int    `json:"inputBytes"`
-	// OutputRecords int    `json:"outputRecords"`
-	// OutputBytes   int    `json:"outputBytes"`
-	// RequestType   string `json:"requestType"`
-	QueryType string `json:"queryType"`
-	// ParentsList             []any  `json:"parentsList"`
-	// Accelerated             bool   `json:"accelerated"`
-	// ReflectionRelationships []any  `json:"reflectionRelationships"`
-	QueryCost float64 `json:"queryCost"`
-	// QueueName               string `json:"queueName"`
-	// PoolWaitTime            int    `json:"poolWaitTime"`
-	// PendingTime             int    `json:"pendingTime"`
-	// MetadataRetrievalTime   int    `json:"metadataRetrievalTime"`
-	PlanningTime float64 `json:"planningTime"`
-	// EngineStartTime         int    `json:"engineStartTime"`
-	// QueuedTime              int    `json:"queuedTime"`
-	// ExecutionPlanningTime float64 `json:"executionPlanningTime"`
-	// StartingTime            int    `json:"startingTime"`
-	RunningTime float64 `json:"runningTime"`
-	// EngineName              string `json:"engineName"`
-	// AttemptCount            int    `json:"attemptCount"`
-	// Submitted               int64  `json:"submitted"`
-	// MetadataRetrieval       int64  `json:"metadataRetrieval"`
-	// PlanningStart           int    `json:"planningStart"`
-	// QueryEnqueued           int64  `json:"queryEnqueued"`
-	// EngineStart             int64  `json:"engineStart"`
-	// ExecutionPlanningStart  int64  `json:"executionPlanningStart"`
-	// ExecutionStart          int64  `json:"executionStart"`
-	// ScannedDatasets         []any  `json:"scannedDatasets"`
-	// ExecutionNodes          []struct {
-	// 	NodeID     string `json:"nodeId"`
-	// 	Hostname   string `json:"hostname"`
-	// 	MaxMemUsed int    `json:"maxMemUsed"`
-	// } `json:"executionNodes"`
-	// ExecutionCPUTimeNs   int   `json:"executionCpuTimeNs"`
-	// SetupTimeNs          int   `json:"setupTimeNs"`
-	// WaitTimeNs           int   `json:"waitTimeNs"`
-	// MemoryAllocated      int   `json:"memoryAllocated"`
-	// StartingStart        int64 `json:"startingStart"`
-	// IsTruncatedQueryText bool  `json:"isTruncatedQueryText"`
+	QueryID                 string          `json:"queryId"`
+	Context                 string          `json:"context"`
+	QueryText               string          `json:"queryText"`
+	Start                   float64         `json:"start"`
+	Finish                  int64           `json:"finish"`
+	Outcome                 string          `json:"outcome"`
+	OutcomeReason           string          `json:"outcomeReason"`
+	Username                string          `json:"username"`
+	InputRecords            int64           `json:"inputRecords"`
+	InputBytes              int64           `json:"inputBytes"`
+	OutputRecords           int64           `json:"outputRecords"`
+	OutputBytes             int64           `json:"outputBytes"`
+	RequestType             string          `json:"requestType"`
+	QueryType               string          `json:"queryType"`
+	ParentsList             json.RawMessage `json:"parentsList,omitempty"`
+	Accelerated             bool            `json:"accelerated"`
+	ReflectionRelationships json.RawMessage `json:"reflectionRelationships,omitempty"`
+	QueryCost               float64         `json:"queryCost"`
+	QueueName               string          `json:"queueName"`
+	PoolWaitTime            int64           `json:"poolWaitTime"`
+	PendingTime             int64           `json:"pendingTime"`
+	MetadataRetrievalTime   int64           `json:"metadataRetrievalTime"`
+	PlanningTime            float64         `json:"planningTime"`
+	EngineStartTime         int64           `json:"engineStartTime"`
+	QueuedTime              int64           `json:"queuedTime"`
+	ExecutionPlanningTime   int64           `json:"executionPlanningTime"`
+	StartingTime            int64           `json:"startingTime"`
+	RunningTime             float64         `json:"runningTime"`
+	EngineName              string          `json:"engineName"`
+	AttemptCount            int64           `json:"attemptCount"`
+	Submitted               int64           `json:"submitted"`
+	MetadataRetrieval       int64           `json:"metadataRetrieval"`
+	PlanningStart           int64           `json:"planningStart"`
+	QueryEnqueued           int64           `json:"queryEnqueued"`
+	EngineStart             int64           `json:"engineStart"`
+	ExecutionPlanningStart  int64           `json:"executionPlanningStart"`
+	ExecutionStart          int64           `json:"executionStart"`
+	ScannedDatasets         json.RawMessage `json:"scannedDatasets,omitempty"`
+	ExecutionNodes          []ExecutionNode `json:"executionNodes"`
+	ExecutionCPUTimeNs      int64           `json:"executionCpuTimeNs"`
+	SetupTimeNs             int64           `json:"setupTimeNs"`
+	WaitTimeNs              int64           `json:"waitTimeNs"`
+	MemoryAllocated         int64           `json:"memoryAllocated"`
+	StartingStart           int64           `json:"startingStart"`
+	IsTruncatedQueryText    bool            `json:"isTruncatedQueryText"`
 }
 
 type HistoryJobs struct {
@@ -139,68 +144,76 @@ type Row struct {
 	FinalStateEpochMillis     int64 `json:"final_state_epoch_millis"`     // Used in sys.jobs_recent
 }
 
-func ReadGzFile(filename string) ([]QueriesRow, error) {
-	queriesrows := []QueriesRow{}
+// StreamFile decodes every valid line of a queries.json file, gzipped when it ends in .gz, and
+// hands each row to fn without keeping them. Lines are read as they come so there is no limit
+// on their length and no large up front buffer
+func StreamFile(filename string, fn func(QueriesRow)) (int, error) {
 	file, err := os.Open(path.Clean(filename))
 	if err != nil {
-		return queriesrows, err
+		return 0, err
 	}
 	defer errCheck(file.Close)
-
-	fz, err := gzip.NewReader(file)
-	if err != nil {
-		return queriesrows, err
-	}
-	defer errCheck(fz.Close)
-
-	scanner := *bufio.NewScanner(fz)
-	maxFileSize := 100 * 1024 * 1024
-	buffer := make([]byte, 0, maxFileSize)
-	scanner.Buffer(buffer, maxFileSize)
-
-	i := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		row, err := parseLine(line, i)
+	var r io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		fz, err := gzip.NewReader(file)
 		if err != nil {
-			simplelog.Errorf(err.Error() + `: ` + filename)
-		} else {
-			queriesrows = append(queriesrows, row)
+			return 0, err
 		}
-		i++
+		defer errCheck(fz.Close)
+		r = fz
 	}
+	reader := bufio.NewReaderSize(r, 64*1024)
+	rows := 0
+	for i := 0; ; i++ {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			row, err := parseLine(string(line), i)
+			if err != nil {
+				simplelog.Errorf("can't parse line from file %v due to error %v", filename, err)
+			} else {
+				fn(row)
+				rows++
+			}
+		}
+		if readErr == io.EOF {
+			return rows, nil
+		}
+		if readErr != nil {
+			return rows, readErr
+		}
+	}
+}
+
+func readFile(filename string) ([]QueriesRow, error) {
+	queriesrows := []QueriesRow{}
+	_, err := StreamFile(filename, func(row QueriesRow) {
+		queriesrows = append(queriesrows, row)
+	})
 	return queriesrows, err
 }
 
+func ReadGzFile(filename string) ([]QueriesRow, error) {
+	return readFile(filename)
+}
+
 func ReadJSONFile(filename string) ([]QueriesRow, error) {
-	// Source: https://gist.github.com/kendellfab/7417164
-	queriesrows := []QueriesRow{}
-	file, err := os.Open(path.Clean(filename))
+	queriesrows, err := readFile(filename)
 	if err != nil {
-		simplelog.Errorf("can't open %v due to error %v", filename, err)
-		return queriesrows, err
-	}
-	defer errCheck(file.Close)
-	scanner := *bufio.NewScanner(file)
-	maxFileSize := 100 * 1024 * 1024
-	buffer := make([]byte, 0, maxFileSize)
-	scanner.Buffer(buffer, maxFileSize)
-
-	i := 0
-	for scanner.Scan() {
-		line := scanner.Text()
-		row, err := parseLine(line, i)
-		if err != nil {
-			simplelog.Errorf("can't parse line %v from file %v due to error %v", line, filename, err)
-		} else {
-			queriesrows = append(queriesrows, row)
-		}
-		i++
+		simplelog.Errorf("can't read %v due to error %v", filename, err)
 	}
 	return queriesrows, err
 }
 
 func ReadHistoryJobsJSONFile(filename string) ([]QueriesRow, error) {
+	return readHistoryJobsFile(filename, streamHistoryJobsJSON)
+}
+
+// ReadHistoryJobsNDJSONFile reads the job history exported as one json row per line
+func ReadHistoryJobsNDJSONFile(filename string) ([]QueriesRow, error) {
+	return readHistoryJobsFile(filename, streamHistoryJobsNDJSON)
+}
+
+func readHistoryJobsFile(filename string, stream func(io.Reader, string, func(QueriesRow)) (int, error)) ([]QueriesRow, error) {
 	queriesrows := []QueriesRow{}
 	file, err := os.Open(path.Clean(filename))
 	if err != nil {
@@ -208,109 +221,172 @@ func ReadHistoryJobsJSONFile(filename string) ([]QueriesRow, error) {
 		return queriesrows, err
 	}
 	defer errCheck(file.Close)
+	_, err = stream(file, filename, func(row QueriesRow) {
+		queriesrows = append(queriesrows, row)
+	})
+	return queriesrows, err
+}
 
-	var bytedata []byte
-	bytedata, err = io.ReadAll(file)
+// StreamHistoryJobsFile hands every row of a job history file exported from the system tables to fn
+// without keeping them, files ending in .ndjson have a row per line and the others are the results
+// of the jobs api as one json document
+func StreamHistoryJobsFile(filename string, fn func(QueriesRow)) (int, error) {
+	file, err := os.Open(path.Clean(filename))
 	if err != nil {
-		simplelog.Errorf("can't read data of %v due to error %v", filename, err)
-		return queriesrows, err
+		return 0, err
+	}
+	defer errCheck(file.Close)
+	if strings.HasSuffix(filename, ".ndjson") {
+		return streamHistoryJobsNDJSON(file, filename, fn)
 	}
+	return streamHistoryJobsJSON(file, filename, fn)
+}
 
-	var dat HistoryJobs
-	err = json.Unmarshal(bytedata, &dat)
-	if err != nil {
-		return queriesrows, fmt.Errorf("can't JSON unmarshall %v due to error %v", filename, err)
+// streamHistoryJobsJSON decodes the rows array of a jobs api result one row at a time, the other
+// fields of the document are skipped
+func streamHistoryJobsJSON(r io.Reader, filename string, fn func(QueriesRow)) (int, error) {
+	dec := json.NewDecoder(bufio.NewReaderSize(r, 64*1024))
+	rows := 0
+	if err := expectDelim(dec, '{'); err != nil {
+		return rows, fmt.Errorf("can't JSON unmarshall %v due to error %v", filename, err)
 	}
-	for _, line := range dat.Rows {
-		row, err := parseLineJobsJSON(line)
+	for dec.More() {
+		key, err := dec.Token()
 		if err != nil {
-			simplelog.Errorf("can't parse line %v from file %v due to error %v", row, filename, err)
-		} else {
-			queriesrows = append(queriesrows, row)
+			return rows, fmt.Errorf("can't JSON unmarshall %v due to error %v", filename, err)
+		}
+		if key != "rows" {
+			var skipped json.RawMessage
+			if err := dec.Decode(&skipped); err != nil {
+				return rows, fmt.Errorf("can't JSON unmarshall %v due to error %v", filename, err)
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return rows, fmt.Errorf("can't JSON unmarshall the rows of %v due to error %v", filename, err)
+		}
+		for dec.More() {
+			var line Row
+			if err := dec.Decode(&line); err != nil {
+				return rows, fmt.Errorf("can't JSON unmarshall row %v of %v due to error %v", rows+1, filename, err)
+			}
+			row, err := parseLineJobsJSON(line)
+			if err != nil {
+				simplelog.Errorf("can't parse line %v from file %v due to error %v", row, filename, err)
+				continue
+			}
+			fn(row)
+			rows++
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return rows, fmt.Errorf("can't JSON unmarshall the rows of %v due to error %v", filename, err)
 		}
 	}
-	return queriesrows, err
+	return rows, nil
 }
 
-func parseLine(line string, i int) (QueriesRow, error) {
-	dat := make(map[string]interface{})
-	err := json.Unmarshal([]byte(line), &dat)
+// expectDelim reads the next token, which has to be the json delimiter d
+func expectDelim(dec *json.Decoder, d json.Delim) error {
+	t, err := dec.Token()
 	if err != nil {
-		return *new(QueriesRow), fmt.Errorf("queries.json line #%v: %v[...] - error: %v", i, strutils.LimitString(line, 50), err)
+		return err
 	}
-	var row = new(QueriesRow)
-	if val, ok := dat["queryId"]; ok {
-		qid, ok := val.(string)
-		if ok {
-			row.QueryID = qid
-		} else {
-			return *new(QueriesRow), fmt.Errorf("incorrect type for 'queryId'")
-		}
-	} else {
-		return *new(QueriesRow), fmt.Errorf("missing field 'queryId'")
+	if t != d {
+		return fmt.Errorf("expected '%v' but found %v", d, t)
 	}
-	if val, ok := dat["queryType"]; ok {
-		qt, ok := val.(string)
-		if ok {
-			row.QueryType = qt
-		} else {
-			return *new(QueriesRow), fmt.Errorf("incorrect type for 'queryType'")
+	return nil
+}
+
+// streamHistoryJobsNDJSON decodes the job history exported as one json row per line
+func streamHistoryJobsNDJSON(r io.Reader, filename string, fn func(QueriesRow)) (int, error) {
+	reader := bufio.NewReaderSize(r, 64*1024)
+	rows := 0
+	for lineNumber := 1; ; lineNumber++ {
+		line, readErr := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var dat Row
+			if err := json.Unmarshal(line, &dat); err != nil {
+				simplelog.Errorf("can't JSON unmarshall line %v of %v due to error %v", lineNumber, filename, err)
+			} else if row, err := parseLineJobsJSON(dat); err != nil {
+				simplelog.Errorf("can't parse line %v from file %v due to error %v", lineNumber, filename, err)
+			} else {
+				fn(row)
+				rows++
+			}
 		}
-	} else {
-		simplelog.Warningf("queries.json is missing field 'queryType'")
-	}
-	if val, ok := dat["queryCost"]; ok {
-		qc, ok := val.(float64)
-		if ok {
-			row.QueryCost = qc
-		} else {
-			return *new(QueriesRow), fmt.Errorf("incorrect type for 'queryCost'")
+		if readErr == io.EOF {
+			return rows, nil
 		}
-	} else {
-		simplelog.Warningf("queries.json is missing field 'queryCost'")
-	}
-	if val, ok := dat["planningTime"]; ok {
-		pt, ok := val.(float64)
-		if ok {
-			row.PlanningTime = pt
-		} else {
-			return *new(QueriesRow), fmt.Errorf("incorrect type for 'planningTime'")
+		if readErr != nil {
+			return rows, fmt.Errorf("can't read data of %v due to error %v", filename, readErr)
 		}
-	} else {
-		simplelog.Warningf("queries.json is missing field 'planningTime'")
 	}
-	if val, ok := dat["runningTime"]; ok {
-		rt, ok := val.(float64)
-		if ok {
-			row.RunningTime = rt
-		} else {
-			return *new(QueriesRow), fmt.Errorf("incorrect type for 'runningTime'")
+}
+
+// checkedRow shadows the fields used to pick job profiles so we can tell a missing field from
+// a null one, everything else is decoded straight into the embedded QueriesRow
+type checkedRow struct {
+	QueriesRow
+	QueryID      json.RawMessage `json:"queryId"`
+	Start        json.RawMessage `json:"start"`
+	Outcome      json.RawMessage `json:"outcome"`
+	QueryType    json.RawMessage `json:"queryType"`
+	QueryCost    json.RawMessage `json:"queryCost"`
+	PlanningTime json.RawMessage `json:"planningTime"`
+	RunningTime  json.RawMessage `json:"runningTime"`
+}
+
+// decodeChecked fills dest from raw, required fields that are missing are an error and
+// optional ones only log a warning
+func decodeChecked(raw json.RawMessage, name string, required bool, dest any) error {
+	if len(raw) == 0 {
+		if required {
+			return fmt.Errorf("missing field '%v'", name)
 		}
-	} else {
-		simplelog.Warningf("queries.json is missing field 'runningTime'")
+		simplelog.Warningf("queries.json is missing field '%v'", name)
+		return nil
+	}
+	if string(raw) == "null" {
+		return fmt.Errorf("incorrect type for '%v'", name)
+	}
+	if err := json.Unmarshal(raw, dest); err != nil {
+		return fmt.Errorf("incorrect type for '%v'", name)
 	}
-	if val, ok := dat["start"]; ok {
-		s, ok := val.(float64)
-		if ok {
-			row.Start = s
-		} else {
-			return *new(QueriesRow), fmt.Errorf("incorrect type for 'start'")
+	return nil
+}
+
+func parseLine(line string, i int) (QueriesRow, error) {
+	var checked checkedRow
+	if err := json.Unmarshal([]byte(line), &checked); err != nil {
+		// the checked fields are raw so a type error is in a field that is only informational,
+		// the rest of the line has still been decoded
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return QueriesRow{}, fmt.Errorf("queries.json line #%v: %v[...] - error: %v", i, strutils.LimitString(line, 50), err)
 		}
-	} else {
-		return *new(QueriesRow), fmt.Errorf("missing field 'start'")
+		simplelog.Debugf("queries.json line #%v has an unexpected type for '%v': %v", i, typeErr.Field, err)
+	}
+	row := checked.QueriesRow
+	fields := []struct {
+		raw      json.RawMessage
+		name     string
+		required bool
+		dest     any
+	}{
+		{checked.QueryID, "queryId", true, &row.QueryID},
+		{checked.QueryType, "queryType", false, &row.QueryType},
+		{checked.QueryCost, "queryCost", false, &row.QueryCost},
+		{checked.PlanningTime, "planningTime", false, &row.PlanningTime},
+		{checked.RunningTime, "runningTime", false, &row.RunningTime},
+		{checked.Start, "start", true, &row.Start},
+		{checked.Outcome, "outcome", true, &row.Outcome},
 	}
-	if val, ok := dat["outcome"]; ok {
-		o, ok := val.(string)
-		if ok {
-			row.Outcome = o
-		} else {
-			return *new(QueriesRow), fmt.Errorf("incorrect type for 'outcome'")
+	for _, f := range fields {
+		if err := decodeChecked(f.raw, f.name, f.required, f.dest); err != nil {
+			return QueriesRow{}, err
 		}
-	} else {
-		return *new(QueriesRow), fmt.Errorf("missing field 'outcome'")
 	}
-	queriesrow := *row
-	return queriesrow, err
+	return row, nil
 }
 
 func parseLineJobsJSON(line Row) (QueriesRow, error) {
@@ -338,47 +414,33 @@ func parseLineJobsJSON(line Row) (QueriesRow, error) {
 }
 
 func GetRecentErrorJobs(queriesrows []QueriesRow, limit int) []QueriesRow {
-	errorqueriesrows := []QueriesRow{}
-
-	for i := range queriesrows {
-		if queriesrows[i].Outcome == "FAILED" {
-			errorqueriesrows = append(errorqueriesrows, queriesrows[i])
+	top := NewTopK(limit, ByStart)
+	for _, row := range queriesrows {
+		if row.Outcome == "FAILED" {
+			top.Add(row)
 		}
 	}
-
-	totalrows := len(errorqueriesrows)
-	sort.Slice(errorqueriesrows, func(i, j int) bool {
-		return errorqueriesrows[i].Start > errorqueriesrows[j].Start
-	})
-	return errorqueriesrows[:min(totalrows, limit)]
+	return top.Rows()
 }
 
 func GetSlowExecJobs(queriesrows []QueriesRow, limit int) []QueriesRow {
-
-	totalrows := len(queriesrows)
-	sort.Slice(queriesrows, func(i, j int) bool {
-		return queriesrows[i].RunningTime > queriesrows[j].RunningTime
-	})
-	return queriesrows[:min(totalrows, limit)]
+	return topRows(queriesrows, limit, ByRunningTime)
 }
 
 func GetSlowPlanningJobs(queriesrows []QueriesRow, limit int) []QueriesRow {
-
-	totalrows := len(queriesrows)
-	sort.Slice(queriesrows, func(i, j int) bool {
-		return queriesrows[i].PlanningTime > queriesrows[j].PlanningTime
-	})
-	return queriesrows[:min(totalrows, limit)]
+	return topRows(queriesrows, limit, ByPlanningTime)
 }
 
 func GetHighCostJobs(queriesrows []QueriesRow, limit int) []QueriesRow {
+	return topRows(queriesrows, limit, ByQueryCost)
+}
 
-	totalrows := len(queriesrows)
-	sort.Slice(queriesrows, func(i, j int) bool {
-		return queriesrows[i].QueryCost > queriesrows[j].QueryCost
-	})
-
-	return queriesrows[:min(totalrows, limit)]
+func topRows(queriesrows []QueriesRow, limit int, score func(QueriesRow) float64) []QueriesRow {
+	top := NewTopK(limit, score)
+	for _, row := range queriesrows {
+		top.Add(row)
+	}
+	return top.Rows()
 }
 
 func min(a, b int) int {
@@ -395,52 +457,64 @@ func AddRowsToSet(queriesrows []QueriesRow, profilesToCollect map[string]string)
 	}
 }
 
-func CollectQueriesJSON(queriesjsons []string) []QueriesRow {
-
-	queriesrows := []QueriesRow{}
+// CollectQueriesJSON decodes the queries.json files with up to threads files at a time and
+// passes every row to fn, fn is never called concurrently. Rows are not kept so callers
+// decide how much of the history they hold on to
+func CollectQueriesJSON(queriesjsons []string, threads int, fn func(QueriesRow)) int {
+	var files []string
 	for _, queriesjson := range queriesjsons {
-		simplelog.Debugf("Attempting to open queries.json file %v", queriesjson)
-		rows := []QueriesRow{}
-		var err error
-
-		if strings.HasSuffix(queriesjson, ".gz") {
-			rows, err = ReadGzFile(queriesjson)
-			if err != nil {
-				simplelog.Errorf("failed to read gunzip %v due to error %v", queriesjson, err)
-				continue
-			}
-			queriesrows = append(queriesrows, rows...)
-		} else if strings.HasSuffix(queriesjson, ".json") {
-			rows, err = ReadJSONFile(queriesjson)
-			if err != nil {
-				simplelog.Errorf("failed to parse json file %v due to error %v", queriesjson, err)
-				continue
-			}
-			queriesrows = append(queriesrows, rows...)
-		} else {
-			simplelog.Error("File is neither JSON or GZIP format.")
+		if !strings.HasSuffix(queriesjson, ".gz") && !strings.HasSuffix(queriesjson, ".json") {
+			simplelog.Errorf("file %v is neither JSON or GZIP format", queriesjson)
+			continue
 		}
-		simplelog.Infof("Found %v new rows in %v", strconv.Itoa(len(rows)), queriesjson)
+		files = append(files, queriesjson)
 	}
-	simplelog.Debugf("Collected a total of %v rows of queries.json", len(queriesrows))
-	return queriesrows
+	total := streamFiles(files, threads, StreamFile, fn)
+	simplelog.Debugf("Collected a total of %v rows of queries.json", total)
+	return total
 }
 
-func CollectJobHistoryJSON(jobhistoryjsons []string) []QueriesRow {
+// CollectJobHistoryJSON is CollectQueriesJSON for the job history exported from the system tables
+func CollectJobHistoryJSON(jobhistoryjsons []string, threads int, fn func(QueriesRow)) int {
+	total := streamFiles(jobhistoryjsons, threads, StreamHistoryJobsFile, fn)
+	simplelog.Infof("Collected a total of %v rows of jobs history", total)
+	return total
+}
 
-	queriesrows := []QueriesRow{}
-	for _, jobhistoryjson := range jobhistoryjsons {
-		simplelog.Infof("Attempting to open json file %v", jobhistoryjson)
-		rows, err := ReadHistoryJobsJSONFile(jobhistoryjson)
-		if err != nil {
-			simplelog.Errorf("failed to parse json file %v due to error %v", jobhistoryjson, err)
-			continue
-		}
-		queriesrows = append(queriesrows, rows...)
-		simplelog.Infof("Found %v new rows in %v", strconv.Itoa(len(rows)), jobhistoryjson)
+// streamFiles runs stream over up to threads files at a time and passes every row to fn, one row at a time
+func streamFiles(files []string, threads int, stream func(string, func(QueriesRow)) (int, error), fn func(QueriesRow)) int {
+	if threads < 1 {
+		threads = 1
+	}
+	var m sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, threads)
+	total := 0
+	for _, file := range files {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(file string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			simplelog.Debugf("Attempting to open json file %v", file)
+			rows, err := stream(file, func(row QueriesRow) {
+				m.Lock()
+				defer m.Unlock()
+				fn(row)
+			})
+			if err != nil {
+				simplelog.Errorf("failed to read %v due to error %v", file, err)
+			}
+			m.Lock()
+			total += rows
+			m.Unlock()
+			simplelog.Infof("Found %v new rows in %v", strconv.Itoa(rows), file)
+		}(file)
 	}
-	simplelog.Infof("Collected a total of %v rows of jobs history", len(queriesrows))
-	return queriesrows
+	wg.Wait()
+	return total
 }
 
 func errCheck(f func() error) {
@@ -18,6 +18,7 @@ package queriesjson
 import (
 	"os"
 	"path"
+	"reflect"
 	"testing"
 )
 
@@ -89,13 +90,13 @@ func TestGetSlowExecJobs_small(t *testing.T) {
 	if len(slowplanqueriesrows) != 3 {
 		t.Errorf("Error")
 	}
-	if slowplanqueriesrows[0] != *row5 {
+	if !reflect.DeepEqual(slowplanqueriesrows[0], *row5) {
 		t.Errorf("Error")
 	}
-	if slowplanqueriesrows[1] != *row2 {
+	if !reflect.DeepEqual(slowplanqueriesrows[1], *row2) {
 		t.Errorf("Error")
 	}
-	if slowplanqueriesrows[2] != *row4 {
+	if !reflect.DeepEqual(slowplanqueriesrows[2], *row4) {
 		t.Errorf("Error")
 	}
 
@@ -111,13 +112,13 @@ func TestGetSlowExecJobs_small(t *testing.T) {
 	if len(slowexecqueriesrows) != 3 {
 		t.Errorf("Error")
 	}
-	if slowexecqueriesrows[0] != *row1 {
+	if !reflect.DeepEqual(slowexecqueriesrows[0], *row1) {
 		t.Errorf("Error")
 	}
-	if slowexecqueriesrows[1] != *row3 {
+	if !reflect.DeepEqual(slowexecqueriesrows[1], *row3) {
 		t.Errorf("Error")
 	}
-	if slowexecqueriesrows[2] != *row5 {
+	if !reflect.DeepEqual(slowexecqueriesrows[2], *row5) {
 		t.Errorf("Error")
 	}
 
@@ -133,13 +134,13 @@ func TestGetSlowExecJobs_small(t *testing.T) {
 	if len(highcostqueriesrows) != 3 {
 		t.Errorf("Error")
 	}
-	if highcostqueriesrows[0] != *row3 {
+	if !reflect.DeepEqual(highcostqueriesrows[0], *row3) {
 		t.Errorf("Error")
 	}
-	if highcostqueriesrows[1] != *row1 {
+	if !reflect.DeepEqual(highcostqueriesrows[1], *row1) {
 		t.Errorf("Error")
 	}
-	if highcostqueriesrows[2] != *row5 {
+	if !reflect.DeepEqual(highcostqueriesrows[2], *row5) {
 		t.Errorf("Error")
 	}
 
@@ -155,10 +156,10 @@ func TestGetSlowExecJobs_small(t *testing.T) {
 	if len(errorqueriesrows) != 2 {
 		t.Errorf("Error")
 	}
-	if errorqueriesrows[0] != *row5 {
+	if !reflect.DeepEqual(errorqueriesrows[0], *row5) {
 		t.Errorf("Error")
 	}
-	if errorqueriesrows[1] != *row2 {
+	if !reflect.DeepEqual(errorqueriesrows[1], *row2) {
 		t.Errorf("Error")
 	}
 }
@@ -170,7 +171,7 @@ func TestParseLine(t *testing.T) {
 		t.Errorf("There should be an error here")
 	}
 	expected := *new(QueriesRow)
-	if expected != actual {
+	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("ERROR")
 	}
 }
@@ -182,7 +183,7 @@ func TestParseLine_Empty(t *testing.T) {
 		t.Errorf("There should be an error here")
 	}
 	expected := *new(QueriesRow)
-	if expected != actual {
+	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("ERROR")
 	}
 }
@@ -209,7 +210,7 @@ func TestParseLine_ValidJson(t *testing.T) {
 	expected.RunningTime = 4785
 	expected.Start = 100
 	expected.Outcome = "COMPLETED"
-	if *expected != actual {
+	if !reflect.DeepEqual(*expected, actual) {
 		t.Errorf("ERROR")
 	}
 }
@@ -221,7 +222,7 @@ func TestParseLine_EmptyJson(t *testing.T) {
 		t.Errorf("There should be an error here")
 	}
 	expected := *new(QueriesRow)
-	if expected != actual {
+	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("ERROR")
 	}
 }
@@ -235,7 +236,7 @@ func TestParseLine_ValidJsonWithMissingFields(t *testing.T) {
 		t.Errorf("There should be an error here")
 	}
 	expected := *new(QueriesRow)
-	if expected != actual {
+	if !reflect.DeepEqual(expected, actual) {
 		t.Errorf("ERROR")
 	}
 }
@@ -351,6 +352,33 @@ func TestReadJobsRecentJSONFile(t *testing.T) {
 	}
 }
 
+func TestReadJobsRecentNDJSONFile(t *testing.T) {
+	// the last two lines have no job id and are not json, they are skipped
+	actual, err := ReadHistoryJobsNDJSONFile(path.Join("testdata", "sys.jobs_recent.ndjson"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(actual) != 2 {
+		t.Fatalf("expected 2 valid entries but was %v", len(actual))
+	}
+	if actual[1].QueryID != "Query2" ||
+		actual[1].QueryType != "REST" ||
+		actual[1].QueryCost != 3.8154000035e9 ||
+		actual[1].Start != 1714033458006 ||
+		actual[1].PlanningTime != 34 ||
+		actual[1].RunningTime != 55 ||
+		actual[1].Outcome != "COMPLETED" {
+		t.Errorf("the second entry was not parsed correctly: %#v", actual[1])
+	}
+	var rows []QueriesRow
+	total := CollectJobHistoryJSON([]string{path.Join("testdata", "sys.jobs_recent.ndjson"), "../../testdata/queries/sys.jobs_recent.json"}, 2, func(row QueriesRow) {
+		rows = append(rows, row)
+	})
+	if total != 4 || len(rows) != 4 {
+		t.Errorf("expected 4 rows from the ndjson and json job history but was %v", len(rows))
+	}
+}
+
 func TestReadBadJobsRecentJSONFile(t *testing.T) {
 	filename := "../../testdata/queries/bad_sys.jobs_recent.json"
 	actual, err := ReadHistoryJobsJSONFile(filename)
@@ -375,8 +403,11 @@ func TestCollectQueriesJSON(t *testing.T) {
 		queriesjsons = append(queriesjsons, path.Join(queriesDir, file.Name()))
 	}
 	numValidEntries := 6
-	queriesrows := CollectQueriesJSON(queriesjsons)
-	if len(queriesrows) != numValidEntries {
+	queriesrows := []QueriesRow{}
+	total := CollectQueriesJSON(queriesjsons, 2, func(row QueriesRow) {
+		queriesrows = append(queriesrows, row)
+	})
+	if total != numValidEntries || len(queriesrows) != numValidEntries {
 		t.Errorf("The queries files in testdata should produce %v entries", numValidEntries)
 	}
 
@@ -405,8 +436,11 @@ func TestCollectJobHistoryJSON(t *testing.T) {
 		queriesjsons = append(queriesjsons, path.Join(queriesDir, file.Name()))
 	}
 	numValidEntries := 4
-	queriesrows := CollectJobHistoryJSON(queriesjsons)
-	if len(queriesrows) != numValidEntries {
+	queriesrows := []QueriesRow{}
+	total := CollectJobHistoryJSON(queriesjsons, 2, func(row QueriesRow) {
+		queriesrows = append(queriesrows, row)
+	})
+	if total != numValidEntries || len(queriesrows) != numValidEntries {
 		t.Errorf("The queries files in testdata should produce %v entries", numValidEntries)
 	}
 
@@ -423,3 +457,32 @@ func TestCollectJobHistoryJSON(t *testing.T) {
 		t.Errorf("The profile ID is missing")
 	}
 }
+
+func TestStreamHistoryJobsFile(t *testing.T) {
+	// the rows do not have to come last, the fields around them are skipped
+	filename := path.Join(t.TempDir(), "sys.jobs_recent.json")
+	if err := os.WriteFile(filename, []byte(`{"schema":[{"name":"job_id","type":{"name":"VARCHAR"}}],"rows":[
+{"job_id":"Query1","status":"FAILED","submitted_epoch_millis":100},
+{"status":"COMPLETED"},
+{"job_id":"Query2","status":"COMPLETED","submitted_epoch_millis":200}
+],"rowCount":3}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	total, err := StreamHistoryJobsFile(filename, func(row QueriesRow) {
+		ids = append(ids, row.QueryID)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if total != 2 || !reflect.DeepEqual(ids, []string{"Query1", "Query2"}) {
+		t.Errorf("expected Query1 and Query2 but was %v rows %v", total, ids)
+	}
+	// a document that is not a jobs api result has no rows
+	if err := os.WriteFile(filename, []byte(`[1, 2]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if total, err := StreamHistoryJobsFile(filename, func(QueriesRow) {}); err == nil || total != 0 {
+		t.Errorf("expected an error and no rows but was %v rows and %v", total, err)
+	}
+}
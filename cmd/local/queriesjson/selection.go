@@ -0,0 +1,301 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queriesjson
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reasons recorded for the built in selections
+const (
+	ReasonSlowPlanning = "slow-planning"
+	ReasonSlowExec     = "slow-exec"
+	ReasonHighCost     = "high-cost"
+	ReasonRecentError  = "recent-error"
+)
+
+// sampling modes for the built in job profile selections
+const (
+	SamplingGlobal     = "global"
+	SamplingStratified = "stratified"
+)
+
+// ProfileLimits is how many job profiles to pick for each reason. With stratified sampling
+// every quota is spread over buckets of BucketSize and the query outcomes, Buckets is how many
+// time buckets the history is expected to span
+type ProfileLimits struct {
+	SlowPlanning int
+	SlowExec     int
+	HighCost     int
+	RecentErrors int
+	Sampling     string
+	BucketSize   time.Duration
+	Buckets      int
+}
+
+func (l ProfileLimits) ranker(k int, score func(QueriesRow) float64) ranker {
+	if l.Sampling == SamplingStratified {
+		return NewStratifiedTopK(k, score, l.BucketSize, l.Buckets)
+	}
+	return NewTopK(k, score)
+}
+
+// SelectorConfig is one entry of job-profile-selectors in ddc.yaml. Every filter that is set
+// must match, the matching jobs are ranked by order-by and up to quota of them are picked
+type SelectorConfig struct {
+	Name       string   `yaml:"name" json:"name"`
+	Quota      int      `yaml:"quota" json:"quota"`
+	OrderBy    string   `yaml:"order-by" json:"orderBy,omitempty"`
+	Users      []string `yaml:"users" json:"users,omitempty"`
+	Queues     []string `yaml:"queues" json:"queues,omitempty"`
+	QueryTypes []string `yaml:"query-types" json:"queryTypes,omitempty"`
+	SQLPattern string   `yaml:"sql-pattern" json:"sqlPattern,omitempty"`
+	Since      string   `yaml:"since" json:"since,omitempty"`
+	Until      string   `yaml:"until" json:"until,omitempty"`
+	JobIDs     []string `yaml:"job-ids" json:"jobIds,omitempty"`
+}
+
+// orderings are the values accepted for order-by, the most recent jobs are picked by default
+var orderings = map[string]func(QueriesRow) float64{
+	"":              ByStart,
+	"start":         ByStart,
+	"running-time":  ByRunningTime,
+	"planning-time": ByPlanningTime,
+	"query-cost":    ByQueryCost,
+}
+
+// Selector is a compiled SelectorConfig
+type Selector struct {
+	config     SelectorConfig
+	users      map[string]bool
+	queues     map[string]bool
+	queryTypes map[string]bool
+	sqlPattern *regexp.Regexp
+	since      time.Time
+	until      time.Time
+	top        *TopK
+}
+
+func toSet(values []string, normalize func(string) string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, v := range values {
+		set[normalize(v)] = true
+	}
+	return set
+}
+
+func identity(s string) string {
+	return s
+}
+
+// NewSelector validates the configuration, explicit job ids are always picked and default the
+// quota to the number of ids
+func NewSelector(config SelectorConfig) (*Selector, error) {
+	if config.Name == "" {
+		return nil, fmt.Errorf("job profile selector is missing a name")
+	}
+	score, ok := orderings[config.OrderBy]
+	if !ok {
+		return nil, fmt.Errorf("job profile selector '%v' has unknown order-by '%v', use start, running-time, planning-time or query-cost", config.Name, config.OrderBy)
+	}
+	if config.Quota < 0 {
+		return nil, fmt.Errorf("job profile selector '%v' has a negative quota %v", config.Name, config.Quota)
+	}
+	s := &Selector{
+		config:     config,
+		users:      toSet(config.Users, identity),
+		queues:     toSet(config.Queues, identity),
+		queryTypes: toSet(config.QueryTypes, strings.ToUpper),
+	}
+	if config.SQLPattern != "" {
+		re, err := regexp.Compile(config.SQLPattern)
+		if err != nil {
+			return nil, fmt.Errorf("job profile selector '%v' has an invalid sql-pattern due to error %v", config.Name, err)
+		}
+		s.sqlPattern = re
+	}
+	var err error
+	if config.Since != "" {
+		if s.since, err = time.Parse(time.RFC3339, config.Since); err != nil {
+			return nil, fmt.Errorf("job profile selector '%v' has an invalid since, expected RFC3339 like 2024-01-02T14:05:00Z: %v", config.Name, err)
+		}
+	}
+	if config.Until != "" {
+		if s.until, err = time.Parse(time.RFC3339, config.Until); err != nil {
+			return nil, fmt.Errorf("job profile selector '%v' has an invalid until, expected RFC3339 like 2024-01-02T14:40:00Z: %v", config.Name, err)
+		}
+	}
+	if s.config.Quota == 0 && len(config.JobIDs) > 0 {
+		s.config.Quota = len(config.JobIDs)
+	}
+	s.top = NewTopK(s.config.Quota, score)
+	return s, nil
+}
+
+// Reason is what is written to the manifest for the jobs this selector picks
+func (s *Selector) Reason() string {
+	return "selector:" + s.config.Name
+}
+
+// Matches reports whether every filter set on the selector accepts the row
+func (s *Selector) Matches(row QueriesRow) bool {
+	if s.users != nil && !s.users[row.Username] {
+		return false
+	}
+	if s.queues != nil && !s.queues[row.QueueName] {
+		return false
+	}
+	if s.queryTypes != nil && !s.queryTypes[strings.ToUpper(row.QueryType)] {
+		return false
+	}
+	if s.sqlPattern != nil && !s.sqlPattern.MatchString(row.QueryText) {
+		return false
+	}
+	start := time.UnixMilli(int64(row.Start))
+	if !s.since.IsZero() && start.Before(s.since) {
+		return false
+	}
+	if !s.until.IsZero() && start.After(s.until) {
+		return false
+	}
+	if len(s.config.JobIDs) > 0 && !contains(s.config.JobIDs, row.QueryID) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, v string) bool {
+	for _, e := range values {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectedProfile is a job picked for download and every reason it was picked for. Row is
+// empty for explicit job ids that were not found in the history
+type SelectedProfile struct {
+	JobID   string
+	Reasons []string
+	Row     QueriesRow
+}
+
+// ProfileSelector picks the job profiles to download while the history is streamed through
+// it, only the rows that can still be selected are held in memory
+type ProfileSelector struct {
+	slowPlanning ranker
+	slowExec     ranker
+	highCost     ranker
+	recentErrors ranker
+	selectors    []*Selector
+	rows         int
+}
+
+func NewProfileSelector(limits ProfileLimits, selectors ...*Selector) *ProfileSelector {
+	return &ProfileSelector{
+		slowPlanning: limits.ranker(limits.SlowPlanning, ByPlanningTime),
+		slowExec:     limits.ranker(limits.SlowExec, ByRunningTime),
+		highCost:     limits.ranker(limits.HighCost, ByQueryCost),
+		recentErrors: limits.ranker(limits.RecentErrors, ByStart),
+		selectors:    selectors,
+	}
+}
+
+// Add offers one query to every selection
+func (s *ProfileSelector) Add(row QueriesRow) {
+	s.rows++
+	s.slowPlanning.Add(row)
+	s.slowExec.Add(row)
+	s.highCost.Add(row)
+	if row.Outcome == "FAILED" {
+		s.recentErrors.Add(row)
+	}
+	for _, selector := range s.selectors {
+		if selector.Matches(row) {
+			selector.top.Add(row)
+		}
+	}
+}
+
+// Rows is the number of queries seen
+func (s *ProfileSelector) Rows() int {
+	return s.rows
+}
+
+func (s *ProfileSelector) SlowPlanningJobs() []QueriesRow { return s.slowPlanning.Rows() }
+func (s *ProfileSelector) SlowExecJobs() []QueriesRow     { return s.slowExec.Rows() }
+func (s *ProfileSelector) HighCostJobs() []QueriesRow     { return s.highCost.Rows() }
+func (s *ProfileSelector) RecentErrorJobs() []QueriesRow  { return s.recentErrors.Rows() }
+
+// Selected lists every picked job once with all the reasons it was picked for, ordered by job id
+func (s *ProfileSelector) Selected() []SelectedProfile {
+	selected := make(map[string]*SelectedProfile)
+	add := func(reason string, rows []QueriesRow) {
+		for _, row := range rows {
+			p, ok := selected[row.QueryID]
+			if !ok {
+				p = &SelectedProfile{JobID: row.QueryID, Row: row}
+				selected[row.QueryID] = p
+			}
+			p.Reasons = append(p.Reasons, reason)
+		}
+	}
+	add(ReasonSlowPlanning, s.SlowPlanningJobs())
+	add(ReasonSlowExec, s.SlowExecJobs())
+	add(ReasonHighCost, s.HighCostJobs())
+	add(ReasonRecentError, s.RecentErrorJobs())
+	for _, selector := range s.selectors {
+		rows := selector.top.Rows()
+		// explicit job ids are downloaded even when they are not in the history we read
+		for _, id := range selector.config.JobIDs {
+			found := false
+			for _, r := range rows {
+				if r.QueryID == id {
+					found = true
+					break
+				}
+			}
+			if !found && len(rows) < selector.config.Quota {
+				rows = append(rows, QueriesRow{QueryID: id})
+			}
+		}
+		add(selector.Reason(), rows)
+	}
+	results := make([]SelectedProfile, 0, len(selected))
+	for _, p := range selected {
+		results = append(results, *p)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].JobID < results[j].JobID
+	})
+	return results
+}
+
+// ProfilesToCollect is the set of job ids picked by any of the selections
+func (s *ProfileSelector) ProfilesToCollect() map[string]string {
+	profilesToCollect := map[string]string{}
+	for _, p := range s.Selected() {
+		profilesToCollect[p.JobID] = ""
+	}
+	return profilesToCollect
+}
@@ -0,0 +1,119 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queriesjson
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestProfileSelector(t *testing.T) {
+	selector := NewProfileSelector(ProfileLimits{SlowPlanning: 1, SlowExec: 1, HighCost: 1, RecentErrors: 2})
+	selector.Add(QueriesRow{QueryID: "plan", PlanningTime: 100, Outcome: "COMPLETED"})
+	selector.Add(QueriesRow{QueryID: "exec", RunningTime: 100, Outcome: "COMPLETED"})
+	selector.Add(QueriesRow{QueryID: "cost", QueryCost: 100, Outcome: "COMPLETED"})
+	selector.Add(QueriesRow{QueryID: "old-error", Start: 1, Outcome: "FAILED"})
+	selector.Add(QueriesRow{QueryID: "new-error", Start: 3, Outcome: "FAILED"})
+	selector.Add(QueriesRow{QueryID: "mid-error", Start: 2, Outcome: "FAILED"})
+	if selector.Rows() != 6 {
+		t.Errorf("expected 6 rows but was %v", selector.Rows())
+	}
+	profiles := selector.ProfilesToCollect()
+	for _, id := range []string{"plan", "exec", "cost", "new-error", "mid-error"} {
+		if _, ok := profiles[id]; !ok {
+			t.Errorf("expected %v to be selected in %v", id, profiles)
+		}
+	}
+	if _, ok := profiles["old-error"]; ok || len(profiles) != 5 {
+		t.Errorf("unexpected profiles %v", profiles)
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	s, err := NewSelector(SelectorConfig{
+		Name:       "etl",
+		Quota:      1,
+		Users:      []string{"etl"},
+		QueryTypes: []string{"odbc"},
+		SQLPattern: "(?i)merge into",
+		Since:      "2024-01-01T10:00:00Z",
+		Until:      "2024-01-01T11:00:00Z",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := QueriesRow{QueryID: "q1", Username: "etl", QueryType: "ODBC", QueryText: "merge INTO t", Start: 1704103200000}
+	if !s.Matches(match) {
+		t.Errorf("expected %#v to match", match)
+	}
+	for name, change := range map[string]func(*QueriesRow){
+		"user":       func(r *QueriesRow) { r.Username = "bob" },
+		"query type": func(r *QueriesRow) { r.QueryType = "REST" },
+		"sql":        func(r *QueriesRow) { r.QueryText = "SELECT 1" },
+		"too early":  func(r *QueriesRow) { r.Start = 1704099599999 },
+		"too late":   func(r *QueriesRow) { r.Start = 1704106800001 },
+	} {
+		row := match
+		change(&row)
+		if s.Matches(row) {
+			t.Errorf("expected no match when the %v differs", name)
+		}
+	}
+}
+
+func TestProfileSelectorRecordsEveryReason(t *testing.T) {
+	reflections, err := NewSelector(SelectorConfig{Name: "reflections", Quota: 2, OrderBy: "running-time", QueryTypes: []string{"REFLECTION"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	explicit, err := NewSelector(SelectorConfig{Name: "ids", JobIDs: []string{"r1", "missing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	selector := NewProfileSelector(ProfileLimits{SlowExec: 1}, reflections, explicit)
+	selector.Add(QueriesRow{QueryID: "r1", QueryType: "REFLECTION", RunningTime: 300})
+	selector.Add(QueriesRow{QueryID: "r2", QueryType: "REFLECTION", RunningTime: 200})
+	selector.Add(QueriesRow{QueryID: "r3", QueryType: "REFLECTION", RunningTime: 100})
+	selector.Add(QueriesRow{QueryID: "q1", QueryType: "ODBC", RunningTime: 50})
+	var got []string
+	reasons := make(map[string][]string)
+	for _, p := range selector.Selected() {
+		got = append(got, p.JobID)
+		reasons[p.JobID] = p.Reasons
+	}
+	if !reflect.DeepEqual(got, []string{"missing", "r1", "r2"}) {
+		t.Errorf("unexpected selection %v", got)
+	}
+	if !reflect.DeepEqual(reasons["r1"], []string{ReasonSlowExec, "selector:reflections", "selector:ids"}) {
+		t.Errorf("unexpected reasons %v", reasons["r1"])
+	}
+}
+
+func TestProfileSelectorStratifiedSampling(t *testing.T) {
+	hour := float64(time.Hour / time.Millisecond)
+	selector := NewProfileSelector(ProfileLimits{RecentErrors: 2, Sampling: SamplingStratified, BucketSize: time.Hour, Buckets: 2})
+	selector.Add(QueriesRow{QueryID: "early", Start: 1, Outcome: "FAILED"})
+	selector.Add(QueriesRow{QueryID: "late1", Start: hour + 1, Outcome: "FAILED"})
+	selector.Add(QueriesRow{QueryID: "late2", Start: hour + 2, Outcome: "FAILED"})
+	var ids []string
+	for _, r := range selector.RecentErrorJobs() {
+		ids = append(ids, r.QueryID)
+	}
+	// globally the two most recent errors are both late, stratified keeps one from each hour
+	if !reflect.DeepEqual(ids, []string{"early", "late2"}) {
+		t.Errorf("unexpected recent errors %v", ids)
+	}
+}
@@ -0,0 +1,211 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queriesjson
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// ByRunningTime, ByPlanningTime, ByQueryCost and ByStart are the scores used to rank job profiles
+func ByRunningTime(r QueriesRow) float64  { return r.RunningTime }
+func ByPlanningTime(r QueriesRow) float64 { return r.PlanningTime }
+func ByQueryCost(r QueriesRow) float64    { return r.QueryCost }
+func ByStart(r QueriesRow) float64        { return r.Start }
+
+// TopK keeps the k rows with the highest score. The lowest kept row sits at the root of a
+// min heap so adding a row is O(log k) and memory stays at k rows however many are added
+type TopK struct {
+	k     int
+	score func(QueriesRow) float64
+	h     topKHeap
+}
+
+type scoredRow struct {
+	score float64
+	row   QueriesRow
+}
+
+type topKHeap []scoredRow
+
+// lower reports whether a ranks below b, ties are broken on the query id so the result does
+// not depend on the order rows arrived in
+func lower(a, b scoredRow) bool {
+	if a.score == b.score {
+		return a.row.QueryID > b.row.QueryID
+	}
+	return a.score < b.score
+}
+
+func (h topKHeap) Len() int           { return len(h) }
+func (h topKHeap) Less(i, j int) bool { return lower(h[i], h[j]) }
+func (h topKHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *topKHeap) Push(x any)        { *h = append(*h, x.(scoredRow)) }
+func (h *topKHeap) Pop() any {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+func NewTopK(k int, score func(QueriesRow) float64) *TopK {
+	return &TopK{k: k, score: score}
+}
+
+// Add offers a row, it is only kept when it ranks in the top k seen so far
+func (t *TopK) Add(row QueriesRow) {
+	if t.k <= 0 {
+		return
+	}
+	s := scoredRow{score: t.score(row), row: row}
+	if len(t.h) < t.k {
+		heap.Push(&t.h, s)
+		return
+	}
+	if lower(t.h[0], s) {
+		t.h[0] = s
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// Len is the number of rows kept
+func (t *TopK) Len() int {
+	return len(t.h)
+}
+
+// Rows returns the kept rows from the highest score down
+func (t *TopK) Rows() []QueriesRow {
+	sorted := make([]scoredRow, len(t.h))
+	copy(sorted, t.h)
+	sort.Slice(sorted, func(i, j int) bool {
+		return lower(sorted[j], sorted[i])
+	})
+	rows := make([]QueriesRow, len(sorted))
+	for i, s := range sorted {
+		rows[i] = s.row
+	}
+	return rows
+}
+
+// ranker keeps the best rows offered to it, either over the whole history or per time bucket
+type ranker interface {
+	Add(row QueriesRow)
+	Rows() []QueriesRow
+}
+
+// stratum is one time bucket and outcome
+type stratum struct {
+	start   int64
+	outcome string
+}
+
+// StratifiedTopK spreads k rows over time buckets and outcomes so a single incident does not
+// take the whole quota. Each stratum keeps its own top rows, capped so memory stays at a small
+// multiple of k, and the strata are then drawn from in turn until k rows are picked. The quota the
+// strata cannot fill, such as when the history spans fewer buckets than expected, goes to the best
+// rows overall
+type StratifiedTopK struct {
+	k         int
+	perBucket int
+	bucket    int64
+	score     func(QueriesRow) float64
+	strata    map[stratum]*TopK
+	overall   *TopK
+}
+
+// NewStratifiedTopK makes buckets of the given size, expectedBuckets is how many time buckets the
+// history is expected to cover and sets how many rows each stratum may hold
+func NewStratifiedTopK(k int, score func(QueriesRow) float64, bucket time.Duration, expectedBuckets int) *StratifiedTopK {
+	if expectedBuckets < 1 {
+		expectedBuckets = 1
+	}
+	// twice the fair share leaves room for busy buckets to fill in for quiet ones
+	perBucket := 2 * ((k + expectedBuckets - 1) / expectedBuckets)
+	return &StratifiedTopK{
+		k:         k,
+		perBucket: perBucket,
+		bucket:    bucket.Milliseconds(),
+		score:     score,
+		strata:    make(map[stratum]*TopK),
+		overall:   NewTopK(k, score),
+	}
+}
+
+// Add offers a row to the top rows of its time bucket and outcome
+func (s *StratifiedTopK) Add(row QueriesRow) {
+	if s.k <= 0 || s.bucket <= 0 {
+		return
+	}
+	start := int64(row.Start)
+	key := stratum{start: start - start%s.bucket, outcome: row.Outcome}
+	top, ok := s.strata[key]
+	if !ok {
+		top = NewTopK(s.perBucket, s.score)
+		s.strata[key] = top
+	}
+	top.Add(row)
+	s.overall.Add(row)
+}
+
+// Rows takes the best remaining row of every stratum in turn, oldest bucket first, until k
+// rows are picked or the strata are exhausted, the rest is then filled with the best rows overall
+// that were not picked yet
+func (s *StratifiedTopK) Rows() []QueriesRow {
+	keys := make([]stratum, 0, len(s.strata))
+	for k := range s.strata {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].start == keys[j].start {
+			return keys[i].outcome < keys[j].outcome
+		}
+		return keys[i].start < keys[j].start
+	})
+	ranked := make([][]QueriesRow, len(keys))
+	for i, k := range keys {
+		ranked[i] = s.strata[k].Rows()
+	}
+	var rows []QueriesRow
+	for round := 0; len(rows) < s.k; round++ {
+		added := false
+		for _, r := range ranked {
+			if round < len(r) && len(rows) < s.k {
+				rows = append(rows, r[round])
+				added = true
+			}
+		}
+		if !added {
+			break
+		}
+	}
+	if len(rows) < s.k {
+		picked := make(map[string]bool, len(rows))
+		for _, r := range rows {
+			picked[r.QueryID] = true
+		}
+		for _, r := range s.overall.Rows() {
+			if len(rows) == s.k {
+				break
+			}
+			if !picked[r.QueryID] {
+				picked[r.QueryID] = true
+				rows = append(rows, r)
+			}
+		}
+	}
+	return rows
+}
@@ -0,0 +1,187 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queriesjson
+
+import (
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTopKKeepsHighestScores(t *testing.T) {
+	top := NewTopK(3, ByRunningTime)
+	for i := 0; i < 1000; i++ {
+		top.Add(QueriesRow{QueryID: fmt.Sprintf("q%v", i), RunningTime: float64((i * 7919) % 1000)})
+	}
+	if top.Len() != 3 {
+		t.Fatalf("expected 3 rows kept but was %v", top.Len())
+	}
+	var ids []string
+	for _, r := range top.Rows() {
+		ids = append(ids, fmt.Sprintf("%v:%v", r.QueryID, r.RunningTime))
+	}
+	expected := []string{"q321:999", "q642:998", "q963:997"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v but was %v", expected, ids)
+	}
+}
+
+func TestTopKTiesDoNotDependOnOrder(t *testing.T) {
+	rows := []QueriesRow{{QueryID: "c", QueryCost: 1}, {QueryID: "a", QueryCost: 1}, {QueryID: "b", QueryCost: 1}}
+	forward := NewTopK(2, ByQueryCost)
+	backward := NewTopK(2, ByQueryCost)
+	for i := range rows {
+		forward.Add(rows[i])
+		backward.Add(rows[len(rows)-1-i])
+	}
+	if !reflect.DeepEqual(forward.Rows(), backward.Rows()) {
+		t.Errorf("expected the same rows but was %v and %v", forward.Rows(), backward.Rows())
+	}
+	if forward.Rows()[0].QueryID != "a" {
+		t.Errorf("expected ties to prefer the lowest query id but was %v", forward.Rows())
+	}
+}
+
+func TestTopKZeroLimit(t *testing.T) {
+	top := NewTopK(0, ByStart)
+	top.Add(QueriesRow{QueryID: "q1"})
+	if len(top.Rows()) != 0 {
+		t.Errorf("expected no rows but was %v", top.Rows())
+	}
+}
+
+func TestCollectQueriesJSONStreamsLargeHistories(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	longText := strings.Repeat("x", 200*1024)
+	for f := 0; f < 4; f++ {
+		name := filepath.Join(dir, fmt.Sprintf("queries.%v.json.gz", f))
+		out, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gz := gzip.NewWriter(out)
+		for i := 0; i < 500; i++ {
+			text := "SELECT 1"
+			if i == 0 {
+				// longer than the reader buffer
+				text = longText
+			}
+			if _, err := fmt.Fprintf(gz, `{"queryId":"f%v-%v","queryText":"%v","start":%v,"outcome":"COMPLETED","queryType":"ODBC","queryCost":1,"planningTime":1,"runningTime":%v}`+"\n", f, i, text, i, f*1000+i); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := gz.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := out.Close(); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, name)
+	}
+	selector := NewProfileSelector(ProfileLimits{SlowExec: 2})
+	total := CollectQueriesJSON(files, 3, selector.Add)
+	if total != 2000 || selector.Rows() != 2000 {
+		t.Errorf("expected 2000 rows but was %v and %v", total, selector.Rows())
+	}
+	slow := selector.SlowExecJobs()
+	if len(slow) != 2 || slow[0].QueryID != "f3-499" || slow[1].QueryID != "f3-498" {
+		t.Errorf("unexpected slowest jobs %v", slow)
+	}
+}
+
+func TestStratifiedTopKSpreadsOverBuckets(t *testing.T) {
+	day := int64(24 * time.Hour / time.Millisecond)
+	top := NewStratifiedTopK(6, ByRunningTime, 24*time.Hour, 3)
+	// the incident day has far slower queries than the two normal days
+	for i := 0; i < 100; i++ {
+		top.Add(QueriesRow{QueryID: fmt.Sprintf("incident-%03d", i), Start: float64(day + int64(i)), RunningTime: float64(10000 + i), Outcome: "COMPLETED"})
+	}
+	for d := int64(0); d < 3; d += 2 {
+		for i := 0; i < 10; i++ {
+			top.Add(QueriesRow{QueryID: fmt.Sprintf("day%v-%v", d, i), Start: float64(d*day + int64(i)), RunningTime: float64(i), Outcome: "COMPLETED"})
+		}
+	}
+	var ids []string
+	for _, r := range top.Rows() {
+		ids = append(ids, r.QueryID)
+	}
+	expected := []string{"day0-9", "incident-099", "day2-9", "day0-8", "incident-098", "day2-8"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected %v but was %v", expected, ids)
+	}
+}
+
+func TestStratifiedTopKSpreadsOverOutcomes(t *testing.T) {
+	top := NewStratifiedTopK(2, ByRunningTime, time.Hour, 1)
+	for i := 0; i < 10; i++ {
+		top.Add(QueriesRow{QueryID: fmt.Sprintf("ok-%v", i), RunningTime: float64(100 + i), Outcome: "COMPLETED"})
+	}
+	top.Add(QueriesRow{QueryID: "failed", RunningTime: 1, Outcome: "FAILED"})
+	rows := top.Rows()
+	if len(rows) != 2 || rows[0].QueryID != "ok-9" || rows[1].QueryID != "failed" {
+		t.Errorf("expected one completed and one failed query but was %v", rows)
+	}
+}
+
+func TestStratifiedTopKUsesQuietBucketShareElsewhere(t *testing.T) {
+	top := NewStratifiedTopK(4, ByRunningTime, time.Hour, 2)
+	for i := 0; i < 10; i++ {
+		top.Add(QueriesRow{QueryID: fmt.Sprintf("q%v", i), RunningTime: float64(i), Outcome: "COMPLETED"})
+	}
+	// only one bucket has queries so it can hold up to twice its fair share of 2
+	if rows := top.Rows(); len(rows) != 4 {
+		t.Errorf("expected 4 rows but was %v", len(rows))
+	}
+}
+
+func TestStratifiedTopKFillsTheQuotaOfBucketsWithoutQueries(t *testing.T) {
+	// a month of buckets is expected but the queries all ran in the same two hours
+	top := NewStratifiedTopK(10, ByRunningTime, time.Hour, 30*24)
+	hour := int64(time.Hour / time.Millisecond)
+	for i := 0; i < 50; i++ {
+		top.Add(QueriesRow{QueryID: fmt.Sprintf("q%02d", i), Start: float64(int64(i%2)*hour + int64(i)), RunningTime: float64(i), Outcome: "COMPLETED"})
+	}
+	rows := top.Rows()
+	if len(rows) != 10 {
+		t.Fatalf("expected exactly 10 rows but was %v", len(rows))
+	}
+	seen := make(map[string]bool)
+	for _, r := range rows {
+		if seen[r.QueryID] {
+			t.Errorf("%v was picked twice", r.QueryID)
+		}
+		seen[r.QueryID] = true
+	}
+	// each bucket holds its best 2 and the rest are the slowest of the others
+	for _, id := range []string{"q49", "q48", "q47", "q46", "q45", "q44", "q43", "q42", "q41", "q40"} {
+		if !seen[id] {
+			t.Errorf("expected %v to be picked but was %v", id, rows)
+		}
+	}
+	// there is no fill in when there are fewer rows than the quota
+	few := NewStratifiedTopK(10, ByRunningTime, time.Hour, 30*24)
+	for i := 0; i < 3; i++ {
+		few.Add(QueriesRow{QueryID: fmt.Sprintf("q%v", i), RunningTime: float64(i), Outcome: "COMPLETED"})
+	}
+	if rows := few.Rows(); len(rows) != 3 {
+		t.Errorf("expected 3 rows but was %v", len(rows))
+	}
+}
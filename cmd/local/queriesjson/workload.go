@@ -0,0 +1,435 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queriesjson
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/stats"
+)
+
+const (
+	WorkloadSummaryFileName = "workload-summary.json"
+	WorkloadGroupsFileName  = "workload-groups.csv"
+	WorkloadHourlyFileName  = "workload-hourly.csv"
+)
+
+// GroupStats describes the queries sharing one value of a dimension, such as a user or a queue
+type GroupStats struct {
+	Dimension          string  `json:"dimension"`
+	Key                string  `json:"key"`
+	Queries            int     `json:"queries"`
+	Failed             int     `json:"failed"`
+	Cancelled          int     `json:"cancelled"`
+	Accelerated        int     `json:"accelerated"`
+	AccelerationRate   float64 `json:"accelerationRate"`
+	TotalRunningMillis float64 `json:"totalRunningMillis"`
+	P50RunningMillis   float64 `json:"p50RunningMillis"`
+	P95RunningMillis   float64 `json:"p95RunningMillis"`
+	P50QueueWaitMillis float64 `json:"p50QueueWaitMillis"`
+	P95QueueWaitMillis float64 `json:"p95QueueWaitMillis"`
+	MaxQueueWaitMillis float64 `json:"maxQueueWaitMillis"`
+	InputBytes         int64   `json:"inputBytes"`
+	OutputRecords      int64   `json:"outputRecords"`
+}
+
+// HourStats is the concurrency seen in one hour, a query counts for every hour it was running in.
+// MaxConcurrency is the most queries running in the same minute of the hour
+type HourStats struct {
+	Hour           time.Time `json:"hour"`
+	Started        int       `json:"started"`
+	MaxConcurrency int       `json:"maxConcurrency"`
+	AvgConcurrency float64   `json:"avgConcurrency"`
+}
+
+// WorkloadSummary is written to workload-summary.json in the queries folder
+type WorkloadSummary struct {
+	Queries           int          `json:"queries"`
+	FirstQuery        time.Time    `json:"firstQuery"`
+	LastQuery         time.Time    `json:"lastQuery"`
+	Overall           GroupStats   `json:"overall"`
+	ByUser            []GroupStats `json:"byUser"`
+	ByQueue           []GroupStats `json:"byQueue"`
+	ByEngine          []GroupStats `json:"byEngine"`
+	ByQueryType       []GroupStats `json:"byQueryType"`
+	ByOutcome         []GroupStats `json:"byOutcome"`
+	HourlyConcurrency []HourStats  `json:"hourlyConcurrency"`
+}
+
+// QueueWaitMillis is the time spent waiting for a slot in a queue, older versions only
+// report the pool wait time
+func (r QueriesRow) QueueWaitMillis() float64 {
+	if r.QueuedTime > 0 {
+		return float64(r.QueuedTime)
+	}
+	return float64(r.PoolWaitTime)
+}
+
+// EndMillis is when the query finished, estimated from the running time when finish is missing
+func (r QueriesRow) EndMillis() float64 {
+	if r.Finish > 0 {
+		return float64(r.Finish)
+	}
+	return r.Start + r.RunningTime
+}
+
+// maxPercentileSamples caps the values kept per group for the percentiles, past that a
+// uniform reservoir sample is kept so memory does not grow with the history
+const maxPercentileSamples = 10000
+
+type groupAccumulator struct {
+	stats      GroupStats
+	maxWait    float64
+	running    []float64
+	queueWaits []float64
+}
+
+func (g *groupAccumulator) add(r QueriesRow, rng *rand.Rand) {
+	g.stats.Queries++
+	switch r.Outcome {
+	case "FAILED":
+		g.stats.Failed++
+	case "CANCELED", "CANCELLED":
+		g.stats.Cancelled++
+	}
+	if r.Accelerated {
+		g.stats.Accelerated++
+	}
+	g.stats.TotalRunningMillis += r.RunningTime
+	g.stats.InputBytes += r.InputBytes
+	g.stats.OutputRecords += r.OutputRecords
+	wait := r.QueueWaitMillis()
+	if wait > g.maxWait {
+		g.maxWait = wait
+	}
+	if len(g.running) < maxPercentileSamples {
+		g.running = append(g.running, r.RunningTime)
+		g.queueWaits = append(g.queueWaits, wait)
+		return
+	}
+	if i := rng.Intn(g.stats.Queries); i < maxPercentileSamples {
+		g.running[i] = r.RunningTime
+		g.queueWaits[i] = wait
+	}
+}
+
+func (g *groupAccumulator) result() GroupStats {
+	s := g.stats
+	if s.Queries > 0 {
+		s.AccelerationRate = float64(s.Accelerated) / float64(s.Queries)
+	}
+	s.P50RunningMillis = stats.Percentile(g.running, 50)
+	s.P95RunningMillis = stats.Percentile(g.running, 95)
+	s.P50QueueWaitMillis = stats.Percentile(g.queueWaits, 50)
+	s.P95QueueWaitMillis = stats.Percentile(g.queueWaits, 95)
+	s.MaxQueueWaitMillis = g.maxWait
+	return s
+}
+
+type dimension struct {
+	name   string
+	key    func(QueriesRow) string
+	groups map[string]*groupAccumulator
+}
+
+func (d *dimension) add(r QueriesRow, rng *rand.Rand) {
+	k := d.key(r)
+	g, ok := d.groups[k]
+	if !ok {
+		g = &groupAccumulator{stats: GroupStats{Dimension: d.name, Key: k}}
+		d.groups[k] = g
+	}
+	g.add(r, rng)
+}
+
+func (d *dimension) results() []GroupStats {
+	results := make([]GroupStats, 0, len(d.groups))
+	for _, g := range d.groups {
+		results = append(results, g.result())
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Queries == results[j].Queries {
+			return results[i].Key < results[j].Key
+		}
+		return results[i].Queries > results[j].Queries
+	})
+	return results
+}
+
+const (
+	minuteMillis = int64(time.Minute / time.Millisecond)
+	hourMillis   = int64(time.Hour / time.Millisecond)
+)
+
+// hourAccumulator is what is known of one hour, the query time inside the hour gives its average concurrency
+type hourAccumulator struct {
+	started       int
+	runningMillis int64
+}
+
+// WorkloadAccumulator builds a WorkloadSummary one query at a time. Only the numbers the
+// summary needs are kept, never the query text or lists of a row, and the concurrency is kept
+// per hour and minute so memory grows with the time the history covers rather than its queries
+type WorkloadAccumulator struct {
+	queries    int
+	first      float64
+	last       float64
+	overall    *dimension
+	dimensions []*dimension
+	hours      map[int64]*hourAccumulator
+	// minuteEdges is how the number of running queries changes at the start of each minute
+	minuteEdges map[int64]int
+	rng         *rand.Rand
+}
+
+func NewWorkloadAccumulator() *WorkloadAccumulator {
+	newDimension := func(name string, key func(QueriesRow) string) *dimension {
+		return &dimension{name: name, key: key, groups: make(map[string]*groupAccumulator)}
+	}
+	return &WorkloadAccumulator{
+		overall: newDimension("overall", func(QueriesRow) string { return "all" }),
+		dimensions: []*dimension{
+			newDimension("user", func(r QueriesRow) string { return r.Username }),
+			newDimension("queue", func(r QueriesRow) string { return r.QueueName }),
+			newDimension("engine", func(r QueriesRow) string { return r.EngineName }),
+			newDimension("queryType", func(r QueriesRow) string { return r.QueryType }),
+			newDimension("outcome", func(r QueriesRow) string { return r.Outcome }),
+		},
+		hours:       make(map[int64]*hourAccumulator),
+		minuteEdges: make(map[int64]int),
+		// the sample only feeds percentiles so a fixed seed keeps the output reproducible
+		rng: rand.New(rand.NewSource(1)), // #nosec G404
+	}
+}
+
+// Add records one query
+func (w *WorkloadAccumulator) Add(r QueriesRow) {
+	if w.queries == 0 || r.Start < w.first {
+		w.first = r.Start
+	}
+	if w.queries == 0 || r.Start > w.last {
+		w.last = r.Start
+	}
+	w.queries++
+	w.overall.add(r, w.rng)
+	for _, d := range w.dimensions {
+		d.add(r, w.rng)
+	}
+	w.addSpan(int64(r.Start), int64(r.EndMillis()))
+}
+
+func (w *WorkloadAccumulator) hour(ms int64) *hourAccumulator {
+	h := ms - ms%hourMillis
+	a, ok := w.hours[h]
+	if !ok {
+		a = &hourAccumulator{}
+		w.hours[h] = a
+	}
+	return a
+}
+
+// addSpan counts the query as running in every minute from the one it started in to the one it
+// ended in, and adds the time it ran in each hour to that hour
+func (w *WorkloadAccumulator) addSpan(start, end int64) {
+	w.hour(start).started++
+	if end <= start {
+		return
+	}
+	w.minuteEdges[start-start%minuteMillis]++
+	last := end - 1
+	w.minuteEdges[last-last%minuteMillis+minuteMillis]--
+	for from := start; from < end; {
+		segmentEnd := from - from%hourMillis + hourMillis
+		if end < segmentEnd {
+			segmentEnd = end
+		}
+		w.hour(from).runningMillis += segmentEnd - from
+		from = segmentEnd
+	}
+}
+
+// Summary is the workload of every query added so far
+func (w *WorkloadAccumulator) Summary() WorkloadSummary {
+	summary := WorkloadSummary{
+		Queries:           w.queries,
+		ByUser:            w.dimensions[0].results(),
+		ByQueue:           w.dimensions[1].results(),
+		ByEngine:          w.dimensions[2].results(),
+		ByQueryType:       w.dimensions[3].results(),
+		ByOutcome:         w.dimensions[4].results(),
+		HourlyConcurrency: w.hourlyConcurrency(),
+	}
+	if overall := w.overall.results(); len(overall) > 0 {
+		summary.Overall = overall[0]
+	}
+	if w.queries > 0 {
+		summary.FirstQuery = time.UnixMilli(int64(w.first)).UTC()
+		summary.LastQuery = time.UnixMilli(int64(w.last)).UTC()
+	}
+	return summary
+}
+
+// hourlyConcurrency sweeps over the minutes where the number of running queries changed and records,
+// for each hour, the most queries that ran in the same minute and how many ran on average
+func (w *WorkloadAccumulator) hourlyConcurrency() []HourStats {
+	results := make(map[int64]*HourStats, len(w.hours))
+	for h, a := range w.hours {
+		results[h] = &HourStats{
+			Hour:           time.UnixMilli(h).UTC(),
+			Started:        a.started,
+			AvgConcurrency: float64(a.runningMillis) / float64(hourMillis),
+		}
+	}
+	minutes := make([]int64, 0, len(w.minuteEdges))
+	for m := range w.minuteEdges {
+		minutes = append(minutes, m)
+	}
+	sort.Slice(minutes, func(i, j int) bool { return minutes[i] < minutes[j] })
+	running := 0
+	for i, m := range minutes {
+		running += w.minuteEdges[m]
+		if running <= 0 || i+1 == len(minutes) {
+			continue
+		}
+		// the count holds until the next change, the hours in between were created by addSpan
+		for h := m - m%hourMillis; h < minutes[i+1]; h += hourMillis {
+			if s, ok := results[h]; ok && running > s.MaxConcurrency {
+				s.MaxConcurrency = running
+			}
+		}
+	}
+	hourly := make([]HourStats, 0, len(results))
+	for _, h := range results {
+		hourly = append(hourly, *h)
+	}
+	sort.Slice(hourly, func(i, j int) bool {
+		return hourly[i].Hour.Before(hourly[j].Hour)
+	})
+	return hourly
+}
+
+// SummarizeWorkload groups the queries by user, queue, engine, query type and outcome
+func SummarizeWorkload(rows []QueriesRow) WorkloadSummary {
+	w := NewWorkloadAccumulator()
+	for _, r := range rows {
+		w.Add(r)
+	}
+	return w.Summary()
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', 2, 64)
+}
+
+// WriteGroupsCSV writes every group of every dimension as one row
+func (w WorkloadSummary) WriteGroupsCSV(out io.Writer) error {
+	cw := csv.NewWriter(out)
+	if err := cw.Write([]string{"dimension", "key", "queries", "failed", "cancelled", "accelerated", "acceleration_rate", "total_running_ms", "p50_running_ms", "p95_running_ms", "p50_queue_wait_ms", "p95_queue_wait_ms", "max_queue_wait_ms", "input_bytes", "output_records"}); err != nil {
+		return err
+	}
+	for _, groups := range [][]GroupStats{w.ByUser, w.ByQueue, w.ByEngine, w.ByQueryType, w.ByOutcome} {
+		for _, g := range groups {
+			if err := cw.Write([]string{
+				g.Dimension, g.Key,
+				strconv.Itoa(g.Queries), strconv.Itoa(g.Failed), strconv.Itoa(g.Cancelled), strconv.Itoa(g.Accelerated),
+				formatFloat(g.AccelerationRate), formatFloat(g.TotalRunningMillis), formatFloat(g.P50RunningMillis), formatFloat(g.P95RunningMillis),
+				formatFloat(g.P50QueueWaitMillis), formatFloat(g.P95QueueWaitMillis), formatFloat(g.MaxQueueWaitMillis),
+				strconv.FormatInt(g.InputBytes, 10), strconv.FormatInt(g.OutputRecords, 10),
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteHourlyCSV writes the hourly concurrency
+func (w WorkloadSummary) WriteHourlyCSV(out io.Writer) error {
+	cw := csv.NewWriter(out)
+	if err := cw.Write([]string{"hour", "started", "max_concurrency", "avg_concurrency"}); err != nil {
+		return err
+	}
+	for _, h := range w.HourlyConcurrency {
+		if err := cw.Write([]string{h.Hour.Format(time.RFC3339), strconv.Itoa(h.Started), strconv.Itoa(h.MaxConcurrency), formatFloat(h.AvgConcurrency)}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func writeCSVFile(fileName string, write func(io.Writer) error) error {
+	f, err := os.Create(filepath.Clean(fileName))
+	if err != nil {
+		return fmt.Errorf("unable to create %v due to error %v", fileName, err)
+	}
+	if err := write(f); err != nil {
+		if closeErr := f.Close(); closeErr != nil {
+			simplelog.Debugf("optional close of %v failed %v", fileName, closeErr)
+		}
+		return fmt.Errorf("unable to write %v due to error %v", fileName, err)
+	}
+	return f.Close()
+}
+
+// RunWorkloadSummary reads the queries.json files already collected into queriesOutDir and
+// writes the workload summary next to them as json and csv, it is only needed when the files
+// were not already read to select the job profiles
+func RunWorkloadSummary(queriesOutDir string, threads int) error {
+	simplelog.Debug("Summarizing queries.json workload ...")
+	files, err := filepath.Glob(filepath.Join(queriesOutDir, "queries*.json*"))
+	if err != nil {
+		return fmt.Errorf("unable to list queries.json files due to error %v", err)
+	}
+	if len(files) == 0 {
+		simplelog.Debugf("no queries.json files in %v to summarize", queriesOutDir)
+		return nil
+	}
+	w := NewWorkloadAccumulator()
+	CollectQueriesJSON(files, threads, w.Add)
+	return WriteWorkloadSummary(queriesOutDir, w)
+}
+
+// WriteWorkloadSummary writes the summary of the queries added to w to queriesOutDir as json and csv
+func WriteWorkloadSummary(queriesOutDir string, w *WorkloadAccumulator) error {
+	summary := w.Summary()
+	b, err := json.MarshalIndent(summary, "", "\t")
+	if err != nil {
+		return fmt.Errorf("unable to marshal workload summary due to error %v", err)
+	}
+	summaryFile := filepath.Join(queriesOutDir, WorkloadSummaryFileName)
+	if err := os.WriteFile(summaryFile, b, 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", summaryFile, err)
+	}
+	if err := writeCSVFile(filepath.Join(queriesOutDir, WorkloadGroupsFileName), summary.WriteGroupsCSV); err != nil {
+		return err
+	}
+	if err := writeCSVFile(filepath.Join(queriesOutDir, WorkloadHourlyFileName), summary.WriteHourlyCSV); err != nil {
+		return err
+	}
+	simplelog.Debugf("... summarizing queries.json workload COMPLETED for %v queries", summary.Queries)
+	return nil
+}
@@ -0,0 +1,155 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package queriesjson
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadJSONFileDecodesEveryField(t *testing.T) {
+	rows, err := ReadJSONFile(filepath.Join("testdata", "full_queries.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected 3 rows but was %v", len(rows))
+	}
+	q1 := rows[0]
+	if q1.Username != "alice" || q1.QueueName != "UI Previews" || q1.InputBytes != 1000 || !q1.Accelerated || q1.QueuedTime != 100 || q1.Finish != 1704099660000 {
+		t.Errorf("unexpected row %#v", q1)
+	}
+	if len(q1.ExecutionNodes) != 1 || q1.ExecutionNodes[0].Hostname != "exec1" || q1.ExecutionNodes[0].MaxMemUsed != 2048 {
+		t.Errorf("unexpected execution nodes %#v", q1.ExecutionNodes)
+	}
+	if q1.QueryText != "SELECT 1" || string(q1.ScannedDatasets) != `[{"datasetName":"t"}]` {
+		t.Errorf("unexpected text and datasets %#v", q1)
+	}
+	// context has the wrong type but the rest of the line is still usable
+	if rows[2].QueryID != "q3" || rows[2].PoolWaitTime != 300 {
+		t.Errorf("unexpected row %#v", rows[2])
+	}
+}
+
+func TestSummarizeWorkload(t *testing.T) {
+	rows, err := ReadJSONFile(filepath.Join("testdata", "full_queries.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := SummarizeWorkload(rows)
+	if s.Queries != 3 || s.Overall.Failed != 1 || s.Overall.Cancelled != 1 || s.Overall.Accelerated != 1 {
+		t.Errorf("unexpected overall %#v", s.Overall)
+	}
+	if len(s.ByUser) != 2 || s.ByUser[0].Key != "alice" || s.ByUser[0].Queries != 2 || s.ByUser[0].AccelerationRate != 0.5 {
+		t.Errorf("unexpected users %#v", s.ByUser)
+	}
+	// q1 waited on queuedTime and q3 only has the pool wait time
+	if s.ByQueue[0].Key != "UI Previews" || s.ByQueue[0].MaxQueueWaitMillis != 300 || s.ByQueue[0].P50QueueWaitMillis != 100 {
+		t.Errorf("unexpected queues %#v", s.ByQueue)
+	}
+	if len(s.HourlyConcurrency) != 2 {
+		t.Fatalf("expected q2 to run into a second hour but was %#v", s.HourlyConcurrency)
+	}
+	first := s.HourlyConcurrency[0]
+	if !first.Hour.Equal(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)) || first.Started != 3 || first.MaxConcurrency != 2 {
+		t.Errorf("unexpected first hour %#v", first)
+	}
+	// q1 60s, q2 3570s and q3 1s inside the first hour
+	expectedAvg := (60.0 + 3570 + 1) / 3600
+	if diff := first.AvgConcurrency - expectedAvg; diff > 0.0001 || diff < -0.0001 {
+		t.Errorf("expected avg concurrency %v but was %v", expectedAvg, first.AvgConcurrency)
+	}
+	second := s.HourlyConcurrency[1]
+	if second.Started != 0 || second.MaxConcurrency != 1 {
+		t.Errorf("unexpected second hour %#v", second)
+	}
+}
+
+func TestRunWorkloadSummary(t *testing.T) {
+	dir := t.TempDir()
+	data, err := os.ReadFile(filepath.Join("testdata", "full_queries.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "queries.json"), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := RunWorkloadSummary(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, WorkloadSummaryFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var summary WorkloadSummary
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatal(err)
+	}
+	if summary.Queries != 3 {
+		t.Errorf("expected 3 queries but was %v", summary.Queries)
+	}
+	groups, err := os.ReadFile(filepath.Join(dir, WorkloadGroupsFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(groups)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// header, 2 users, 2 queues, 1 engine, 2 query types and 3 outcomes
+	if len(records) != 11 {
+		t.Errorf("expected 11 csv rows but was %v", len(records))
+	}
+	if _, err := os.Stat(filepath.Join(dir, WorkloadHourlyFileName)); err != nil {
+		t.Errorf("expected the hourly csv: %v", err)
+	}
+}
+
+func TestWorkloadAccumulatorKeepsTheConcurrencyPerHourAndMinute(t *testing.T) {
+	w := NewWorkloadAccumulator()
+	start := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC).UnixMilli()
+	// back to back queries of 30 seconds for two hours, one at a time
+	for i := int64(0); i < 240; i++ {
+		w.Add(QueriesRow{QueryID: fmt.Sprintf("q%v", i), Start: float64(start + i*30000), Finish: start + (i+1)*30000})
+	}
+	// and 1000 one millisecond queries at the same instant
+	for i := 0; i < 1000; i++ {
+		w.Add(QueriesRow{QueryID: fmt.Sprintf("burst%v", i), Start: float64(start + 90*60000), Finish: start + 90*60000 + 1})
+	}
+	if len(w.hours) != 2 || len(w.minuteEdges) > 121 {
+		t.Errorf("expected memory to follow the hours and minutes covered but was %v hours and %v minutes", len(w.hours), len(w.minuteEdges))
+	}
+	s := w.Summary()
+	if len(s.HourlyConcurrency) != 2 {
+		t.Fatalf("expected 2 hours but was %#v", s.HourlyConcurrency)
+	}
+	first, second := s.HourlyConcurrency[0], s.HourlyConcurrency[1]
+	// two of the back to back queries run in each minute
+	if first.Started != 120 || first.MaxConcurrency != 2 || first.AvgConcurrency != 1 {
+		t.Errorf("unexpected first hour %#v", first)
+	}
+	if second.Started != 1120 || second.MaxConcurrency != 1002 {
+		t.Errorf("unexpected second hour %#v", second)
+	}
+	if expected := 1 + 1000.0/float64(hourMillis); second.AvgConcurrency-expected > 0.0001 || expected-second.AvgConcurrency > 0.0001 {
+		t.Errorf("expected avg concurrency %v but was %v", expected, second.AvgConcurrency)
+	}
+}
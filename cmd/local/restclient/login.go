@@ -0,0 +1,109 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// restclient is the client of the Dremio REST api used by the collectors
+package restclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// sessionRefreshMargin is how long before it expires a session is replaced, so a download that starts
+// just before the expiry does not fail halfway
+const sessionRefreshMargin = 2 * time.Minute
+
+// session is the token /apiv2/login returned, the mutex keeps the parallel downloads from logging in
+// at the same time
+type session struct {
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+// usesLogin is true when the client logs in with a user name and password instead of a personal access token
+func (h *HTTPClient) usesLogin() bool {
+	return h.conf.Token == "" && h.conf.Password != ""
+}
+
+// authorization is the Authorization header of the requests, it logs in when there is no session or
+// the session is about to expire
+func (h *HTTPClient) authorization() (string, error) {
+	if !h.usesLogin() {
+		return "Bearer " + h.conf.Token, nil
+	}
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+	if h.session.token == "" || (!h.session.expires.IsZero() && time.Now().Add(sessionRefreshMargin).After(h.session.expires)) {
+		if err := h.loginLocked(); err != nil {
+			return "", err
+		}
+	}
+	return "_dremio" + h.session.token, nil
+}
+
+// expireSession drops the token so the next request logs in again
+func (h *HTTPClient) expireSession() {
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+	h.session.token = ""
+}
+
+func (h *HTTPClient) login() error {
+	h.session.mu.Lock()
+	defer h.session.mu.Unlock()
+	return h.loginLocked()
+}
+
+func (h *HTTPClient) loginLocked() error {
+	if h.conf.IsCloud {
+		return errors.New("Dremio Cloud does not support logging in with a password, use a personal access token")
+	}
+	body, err := json.Marshal(struct {
+		UserName string `json:"userName"`
+		Password string `json:"password"`
+	}{UserName: h.conf.Username, Password: h.conf.Password})
+	if err != nil {
+		return fmt.Errorf("unable to encode the login of %v due to error %v", h.conf.Username, err)
+	}
+	loginURL := h.conf.Endpoint + "/apiv2/login"
+	res, err := h.send("POST", loginURL, body, map[string]string{"Content-Type": "application/json"}, false)
+	if err != nil {
+		return fmt.Errorf("unable to log in as %v due to error %w", h.conf.Username, err)
+	}
+	defer closeBody(loginURL, res)
+	var login struct {
+		Token string `json:"token"`
+		// Expires is in milliseconds since the epoch
+		Expires int64 `json:"expires"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&login); err != nil {
+		return fmt.Errorf("unable to decode the login of %v due to error %v", h.conf.Username, err)
+	}
+	if login.Token == "" {
+		return fmt.Errorf("the login of %v did not return a token", h.conf.Username)
+	}
+	h.session.token = login.Token
+	h.session.expires = time.Time{}
+	if login.Expires > 0 {
+		h.session.expires = time.UnixMilli(login.Expires)
+	}
+	simplelog.Debugf("logged in as %v, the session expires at %v", h.conf.Username, h.session.expires)
+	return nil
+}
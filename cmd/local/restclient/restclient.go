@@ -12,95 +12,530 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
+// restclient is the client of the Dremio REST api used by the collectors
 package restclient
 
 import (
+	"bytes"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
-var client *http.Client
+// Client is the Dremio REST api, the paths of Dremio Cloud and of software clusters are handled by the client
+type Client interface {
+	// ValidateCredentials checks the endpoint accepts the credentials
+	ValidateCredentials() error
+	// SubmitSQL starts a job running the sql and returns its id
+	SubmitSQL(sql string) (string, error)
+	// JobStatus is the state of a job
+	JobStatus(jobID string) (JobStatus, error)
+	// JobResults is a page of up to limit rows of the results of a completed job
+	JobResults(jobID string, offset, limit int) (JobResults, error)
+	// DownloadJobProfile writes the zip of the profile of a job to w
+	DownloadJobProfile(jobID string, w io.Writer) error
+	// WLM returns the workload management objects, queues and rules or the engines of Dremio Cloud
+	WLM() ([]WLMObject, error)
+	// KVStoreReport writes the zip of the kv store report to w
+	KVStoreReport(w io.Writer) error
+	// Catalog lists the top level of the catalog
+	Catalog() ([]CatalogEntry, error)
+	// CatalogItem is the json of a catalog entity, id is its id or its path
+	CatalogItem(id string) (json.RawMessage, error)
+	// Projects lists the Dremio Cloud projects of the organization the token can see
+	Projects() ([]Project, error)
+	// ForProject is a client of another Dremio Cloud project of the same organization
+	ForProject(projectID string) Client
+}
+
+// JobStatus is the part of the job api response the collectors use
+type JobStatus struct {
+	JobState     string `json:"jobState"`
+	RowCount     int    `json:"rowCount"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// Failed is true when the job will not complete
+func (j JobStatus) Failed() bool {
+	switch j.JobState {
+	case "FAILED", "CANCELED", "CANCELLATION_REQUESTED", "INVALID_STATE":
+		return true
+	}
+	return false
+}
+
+// JobResults is a page of the job results api, the schema and rows are kept as they were returned
+type JobResults struct {
+	RowCount int               `json:"rowCount"`
+	Schema   json.RawMessage   `json:"schema"`
+	Rows     []json.RawMessage `json:"rows"`
+}
+
+// WLMObject is a workload management api response, Name is what it holds such as queues or rules
+type WLMObject struct {
+	Name string
+	Body json.RawMessage
+}
+
+// CatalogEntry is an entry of the catalog listing
+type CatalogEntry struct {
+	ID            string   `json:"id"`
+	Path          []string `json:"path"`
+	Type          string   `json:"type"`
+	ContainerType string   `json:"containerType"`
+	DatasetType   string   `json:"datasetType"`
+}
+
+// Project is a Dremio Cloud project of the project listing
+type Project struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	State string `json:"state"`
+}
+
+// Config is what NewClient needs to reach the api
+type Config struct {
+	// Endpoint is the url of the coordinator or of the Dremio Cloud api
+	Endpoint string
+	// AppEndpoint is the url of the Dremio Cloud app, job profiles are downloaded from it
+	AppEndpoint string
+	IsCloud     bool
+	ProjectID   string
+	// Token is the personal access token, without one Username and Password log in to a session
+	Token    string
+	Username string
+	Password string
+	// AllowInsecureSSL skips the verification of the certificate of the endpoint
+	AllowInsecureSSL bool
+	// CAFile has pem encoded certificates that are trusted on top of the ones of the system
+	CAFile string
+	// ClientCertFile and ClientKeyFile are the pem encoded certificate and key sent to coordinators that require mutual TLS
+	ClientCertFile string
+	ClientKeyFile  string
+	// ProxyURL is the proxy all requests go through except the ones to the comma separated hosts of NoProxy
+	ProxyURL string
+	NoProxy  string
+	Timeout  time.Duration
+	// Retries is how many times a request that was throttled or hit an unavailable coordinator is tried again
+	Retries int
+	// RetryWait is the wait before the first retry, it doubles with every retry up to MaxRetryWait
+	RetryWait    time.Duration
+	MaxRetryWait time.Duration
+}
+
+// DefaultRetries is the default of rest-http-retries, DefaultRetryWait and DefaultMaxRetryWait are used
+// when the Config leaves them unset
+const (
+	DefaultRetries      = 3
+	DefaultRetryWait    = 500 * time.Millisecond
+	DefaultMaxRetryWait = 30 * time.Second
+)
+
+// maxErrorBody is how much of the body of a failed response is kept in the error
+const maxErrorBody = 2048
+
+// HTTPError is a response with a status other than 200, the start of the body is kept since Dremio
+// explains most failures in it
+type HTTPError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *HTTPError) Error() string {
+	if e.Body == "" {
+		return fmt.Sprintf("%v %v returned %v", e.Method, e.URL, e.Status)
+	}
+	return fmt.Sprintf("%v %v returned %v: %v", e.Method, e.URL, e.Status, e.Body)
+}
+
+// retryable are the statuses of a throttled request or a coordinator that is restarting or behind a busy proxy.
+// A proxy may return a bad gateway or gateway timeout after the coordinator got the request, so a request that
+// is not idempotent is only sent again when it was throttled or the coordinator was unavailable
+func retryable(method string, statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		return true
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent(method)
+	}
+	return false
+}
 
-func InitClient(allowInsecureSSL bool, restHTTPTimeout int) {
+// retryableError reports whether a request that failed with err can be sent again. A timeout is not as the
+// request may still be running on the coordinator and a rejected certificate will not be accepted on the next
+// try either. A request that is not idempotent, such as submitting sql, is only sent again when the connection
+// to the coordinator could not be made, as otherwise it may have been run already
+func retryableError(method string, err error) bool {
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		return false
+	}
+	if idempotent(method) {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// idempotent methods can be sent again without changing what the first request did
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// HTTPClient is the Client over http
+type HTTPClient struct {
+	conf   Config
+	client *http.Client
+	// sleep is replaced in tests
+	sleep func(time.Duration)
+	// session is the login of Username when there is no Token
+	session session
+}
+
+// NewClient creates a client for the endpoint of the config
+func NewClient(conf Config) (*HTTPClient, error) {
+	if conf.Retries < 0 {
+		conf.Retries = 0
+	}
+	if conf.RetryWait <= 0 {
+		conf.RetryWait = DefaultRetryWait
+	}
+	if conf.MaxRetryWait <= 0 {
+		conf.MaxRetryWait = DefaultMaxRetryWait
+	}
+	conf.Endpoint = strings.TrimSuffix(conf.Endpoint, "/")
+	conf.AppEndpoint = strings.TrimSuffix(conf.AppEndpoint, "/")
+	tlsClientConfig, err := tlsConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	proxyFunc, err := proxy(conf)
+	if err != nil {
+		return nil, err
+	}
 	tr := &http.Transport{
+		Proxy:                 proxyFunc,
 		MaxIdleConns:          10,
 		IdleConnTimeout:       time.Duration(30) * time.Second,
 		ResponseHeaderTimeout: time.Duration(30) * time.Second,
 		TLSHandshakeTimeout:   time.Duration(30) * time.Second,
 		ExpectContinueTimeout: time.Duration(30) * time.Second,
-		TLSClientConfig:       &tls.Config{InsecureSkipVerify: allowInsecureSSL},
+		TLSClientConfig:       tlsClientConfig,
 	}
-	client = &http.Client{
-		Transport: tr,
-		Timeout:   time.Duration(restHTTPTimeout) * time.Second,
+	return &HTTPClient{
+		conf: conf,
+		client: &http.Client{
+			Transport: tr,
+			Timeout:   conf.Timeout,
+		},
+		sleep: time.Sleep,
+	}, nil
+}
+
+// apiPath is the url of a path of the api, paths start with / and are under the project on Dremio Cloud
+func (h *HTTPClient) apiPath(softwarePath, cloudPath string) string {
+	if h.conf.IsCloud {
+		return h.conf.Endpoint + "/v0/projects/" + url.PathEscape(h.conf.ProjectID) + cloudPath
 	}
+	return h.conf.Endpoint + softwarePath
 }
 
-func APIRequest(url string, pat string, request string, headers map[string]string) ([]byte, error) {
-	if client == nil {
-		return []byte(""), errors.New("critical error call InitClient first")
+// backoff is the wait before retry number attempt, the second half of the wait is random so clients
+// that were throttled together do not come back together. A Retry-After from the server wins
+func (h *HTTPClient) backoff(attempt int, res *http.Response) time.Duration {
+	if res != nil {
+		if seconds, err := strconv.Atoi(res.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			return min(time.Duration(seconds)*time.Second, h.conf.MaxRetryWait)
+		}
 	}
-	simplelog.Debugf("Requesting %s", url)
-	req, err := http.NewRequest(request, url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("unable to create request due to error %v", err)
+	wait := h.conf.RetryWait
+	for i := 0; i < attempt && wait < h.conf.MaxRetryWait; i++ {
+		wait *= 2
 	}
-	authorization := "Bearer " + pat
-	req.Header.Set("Authorization", authorization)
-	for key, value := range headers {
-		req.Header.Set(key, value)
+	wait = min(wait, h.conf.MaxRetryWait)
+	half := wait / 2
+	// #nosec G404 the jitter does not need a secure random number
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// do sends the request and returns the response of the first attempt that was not throttled. The caller
+// closes the body. Requests that failed are tried again as retryableError allows, timeouts are not since
+// the request may still be running on the coordinator
+func (h *HTTPClient) do(method, rawURL string, body []byte, headers map[string]string) (*http.Response, error) {
+	return h.send(method, rawURL, body, headers, true)
+}
+
+// send is do without the Authorization header when authenticated is false, as the login needs.
+// A session that expired while it was used is logged in again once
+func (h *HTTPClient) send(method, rawURL string, body []byte, headers map[string]string, authenticated bool) (*http.Response, error) {
+	loggedInAgain := false
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequest(method, rawURL, reader)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create request due to error %v", err)
+		}
+		if authenticated {
+			authorization, err := h.authorization()
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", authorization)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		simplelog.Debugf("Requesting %v %s", method, rawURL)
+		res, err := h.client.Do(req)
+		if err != nil {
+			if attempt < h.conf.Retries && retryableError(method, err) {
+				wait := h.backoff(attempt, nil)
+				simplelog.Warningf("%v %v failed due to error %v, retrying in %v", method, rawURL, err, wait)
+				h.sleep(wait)
+				continue
+			}
+			return nil, err
+		}
+		if res.StatusCode == http.StatusOK {
+			return res, nil
+		}
+		errBody, readErr := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+		if closeErr := res.Body.Close(); closeErr != nil {
+			simplelog.Debugf("unable to close response of %v due to error %v", rawURL, closeErr)
+		}
+		if readErr != nil {
+			simplelog.Debugf("unable to read error response of %v due to error %v", rawURL, readErr)
+		}
+		if res.StatusCode == http.StatusUnauthorized && authenticated && h.usesLogin() && !loggedInAgain {
+			simplelog.Infof("the session of %v expired, logging in again", h.conf.Username)
+			h.expireSession()
+			loggedInAgain = true
+			attempt--
+			continue
+		}
+		if retryable(method, res.StatusCode) && attempt < h.conf.Retries {
+			wait := h.backoff(attempt, res)
+			simplelog.Warningf("%v %v returned %v, retrying in %v", method, rawURL, res.Status, wait)
+			h.sleep(wait)
+			continue
+		}
+		return nil, &HTTPError{
+			Method:     method,
+			URL:        rawURL,
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+			Body:       strings.TrimSpace(string(errBody)),
+		}
 	}
+}
+
+// getJSON decodes the response of a GET into dest
+func (h *HTTPClient) getJSON(rawURL string, dest any) error {
+	return h.requestJSON("GET", rawURL, nil, dest)
+}
 
-	res, err := client.Do(req)
+func (h *HTTPClient) requestJSON(method, rawURL string, request any, dest any) error {
+	var body []byte
+	if request != nil {
+		var err error
+		body, err = json.Marshal(request)
+		if err != nil {
+			return fmt.Errorf("unable to encode request to %v due to error %v", rawURL, err)
+		}
+	}
+	res, err := h.do(method, rawURL, body, map[string]string{"Content-Type": "application/json"})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf(res.Status)
+	defer closeBody(rawURL, res)
+	if dest == nil {
+		return nil
 	}
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+	if err := json.NewDecoder(res.Body).Decode(dest); err != nil {
+		return fmt.Errorf("unable to decode the response of %v due to error %w", rawURL, err)
 	}
-	return body, nil
+	return nil
 }
 
-func PostQuery(url string, pat string, headers map[string]string, sqlbody string) (string, error) {
-
-	req, err := http.NewRequest("POST", url, strings.NewReader(sqlbody))
+// download copies the response to w
+func (h *HTTPClient) download(method, rawURL string, w io.Writer) error {
+	res, err := h.do(method, rawURL, nil, map[string]string{"Accept": "application/octet-stream"})
 	if err != nil {
-		return "", fmt.Errorf("unable to create request due to error %v", err)
+		return err
+	}
+	defer closeBody(rawURL, res)
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return fmt.Errorf("unable to read the response of %v due to error %w", rawURL, err)
 	}
-	authorization := "Bearer " + pat
-	req.Header.Set("Authorization", authorization)
+	return nil
+}
 
-	for key, value := range headers {
-		req.Header.Set(key, value)
+func closeBody(rawURL string, res *http.Response) {
+	if err := res.Body.Close(); err != nil {
+		simplelog.Debugf("unable to close response of %v due to error %v", rawURL, err)
 	}
-	res, err := client.Do(req)
+}
 
-	if err != nil {
-		return "", err
+func (h *HTTPClient) ValidateCredentials() error {
+	if h.usesLogin() {
+		if err := h.login(); err != nil {
+			return err
+		}
 	}
-	if res.StatusCode != 200 {
-		return "", fmt.Errorf(res.Status)
+	if h.conf.IsCloud {
+		if h.conf.ProjectID == "" {
+			// collecting several projects starts from the project listing
+			_, err := h.Projects()
+			return err
+		}
+		return h.getJSON(h.apiPath("", ""), nil)
 	}
+	return h.getJSON(h.conf.Endpoint+"/apiv2/login", nil)
+}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		return "", err
+func (h *HTTPClient) SubmitSQL(sql string) (string, error) {
+	var job struct {
+		ID string `json:"id"`
 	}
-	var job map[string]string
-	if err := json.Unmarshal(body, &job); err != nil {
+	request := struct {
+		SQL string `json:"sql"`
+	}{SQL: sql}
+	if err := h.requestJSON("POST", h.apiPath("/api/v3/sql", "/sql"), request, &job); err != nil {
 		return "", err
 	}
-	return job["id"], nil
+	if job.ID == "" {
+		return "", errors.New("the sql api did not return a job id")
+	}
+	return job.ID, nil
+}
+
+func (h *HTTPClient) JobStatus(jobID string) (JobStatus, error) {
+	var status JobStatus
+	path := "/job/" + url.PathEscape(jobID)
+	if err := h.getJSON(h.apiPath("/api/v3"+path, path), &status); err != nil {
+		return JobStatus{}, err
+	}
+	if status.JobState == "" {
+		return JobStatus{}, errors.New("returned json does not contain required field 'jobState'")
+	}
+	return status, nil
+}
+
+func (h *HTTPClient) JobResults(jobID string, offset, limit int) (JobResults, error) {
+	var results JobResults
+	path := "/job/" + url.PathEscape(jobID) + "/results?offset=" + strconv.Itoa(offset) + "&limit=" + strconv.Itoa(limit)
+	if err := h.getJSON(h.apiPath("/api/v3"+path, path), &results); err != nil {
+		return JobResults{}, err
+	}
+	return results, nil
+}
+
+func (h *HTTPClient) DownloadJobProfile(jobID string, w io.Writer) error {
+	if h.conf.IsCloud {
+		return h.download("POST", h.conf.AppEndpoint+"/ui/projects/"+url.PathEscape(h.conf.ProjectID)+"/support/"+url.PathEscape(jobID)+"/download", w)
+	}
+	return h.download("POST", h.conf.Endpoint+"/apiv2/support/"+url.PathEscape(jobID)+"/download", w)
+}
+
+func (h *HTTPClient) WLM() ([]WLMObject, error) {
+	var objects []WLMObject
+	var paths [][]string
+	if !h.conf.IsCloud {
+		paths = [][]string{
+			{"queues", h.conf.Endpoint + "/api/v3/wlm/queue"},
+			{"rules", h.conf.Endpoint + "/api/v3/wlm/rule"},
+			{"awse_engines", h.conf.Endpoint + "/apiv2/provision/clusters"},
+		}
+	} else {
+		paths = [][]string{
+			{"engines", h.apiPath("", "/engines")},
+			{"rules", h.apiPath("", "/rules")},
+		}
+	}
+	for _, p := range paths {
+		var body json.RawMessage
+		if err := h.getJSON(p[1], &body); err != nil {
+			return objects, err
+		}
+		objects = append(objects, WLMObject{Name: p[0], Body: body})
+	}
+	return objects, nil
+}
+
+func (h *HTTPClient) KVStoreReport(w io.Writer) error {
+	return h.download("GET", h.conf.Endpoint+"/apiv2/kvstore/report", w)
+}
+
+func (h *HTTPClient) Catalog() ([]CatalogEntry, error) {
+	var catalog struct {
+		Data []CatalogEntry `json:"data"`
+	}
+	if err := h.getJSON(h.apiPath("/api/v3/catalog", "/catalog"), &catalog); err != nil {
+		return nil, err
+	}
+	return catalog.Data, nil
+}
+
+func (h *HTTPClient) CatalogItem(id string) (json.RawMessage, error) {
+	var item json.RawMessage
+	path := "/catalog/" + url.PathEscape(id)
+	if strings.Contains(id, "/") {
+		// a path such as source/folder/table is looked up by path with every part escaped
+		var parts []string
+		for _, part := range strings.Split(id, "/") {
+			parts = append(parts, url.PathEscape(part))
+		}
+		path = "/catalog/by-path/" + strings.Join(parts, "/")
+	}
+	if err := h.getJSON(h.apiPath("/api/v3"+path, path), &item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (h *HTTPClient) Projects() ([]Project, error) {
+	if !h.conf.IsCloud {
+		return nil, errors.New("projects are only available on Dremio Cloud")
+	}
+	var projects []Project
+	if err := h.getJSON(h.conf.Endpoint+"/v0/projects", &projects); err != nil {
+		return nil, err
+	}
+	return projects, nil
+}
+
+func (h *HTTPClient) ForProject(projectID string) Client {
+	conf := h.conf
+	conf.ProjectID = projectID
+	// the connections are shared, Dremio Cloud only takes tokens so there is no session to share
+	return &HTTPClient{
+		conf:   conf,
+		client: h.client,
+		sleep:  h.sleep,
+	}
 }
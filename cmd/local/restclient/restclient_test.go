@@ -15,63 +15,273 @@
 package restclient
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
-func TestAPIRequest(t *testing.T) {
+// testClient does not wait between retries and records the waits instead
+func testClient(t *testing.T, conf Config) (*HTTPClient, *[]time.Duration) {
+	client, err := NewClient(conf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var waits []time.Duration
+	client.sleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+	return client, &waits
+}
+
+func TestSubmitSQL(t *testing.T) {
+	sql := `SELECT * FROM sys.options WHERE name = "a" AND status <> 'DEFAULT'`
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		rw.WriteHeader(http.StatusOK)
-		fmt.Fprintln(rw, `{"message":"success"}`)
+		if req.Method != "POST" || req.URL.Path != "/api/v3/sql" {
+			t.Errorf("unexpected request %v %v", req.Method, req.URL.Path)
+		}
+		if auth := req.Header.Get("Authorization"); auth != "Bearer token" {
+			t.Errorf("unexpected authorization %v", auth)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("the sql request is not json: %v", err)
+		}
+		if body["sql"] != sql {
+			t.Errorf("expected sql %v but was %v", sql, body["sql"])
+		}
+		fmt.Fprintln(rw, `{"id":"123"}`)
 	}))
 	defer server.Close()
 
-	InitClient(true, 10)
-
-	_, err := APIRequest(server.URL, "token", "GET", map[string]string{})
+	client, _ := testClient(t, Config{Endpoint: server.URL, Token: "token", Timeout: 10 * time.Second})
+	id, err := client.SubmitSQL(sql)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
+	if id != "123" {
+		t.Errorf("expected job id 123 but was %v", id)
+	}
+}
+
+func TestBadStatusCodeKeepsTheBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		rw.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(rw, `{"errorMessage":"Table 'sys.nope' not found"}`)
+	}))
+	defer server.Close()
+
+	client, waits := testClient(t, Config{Endpoint: server.URL, Token: "token", Timeout: 10 * time.Second, Retries: 3})
+	_, err := client.SubmitSQL("SELECT * FROM sys.nope")
+	if err == nil {
+		t.Fatal("Expected error, got nil")
+	}
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an HTTPError with 400 but was %v", err)
+	}
+	if !strings.Contains(err.Error(), "400") || !strings.Contains(err.Error(), "Table 'sys.nope' not found") {
+		t.Errorf("expected the status and the body in the error but was %v", err)
+	}
+	if len(*waits) != 0 {
+		t.Errorf("a bad request should not be retried but was retried %v times", len(*waits))
+	}
 }
 
-func TestPostQuery(t *testing.T) {
+func TestRetriesThrottledAndUnavailableResponses(t *testing.T) {
+	calls := 0
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		if req.Method != "POST" {
-			t.Fatalf("Expected 'POST', got '%v'", req.Method)
+		calls++
+		switch calls {
+		case 1:
+			rw.Header().Set("Retry-After", "2")
+			rw.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		case 3:
+			rw.WriteHeader(http.StatusBadGateway)
+		default:
+			fmt.Fprintln(rw, `{"jobState":"COMPLETED","rowCount":3}`)
 		}
-		rw.WriteHeader(http.StatusOK)
-		fmt.Fprintln(rw, `{"id":"123"}`)
 	}))
 	defer server.Close()
 
-	InitClient(true, 10)
+	client, waits := testClient(t, Config{Endpoint: server.URL, Token: "token", Timeout: 10 * time.Second, Retries: 3, RetryWait: time.Second, MaxRetryWait: 10 * time.Second})
+	status, err := client.JobStatus("job1")
+	if err != nil {
+		t.Fatalf("expected the fourth attempt to succeed but got %v", err)
+	}
+	if status.JobState != "COMPLETED" || status.RowCount != 3 {
+		t.Errorf("unexpected status %#v", status)
+	}
+	if len(*waits) != 3 {
+		t.Fatalf("expected 3 retries but was %v", len(*waits))
+	}
+	if (*waits)[0] != 2*time.Second {
+		t.Errorf("expected the Retry-After of 2s to be used but waited %v", (*waits)[0])
+	}
+	// the jitter keeps each wait between half and all of the doubled wait
+	if w := (*waits)[1]; w < time.Second || w > 2*time.Second {
+		t.Errorf("second retry waited %v", w)
+	}
+	if w := (*waits)[2]; w < 2*time.Second || w > 4*time.Second {
+		t.Errorf("third retry waited %v", w)
+	}
+}
+
+func TestGivesUpAfterTheRetries(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		calls++
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprint(rw, "coordinator is starting")
+	}))
+	defer server.Close()
+
+	client, _ := testClient(t, Config{Endpoint: server.URL, Token: "token", Timeout: 10 * time.Second, Retries: 2})
+	err := client.ValidateCredentials()
+	if err == nil || !strings.Contains(err.Error(), "coordinator is starting") {
+		t.Errorf("expected the last response in the error but was %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 attempts but was %v", calls)
+	}
+}
+
+func TestDremioCloudPaths(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		paths = append(paths, req.Method+" "+req.URL.RequestURI())
+		switch {
+		case strings.HasSuffix(req.URL.Path, "/results"):
+			fmt.Fprintln(rw, `{"rowCount":1,"schema":[{"name":"a","type":{"name":"VARCHAR"}}],"rows":[{"a":"b"}]}`)
+		case strings.HasSuffix(req.URL.Path, "/catalog"):
+			fmt.Fprintln(rw, `{"data":[{"id":"1","path":["s3"],"type":"CONTAINER","containerType":"SOURCE"}]}`)
+		case strings.HasSuffix(req.URL.Path, "/download"):
+			fmt.Fprint(rw, "PK")
+		default:
+			fmt.Fprintln(rw, `{}`)
+		}
+	}))
+	defer server.Close()
 
-	sqlbody := "{\"sql\": \"SELECT * FROM test_table\"}"
-	_, err := PostQuery(server.URL, "token", map[string]string{}, sqlbody)
+	client, _ := testClient(t, Config{Endpoint: server.URL, AppEndpoint: server.URL + "/app", IsCloud: true, ProjectID: "p1", Token: "token", Timeout: 10 * time.Second})
+	if err := client.ValidateCredentials(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	results, err := client.JobResults("job1", 500, 500)
 	if err != nil {
-		t.Fatalf("Expected no error, got %v", err)
+		t.Fatalf("unexpected error %v", err)
+	}
+	if results.RowCount != 1 || len(results.Rows) != 1 || string(results.Rows[0]) != `{"a":"b"}` {
+		t.Errorf("unexpected results %#v", results)
+	}
+	entries, err := client.Catalog()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(entries) != 1 || entries[0].ContainerType != "SOURCE" || entries[0].Path[0] != "s3" {
+		t.Errorf("unexpected catalog %#v", entries)
+	}
+	if _, err := client.CatalogItem("s3/my folder/t"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var profile bytes.Buffer
+	if err := client.DownloadJobProfile("job1", &profile); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if profile.String() != "PK" {
+		t.Errorf("unexpected profile %q", profile.String())
+	}
+	objects, err := client.WLM()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(objects) != 2 || objects[0].Name != "engines" || objects[1].Name != "rules" {
+		t.Errorf("unexpected wlm objects %#v", objects)
+	}
+	expected := []string{
+		"GET /v0/projects/p1",
+		"GET /v0/projects/p1/job/job1/results?offset=500&limit=500",
+		"GET /v0/projects/p1/catalog",
+		"GET /v0/projects/p1/catalog/by-path/s3/my%20folder/t",
+		"POST /app/ui/projects/p1/support/job1/download",
+		"GET /v0/projects/p1/engines",
+		"GET /v0/projects/p1/rules",
+	}
+	if strings.Join(paths, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected requests\n%v\nbut was\n%v", strings.Join(expected, "\n"), strings.Join(paths, "\n"))
 	}
 }
 
-func TestPostQueryBadStatusCode(t *testing.T) {
+func TestDremioCloudProjects(t *testing.T) {
+	var paths []string
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
-		rw.WriteHeader(http.StatusBadRequest)
+		paths = append(paths, req.Method+" "+req.URL.RequestURI())
+		if req.URL.Path == "/v0/projects" {
+			fmt.Fprintln(rw, `[{"id":"p1","name":"sales","state":"ACTIVE"},{"id":"p2","name":"finance","state":"ACTIVE"}]`)
+			return
+		}
+		fmt.Fprintln(rw, `{"id":"job1"}`)
 	}))
 	defer server.Close()
 
-	InitClient(true, 10)
+	// without a project the token is checked against the project listing
+	client, _ := testClient(t, Config{Endpoint: server.URL, IsCloud: true, Token: "token"})
+	if err := client.ValidateCredentials(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	projects, err := client.Projects()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(projects) != 2 || projects[1].ID != "p2" || projects[1].Name != "finance" {
+		t.Errorf("unexpected projects %#v", projects)
+	}
+	if _, err := client.ForProject("p2").SubmitSQL("SELECT 1"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []string{
+		"GET /v0/projects",
+		"GET /v0/projects",
+		"POST /v0/projects/p2/sql",
+	}
+	if strings.Join(paths, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected requests\n%v\nbut was\n%v", strings.Join(expected, "\n"), strings.Join(paths, "\n"))
+	}
+
+	software, _ := testClient(t, Config{Endpoint: server.URL, Token: "token"})
+	if _, err := software.Projects(); err == nil {
+		t.Error("expected an error listing projects of a software cluster")
+	}
+}
 
-	sqlbody := "{\"sql\": \"SELECT * FROM test_table\"}"
-	_, err := PostQuery(server.URL, "token", map[string]string{}, sqlbody)
-	if err == nil {
-		t.Fatal("Expected error, got nil")
+func TestKVStoreReportIsStreamed(t *testing.T) {
+	report := strings.Repeat("kvstore", 100000)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/apiv2/kvstore/report" || req.Header.Get("Accept") != "application/octet-stream" {
+			t.Errorf("unexpected request %v %v", req.URL.Path, req.Header.Get("Accept"))
+		}
+		if _, err := io.WriteString(rw, report); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := testClient(t, Config{Endpoint: server.URL, Token: "token", Timeout: 10 * time.Second})
+	var out bytes.Buffer
+	if err := client.KVStoreReport(&out); err != nil {
+		t.Fatalf("unexpected error %v", err)
 	}
-	if !strings.Contains(err.Error(), "400") {
-		t.Fatalf("Expected '400' in error message, got %v", err)
+	if out.String() != report {
+		t.Errorf("the report was not copied, %v bytes", out.Len())
 	}
 }
 
@@ -84,10 +294,10 @@ func TestClientTimeout(t *testing.T) {
 	}))
 	defer server.Close()
 
-	// Init the client with a timeout of 1 second
-	InitClient(true, 1)
+	// Init the client with a timeout of 1 second, timeouts are not retried
+	client, waits := testClient(t, Config{Endpoint: server.URL, Token: "token", Timeout: time.Second, Retries: 3})
 
-	_, err := APIRequest(server.URL, "token", "GET", map[string]string{})
+	err := client.ValidateCredentials()
 	if err == nil {
 		t.Fatal("Expected error due to client timeout, got nil")
 	}
@@ -96,4 +306,175 @@ func TestClientTimeout(t *testing.T) {
 	if !strings.Contains(err.Error(), "Client.Timeout exceeded while awaiting headers") {
 		t.Fatalf("Expected timeout error, got %v", err)
 	}
+	if len(*waits) != 0 {
+		t.Errorf("a timeout should not be retried but was retried %v times", len(*waits))
+	}
+}
+
+func TestConnectionErrorsAreRetried(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	endpoint := server.URL
+	server.Close()
+
+	client, waits := testClient(t, Config{Endpoint: endpoint, Token: "token", Timeout: time.Second, Retries: 2})
+	if err := client.ValidateCredentials(); err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+	if len(*waits) != 2 {
+		t.Errorf("expected 2 retries but was %v", len(*waits))
+	}
+}
+
+func TestSubmitSQLIsOnlyRetriedWhenItDidNotConnect(t *testing.T) {
+	// a closed server never got the sql
+	closed := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {}))
+	endpoint := closed.URL
+	closed.Close()
+	client, waits := testClient(t, Config{Endpoint: endpoint, Token: "token", Timeout: time.Second, Retries: 2})
+	if _, err := client.SubmitSQL("SELECT 1"); err == nil {
+		t.Fatal("expected an error from a closed server")
+	}
+	if len(*waits) != 2 {
+		t.Errorf("expected 2 retries but was %v", len(*waits))
+	}
+
+	// a connection dropped after the request was sent may have run the sql already
+	var mu sync.Mutex
+	calls := map[string]int{}
+	count := func(method string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return calls[method]
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		calls[req.Method]++
+		mu.Unlock()
+		conn, _, err := rw.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("unable to hijack the connection %v", err)
+			return
+		}
+		if err := conn.Close(); err != nil {
+			t.Errorf("unable to close the connection %v", err)
+		}
+	}))
+	defer server.Close()
+	client, waits = testClient(t, Config{Endpoint: server.URL, Token: "token", Timeout: time.Second, Retries: 2})
+	if _, err := client.SubmitSQL("SELECT 1"); err == nil {
+		t.Fatal("expected an error from a dropped connection")
+	}
+	if count(http.MethodPost) != 1 || len(*waits) != 0 {
+		t.Errorf("expected the sql to be sent once but was sent %v times", count(http.MethodPost))
+	}
+	// reading the status of a job can be repeated
+	if _, err := client.JobStatus("job1"); err == nil {
+		t.Fatal("expected an error from a dropped connection")
+	}
+	if count(http.MethodGet) != 3 {
+		t.Errorf("expected the job status to be requested 3 times but was %v", count(http.MethodGet))
+	}
+
+	// a proxy may return bad gateway after the coordinator got the sql
+	mu.Lock()
+	calls = map[string]int{}
+	mu.Unlock()
+	proxy := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		calls[req.Method]++
+		mu.Unlock()
+		rw.WriteHeader(http.StatusBadGateway)
+	}))
+	defer proxy.Close()
+	client, _ = testClient(t, Config{Endpoint: proxy.URL, Token: "token", Timeout: time.Second, Retries: 2})
+	if _, err := client.SubmitSQL("SELECT 1"); err == nil {
+		t.Fatal("expected a bad gateway error")
+	}
+	if count(http.MethodPost) != 1 {
+		t.Errorf("expected the sql to be sent once but was sent %v times", count(http.MethodPost))
+	}
+}
+
+func TestLoginWithPassword(t *testing.T) {
+	logins := 0
+	var authorizations []string
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.Method == "POST" && req.URL.Path == "/apiv2/login" {
+			if req.Header.Get("Authorization") != "" {
+				t.Errorf("the login should not send an authorization")
+			}
+			var body map[string]string
+			if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+				t.Errorf("the login is not json: %v", err)
+			}
+			if body["userName"] != "admin" || body["password"] != `pa"ss` {
+				rw.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(rw, `{"errorMessage":"Invalid username or password"}`)
+				return
+			}
+			logins++
+			fmt.Fprintf(rw, `{"token":"session%v","expires":%v}`, logins, time.Now().Add(time.Hour).UnixMilli())
+			return
+		}
+		authorizations = append(authorizations, req.Header.Get("Authorization"))
+		// the first session expires on the server after the first job status
+		if req.Header.Get("Authorization") == "_dremiosession1" && len(authorizations) > 2 {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(rw, `{"jobState":"RUNNING"}`)
+	}))
+	defer server.Close()
+
+	client, _ := testClient(t, Config{Endpoint: server.URL, Username: "admin", Password: `pa"ss`, Timeout: 10 * time.Second})
+	if err := client.ValidateCredentials(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := client.JobStatus("job1"); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	expected := []string{"_dremiosession1", "_dremiosession1", "_dremiosession1", "_dremiosession2"}
+	if strings.Join(authorizations, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected authorizations %v but was %v", expected, authorizations)
+	}
+	if logins != 2 {
+		t.Errorf("expected 2 logins but was %v", logins)
+	}
+
+	wrong, _ := testClient(t, Config{Endpoint: server.URL, Username: "admin", Password: "nope", Timeout: 10 * time.Second})
+	err := wrong.ValidateCredentials()
+	if err == nil || !strings.Contains(err.Error(), "Invalid username or password") || strings.Contains(err.Error(), "nope") {
+		t.Errorf("expected the failed login without the password but was %v", err)
+	}
+}
+
+func TestLoginRefreshesASessionAboutToExpire(t *testing.T) {
+	logins := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/apiv2/login" && req.Method == "POST" {
+			logins++
+			// the session expires within the refresh margin
+			fmt.Fprintf(rw, `{"token":"session%v","expires":%v}`, logins, time.Now().Add(time.Minute).UnixMilli())
+			return
+		}
+		fmt.Fprint(rw, `{}`)
+	}))
+	defer server.Close()
+
+	client, _ := testClient(t, Config{Endpoint: server.URL, Username: "admin", Password: "secret", Timeout: 10 * time.Second})
+	if _, err := client.WLM(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if logins != 3 {
+		t.Errorf("expected a login before each of the 3 wlm requests but was %v", logins)
+	}
+}
+
+func TestLoginIsNotSupportedOnDremioCloud(t *testing.T) {
+	client, _ := testClient(t, Config{Endpoint: "https://api.dremio.cloud", IsCloud: true, ProjectID: "p1", Username: "admin", Password: "secret"})
+	if err := client.ValidateCredentials(); err == nil || !strings.Contains(err.Error(), "personal access token") {
+		t.Errorf("expected an error asking for a pat but was %v", err)
+	}
 }
@@ -0,0 +1,126 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// restclient is the client of the Dremio REST api used by the collectors
+package restclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the TLS modes recorded in summary.json
+const (
+	// TLSModePlaintext is an http endpoint
+	TLSModePlaintext = "plaintext"
+	// TLSModeInsecure skips the verification of the certificate of the endpoint
+	TLSModeInsecure = "insecure"
+	// TLSModeVerified checks the certificate of the endpoint against the CAs of the system
+	TLSModeVerified = "verified"
+	// TLSModeVerifiedCustomCA checks the certificate of the endpoint against the CAs of the CAFile
+	TLSModeVerifiedCustomCA = "verified-custom-ca"
+)
+
+// TLSMode is how the certificate of the endpoint is checked, with a client certificate "+mtls" is added
+func (c Config) TLSMode() string {
+	if strings.HasPrefix(strings.ToLower(c.Endpoint), "http://") {
+		return TLSModePlaintext
+	}
+	mode := TLSModeVerified
+	if c.AllowInsecureSSL {
+		mode = TLSModeInsecure
+	} else if c.CAFile != "" {
+		mode = TLSModeVerifiedCustomCA
+	}
+	if c.ClientCertFile != "" {
+		mode += "+mtls"
+	}
+	return mode
+}
+
+// tlsConfig adds the CAs of the CAFile to the ones of the system and loads the client certificate
+func tlsConfig(conf Config) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: conf.AllowInsecureSSL, // #nosec G402 only when allow-insecure-ssl is set
+	}
+	if conf.CAFile != "" {
+		pem, err := os.ReadFile(filepath.Clean(conf.CAFile))
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the ca file %v due to error %v", conf.CAFile, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("the ca file %v has no pem encoded certificates", conf.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if conf.ClientCertFile != "" || conf.ClientKeyFile != "" {
+		if conf.ClientCertFile == "" || conf.ClientKeyFile == "" {
+			return nil, errors.New("a client certificate needs both the certificate and the key file")
+		}
+		cert, err := tls.LoadX509KeyPair(conf.ClientCertFile, conf.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the client certificate %v due to error %v", conf.ClientCertFile, err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// proxy is the proxy of the transport, without a ProxyURL requests go to the endpoint directly
+func proxy(conf Config) (func(*http.Request) (*url.URL, error), error) {
+	if conf.ProxyURL == "" {
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(conf.ProxyURL)
+	if err != nil {
+		// the parse error repeats the url and with it the password of the proxy
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, fmt.Errorf("invalid proxy url: %v", err)
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("invalid proxy url %v, the scheme must be http, https or socks5", proxyURL.Redacted())
+	}
+	if proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy url %v, it has no host", proxyURL.Redacted())
+	}
+	noProxy := map[string]bool{}
+	for _, host := range strings.Split(conf.NoProxy, ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			noProxy[host] = true
+		}
+	}
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxy[strings.ToLower(req.URL.Hostname())] {
+			return nil, nil
+		}
+		return proxyURL, nil
+	}, nil
+}
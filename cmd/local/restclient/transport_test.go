@@ -0,0 +1,197 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package restclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeServerCA writes the certificate of a tls test server to a pem file
+func writeServerCA(t *testing.T, server *httptest.Server) string {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return caFile
+}
+
+// writeClientCert writes a self signed client certificate and its key to pem files
+func writeClientCert(t *testing.T) (*x509.Certificate, string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "ddc"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return cert, certFile, keyFile
+}
+
+func TestCAFileIsTrusted(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	untrusted, waits := testClient(t, Config{Endpoint: server.URL, Token: "pat", Retries: 3})
+	if err := untrusted.ValidateCredentials(); err == nil {
+		t.Error("expected the certificate of the test server to be rejected without the ca file")
+	}
+	if len(*waits) != 0 {
+		t.Errorf("expected a rejected certificate not to be retried but it was retried %v times", len(*waits))
+	}
+
+	client, _ := testClient(t, Config{Endpoint: server.URL, Token: "pat", CAFile: writeServerCA(t, server)})
+	if err := client.ValidateCredentials(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestCAFileWithoutCertificates(t *testing.T) {
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := NewClient(Config{Endpoint: "https://localhost:9047", CAFile: caFile}); err == nil {
+		t.Error("expected an error for a ca file without certificates")
+	}
+}
+
+func TestClientCertificateIsSent(t *testing.T) {
+	cert, certFile, keyFile := writeClientCert(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MinVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	caFile := writeServerCA(t, server)
+
+	withoutCert, _ := testClient(t, Config{Endpoint: server.URL, Token: "pat", CAFile: caFile})
+	if err := withoutCert.ValidateCredentials(); err == nil {
+		t.Error("expected the server to reject a client without a certificate")
+	}
+
+	client, _ := testClient(t, Config{Endpoint: server.URL, Token: "pat", CAFile: caFile, ClientCertFile: certFile, ClientKeyFile: keyFile})
+	if err := client.ValidateCredentials(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestClientCertificateNeedsAKey(t *testing.T) {
+	_, certFile, _ := writeClientCert(t)
+	if _, err := NewClient(Config{Endpoint: "https://localhost:9047", ClientCertFile: certFile}); err == nil {
+		t.Error("expected an error for a client certificate without a key")
+	}
+}
+
+func TestRequestsGoThroughTheProxy(t *testing.T) {
+	var proxied []string
+	proxyServer := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		// a proxy gets the absolute url of the endpoint
+		proxied = append(proxied, req.URL.String())
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer proxyServer.Close()
+
+	client, _ := testClient(t, Config{Endpoint: "http://dremio-coordinator:9047", Token: "pat", ProxyURL: proxyServer.URL})
+	if err := client.ValidateCredentials(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(proxied) != 1 || proxied[0] != "http://dremio-coordinator:9047/apiv2/login" {
+		t.Errorf("expected the request to go through the proxy but the proxy saw %v", proxied)
+	}
+}
+
+func TestNoProxyHostsAreCalledDirectly(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, _ *http.Request) {
+		_, _ = rw.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	// nothing listens on the proxy so only a direct request succeeds
+	client, _ := testClient(t, Config{Endpoint: server.URL, Token: "pat", ProxyURL: "http://127.0.0.1:1", NoProxy: "localhost, 127.0.0.1"})
+	if err := client.ValidateCredentials(); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestInvalidProxyURL(t *testing.T) {
+	for _, proxyURL := range []string{"ftp://proxy:21", "http://", "://proxy"} {
+		if _, err := NewClient(Config{Endpoint: "https://localhost:9047", ProxyURL: proxyURL}); err == nil {
+			t.Errorf("expected an error for the proxy url %q", proxyURL)
+		}
+	}
+}
+
+func TestTLSMode(t *testing.T) {
+	tests := []struct {
+		conf     Config
+		expected string
+	}{
+		{Config{Endpoint: "http://localhost:9047"}, TLSModePlaintext},
+		{Config{Endpoint: "https://localhost:9047"}, TLSModeVerified},
+		{Config{Endpoint: "https://localhost:9047", AllowInsecureSSL: true}, TLSModeInsecure},
+		{Config{Endpoint: "https://localhost:9047", CAFile: "ca.pem"}, TLSModeVerifiedCustomCA},
+		{Config{Endpoint: "https://localhost:9047", CAFile: "ca.pem", ClientCertFile: "client.pem"}, TLSModeVerifiedCustomCA + "+mtls"},
+	}
+	for _, tt := range tests {
+		if actual := tt.conf.TLSMode(); actual != tt.expected {
+			t.Errorf("expected %v for %+v but was %v", tt.expected, tt.conf, actual)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// remoteapi collects the rest api of a cluster from wherever ddc runs, without exec rights on any node
+package remoteapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	local "github.com/dremio/dremio-diagnostic-collector/cmd/local"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/collection"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
+	"github.com/spf13/cobra"
+)
+
+// Args are the settings of ddc api-collect
+type Args struct {
+	Endpoint       string
+	DDCYamlLoc     string
+	OutputLoc      string
+	CollectionMode string
+	Since          string
+	Until          string
+	DremioPAT      string
+	DremioUsername string
+	DremioPassword string
+	// CloudProjectIDs are the comma separated Dremio Cloud projects to collect or all
+	CloudProjectIDs string
+}
+
+var args Args
+var passwordStdIn, promptPassword bool
+
+var APICollectCmd = &cobra.Command{
+	Use:   "api-collect",
+	Short: "collects WLM, the KV store report, system tables and job profiles from the REST api of a remote Dremio endpoint",
+	Long: `Collects WLM, the KV store report, system tables and job profiles from the REST api of a remote Dremio endpoint, without exec rights on any node.
+Job profiles are picked from sys.jobs_recent and the tarball has the same layout as the one of ddc`,
+	Run: func(cmd *cobra.Command, _ []string) {
+		simplelog.LogStartMessage()
+		defer simplelog.LogEndMessage()
+		if err := readCredentials(cmd.InOrStdin()); err != nil {
+			fmt.Printf("\nCRITICAL ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		if err := Execute(args); err != nil {
+			fmt.Printf("\nCRITICAL ERROR: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("api collection written to %v\n", args.OutputLoc)
+	},
+}
+
+// readCredentials takes the password or PAT from standard in or a prompt, without either on the command
+// line the PAT, password and password file of ddc.yaml are used
+func readCredentials(stdin io.Reader) error {
+	if passwordStdIn {
+		password, err := conf.ReadStdIn(stdin, conf.KeyDremioPassword)
+		if err != nil {
+			return err
+		}
+		args.DremioPassword = password
+		return nil
+	}
+	if promptPassword {
+		password, err := masking.PromptForPassword(args.DremioUsername)
+		if err != nil {
+			return fmt.Errorf("unable to get password due to: %v", err)
+		}
+		args.DremioPassword = password
+		return nil
+	}
+	if args.DremioPAT != "" {
+		return nil
+	}
+	piped, err := conf.StdInPiped()
+	if err != nil {
+		return err
+	}
+	if piped {
+		simplelog.Info("accepting PAT from standard in")
+		pat, err := conf.ReadStdIn(stdin, conf.KeyDremioPatToken)
+		if err != nil {
+			return err
+		}
+		args.DremioPAT = pat
+	}
+	return nil
+}
+
+// nodeName is the name the collection of the endpoint is filed under in the tarball
+func nodeName(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint %v: %w", endpoint, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid endpoint %v, expected a url such as https://dremio.example.com", endpoint)
+	}
+	return u.Hostname(), nil
+}
+
+// Execute runs the rest api collections of local-collect against the endpoint and archives them like ddc does
+func Execute(a Args) error {
+	start := time.Now().UTC()
+	node, err := nodeName(a.Endpoint)
+	if err != nil {
+		return err
+	}
+	outputLoc, err := filepath.Abs(a.OutputLoc)
+	if err != nil {
+		return err
+	}
+	outputDir := filepath.Dir(outputLoc)
+	tarballOutDir, err := os.MkdirTemp(outputDir, "ddc-api-collect-")
+	if err != nil {
+		return fmt.Errorf("unable to create a tmp dir in %v due to error %w", outputDir, err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tarballOutDir); err != nil {
+			simplelog.Warningf("unable to remove %v due to error %v. It will need to be removed manually", tarballOutDir, err)
+		}
+	}()
+
+	overrides := map[string]string{
+		conf.KeyDremioEndpoint: a.Endpoint,
+		conf.KeyNodeName:       node,
+		conf.KeyTarballOutDir:  tarballOutDir,
+	}
+	if a.Since != "" {
+		overrides[conf.KeySince] = a.Since
+	}
+	if a.Until != "" {
+		overrides[conf.KeyUntil] = a.Until
+	}
+	if a.DremioPAT != "" {
+		overrides[conf.KeyDremioPatToken] = a.DremioPAT
+	}
+	if a.DremioUsername != "" {
+		overrides[conf.KeyDremioUsername] = a.DremioUsername
+	}
+	if a.DremioPassword != "" {
+		overrides[conf.KeyDremioPassword] = a.DremioPassword
+	}
+	if a.CloudProjectIDs != "" {
+		overrides[conf.KeyDremioCloudProjectIDs] = a.CloudProjectIDs
+	}
+	c, tarball, err := local.ExecuteAPIOnly(a.DDCYamlLoc, a.CollectionMode, overrides)
+	if err != nil {
+		return err
+	}
+
+	var collectionInfo collection.SummaryInfo
+	collectionInfo.StartTimeUTC = start
+	collectionInfo.ClusterInfo.TotalNodesAttempted = 1
+	collectionInfo.ClusterInfo.NumberNodesContacted = 1
+	collectionInfo.Coordinators = []string{node}
+	collectionInfo.DDCVersion = versions.GetCLIVersion()
+	collectionInfo.CollectionsEnabled, collectionInfo.CollectionsDisabled = collections(c)
+	collectionInfo.TLSMode = c.TLSMode()
+	if fi, err := os.Stat(tarball); err == nil {
+		collectionInfo.CollectedFiles = []helpers.CollectedFile{{Path: tarball, Size: fi.Size()}}
+		collectionInfo.TotalBytesCollected = fi.Size()
+	}
+
+	// the cluster-stats.json of the tarball has the version read from sys.version and cloud-projects.json
+	// how each Dremio Cloud project went
+	var clusterStats, cloudProjects bytes.Buffer
+	tee := func(name string) io.Writer {
+		switch path.Base(name) {
+		case "cluster-stats.json":
+			return &clusterStats
+		case clusterstats.CloudProjectsFile:
+			return &cloudProjects
+		}
+		return nil
+	}
+	summary := func() (string, error) {
+		end := time.Now().UTC()
+		collectionInfo.EndTimeUTC = end
+		collectionInfo.TotalRuntimeSeconds = end.Unix() - start.Unix()
+		if clusterStats.Len() > 0 {
+			stats, err := collection.FindClusterID(&clusterStats)
+			if err != nil {
+				simplelog.Errorf("unable to read the cluster stats of %v: %v", tarball, err)
+			} else {
+				collectionInfo.DremioVersion = map[string]string{node: stats[0].DremioVersion}
+				collectionInfo.ClusterID = map[string]string{node: stats[0].ClusterID}
+			}
+		}
+		if cloudProjects.Len() > 0 {
+			if err := json.Unmarshal(cloudProjects.Bytes(), &collectionInfo.CloudProjects); err != nil {
+				simplelog.Errorf("unable to read the Dremio Cloud projects of %v: %v", tarball, err)
+			}
+		}
+		return collectionInfo.String()
+	}
+	cs := helpers.NewHCCopyStrategy(helpers.NewRealFileSystem(), &helpers.RealTimeService{}, outputDir)
+	defer cs.Close()
+	return cs.ArchiveDiag(outputLoc, []string{tarball}, tee, summary)
+}
+
+// collections lists the rest api collections that were enabled and disabled for summary.json
+func collections(c *conf.CollectConf) (enabled, disabled []string) {
+	add := func(name string, on bool) {
+		if on {
+			enabled = append(enabled, name)
+		} else {
+			disabled = append(disabled, name)
+		}
+	}
+	add("wlm", c.CollectWLM())
+	add("system-tables-export", c.CollectSystemTablesExport())
+	add("kvstore-report", !c.IsDremioCloud() && c.CollectKVStoreReport())
+	add("job-profiles", c.CollectJobProfiles())
+	add("catalog", c.CollectCatalog())
+	return enabled, disabled
+}
+
+func init() {
+	APICollectCmd.Flags().StringVar(&args.Endpoint, "endpoint", "", "url of the Dremio coordinator or load balancer, e.g. https://dremio.example.com")
+	if err := APICollectCmd.MarkFlagRequired("endpoint"); err != nil {
+		fmt.Printf("unable to mark flag required critical error %v", err)
+		os.Exit(1)
+	}
+	execLoc, err := os.Executable()
+	if err != nil {
+		fmt.Printf("unable to find ddc, critical error %v", err)
+		os.Exit(1)
+	}
+	APICollectCmd.Flags().StringVar(&args.DDCYamlLoc, "ddc-yaml", filepath.Join(filepath.Dir(execLoc), "ddc.yaml"), "location of ddc.yaml with the system tables, job profile and tls settings")
+	APICollectCmd.Flags().StringVar(&args.OutputLoc, "output-file", "diag.tgz", "name and location of diagnostic tarball")
+	APICollectCmd.Flags().StringVar(&args.CollectionMode, "collect", "light", "type of collection: 'light' and 'standard' - 20 job profiles. 'health-check' - 25,000 job profiles")
+	APICollectCmd.Flags().StringVar(&args.Since, conf.KeySince, "", "only collect the job history and job profiles from this time onwards (e.g. 2024-03-01T08:00:00Z)")
+	APICollectCmd.Flags().StringVar(&args.Until, conf.KeyUntil, "", "only collect the job history and job profiles up to this time, same format as --since")
+	APICollectCmd.Flags().StringVar(&args.DremioPAT, conf.KeyDremioPatToken, "", "Dremio Personal Access Token (PAT), it can also be piped to standard in")
+	if err := APICollectCmd.Flags().MarkHidden(conf.KeyDremioPatToken); err != nil {
+		fmt.Printf("unable to mark flag hidden critical error %v", err)
+		os.Exit(1)
+	}
+	APICollectCmd.Flags().StringVar(&args.DremioUsername, conf.KeyDremioUsername, "", "Dremio user that logs in with a password when no PAT is set, overrides ddc.yaml")
+	APICollectCmd.Flags().BoolVar(&passwordStdIn, "password-stdin", false, "read the password of the dremio-username from standard in instead of a PAT")
+	APICollectCmd.Flags().BoolVar(&promptPassword, "prompt-password", false, "prompt for the password of the dremio-username instead of a PAT")
+	APICollectCmd.Flags().StringVar(&args.CloudProjectIDs, conf.KeyDremioCloudProjectIDs, "", "DREMIO CLOUD ONLY: comma separated ids of the projects to collect or 'all' for every project the PAT can see, overrides ddc.yaml")
+}
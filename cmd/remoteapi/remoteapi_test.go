@@ -0,0 +1,196 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remoteapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/cmd/root/collection"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+)
+
+// dremioServer answers the rest calls of the collections, sys.jobs_recent returns the rows of the
+// queriesjson fixture and sys.version a single version
+func dremioServer(t *testing.T) (*httptest.Server, *[]string) {
+	f, err := os.Open(filepath.Join("..", "local", "queriesjson", "testdata", "sys.jobs_recent.ndjson"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer f.Close()
+	var jobsRecent []json.RawMessage
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// the fixture also has broken lines for the reader tests
+		if json.Valid(scanner.Bytes()) {
+			jobsRecent = append(jobsRecent, json.RawMessage(scanner.Text()))
+		}
+	}
+
+	var mu sync.Mutex
+	var downloaded []string
+	sqlByJob := map[string]string{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer my-pat" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var response any
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/v3/sql":
+			var request struct {
+				SQL string `json:"sql"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				t.Errorf("unexpected error %v", err)
+			}
+			id := "job" + string(rune('a'+len(sqlByJob)))
+			sqlByJob[id] = request.SQL
+			response = map[string]string{"id": id}
+		case strings.HasSuffix(r.URL.Path, "/results"):
+			sql := sqlByJob[strings.Split(r.URL.Path, "/")[4]]
+			rows := []json.RawMessage{}
+			if strings.Contains(sql, "sys.jobs_recent") && r.URL.Query().Get("offset") == "0" {
+				rows = jobsRecent
+			}
+			if strings.Contains(sql, "sys.version") && r.URL.Query().Get("offset") == "0" {
+				rows = []json.RawMessage{json.RawMessage(`{"version":"25.0.0-202404051521110861-ed9515a8"}`)}
+			}
+			response = map[string]any{
+				"rowCount": len(rows),
+				"schema":   []map[string]any{{"name": "version", "type": map[string]string{"name": "VARCHAR"}}},
+				"rows":     rows,
+			}
+		case strings.HasPrefix(r.URL.Path, "/api/v3/job/"):
+			response = map[string]string{"jobState": "COMPLETED"}
+		case r.URL.Path == "/api/v3/wlm/queue" || r.URL.Path == "/api/v3/wlm/rule":
+			response = map[string]any{"data": []any{}}
+		case r.URL.Path == "/apiv2/kvstore/report":
+			_, _ = w.Write([]byte("kvstore report"))
+			return
+		case strings.HasPrefix(r.URL.Path, "/apiv2/support/"):
+			downloaded = append(downloaded, strings.Split(r.URL.Path, "/")[3])
+			_, _ = w.Write([]byte("profile"))
+			return
+		case r.URL.Path == "/apiv2/login":
+			response = map[string]string{}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	})), &downloaded
+}
+
+func TestExecuteCollectsTheRESTAPIIntoTheStandardLayout(t *testing.T) {
+	server, downloaded := dremioServer(t)
+	defer server.Close()
+
+	ddcYaml := filepath.Join(t.TempDir(), "ddc.yaml")
+	if err := os.WriteFile(ddcYaml, []byte(`
+system-tables-remove: [threads]
+collect-wlm: false
+disable-free-space-check: true
+`), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	outputFile := filepath.Join(t.TempDir(), "diag.tgz")
+	err := Execute(Args{
+		Endpoint:       server.URL,
+		DDCYamlLoc:     ddcYaml,
+		OutputLoc:      outputFile,
+		CollectionMode: "light",
+		DremioPAT:      "my-pat",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	extracted := t.TempDir()
+	if err := archive.ExtractTarGz(outputFile, extracted); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	entries, err := os.ReadDir(extracted)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var bundleDir string
+	for _, e := range entries {
+		if e.IsDir() && strings.HasSuffix(e.Name(), "-DDC") {
+			bundleDir = filepath.Join(extracted, e.Name())
+		}
+	}
+	if bundleDir == "" {
+		t.Fatalf("expected a <time>-DDC directory in the tarball but there was %v", entries)
+	}
+	for _, expected := range []string{
+		filepath.Join("system-tables", "127.0.0.1", "sys.jobs_recent.ndjson"),
+		filepath.Join("system-tables", "127.0.0.1", "sys.version.ndjson"),
+		filepath.Join("kvstore", "127.0.0.1", "kvstore-report.zip"),
+		filepath.Join("cluster-stats", "127.0.0.1", "cluster-stats.json"),
+	} {
+		if _, err := os.Stat(filepath.Join(bundleDir, expected)); err != nil {
+			t.Errorf("expected %v in the tarball: %v", expected, err)
+		}
+	}
+	for _, nodeOnly := range []string{"logs", "node-info", "configuration", "jfr"} {
+		if _, err := os.Stat(filepath.Join(bundleDir, nodeOnly, "127.0.0.1")); err == nil {
+			t.Errorf("expected no %v of a node in an api collection", nodeOnly)
+		}
+	}
+	if len(*downloaded) == 0 {
+		t.Error("expected job profiles picked from sys.jobs_recent to be downloaded")
+	}
+
+	b, err := os.ReadFile(filepath.Join(extracted, "summary.json"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var summary collection.SummaryInfo
+	if err := json.Unmarshal(b, &summary); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if summary.DremioVersion["127.0.0.1"] != "25.0.0-202404051521110861-ed9515a8" {
+		t.Errorf("expected the version of sys.version in summary.json but was %v", summary.DremioVersion)
+	}
+	if summary.TLSMode != "plaintext" {
+		t.Errorf("expected the plaintext tls mode but was %v", summary.TLSMode)
+	}
+	if strings.Join(summary.CollectionsDisabled, ",") != "wlm" {
+		t.Errorf("expected only wlm to be disabled but was %v", summary.CollectionsDisabled)
+	}
+}
+
+func TestNodeNameNeedsAURL(t *testing.T) {
+	if name, err := nodeName("https://dremio.example.com:9047/"); err != nil || name != "dremio.example.com" {
+		t.Errorf("expected dremio.example.com but was %v %v", name, err)
+	}
+	for _, endpoint := range []string{"dremio.example.com", "ftp://dremio.example.com", ""} {
+		if _, err := nodeName(endpoint); err == nil {
+			t.Errorf("expected an error for %q", endpoint)
+		}
+	}
+}
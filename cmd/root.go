@@ -18,15 +18,17 @@ package cmd
 import (
 	"errors"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/dremio/dremio-diagnostic-collector/cmd/analyze"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/awselogs"
 	local "github.com/dremio/dremio-diagnostic-collector/cmd/local"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/local/restclient"
+	"github.com/dremio/dremio-diagnostic-collector/cmd/remoteapi"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/collection"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/fallback"
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
@@ -37,7 +39,11 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/dirs"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pgzip"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pseudonym"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/redaction"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/timewindow"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/validation"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
 	"github.com/manifoldco/promptui"
@@ -64,8 +70,14 @@ var disablePrompt bool
 var detectNamespace bool
 var collectionMode string
 var cliAuthToken string
+var passwordStdIn bool
+var promptPassword bool
 var pid string
 var transferThreads int
+var compressionThreads int
+var since string
+var until string
+var pseudonymize bool
 
 // var isEmbeddedK8s bool
 // var isEmbeddedSSH bool
@@ -125,7 +137,7 @@ func startTicker() (stop func()) {
 }
 
 func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs kubernetes.KubeArgs, fallbackEnabled bool) error {
-	patSet := collectionArgs.DremioPAT != ""
+	patSet := collectionArgs.DremioPAT != "" || collectionArgs.DremioPassword != ""
 	consoleprint.UpdateRuntime(
 		versions.GetCLIVersion(),
 		simplelog.GetLogLoc(),
@@ -145,6 +157,10 @@ func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs ku
 		return fmt.Errorf("error when getting directory for copy strategy: %v", err)
 	}
 	cs := helpers.NewHCCopyStrategy(collectionArgs.DDCfs, &helpers.RealTimeService{}, outputDir)
+	if collectionArgs.Pseudonyms != nil {
+		cs.Rewriter = collectionArgs.Pseudonyms
+	}
+	cs.Redactor = collectionArgs.Redactor
 
 	defer cs.Close()
 	var clusterCollect = func([]string) {}
@@ -164,6 +180,10 @@ func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs ku
 			0,
 		)
 	} else if kubeArgs.Namespace != "" {
+		window, err := timewindow.Parse(collectionArgs.Since, collectionArgs.Until)
+		if err != nil {
+			return err
+		}
 		simplelog.Info("using Kubernetes api based collection")
 		consoleprint.UpdateCollectionArgs(fmt.Sprintf("namespace: '%v', label selector: '%v'", kubeArgs.Namespace, kubeArgs.LabelSelector))
 		collectorStrategy, err = kubernetes.NewKubectlK8sActions(kubeArgs)
@@ -183,11 +203,11 @@ func RemoteCollect(collectionArgs collection.Args, sshArgs ssh.Args, kubeArgs ku
 		)
 
 		clusterCollect = func(pods []string) {
-			err = collection.ClusterK8sExecute(kubeArgs.Namespace, cs, collectionArgs.DDCfs)
+			err = collection.ClusterK8sExecute(kubeArgs.Namespace, cs, collectionArgs.DDCfs, collectionArgs.Pseudonyms)
 			if err != nil {
 				simplelog.Errorf("when getting Kubernetes info, the following error was returned: %v", err)
 			}
-			err = collection.GetClusterLogs(kubeArgs.Namespace, cs, collectionArgs.DDCfs, pods)
+			err = collection.GetClusterLogs(kubeArgs.Namespace, cs, collectionArgs.DDCfs, pods, window)
 			if err != nil {
 				simplelog.Errorf("when getting container logs, the following error was returned: %v", err)
 			}
@@ -229,7 +249,7 @@ func ValidateAndReadYaml(ddcYaml, collectionMode string) (map[string]interface{}
 	conf.SetViperDefaults(confData, "", 0, collectionMode)
 	simplelog.Infof("parsed configuration for %v follows", ddcYaml)
 	for k, v := range confData {
-		if k == conf.KeyDremioPatToken && v != "" {
+		if conf.IsSecretKey(k) && v != "" {
 			simplelog.Infof("yaml key '%v':'REDACTED'", k)
 		} else {
 			simplelog.Infof("yaml key '%v':'%v'", k, v)
@@ -390,33 +410,70 @@ func Execute(args []string) error {
 		}
 
 		dremioPAT := confData[conf.KeyDremioPatToken].(string)
-		if cliAuthToken == "" {
-			fi, err := os.Stdin.Stat()
+		dremioUsername := conf.GetString(confData, conf.KeyDremioUsername)
+		dremioPassword := conf.GetString(confData, conf.KeyDremioPassword)
+		if passwordStdIn {
+			simplelog.Info("accepting password from standard in")
+			if dremioPassword, err = conf.ReadStdIn(RootCmd.InOrStdin(), conf.KeyDremioPassword); err != nil {
+				return err
+			}
+		} else if cliAuthToken == "" {
+			piped, err := conf.StdInPiped()
 			if err != nil {
 				return err
 			}
-			if fi.Size() > 0 {
+			if piped {
 				simplelog.Info("accepting PAT from standard in")
-				var inputReader io.Reader = RootCmd.InOrStdin()
-				b, err := io.ReadAll(inputReader)
-				if err != nil {
+				if dremioPAT, err = conf.ReadStdIn(RootCmd.InOrStdin(), conf.KeyDremioPatToken); err != nil {
 					return err
 				}
-				dremioPAT = strings.TrimSpace(string(b[:]))
 			}
 		}
+		// the password file is on this machine, the nodes get the password piped to local-collect
+		if passwordFile := conf.GetString(confData, conf.KeyDremioPasswordFile); dremioPAT == "" && dremioPassword == "" && passwordFile != "" {
+			password, err := conf.ReadPasswordFile(passwordFile)
+			if err != nil {
+				return err
+			}
+			dremioPassword = password
+		}
 		if err := validation.ValidateCollectMode(collectionMode); err != nil {
 			return err
 		}
+		if _, err := timewindow.Parse(since, until); err != nil {
+			return err
+		}
 
-		if collectionMode == collects.HealthCheckCollection && dremioPAT == "" {
-			pat, err := masking.PromptForPAT()
-			if err != nil {
-				return fmt.Errorf("unable to get PAT due to: %v", err)
+		if dremioPAT == "" && dremioPassword == "" && (promptPassword || collectionMode == collects.HealthCheckCollection) {
+			if promptPassword {
+				if dremioUsername == "" {
+					return fmt.Errorf("--prompt-password needs the %v set in %v", conf.KeyDremioUsername, ddcYamlLoc)
+				}
+				password, err := masking.PromptForPassword(dremioUsername)
+				if err != nil {
+					return fmt.Errorf("unable to get password due to: %v", err)
+				}
+				dremioPassword = password
+			} else {
+				pat, err := masking.PromptForPAT()
+				if err != nil {
+					return fmt.Errorf("unable to get PAT due to: %v", err)
+				}
+				dremioPAT = pat
+			}
+		}
+		if dremioPAT == "" && dremioPassword != "" && dremioUsername == "" {
+			return fmt.Errorf("logging in with a password needs the %v set in %v", conf.KeyDremioUsername, ddcYamlLoc)
+		}
+		// the rest api is used with either a PAT or a password login
+		patSet := dremioPAT != "" || dremioPassword != ""
+		var tlsMode string
+		if patSet {
+			tlsMode = conf.TLSMode(confData)
+			if strings.HasPrefix(tlsMode, restclient.TLSModeInsecure) {
+				simplelog.Warningf("%v is set, the certificate of %v is not verified", conf.KeyAllowInsecureSSL, conf.GetString(confData, conf.KeyDremioEndpoint))
 			}
-			dremioPAT = pat
 		}
-		patSet := dremioPAT != ""
 		var enableFallback bool
 		if detectNamespace {
 			enableFallback := func(err error) {
@@ -469,7 +526,7 @@ func Execute(args []string) error {
 				if value, ok := v.(bool); ok {
 					// check pat so they end up in the right column
 					if !patSet {
-						if k == conf.KeyCollectWLM || k == conf.KeyCollectKVStoreReport || k == conf.KeyCollectSystemTablesExport {
+						if k == conf.KeyCollectWLM || k == conf.KeyCollectKVStoreReport || k == conf.KeyCollectSystemTablesExport || k == conf.KeyCollectCatalog {
 							disabled = append(disabled, newName)
 							continue
 						}
@@ -490,6 +547,7 @@ func Execute(args []string) error {
 			OutputLoc:             filepath.Clean(outputLoc),
 			DDCfs:                 helpers.NewRealFileSystem(),
 			DremioPAT:             dremioPAT,
+			DremioPassword:        dremioPassword,
 			TransferDir:           transferDir,
 			DDCYamlLoc:            ddcYamlLoc,
 			Enabled:               enabled,
@@ -498,6 +556,22 @@ func Execute(args []string) error {
 			MinFreeSpaceGB:        minFreeSpaceGB,
 			CollectionMode:        collectionMode,
 			TransferThreads:       transferThreads,
+			Since:                 since,
+			Until:                 until,
+			TLSMode:               tlsMode,
+		}
+		if pseudonymize {
+			collectionArgs.Pseudonyms = pseudonym.New()
+		}
+		// the cluster level files such as the kubernetes collection are redacted with the same rules as the nodes
+		rules, err := conf.GetRedactionRules(confData)
+		if err != nil {
+			return fmt.Errorf("CRITICAL ERROR: unable to parse %v: %v", ddcYamlLoc, err)
+		}
+		if len(rules) > 0 {
+			if collectionArgs.Redactor, err = redaction.New(rules); err != nil {
+				return fmt.Errorf("CRITICAL ERROR: unable to parse %v: %v", ddcYamlLoc, err)
+			}
 		}
 		sshArgs := ssh.Args{
 			SSHKeyLoc:      sshKeyLoc,
@@ -510,6 +584,7 @@ func Execute(args []string) error {
 			Namespace:     namespace,
 			LabelSelector: labelSelector,
 		}
+		pgzip.SetWorkers(compressionThreads)
 		if err := RemoteCollect(collectionArgs, sshArgs, kubeArgs, enableFallback); err != nil {
 			consoleprint.UpdateResult(err.Error())
 		} else {
@@ -561,6 +636,9 @@ func init() {
 
 	// shared flags
 	RootCmd.Flags().StringVar(&collectionMode, "collect", "light", "type of collection: 'light'- 2 days of logs (no ttop or jfr). 'standard' - includes jfr, ttop, 7 days of logs and 30 days of queries.json logs. 'health-check' - all of 'standard' + WLM, KV Store Report, 25,000 Job Profiles")
+	RootCmd.Flags().StringVar(&since, conf.KeySince, "", "only collect logs, queries and job profiles from this time onwards (e.g. 2024-03-01T08:00:00Z or 2024-03-01), times without an offset are UTC")
+	RootCmd.Flags().StringVar(&until, conf.KeyUntil, "", "only collect logs, queries and job profiles up to this time, same format as --since")
+	RootCmd.Flags().BoolVar(&pseudonymize, "pseudonymize", false, "replace node names, pod names and ip addresses in the tarball with aliases such as executor-1 and ip-001, the mapping is written next to the tarball and is not included in it")
 	RootCmd.Flags().BoolVar(&disableFreeSpaceCheck, conf.KeyDisableFreeSpaceCheck, false, "disables the free space check for the --transfer-dir")
 	RootCmd.Flags().BoolVar(&disablePrompt, "disable-prompt", false, "disables the prompt ui")
 	if err := RootCmd.Flags().MarkHidden("disable-prompt"); err != nil {
@@ -572,6 +650,8 @@ func init() {
 		fmt.Printf("unable to mark flag hidden critical error %v", err)
 		os.Exit(1)
 	}
+	RootCmd.Flags().BoolVar(&passwordStdIn, "password-stdin", false, "read the password of the dremio-username of ddc.yaml from standard in instead of a PAT")
+	RootCmd.Flags().BoolVar(&promptPassword, "prompt-password", false, "prompt for the password of the dremio-username of ddc.yaml instead of a PAT")
 	RootCmd.Flags().BoolVar(&detectNamespace, "detect-namespace", false, "detect namespace feature to pass the namespace automatically")
 	if err := RootCmd.Flags().MarkHidden("detect-namespace"); err != nil {
 		fmt.Printf("unable to mark flag hidden critical error %v", err)
@@ -587,6 +667,7 @@ func init() {
 		fmt.Printf("unable to mark flag hidden critical error %v", err)
 		os.Exit(1)
 	}
+	RootCmd.Flags().IntVar(&compressionThreads, conf.KeyCompressionThreads, 0, "number of threads used to compress the final tarball, 0 uses a quarter of the available cpus")
 	RootCmd.Flags().IntVar(&minFreeSpaceGB, "min-free-space-gb", 40, "min free space needed in GB for the process to run")
 	if err := RootCmd.Flags().MarkHidden("min-free-space-gb"); err != nil {
 		fmt.Printf("unable to mark flag hidden critical error %v", err)
@@ -607,6 +688,8 @@ func init() {
 	RootCmd.AddCommand(local.LocalCollectCmd)
 	RootCmd.AddCommand(version.VersionCmd)
 	RootCmd.AddCommand(awselogs.AWSELogsCmd)
+	RootCmd.AddCommand(analyze.AnalyzeCmd)
+	RootCmd.AddCommand(remoteapi.APICollectCmd)
 }
 
 func validateSSHParameters(sshArgs ssh.Args) error {
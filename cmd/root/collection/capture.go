@@ -127,6 +127,8 @@ func StartCapture(c HostCaptureConfiguration, localDDCPath, localDDCYamlPath str
 	// we cannot use filepath.join here as it will break everything during the transfer
 	pathToDDCYAML := path.Join(c.TransferDir, "ddc.yaml")
 	dremioPAT := c.DremioPAT
+	// what is piped to the standard in of local-collect
+	var secret string
 	versionMatch := false
 	// if out, err := ComposeExecute(conf, []string{pathToDDC, "version"}); err != nil {
 	// 	simplelog.Warningf("host %v unable to find ddc version due to error '%v' with output '%v'", host, err, out)
@@ -241,6 +243,12 @@ func StartCapture(c HostCaptureConfiguration, localDDCPath, localDDCYamlPath str
 	//execute local-collect with a tarball-out-dir flag it must match our transfer-dir flag
 	var mask bool // to mask PAT token in logs
 	localCollectArgs := []string{pathToDDC, "local-collect", fmt.Sprintf("--%v", conf.KeyTarballOutDir), c.TransferDir, fmt.Sprintf("--%v", conf.KeyCollectionMode), c.CollectionMode, fmt.Sprintf("--%v", conf.KeyMinFreeSpaceGB), fmt.Sprintf("%v", minFreeSpaceGB)}
+	if c.Since != "" {
+		localCollectArgs = append(localCollectArgs, fmt.Sprintf("--%v", conf.KeySince), c.Since)
+	}
+	if c.Until != "" {
+		localCollectArgs = append(localCollectArgs, fmt.Sprintf("--%v", conf.KeyUntil), c.Until)
+	}
 	if disableFreeSpaceCheck {
 		localCollectArgs = append(localCollectArgs, fmt.Sprintf("--%v", conf.KeyDisableFreeSpaceCheck))
 	}
@@ -250,6 +258,12 @@ func StartCapture(c HostCaptureConfiguration, localDDCPath, localDDCYamlPath str
 	} else if dremioPAT != "" {
 		//if the dremio PAT is set, set the pat-stdin value so we can pass it in via that mechanism
 		localCollectArgs = append(localCollectArgs, "--pat-stdin")
+		secret = dremioPAT
+		mask = true
+	} else if c.DremioPassword != "" {
+		//without a PAT local-collect logs in with the dremio-username of ddc.yaml and the password piped to it
+		localCollectArgs = append(localCollectArgs, "--password-stdin")
+		secret = c.DremioPassword
 		mask = true
 	} else {
 		mask = false
@@ -289,7 +303,7 @@ func StartCapture(c HostCaptureConfiguration, localDDCPath, localDDCYamlPath str
 			consoleprint.UpdateNodeAutodetectDisabled(host, true)
 		}
 		simplelog.HostLog(host, line)
-	}, dremioPAT, localCollectArgs...)
+	}, secret, localCollectArgs...)
 	if err != nil {
 		consoleprint.UpdateNodeState(consoleprint.NodeState{
 			Node:       c.Host,
@@ -29,14 +29,18 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/kubernetes"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pseudonym"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/timewindow"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var clusterRequestTimeout = 120
 
-func ClusterK8sExecute(namespace string, cs CopyStrategy, ddfs helpers.Filesystem) error {
+// ClusterK8sExecute writes the kubernetes resources of the namespace, the pods and nodes listed also seed
+// pseudonyms when it is not nil
+func ClusterK8sExecute(namespace string, cs CopyStrategy, ddfs helpers.Filesystem, pseudonyms *pseudonym.Mapper) error {
 	cmds := []string{"nodes", "sc", "pvc", "pv", "service", "endpoints", "pods", "deployments", "statefulsets", "daemonset", "replicaset", "cronjob", "job", "events", "ingress", "limitrange", "resourcequota", "hpa", "pdb", "pc"}
 	p, err := cs.CreatePath("kubernetes", "dremio-master", "")
 	if err != nil {
@@ -51,6 +55,9 @@ func ClusterK8sExecute(namespace string, cs CopyStrategy, ddfs helpers.Filesyste
 			simplelog.Errorf("when getting cluster config, error was %v", err)
 			continue
 		}
+		if pseudonyms != nil {
+			addK8sPseudonyms(pseudonyms, resource, out)
+		}
 		text, err := masking.RemoveSecretsFromK8sJSON(out)
 		if err != nil {
 			simplelog.Errorf("unable to mask secrets for %v in namespace %v returning am empty text due to error '%v'", resource, namespace, err)
@@ -69,7 +76,21 @@ func ClusterK8sExecute(namespace string, cs CopyStrategy, ddfs helpers.Filesyste
 	return nil
 }
 
-func GetClusterLogs(namespace string, cs CopyStrategy, ddfs helpers.Filesystem, pods []string) error {
+// addK8sPseudonyms gives the pods and kubernetes nodes in the list out their aliases
+func addK8sPseudonyms(pseudonyms *pseudonym.Mapper, resource string, out []byte) {
+	var err error
+	switch resource {
+	case "pods":
+		err = pseudonyms.AddKubernetesPods(out)
+	case "nodes":
+		err = pseudonyms.AddKubernetesNodes(out)
+	}
+	if err != nil {
+		simplelog.Warningf("unable to read the names of the %v for the pseudonyms: %v", resource, err)
+	}
+}
+
+func GetClusterLogs(namespace string, cs CopyStrategy, ddfs helpers.Filesystem, pods []string, window timewindow.Window) error {
 	path, err := cs.CreatePath("kubernetes", "container-logs", "")
 	if err != nil {
 		simplelog.Errorf("trying to construct cluster container log path %v with error %v", path, err)
@@ -96,14 +117,14 @@ func GetClusterLogs(namespace string, cs CopyStrategy, ddfs helpers.Filesystem,
 		// Loop over each container, construct a path and log file name
 		// write the output of the kubectl logs command to a file
 		for _, container := range containers {
-			copyContainerLog(cs, ddfs, container, namespace, path, podname)
+			copyContainerLog(cs, ddfs, container, namespace, path, podname, window)
 		}
 		consoleprint.UpdateK8sFiles(fmt.Sprintf("pod %v logs", podname))
 	}
 	return err
 }
 
-func copyContainerLog(cs CopyStrategy, ddfs helpers.Filesystem, container, namespace, path, pod string) {
+func copyContainerLog(cs CopyStrategy, ddfs helpers.Filesystem, container, namespace, path, pod string, window timewindow.Window) {
 	client, _, err := kubernetes.GetClientset()
 	if err != nil {
 		simplelog.Errorf("unable to get k8s client for collecting logs on pod: %v container: %v with error: %v", pod, container, err)
@@ -111,9 +132,17 @@ func copyContainerLog(cs CopyStrategy, ddfs helpers.Filesystem, container, names
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(clusterRequestTimeout)*time.Second)
 	defer cancel() // releases resources if slowOperation completes before timeout elapses
-	req := client.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+	logOptions := &corev1.PodLogOptions{
 		Container: container,
-	})
+	}
+	if !window.Since.IsZero() {
+		logOptions.SinceTime = &metav1.Time{Time: window.Since}
+	}
+	if !window.Until.IsZero() {
+		// the api has no upper bound so we ask for timestamps and drop the later lines ourselves
+		logOptions.Timestamps = true
+	}
+	req := client.CoreV1().Pods(namespace).GetLogs(pod, logOptions)
 	r, err := req.Stream(ctx)
 	if err != nil {
 		simplelog.Errorf("trying to get log from pod: %v container: %v with error: %v", pod, container, err)
@@ -128,6 +157,9 @@ func copyContainerLog(cs CopyStrategy, ddfs helpers.Filesystem, container, names
 		return
 	}
 	out := buf.String()
+	if !window.Until.IsZero() {
+		out = trimContainerLogUntil(out, window.Until)
+	}
 	outFile := filepath.Join(path, pod+"-"+container+".txt")
 	simplelog.Debugf("getting logs for pod: %v container: %v", pod, container)
 	p, err := cs.CreatePath("kubernetes", "container-logs", "")
@@ -142,6 +174,32 @@ func copyContainerLog(cs CopyStrategy, ddfs helpers.Filesystem, container, names
 	}
 }
 
+// trimContainerLogUntil drops the lines of a timestamped container log that were written after until
+// and removes the timestamp prefix the api added so the output matches an untimestamped log
+func trimContainerLogUntil(log string, until time.Time) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(log, "\n") {
+		if line == "" {
+			continue
+		}
+		ts, rest, found := strings.Cut(line, " ")
+		if !found {
+			ts, rest = strings.TrimSuffix(line, "\n"), "\n"
+		}
+		t, err := time.Parse(time.RFC3339Nano, ts)
+		if err != nil {
+			// not a timestamped line so keep it as is
+			b.WriteString(line)
+			continue
+		}
+		if t.After(until) {
+			break
+		}
+		b.WriteString(rest)
+	}
+	return b.String()
+}
+
 // Execute commands at the cluster level
 // Calls a raw execute function and simply writes out the byte array read from the response
 // that comes in directly from kubectl
@@ -22,6 +22,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 type ExpectedJSON struct {
@@ -77,3 +78,26 @@ func TestClusterCopyJSON(t *testing.T) {
 	}
 
 }
+
+func TestTrimContainerLogUntil(t *testing.T) {
+	log := "2024-01-02T14:00:00.123456789Z first line\n" +
+		"2024-01-02T14:59:59Z second line\n" +
+		"2024-01-02T15:00:01Z third line\n" +
+		"2024-01-02T15:10:00Z fourth line\n"
+	actual := trimContainerLogUntil(log, time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC))
+	expected := "first line\nsecond line\n"
+	if actual != expected {
+		t.Errorf("expected %q but was %q", expected, actual)
+	}
+}
+
+func TestTrimContainerLogUntilKeepsUntimestampedLines(t *testing.T) {
+	log := "2024-01-02T14:00:00Z first line\n" +
+		"\tat a.stack.Frame\n" +
+		"2024-01-02T14:00:01Z\n"
+	actual := trimContainerLogUntil(log, time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC))
+	expected := "first line\n\tat a.stack.Frame\n\n"
+	if actual != expected {
+		t.Errorf("expected %q but was %q", expected, actual)
+	}
+}
@@ -16,11 +16,14 @@
 package collection
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -32,6 +35,8 @@ import (
 	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/consoleprint"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pseudonym"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/redaction"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/versions"
 )
@@ -40,7 +45,7 @@ var DirPerms fs.FileMode = 0750
 
 type CopyStrategy interface {
 	CreatePath(fileType, source, nodeType string) (path string, err error)
-	ArchiveDiag(o string, outputLoc string) error
+	ArchiveDiag(outputLoc string, tarballs []string, tee archive.TeeFunc, summary func() (string, error)) error
 	GetTmpDir() string
 }
 
@@ -56,10 +61,12 @@ type Collector interface {
 }
 
 type Args struct {
-	DDCfs                 helpers.Filesystem
-	OutputLoc             string
-	CopyStrategy          CopyStrategy
-	DremioPAT             string
+	DDCfs        helpers.Filesystem
+	OutputLoc    string
+	CopyStrategy CopyStrategy
+	DremioPAT    string
+	// DremioPassword is the password of the dremio-username of ddc.yaml, it is only used when no PAT is set
+	DremioPassword        string
 	TransferDir           string
 	DDCYamlLoc            string
 	Disabled              []string
@@ -68,6 +75,14 @@ type Args struct {
 	MinFreeSpaceGB        int
 	CollectionMode        string
 	TransferThreads       int
+	Since                 string
+	Until                 string
+	// TLSMode is how the rest api calls check the certificate of the dremio-endpoint, it is recorded in summary.json
+	TLSMode string
+	// Pseudonyms replaces the node names and ip addresses of the bundle with aliases when set
+	Pseudonyms *pseudonym.Mapper
+	// Redactor applies the redaction rules of ddc.yaml to the cluster level files when set
+	Redactor *redaction.Redactor
 }
 
 type HostCaptureConfiguration struct {
@@ -77,8 +92,11 @@ type HostCaptureConfiguration struct {
 	CopyStrategy   CopyStrategy
 	DDCfs          helpers.Filesystem
 	DremioPAT      string
+	DremioPassword string
 	TransferDir    string
 	CollectionMode string
+	Since          string
+	Until          string
 }
 
 func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection ...func([]string)) error {
@@ -87,12 +105,15 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 	outputLocDir := filepath.Dir(outputLoc)
 	ddcfs := collectionArgs.DDCfs
 	dremioPAT := collectionArgs.DremioPAT
+	dremioPassword := collectionArgs.DremioPassword
 	transferDir := collectionArgs.TransferDir
 	ddcYamlFilePath := collectionArgs.DDCYamlLoc
 	disableFreeSpaceCheck := collectionArgs.DisableFreeSpaceCheck
 	minFreeSpaceGB := collectionArgs.MinFreeSpaceGB
 	collectionMode := collectionArgs.CollectionMode
 	transferThreads := collectionArgs.TransferThreads
+	since := collectionArgs.Since
+	until := collectionArgs.Until
 	var err error
 	tmpInstallDir := filepath.Join(outputLocDir, fmt.Sprintf("ddcex-output-%v", time.Now().Unix()))
 	err = os.Mkdir(tmpInstallDir, 0700)
@@ -123,6 +144,10 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 	if totalNodes == 0 {
 		return fmt.Errorf("no hosts found nothing to collect: %v", c.HelpText())
 	}
+	pseudonyms := collectionArgs.Pseudonyms
+	if pseudonyms != nil {
+		pseudonyms.AddNodes(coordinators, executors)
+	}
 	hosts := append(coordinators, executors...)
 	var clusterWg sync.WaitGroup
 	clusterWg.Add(1)
@@ -134,6 +159,7 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 		}
 	}()
 	var tarballs []string
+	var coordinatorTarballs []string
 	var files []helpers.CollectedFile
 	var totalFailedFiles []string
 	var totalSkippedFiles []string
@@ -152,7 +178,7 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 		c.Name(),
 		collectionArgs.Enabled,
 		collectionArgs.Disabled,
-		dremioPAT != "",
+		dremioPAT != "" || dremioPassword != "",
 		0,
 		len(coordinators)+len(executors),
 	)
@@ -169,7 +195,10 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 				DDCfs:          ddcfs,
 				TransferDir:    transferDir,
 				DremioPAT:      dremioPAT,
+				DremioPassword: dremioPassword,
 				CollectionMode: collectionMode,
+				Since:          since,
+				Until:          until,
 			}
 			//we want to be able to capture the job profiles of all the nodes
 			skipRESTCalls := false
@@ -188,8 +217,13 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 					totalFailedFiles = append(totalFailedFiles, f)
 					m.Unlock()
 				} else {
+					if pseudonyms != nil {
+						// the tarball is named after the host name the node reports
+						pseudonyms.AddName(host, strings.TrimSuffix(filepath.Base(f), ".tar.gz"))
+					}
 					m.Lock()
 					tarballs = append(tarballs, f)
+					coordinatorTarballs = append(coordinatorTarballs, f)
 					files = append(files, helpers.CollectedFile{
 						Path: f,
 						Size: size,
@@ -214,6 +248,8 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 				DDCfs:          ddcfs,
 				TransferDir:    transferDir,
 				CollectionMode: collectionMode,
+				Since:          since,
+				Until:          until,
 			}
 			//always skip executor calls
 			skipRESTCalls := true
@@ -232,6 +268,10 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 					totalFailedFiles = append(totalFailedFiles, f)
 					m.Unlock()
 				} else {
+					if pseudonyms != nil {
+						// the tarball is named after the host name the node reports
+						pseudonyms.AddName(host, strings.TrimSuffix(filepath.Base(f), ".tar.gz"))
+					}
 					m.Lock()
 					tarballs = append(tarballs, f)
 					files = append(files, helpers.CollectedFile{
@@ -268,52 +308,62 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 	collectionInfo.DDCVersion = versions.GetCLIVersion()
 	collectionInfo.CollectionsEnabled = collectionArgs.Enabled
 	collectionInfo.CollectionsDisabled = collectionArgs.Disabled
+	collectionInfo.TLSMode = collectionArgs.TLSMode
 
-	if len(tarballs) > 0 {
-		simplelog.Debugf("extracting the following tarballs %v", strings.Join(tarballs, ", "))
-		for _, t := range tarballs {
-			simplelog.Debugf("extracting %v to %v", t, s.GetTmpDir())
-			if err := archive.ExtractTarGz(t, s.GetTmpDir()); err != nil {
-				simplelog.Errorf("unable to extract tarball %v due to error %v", t, err)
-			}
-			simplelog.Debugf("extracted %v", t)
-			if err := os.Remove(t); err != nil {
-				simplelog.Errorf("unable to delete tarball %v due to error %v", t, err)
-			}
-			simplelog.Debugf("removed %v", t)
+	if len(files) == 0 {
+		return errors.New("no files transferred")
+	}
+	if pseudonyms != nil {
+		// every node has its names by now, sys.nodes adds the ones reported by dremio before anything is rewritten
+		for _, f := range coordinatorTarballs {
+			addSysNodes(pseudonyms, f)
 		}
 	}
 
-	clusterstats, err := FindClusterID(s.GetTmpDir())
-	if err != nil {
-		simplelog.Errorf("unable to find cluster ID in %v: %v", s.GetTmpDir(), err)
-	} else {
-		versions := make(map[string]string)
-		clusterIDs := make(map[string]string)
-		for _, stats := range clusterstats {
-			versions[stats.NodeName] = stats.DremioVersion
-			clusterIDs[stats.NodeName] = stats.ClusterID
+	// the node tarballs are streamed straight into the final archive, as they pass through
+	// we keep a copy of every cluster-stats.json so the summary can report cluster ids and versions
+	var clusterStatsFiles []io.Reader
+	tee := func(name string) io.Writer {
+		if path.Base(name) != "cluster-stats.json" {
+			return nil
 		}
-		collectionInfo.ClusterID = clusterIDs
-		collectionInfo.DremioVersion = versions
-	}
-	if len(files) == 0 {
-		return errors.New("no files transferred")
+		var b bytes.Buffer
+		clusterStatsFiles = append(clusterStatsFiles, &b)
+		return &b
 	}
-
-	// converts the collection info to a string
-	// ready to write out to a file
-	o, err := collectionInfo.String()
-	if err != nil {
-		return err
+	summary := func() (string, error) {
+		clusterstats, err := FindClusterID(clusterStatsFiles...)
+		if err != nil {
+			simplelog.Errorf("unable to find cluster ID in %v: %v", strings.Join(tarballs, ", "), err)
+		} else {
+			versions := make(map[string]string)
+			clusterIDs := make(map[string]string)
+			for _, stats := range clusterstats {
+				versions[stats.NodeName] = stats.DremioVersion
+				clusterIDs[stats.NodeName] = stats.ClusterID
+			}
+			collectionInfo.ClusterID = clusterIDs
+			collectionInfo.DremioVersion = versions
+		}
+		// converts the collection info to a string
+		// ready to write out to a file
+		return collectionInfo.String()
 	}
 
 	// archives the collected files
 	// creates the summary file too
-	err = s.ArchiveDiag(o, outputLoc)
+	err = s.ArchiveDiag(outputLoc, tarballs, tee, summary)
 	if err != nil {
 		return err
 	}
+	if pseudonyms != nil {
+		// the mapping stays next to the bundle so support only ever sees the aliases
+		mappingFile := pseudonym.MappingFileName(outputLoc)
+		if err := pseudonyms.WriteMapping(mappingFile); err != nil {
+			return err
+		}
+		simplelog.Infof("pseudonym mapping written to %v, it is not part of %v", mappingFile, outputLoc)
+	}
 	fullPath, err := filepath.Abs(outputLoc)
 	if err != nil {
 		return err
@@ -322,26 +372,36 @@ func Execute(c Collector, s CopyStrategy, collectionArgs Args, clusterCollection
 	return nil
 }
 
-func FindClusterID(outputDir string) (clusterStatsList []clusterstats.ClusterStats, err error) {
-	err = filepath.Walk(outputDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err // Handle the error according to your needs
+// addSysNodes seeds the pseudonyms with the sys.nodes export in the coordinator tarball
+func addSysNodes(pseudonyms *pseudonym.Mapper, tarball string) {
+	err := archive.WalkTarGzFile(tarball, func(name string, r io.Reader) error {
+		if path.Base(name) != "sys.nodes.ndjson" {
+			return nil
 		}
-		if info.Name() == "cluster-stats.json" {
-			b, err := os.ReadFile(filepath.Clean(path))
-			if err != nil {
-				return err
-			}
-			var clusterStats clusterstats.ClusterStats
+		return pseudonyms.AddSysNodes(r)
+	})
+	if err != nil {
+		simplelog.Warningf("unable to read the node names of sys.nodes in %v, only the names of the nodes ddc collected from are replaced: %v", tarball, err)
+	}
+}
 
-			err = json.Unmarshal(b, &clusterStats)
-			if err != nil {
-				return err
-			}
-			clusterStatsList = append(clusterStatsList, clusterStats)
+// FindClusterID decodes each of the cluster-stats.json files read out of the node tarballs on its own, a
+// file that cannot be decoded is skipped so one bad node does not lose the cluster ids of the others. It
+// only fails when none of the files could be decoded
+func FindClusterID(clusterStatsFiles ...io.Reader) ([]clusterstats.ClusterStats, error) {
+	var clusterStatsList []clusterstats.ClusterStats
+	var errs []error
+	for i, r := range clusterStatsFiles {
+		var clusterStats clusterstats.ClusterStats
+		if err := json.NewDecoder(r).Decode(&clusterStats); err != nil {
+			simplelog.Warningf("skipping cluster-stats.json %v of %v as it could not be decoded: %v", i+1, len(clusterStatsFiles), err)
+			errs = append(errs, err)
+			continue
 		}
-
-		return nil
-	})
-	return
+		clusterStatsList = append(clusterStatsList, clusterStats)
+	}
+	if len(clusterStatsList) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return clusterStatsList, nil
 }
@@ -0,0 +1,46 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// collection package provides the interface for collection implementation and the actual collection execution
+package collection
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
+)
+
+func TestFindClusterIDSkipsABadNode(t *testing.T) {
+	stats, err := FindClusterID(
+		strings.NewReader(`{"dremioVersion":"25.0.0","clusterID":"abc","nodeName":"dremio-master-0"}`),
+		strings.NewReader(`{"dremioVersion":`),
+		strings.NewReader(`{"dremioVersion":"25.0.0","clusterID":"abc","nodeName":"dremio-executor-0"}`),
+	)
+	if err != nil {
+		t.Fatalf("expected the bad node to be skipped but got error %v", err)
+	}
+	expected := []clusterstats.ClusterStats{
+		{DremioVersion: "25.0.0", ClusterID: "abc", NodeName: "dremio-master-0"},
+		{DremioVersion: "25.0.0", ClusterID: "abc", NodeName: "dremio-executor-0"},
+	}
+	if !reflect.DeepEqual(expected, stats) {
+		t.Errorf("expected %v but was %v", expected, stats)
+	}
+	if _, err := FindClusterID([]io.Reader{strings.NewReader("not json")}...); err == nil {
+		t.Error("expected an error when no file could be decoded")
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/root/helpers"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/clusterstats"
 )
 
 type SummaryInfo struct {
@@ -39,6 +40,10 @@ type SummaryInfo struct {
 	DDCVersion          string                  `json:"ddcVersion"`
 	CollectionsEnabled  []string                `json:"collectionsEnabled"`
 	CollectionsDisabled []string                `json:"collectionsDisabled"`
+	// TLSMode is how the rest api calls checked the certificate of the dremio-endpoint, empty without rest api calls
+	TLSMode string `json:"tlsMode,omitempty"`
+	// CloudProjects is how the collection of each Dremio Cloud project went when several were collected
+	CloudProjects []clusterstats.CloudProject `json:"cloudProjects,omitempty"`
 }
 
 type ClusterInfo struct {
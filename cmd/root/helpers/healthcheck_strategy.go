@@ -17,12 +17,15 @@ package helpers
 
 import (
 	"fmt"
+	"os"
 	"path"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"time"
 
 	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/redaction"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
@@ -58,6 +61,8 @@ type CopyStrategyHC struct {
 	BaseDir      string     // the base dir of where the output is routed
 	Fs           Filesystem // filesystem interface (so we can pass in realof fake filesystem, assists testing)
 	TimeService  TimeService
+	Rewriter     archive.Rewriter    // rewrites the names and contents of the archive entries when set
+	Redactor     *redaction.Redactor // redacts the cluster level files of the tmp dir before they are archived when set
 }
 
 /*
@@ -146,30 +151,96 @@ func (s *CopyStrategyHC) Close() {
 		if err := s.Fs.RemoveAll(s.GetTmpDir()); err != nil {
 			simplelog.Warningf("unable to remove %v due to error %v. It will need to be removed manually", s.GetTmpDir(), err)
 		}
-		summaryFile := filepath.Join(s.TmpDir, "summary.json")
-		simplelog.Infof("cleaning up file %v", summaryFile)
-		//temp folders stay around forever unless we tell them to go away
-		if err := s.Fs.Remove(summaryFile); err != nil {
-			simplelog.Warningf("unable to remove %v due to error %v. It will need to be removed manually", summaryFile, err)
-		}
 	}()
 }
 
-// Archive calls out to the main archive function
-func (s *CopyStrategyHC) ArchiveDiag(o string, outputLoc string) error {
-	// creates the summary file
-	summaryFile := filepath.Join(s.TmpDir, "summary.json")
-	if err := s.Fs.WriteFile(summaryFile, []byte(o), 0600); err != nil {
-		return fmt.Errorf("failed writing summary file '%v' due to error %v", summaryFile, err)
-	}
-
+// ArchiveDiag streams each node tarball straight into the final archive under the healthcheck layout
+// next to the cluster level files already in the tmp dir, so nothing has to be extracted to disk first.
+// Every regular file read out of the tarballs is offered to tee, and summary is only called once all
+// of them have been read so the summary can be built from what was seen in the stream.
+func (s *CopyStrategyHC) ArchiveDiag(outputLoc string, tarballs []string, tee archive.TeeFunc, summary func() (string, error)) error {
 	// create completed file (its not gzipped)
 	if _, err := s.createHCFiles(); err != nil {
 		return err
 	}
+	if err := simplelog.CopyLog(filepath.Join(s.GetTmpDir(), "ddc.log")); err != nil {
+		simplelog.Warningf("unable to copy ddc.log: \n%v", err)
+	}
+	if s.Redactor != nil {
+		// the node tarballs were redacted on the nodes, this covers the files collected from the cluster
+		report, err := s.Redactor.Dir(s.GetTmpDir(), runtime.NumCPU())
+		if err != nil {
+			return fmt.Errorf("unable to redact %v, the archive was not created: %w", s.GetTmpDir(), err)
+		}
+		if err := redaction.WriteReport(report, filepath.Join(s.GetTmpDir(), redaction.ReportFileName)); err != nil {
+			return err
+		}
+	}
 
-	// call general archive routine
-	return archive.TarDDC(s.TmpDir, outputLoc, s.BaseDir)
+	tarGzFile, err := os.Create(filepath.Clean(outputLoc))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := tarGzFile.Close(); err != nil {
+			simplelog.Debugf("failed extra close to tgz file %v", err)
+		}
+	}()
+	tgzWriter := archive.NewTarGzWriter(tarGzFile)
+	defer func() {
+		if err := tgzWriter.Close(); err != nil {
+			simplelog.Debugf("failed extra close to tgz stream %v", err)
+		}
+	}()
+	if s.Rewriter != nil {
+		// staged outside of the tmp dir as that is being archived
+		stagingDir, err := os.MkdirTemp(s.TmpDir, "ddc-rewrite-")
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := os.RemoveAll(stagingDir); err != nil {
+				simplelog.Warningf("unable to remove %v due to error %v. It will need to be removed manually", stagingDir, err)
+			}
+		}()
+		tgzWriter.SetRewriter(s.Rewriter, stagingDir)
+	}
+	// the cluster level collections (kubernetes etc) are written directly to the tmp dir
+	if err := tgzWriter.AddDir(s.GetTmpDir(), s.BaseDir, func(string) bool { return true }); err != nil {
+		return fmt.Errorf("unable to archive %v due to error %w", s.GetTmpDir(), err)
+	}
+	for _, t := range tarballs {
+		simplelog.Debugf("streaming %v into %v", t, outputLoc)
+		if err := tgzWriter.AddTarGzFile(t, s.BaseDir, tee); err != nil {
+			// what was streamed before the error is in the archive, the tarball is the only full copy of the node
+			kept, absErr := filepath.Abs(t)
+			if absErr != nil {
+				kept = t
+			}
+			simplelog.Errorf("unable to archive tarball %v due to error %v, the node is incomplete in %v and the tarball is kept at %v", t, err, outputLoc, kept)
+			continue
+		}
+		if err := s.Fs.Remove(t); err != nil {
+			simplelog.Errorf("unable to delete tarball %v due to error %v", t, err)
+		}
+		simplelog.Debugf("removed %v", t)
+	}
+
+	// creates the summary file last so it can use everything read from the tarballs
+	o, err := summary()
+	if err != nil {
+		return err
+	}
+	if err := tgzWriter.AddFile("summary.json", []byte(o)); err != nil {
+		return fmt.Errorf("failed writing summary file due to error %w", err)
+	}
+	if err := tgzWriter.Close(); err != nil {
+		return err
+	}
+	if err := tarGzFile.Close(); err != nil {
+		return fmt.Errorf("failed close to tgz file %w", err)
+	}
+	return nil
 }
 
 // This function creates a couple of supplemental files required for the HC data to be uploaded
@@ -16,9 +16,18 @@
 package helpers
 
 import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pseudonym"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/redaction"
 )
 
 type MockTimeService struct {
@@ -80,30 +89,213 @@ func TestGetPathHC(t *testing.T) {
 	}
 }
 
-// Test archiving of a file (which is also tested elsewhere) but in addition
-// it tests the call via the selected strategy
+// Test archiving of a node tarball via the selected strategy, the tarball should be
+// streamed into the final archive and removed without being extracted first
 func TestArchiveDiagHC(t *testing.T) {
 	ddcfs := NewRealFileSystem()
 	tmpDir := t.TempDir()
 
 	testStrat := NewHCCopyStrategy(ddcfs, &MockTimeService{Time: time.Now()}, tmpDir)
-	testFileRaw := filepath.Join("testdata", "test.txt")
-	if testFile, err := filepath.Abs(testFileRaw); err != nil {
-		t.Fatalf("not able to get absolute path for test file %v", err)
-	} else {
-		if _, err := ddcfs.Stat(testFile); err != nil {
-			t.Fatalf("unexpected error getting file size for file %v due to error %v", testFile, err)
-		}
-		archiveFile := tmpDir + ".tgz"
-		if err != nil {
-			t.Fatalf("not able to get absolute path for testdata dir %v", err)
+	nodeDir := t.TempDir()
+	nodeFile := filepath.Join(nodeDir, "configuration", "node1-C", "test.txt")
+	if err := os.MkdirAll(filepath.Dir(nodeFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+	testFile, err := os.ReadFile(filepath.Join("testdata", "test.txt"))
+	if err != nil {
+		t.Fatalf("unable to read test file %v", err)
+	}
+	if err := os.WriteFile(nodeFile, testFile, 0600); err != nil {
+		t.Fatal(err)
+	}
+	tarball := filepath.Join(tmpDir, "node1.tar.gz")
+	if err := archive.TarGzDir(nodeDir, tarball); err != nil {
+		t.Fatalf("unable to make node tarball %v", err)
+	}
+
+	var teed []string
+	tee := func(name string) io.Writer {
+		teed = append(teed, name)
+		return nil
+	}
+	summaryCalled := false
+	summary := func() (string, error) {
+		summaryCalled = true
+		return "test", nil
+	}
+	archiveFile := tmpDir + ".tgz"
+	if err := testStrat.ArchiveDiag(archiveFile, []string{tarball}, tee, summary); err != nil {
+		t.Errorf("\nERROR: gzip file: \nexpected:\t%v\nactual:\t\t%v\n", nil, err)
+	}
+	if !summaryCalled {
+		t.Error("expected summary to be called")
+	}
+	expectedTee := []string{path.Join(testStrat.BaseDir, "configuration", "node1-C", "test.txt")}
+	if !reflect.DeepEqual(expectedTee, teed) {
+		t.Errorf("expected tee to see %v but saw %v", expectedTee, teed)
+	}
+	if _, err := os.Stat(tarball); !os.IsNotExist(err) {
+		t.Errorf("expected node tarball %v to be removed but stat returned %v", tarball, err)
+	}
+
+	outDir := t.TempDir()
+	if err := archive.ExtractTarGz(archiveFile, outDir); err != nil {
+		t.Fatalf("unable to extract %v: %v", archiveFile, err)
+	}
+	for _, f := range []string{
+		filepath.Join(outDir, "summary.json"),
+		filepath.Join(outDir, testStrat.BaseDir, "configuration", "node1-C", "test.txt"),
+		filepath.Join(outDir, testStrat.BaseDir, "completed", testStrat.BaseDir),
+	} {
+		if _, err := os.Stat(f); err != nil {
+			t.Errorf("expected %v in the archive but got %v", f, err)
 		}
+	}
+}
+
+func TestArchiveDiagHCWithPseudonyms(t *testing.T) {
+	ddcfs := NewRealFileSystem()
+	tmpDir := t.TempDir()
+
+	testStrat := NewHCCopyStrategy(ddcfs, &MockTimeService{Time: time.Now()}, tmpDir)
+	mapper := pseudonym.New()
+	mapper.AddNodes([]string{"10.0.0.1"}, nil)
+	mapper.AddName("10.0.0.1", "node1")
+	testStrat.Rewriter = mapper
+	nodeDir := t.TempDir()
+	nodeFile := filepath.Join(nodeDir, "configuration", "10.0.0.1-C", "node1.txt")
+	if err := os.MkdirAll(filepath.Dir(nodeFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(nodeFile, []byte("node1 talks to 10.0.0.9\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tarball := filepath.Join(tmpDir, "node1.tar.gz")
+	if err := archive.TarGzDir(nodeDir, tarball); err != nil {
+		t.Fatalf("unable to make node tarball %v", err)
+	}
+	summary := func() (string, error) {
+		return `{"coordinators":["10.0.0.1"]}`, nil
+	}
+	archiveFile := tmpDir + ".tgz"
+	if err := testStrat.ArchiveDiag(archiveFile, []string{tarball}, nil, summary); err != nil {
+		t.Fatalf("unable to archive %v", err)
+	}
 
-		// Test Archive, pushes a teal test file into a zip archive
-		err = testStrat.ArchiveDiag("test", archiveFile)
+	outDir := t.TempDir()
+	if err := archive.ExtractTarGz(archiveFile, outDir); err != nil {
+		t.Fatalf("unable to extract %v: %v", archiveFile, err)
+	}
+	for f, expected := range map[string]string{
+		filepath.Join(outDir, testStrat.BaseDir, "configuration", "coordinator-1-C", "coordinator-1.txt"): "coordinator-1 talks to ip-001\n",
+		filepath.Join(outDir, "summary.json"): `{"coordinators":["coordinator-1"]}`,
+	} {
+		b, err := os.ReadFile(f)
 		if err != nil {
-			t.Errorf("\nERROR: gzip file: \nexpected:\t%v\nactual:\t\t%v\n", nil, err)
+			t.Errorf("expected %v in the archive but got %v", f, err)
+			continue
+		}
+		if string(b) != expected {
+			t.Errorf("expected %v to be '%v' but was '%v'", f, expected, string(b))
 		}
 	}
+	staging, err := filepath.Glob(filepath.Join(tmpDir, "ddc-rewrite-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staging) > 0 {
+		t.Errorf("expected the staging dir to be removed but found %v", staging)
+	}
+}
+
+func TestArchiveDiagHCKeepsATarballThatCannotBeStreamed(t *testing.T) {
+	ddcfs := NewRealFileSystem()
+	tmpDir := t.TempDir()
+	testStrat := NewHCCopyStrategy(ddcfs, &MockTimeService{Time: time.Now()}, tmpDir)
+	nodeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(nodeDir, "node.txt"), []byte("node\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	good := filepath.Join(tmpDir, "node1.tar.gz")
+	if err := archive.TarGzDir(nodeDir, good); err != nil {
+		t.Fatalf("unable to make node tarball %v", err)
+	}
+	b, err := os.ReadFile(good)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a transfer that was cut short
+	truncated := filepath.Join(tmpDir, "node2.tar.gz")
+	if err := os.WriteFile(truncated, b[:len(b)/2], 0600); err != nil {
+		t.Fatal(err)
+	}
+	archiveFile := tmpDir + ".tgz"
+	if err := testStrat.ArchiveDiag(archiveFile, []string{good, truncated}, nil, func() (string, error) { return "{}", nil }); err != nil {
+		t.Fatalf("unable to archive %v", err)
+	}
+	if _, err := os.Stat(good); !os.IsNotExist(err) {
+		t.Errorf("expected %v to be removed once it was streamed but got %v", good, err)
+	}
+	kept, err := os.ReadFile(truncated)
+	if err != nil {
+		t.Fatalf("expected %v to be kept as it could not be streamed: %v", truncated, err)
+	}
+	if len(kept) != len(b)/2 {
+		t.Errorf("expected %v to be left as it was", truncated)
+	}
+}
 
+func TestArchiveDiagHCWithRedaction(t *testing.T) {
+	ddcfs := NewRealFileSystem()
+	tmpDir := t.TempDir()
+
+	testStrat := NewHCCopyStrategy(ddcfs, &MockTimeService{Time: time.Now()}, tmpDir)
+	redactor, err := redaction.New([]redaction.Rule{{Name: "customer", Pattern: `acme-\d+`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStrat.Redactor = redactor
+	// written by the cluster level collection, such as the kubernetes describe of the pods
+	clusterFile := filepath.Join(testStrat.GetTmpDir(), "kubernetes", "pods.json")
+	if err := os.MkdirAll(filepath.Dir(clusterFile), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(clusterFile, []byte(`{"namespace":"acme-42"}`+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	nodeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(nodeDir, "node.txt"), []byte("node\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tarball := filepath.Join(tmpDir, "node1.tar.gz")
+	if err := archive.TarGzDir(nodeDir, tarball); err != nil {
+		t.Fatalf("unable to make node tarball %v", err)
+	}
+	archiveFile := tmpDir + ".tgz"
+	if err := testStrat.ArchiveDiag(archiveFile, []string{tarball}, nil, func() (string, error) { return "{}", nil }); err != nil {
+		t.Fatalf("unable to archive %v", err)
+	}
+
+	outDir := t.TempDir()
+	if err := archive.ExtractTarGz(archiveFile, outDir); err != nil {
+		t.Fatalf("unable to extract %v: %v", archiveFile, err)
+	}
+	b, err := os.ReadFile(filepath.Join(outDir, testStrat.BaseDir, "kubernetes", "pods.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := `{"namespace":"<REDACTED_CUSTOMER>"}` + "\n"; string(b) != expected {
+		t.Errorf("expected '%v' but was '%v'", expected, string(b))
+	}
+	b, err = os.ReadFile(filepath.Join(outDir, testStrat.BaseDir, redaction.ReportFileName))
+	if err != nil {
+		t.Fatalf("expected the redaction report in the archive: %v", err)
+	}
+	var report redaction.Report
+	if err := json.Unmarshal(b, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Files) != 1 || report.Files[0].File != "kubernetes/pods.json" || report.Files[0].Matches["customer"] != 1 {
+		t.Errorf("expected one match in kubernetes/pods.json but the report was %+v", report.Files)
+	}
 }
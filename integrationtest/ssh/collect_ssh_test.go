@@ -398,13 +398,10 @@ dremio-jfr-time-seconds: 10
 				continue
 			}
 		}
-		if e == "options" {
-			//we double up for options since it's big
-			systemTables = append(systemTables, "sys.options_offset_500_limit_500")
-		}
 		//we do the trim because sys.\"tables\" becomes sys.tables on the filesystem
-		fullFileName := fmt.Sprintf("sys.%v_offset_0_limit_500.json", e)
-		systemTables = append(systemTables, strings.ReplaceAll(fullFileName, "\\\"", ""))
+		baseName := strings.ReplaceAll(fmt.Sprintf("sys.%v", e), "\\\"", "")
+		//every table has its rows and the schema of the results
+		systemTables = append(systemTables, baseName+".ndjson", baseName+".schema.json")
 	}
 	sort.Strings(systemTables)
 	var expectedEntriesCount int
@@ -417,8 +414,8 @@ dremio-jfr-time-seconds: 10
 		// - sys.roles
 		// and system.tables because it seems to not be setup
 		// - sys.\"tables\"
-
-		expectedEntriesCount = len(systemTables) - 4
+		// each of them would have written an ndjson and a schema file
+		expectedEntriesCount = len(systemTables) - 8
 	}
 
 	entries, err = os.ReadDir(filepath.Join(hcDir, "system-tables", coordinator))
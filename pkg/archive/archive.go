@@ -74,91 +74,14 @@ func TarGzDirFiltered(srcDir, dest string, filterList func(string) bool) error {
 }
 
 func TarGzDirFilteredStream(srcDir string, w io.Writer, filterList func(string) bool) error {
-	gzWriter := gzip.NewWriter(w)
-	defer func() {
-		if err := gzWriter.Close(); err != nil {
-			simplelog.Debugf("failed extra close to gz file %v", err)
-		}
-	}()
-
-	tarWriter := tar.NewWriter(gzWriter)
-	defer func() {
-		if err := tarWriter.Close(); err != nil {
-			simplelog.Debugf("failed extra close to tar file %v", err)
-		}
-	}()
-
-	srcDir = strings.TrimSuffix(srcDir, string(os.PathSeparator))
-
-	if err := filepath.Walk(srcDir, func(filePath string, fileInfo os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		//don't try and archive the tarball itself
-		//if filePath == dest {
-		//		return nil
-		//	}
-
-		if !filterList(filePath) {
-			return nil
-		}
-
-		// Get the relative path of the file
-		relativePath, err := filepath.Rel(srcDir, filePath)
-		if err != nil {
-			return err
-		}
-
-		header, err := tar.FileInfoHeader(fileInfo, relativePath)
-		if err != nil {
-			return err
+	tgzWriter := NewTarGzWriter(w)
+	if err := tgzWriter.AddDir(srcDir, "", filterList); err != nil {
+		if closeErr := tgzWriter.Close(); closeErr != nil {
+			simplelog.Debugf("failed extra close to tgz stream %v", closeErr)
 		}
-
-		// Convert path to use forward slashes
-		header.Name = filepath.ToSlash(relativePath)
-
-		header.Size = fileInfo.Size()
-
-		if err := tarWriter.WriteHeader(header); err != nil {
-			return err
-		}
-
-		if !fileInfo.Mode().IsRegular() { //nothing more to do for non-regular
-			return nil
-		}
-
-		if !fileInfo.IsDir() {
-			file, err := os.Open(filepath.Clean(filePath))
-			if err != nil {
-				return err
-			}
-
-			defer func() {
-				if err := file.Close(); err != nil {
-					simplelog.Debugf("optional file close for file %v failed %v", filePath, err)
-				}
-			}()
-			if _, err := io.Copy(tarWriter, file); err != nil {
-				return fmt.Errorf("unable to copy file %v to tar due to error %w", filePath, err)
-			}
-			// if err := file.Close(); err != nil {
-			// 	return fmt.Errorf("failed closing file %v: %v", filePath, err)
-			// }
-			return nil
-		}
-
-		return nil
-	}); err != nil {
 		return err
 	}
-	if err := tarWriter.Close(); err != nil {
-		return fmt.Errorf("failed close to tar file %w", err)
-	}
-	if err := gzWriter.Close(); err != nil {
-		return fmt.Errorf("failed close to gz file %w", err)
-	}
-
-	return nil
+	return tgzWriter.Close()
 }
 
 // Sanitize archive file pathing from "G305: Zip Slip vulnerability"
@@ -232,6 +155,35 @@ func ExtractTarStream(reader io.Reader, dest, pathToStrip string) error {
 	}
 }
 
+// WalkTarGzFile calls fn with the name and contents of every regular file in the tar.gz at gzFilePath
+func WalkTarGzFile(gzFilePath string, fn func(name string, r io.Reader) error) error {
+	reader, err := os.Open(path.Clean(gzFilePath))
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	gzReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer gzReader.Close()
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		case header == nil || header.Typeflag != tar.TypeReg:
+			continue
+		}
+		if err := fn(header.Name, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
 func ExtractTarGzStream(reader io.Reader, dest, pathToStrip string) error {
 	gzReader, err := gzip.NewReader(reader)
 	if err != nil {
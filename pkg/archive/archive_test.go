@@ -16,11 +16,13 @@ package archive_test
 
 import (
 	"archive/tar"
+	"bytes"
 	"compress/gzip"
 	"io"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/dremio/dremio-diagnostic-collector/pkg/archive"
@@ -249,7 +251,7 @@ func TestCopyLog(t *testing.T) {
 	simplelog.InitLogger(2)
 	simplelog.Infof("test for copy")
 	currLog := simplelog.GetLogLoc()
-	destLog := filepath.Join("testdata", "ddc.log")
+	destLog := filepath.Join(t.TempDir(), "ddc.log")
 	err := simplelog.CopyLog(destLog)
 	if err != nil {
 		t.Errorf("error copying log\n%v", err)
@@ -267,3 +269,178 @@ func TestCopyLog(t *testing.T) {
 		t.Errorf("expected logs to be equal size but they were not:\nFile: %v\nSize: %v\nFile: %v\nSize: %v", currLog, expected.Size(), destLog, actual.Size())
 	}
 }
+
+func TestTarGzWriterMergesTarballs(t *testing.T) {
+	tmpDir := t.TempDir()
+	node1 := filepath.Join(tmpDir, "node1.tar.gz")
+	if err := archive.TarGzDir(filepath.Join("testdata", "targz"), node1); err != nil {
+		t.Fatalf("unable to archive node1 due to error %v", err)
+	}
+	node2 := filepath.Join(tmpDir, "node2.tar.gz")
+	if err := archive.TarGzDir(filepath.Join("testdata", "ddctgz"), node2); err != nil {
+		t.Fatalf("unable to archive node2 due to error %v", err)
+	}
+
+	var out bytes.Buffer
+	tgzWriter := archive.NewTarGzWriter(&out)
+	var teed bytes.Buffer
+	tee := func(name string) io.Writer {
+		if name == "20500101-DDC/file1.txt" {
+			return &teed
+		}
+		return nil
+	}
+	for _, node := range []string{node1, node2} {
+		if err := tgzWriter.AddTarGzFile(node, "20500101-DDC", tee); err != nil {
+			t.Fatalf("unable to merge %v due to error %v", node, err)
+		}
+	}
+	if err := tgzWriter.AddFile("summary.json", []byte("{}")); err != nil {
+		t.Fatalf("unable to add summary due to error %v", err)
+	}
+	if err := tgzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, hdr.Name)
+	}
+	expected := []string{
+		"20500101-DDC",
+		"20500101-DDC/file1.txt",
+		"20500101-DDC/file2.txt",
+		"20500101-DDC/2050101011-DDC",
+		"20500101-DDC/2050101011-DDC/file1.txt",
+		"20500101-DDC/2050101011-DDC/file2.txt",
+		"summary.json",
+	}
+	if !reflect.DeepEqual(expected, names) {
+		t.Errorf("expected entries %v but got %v", expected, names)
+	}
+	original1, err := os.ReadFile(filepath.Join("testdata", "targz", "file1.txt"))
+	if err != nil {
+		t.Fatalf("unable to read original file1.txt file: %v", err)
+	}
+	if !reflect.DeepEqual(original1, teed.Bytes()) {
+		t.Errorf("expected tee to see '%q' but got '%q'", string(original1), teed.String())
+	}
+}
+
+func TestWalkTarGzFile(t *testing.T) {
+	node := filepath.Join(t.TempDir(), "node.tar.gz")
+	if err := archive.TarGzDir(filepath.Join("testdata", "targz"), node); err != nil {
+		t.Fatalf("unable to archive node due to error %v", err)
+	}
+	contents := make(map[string]string)
+	err := archive.WalkTarGzFile(node, func(name string, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		contents[name] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	original1, err := os.ReadFile(filepath.Join("testdata", "targz", "file1.txt"))
+	if err != nil {
+		t.Fatalf("unable to read original file1.txt file: %v", err)
+	}
+	if len(contents) != 2 || contents["file1.txt"] != string(original1) {
+		t.Errorf("expected file1.txt and file2.txt with their contents but got %v", contents)
+	}
+	if err := archive.WalkTarGzFile(filepath.Join("testdata", "missing.tar.gz"), nil); err == nil {
+		t.Error("expected an error for a missing tarball")
+	}
+}
+
+type upperRewriter struct{}
+
+func (upperRewriter) Name(name string) string {
+	return strings.ReplaceAll(name, "file", "FILE")
+}
+
+func (upperRewriter) File(_, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, bytes.ToUpper(b), 0600)
+}
+
+func TestTarGzWriterRewritesEntries(t *testing.T) {
+	tmpDir := t.TempDir()
+	node := filepath.Join(tmpDir, "node.tar.gz")
+	if err := archive.TarGzDir(filepath.Join("testdata", "targz"), node); err != nil {
+		t.Fatalf("unable to archive node due to error %v", err)
+	}
+
+	var out bytes.Buffer
+	tgzWriter := archive.NewTarGzWriter(&out)
+	tgzWriter.SetRewriter(upperRewriter{}, tmpDir)
+	var teed bytes.Buffer
+	tee := func(name string) io.Writer {
+		if name == "20500101-DDC/file1.txt" {
+			return &teed
+		}
+		return nil
+	}
+	if err := tgzWriter.AddTarGzFile(node, "20500101-DDC", tee); err != nil {
+		t.Fatalf("unable to add %v due to error %v", node, err)
+	}
+	if err := tgzWriter.AddFile("summary-file.json", []byte("{}")); err != nil {
+		t.Fatalf("unable to add summary due to error %v", err)
+	}
+	if err := tgzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(zr)
+	contents := make(map[string]string)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[hdr.Name] = string(b)
+	}
+	if contents["20500101-DDC/FILE1.txt"] != "THIS IS FILE 1\n" {
+		t.Errorf("expected FILE1.txt to be rewritten but got %v", contents)
+	}
+	if _, ok := contents["summary-FILE.json"]; !ok {
+		t.Errorf("expected summary-FILE.json in %v", contents)
+	}
+	// the tee sees the entry before it is rewritten
+	if teed.String() != "this is file 1\n" {
+		t.Errorf("expected tee to see the original contents but got '%q'", teed.String())
+	}
+	staged, err := filepath.Glob(filepath.Join(tmpDir, "entry-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(staged) > 0 {
+		t.Errorf("expected staged files to be removed but found %v", staged)
+	}
+}
@@ -0,0 +1,302 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pgzip"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// TeeFunc is called for every regular file streamed through a TarGzWriter with the
+// name it will have in the output archive. When it returns a writer the file contents
+// are copied to it as well as into the archive.
+type TeeFunc func(name string) io.Writer
+
+// Rewriter changes the names and the contents of the entries added to a TarGzWriter
+type Rewriter interface {
+	// Name returns the name the entry is written under
+	Name(name string) string
+	// File rewrites the regular file at path in place, name is the name of its entry
+	File(name, path string) error
+}
+
+// TarGzWriter assembles a single tar.gz from directories on disk, in memory files and
+// other tar.gz streams. Entries from other tarballs are copied across directly so they
+// never have to be extracted to disk first.
+type TarGzWriter struct {
+	gzWriter  *pgzip.Writer
+	tarWriter *tar.Writer
+	dirs      map[string]bool
+	rewriter  Rewriter
+	tmpDir    string
+}
+
+// NewTarGzWriter compresses with pgzip so large bundles use the configured number of workers
+func NewTarGzWriter(w io.Writer) *TarGzWriter {
+	gzWriter := pgzip.NewWriter(w)
+	return &TarGzWriter{
+		gzWriter:  gzWriter,
+		tarWriter: tar.NewWriter(gzWriter),
+		dirs:      make(map[string]bool),
+	}
+}
+
+// SetRewriter rewrites every entry added from now on with r, the regular files are staged in tmpDir
+// while they are rewritten as their size has to be known before they are written
+func (t *TarGzWriter) SetRewriter(r Rewriter, tmpDir string) {
+	t.rewriter = r
+	t.tmpDir = tmpDir
+}
+
+// entryName joins the prefix and name into a forward slash tar entry name
+func entryName(prefix, name string) string {
+	name = filepath.ToSlash(name)
+	if prefix == "" {
+		return name
+	}
+	return path.Join(prefix, strings.TrimPrefix(name, "/"))
+}
+
+// writeHeader writes the header skipping any directory we have already written, this
+// happens when several node tarballs share the same top level folders
+func (t *TarGzWriter) writeHeader(header *tar.Header) error {
+	if t.rewriter != nil {
+		header.Name = t.rewriter.Name(header.Name)
+		if header.Linkname != "" {
+			header.Linkname = t.rewriter.Name(header.Linkname)
+		}
+	}
+	if header.Typeflag == tar.TypeDir {
+		dirName := strings.TrimSuffix(header.Name, "/")
+		if t.dirs[dirName] {
+			return nil
+		}
+		t.dirs[dirName] = true
+	}
+	return t.tarWriter.WriteHeader(header)
+}
+
+// AddDir walks srcDir and adds every file accepted by filterList under prefix
+func (t *TarGzWriter) AddDir(srcDir, prefix string, filterList func(string) bool) error {
+	srcDir = strings.TrimSuffix(srcDir, string(os.PathSeparator))
+	return filepath.Walk(srcDir, func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !filterList(filePath) {
+			return nil
+		}
+
+		// Get the relative path of the file
+		relativePath, err := filepath.Rel(srcDir, filePath)
+		if err != nil {
+			return err
+		}
+
+		header, err := tar.FileInfoHeader(fileInfo, relativePath)
+		if err != nil {
+			return err
+		}
+
+		// Convert path to use forward slashes
+		header.Name = entryName(prefix, relativePath)
+		header.Size = fileInfo.Size()
+
+		if !fileInfo.Mode().IsRegular() { //nothing more to do for non-regular
+			return t.writeHeader(header)
+		}
+
+		file, err := os.Open(filepath.Clean(filePath))
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if err := file.Close(); err != nil {
+				simplelog.Debugf("optional file close for file %v failed %v", filePath, err)
+			}
+		}()
+		if err := t.writeRegular(header, file, nil); err != nil {
+			return fmt.Errorf("unable to copy file %v to tar due to error %w", filePath, err)
+		}
+		return nil
+	})
+}
+
+// writeRegular writes the header and the contents of a regular file, copying the contents to the
+// writer tee returns as well. With a rewriter the contents are staged and rewritten first
+func (t *TarGzWriter) writeRegular(header *tar.Header, r io.Reader, tee TeeFunc) error {
+	if tee != nil {
+		if w := tee(header.Name); w != nil {
+			r = io.TeeReader(r, w)
+		}
+	}
+	if t.rewriter != nil {
+		return t.writeRewritten(header, r)
+	}
+	if err := t.writeHeader(header); err != nil {
+		return err
+	}
+	if copied, err := io.Copy(t.tarWriter, r); err != nil {
+		// pad out the entry so the header we already wrote stays valid and the rest of the archive is readable
+		if _, padErr := io.CopyN(t.tarWriter, zeroReader{}, header.Size-copied); padErr != nil {
+			simplelog.Debugf("unable to pad truncated entry %v: %v", header.Name, padErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// writeRewritten stages the contents in a temporary file, keeping the extension so gzipped and
+// zipped files are recognised, rewrites it and then writes it with its new size
+func (t *TarGzWriter) writeRewritten(header *tar.Header, r io.Reader) error {
+	staged, err := os.CreateTemp(t.tmpDir, "entry-*"+path.Ext(header.Name))
+	if err != nil {
+		return err
+	}
+	stagedName := staged.Name()
+	defer func() {
+		if err := os.Remove(stagedName); err != nil {
+			simplelog.Debugf("unable to remove staged file %v: %v", stagedName, err)
+		}
+	}()
+	_, err = io.Copy(staged, r)
+	if closeErr := staged.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err := t.rewriter.File(header.Name, stagedName); err != nil {
+		// the contents may still hold what the rewriter is there to remove so the entry is left out
+		simplelog.Warningf("leaving %v out of the archive: %v", header.Name, err)
+		return nil
+	}
+	info, err := os.Stat(stagedName)
+	if err != nil {
+		return err
+	}
+	header.Size = info.Size()
+	if err := t.writeHeader(header); err != nil {
+		return err
+	}
+	rewritten, err := os.Open(filepath.Clean(stagedName))
+	if err != nil {
+		return err
+	}
+	defer rewritten.Close()
+	if copied, err := io.Copy(t.tarWriter, rewritten); err != nil {
+		if _, padErr := io.CopyN(t.tarWriter, zeroReader{}, header.Size-copied); padErr != nil {
+			simplelog.Debugf("unable to pad truncated entry %v: %v", header.Name, padErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// AddFile writes data as a regular file called name
+func (t *TarGzWriter) AddFile(name string, data []byte) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     entryName("", name),
+		Size:     int64(len(data)),
+		Mode:     0600,
+		ModTime:  time.Now(),
+	}
+	if err := t.writeRegular(header, bytes.NewReader(data), nil); err != nil {
+		return fmt.Errorf("unable to write %v to tar due to error %w", name, err)
+	}
+	return nil
+}
+
+// AddTarGz copies every entry of the tar.gz stream into the archive under prefix, the
+// contents of regular files are also copied to the writer returned by tee if it is not nil
+func (t *TarGzWriter) AddTarGz(reader io.Reader, prefix string, tee TeeFunc) error {
+	gzReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return err
+	}
+	defer gzReader.Close()
+	tarReader := tar.NewReader(gzReader)
+	for {
+		header, err := tarReader.Next()
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		case header == nil:
+			continue
+		}
+		header.Name = entryName(prefix, header.Name)
+		if header.Typeflag != tar.TypeReg {
+			if err := t.writeHeader(header); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := t.writeRegular(header, tarReader, tee); err != nil {
+			return fmt.Errorf("unable to copy entry %v to tar due to error %w", header.Name, err)
+		}
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// AddTarGzFile opens the tar.gz at gzFilePath and streams it in with AddTarGz
+func (t *TarGzWriter) AddTarGzFile(gzFilePath, prefix string, tee TeeFunc) error {
+	reader, err := os.Open(filepath.Clean(gzFilePath))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := reader.Close(); err != nil {
+			simplelog.Debugf("optional close of file %v failed %v", gzFilePath, err)
+		}
+	}()
+	return t.AddTarGz(reader, prefix, tee)
+}
+
+// Close flushes the tar and gzip streams, it does not close the underlying writer
+func (t *TarGzWriter) Close() error {
+	if err := t.tarWriter.Close(); err != nil {
+		// still close the gzip stream so its workers exit
+		if gzErr := t.gzWriter.Close(); gzErr != nil {
+			simplelog.Debugf("failed extra close to gz file %v", gzErr)
+		}
+		return fmt.Errorf("failed close to tar file %w", err)
+	}
+	if err := t.gzWriter.Close(); err != nil {
+		return fmt.Errorf("failed close to gz file %w", err)
+	}
+	return nil
+}
@@ -20,3 +20,15 @@ type ClusterStats struct {
 	ClusterID     string `json:"clusterID"`
 	NodeName      string `json:"nodeName"`
 }
+
+// CloudProjectsFile is where local-collect records how the collection of each Dremio Cloud project went
+const CloudProjectsFile = "cloud-projects.json"
+
+// CloudProject is how the collection of a Dremio Cloud project went, Errors has the collections that failed
+type CloudProject struct {
+	ID                   string   `json:"id"`
+	Name                 string   `json:"name,omitempty"`
+	Success              bool     `json:"success"`
+	Errors               []string `json:"errors,omitempty"`
+	JobProfilesCollected int      `json:"jobProfilesCollected"`
+}
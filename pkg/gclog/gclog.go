@@ -0,0 +1,339 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package gclog parses JVM garbage collection logs in both the unified logging format
+// used by JDK 11+ (-Xlog:gc*) and the legacy -XX:+PrintGCDetails format used by JDK 8
+package gclog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// Event is a single stop the world pause
+type Event struct {
+	Time             time.Time `json:"time"`
+	UptimeSeconds    float64   `json:"uptimeSeconds"`
+	Type             string    `json:"type"`
+	Cause            string    `json:"cause"`
+	PauseMillis      float64   `json:"pauseMillis"`
+	HeapBeforeMB     float64   `json:"heapBeforeMB"`
+	HeapAfterMB      float64   `json:"heapAfterMB"`
+	HeapTotalMB      float64   `json:"heapTotalMB"`
+	ToSpaceExhausted bool      `json:"toSpaceExhausted"`
+}
+
+// IsFull is true for any full collection regardless of the collector
+func (e Event) IsFull() bool {
+	return strings.HasPrefix(e.Type, "Full")
+}
+
+var (
+	// [2024-04-25T10:00:00.123+0000][12.345s][info][gc] GC(12) Pause Young (Normal) (G1 Evacuation Pause) 1024M->256M(4096M) 12.345ms
+	unifiedDecorators = regexp.MustCompile(`^((?:\[[^\]]*\])+)\s*(.*)$`)
+	unifiedPause      = regexp.MustCompile(`^GC\((\d+)\) Pause (\w+)(.*?) (\d+(?:\.\d+)?[BKMG])->(\d+(?:\.\d+)?[BKMG])\((\d+(?:\.\d+)?[BKMG])\) ([\d.]+)ms`)
+	unifiedToSpace    = regexp.MustCompile(`^GC\((\d+)\) To-space exhausted`)
+
+	// 2024-04-25T10:00:00.123+0000: 12.345: [GC pause (G1 Evacuation Pause) (young), 0.0123456 secs]
+	legacyStart = regexp.MustCompile(`^(?:(\d{4}-\d{2}-\d{2}T[\d:.]+[+-]\d{4}): )?(?:([\d.]+): )?\[(Full GC|GC)\b\s*(.*)$`)
+	legacySecs  = regexp.MustCompile(`, ([\d.]+) secs\]`)
+	// generation breakdowns are dropped so the first size change left is the whole heap
+	legacyGenerations = regexp.MustCompile(`\[(?:PSYoungGen|ParOldGen|PSOldGen|ParNew|DefNew|Tenured|CMS|Metaspace|PSPermGen|CMS Perm|Perm)[^\[\]]*\]`)
+	legacyHeapInline  = regexp.MustCompile(`(\d+(?:\.\d+)?[BKMG])->(\d+(?:\.\d+)?[BKMG])\((\d+(?:\.\d+)?[BKMG])\)`)
+	// G1 with PrintGCDetails prints the heap on a later line
+	legacyHeapDetail = regexp.MustCompile(`Heap: (\d+(?:\.\d+)?[BKMG])\((\d+(?:\.\d+)?[BKMG])\)->(\d+(?:\.\d+)?[BKMG])\((\d+(?:\.\d+)?[BKMG])\)`)
+	legacyDescEnd    = regexp.MustCompile(`\[|\d+(?:\.\d+)?[BKMG]->|, [\d.]+ secs`)
+	parenGroups      = regexp.MustCompile(`\(([^()]*)\)`)
+)
+
+var timeLayouts = []string{"2006-01-02T15:04:05.000-0700", "2006-01-02T15:04:05.000Z0700", "2006-01-02T15:04:05.000-07:00"}
+
+func parseTime(s string) (time.Time, bool) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseSize converts sizes such as 1024K, 3.5G and 0.0B to megabytes
+func parseSize(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	unit := s[len(s)-1]
+	v, err := strconv.ParseFloat(s[:len(s)-1], 64)
+	if err != nil {
+		return 0
+	}
+	switch unit {
+	case 'B':
+		return v / 1024 / 1024
+	case 'K':
+		return v / 1024
+	case 'G':
+		return v * 1024
+	default:
+		return v
+	}
+}
+
+// classify turns the parenthesised parts of a pause description into a type and a cause,
+// young pauses keep their G1 phase, eg Young (Mixed), so they can be told apart
+func classify(kind string, groups []string) (string, string, bool) {
+	var causes []string
+	var toSpace bool
+	phase := ""
+	for _, g := range groups {
+		switch strings.ToLower(g) {
+		case "evacuation failure", "to-space exhausted", "to-space overflow":
+			toSpace = true
+		case "normal", "mixed", "concurrent start", "prepare mixed", "young":
+			if phase == "" {
+				phase = g
+			}
+		case "initial-mark":
+			phase = "Concurrent Start"
+		default:
+			causes = append(causes, g)
+		}
+	}
+	if kind == "Young" {
+		switch strings.ToLower(phase) {
+		case "", "young", "normal":
+			phase = "Normal"
+		case "mixed":
+			phase = "Mixed"
+		}
+		kind = fmt.Sprintf("Young (%v)", phase)
+	}
+	return kind, strings.Join(causes, ", "), toSpace
+}
+
+func groupsOf(s string) []string {
+	var groups []string
+	for _, m := range parenGroups.FindAllStringSubmatch(s, -1) {
+		groups = append(groups, strings.TrimSpace(m[1]))
+	}
+	return groups
+}
+
+// Parse reads every pause from a gc log, the format is detected line by line so a
+// directory with logs from before and after a JDK upgrade can be read with the same call
+func Parse(r io.Reader) ([]Event, error) {
+	var events []Event
+	// unified logging prints to-space exhausted as its own line before the pause it belongs to
+	toSpaceIDs := make(map[string]bool)
+	// legacy G1 details put the heap sizes on a line after the pause
+	var pendingLegacy = -1
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if pendingLegacy >= 0 {
+			if h := legacyHeapDetail.FindStringSubmatch(line); h != nil {
+				e := &events[pendingLegacy]
+				e.HeapBeforeMB = parseSize(h[1])
+				e.HeapAfterMB = parseSize(h[3])
+				e.HeapTotalMB = parseSize(h[4])
+				pendingLegacy = -1
+				continue
+			}
+		}
+		if e, ok := parseUnified(line, toSpaceIDs); ok {
+			if e != nil {
+				events = append(events, *e)
+			}
+			continue
+		}
+		if m := legacyStart.FindStringSubmatch(line); m != nil {
+			rest := m[4]
+			if strings.Contains(rest, "concurrent") {
+				continue
+			}
+			secs := legacySecs.FindAllStringSubmatch(rest, -1)
+			if len(secs) == 0 {
+				continue
+			}
+			pause, err := strconv.ParseFloat(secs[len(secs)-1][1], 64)
+			if err != nil {
+				continue
+			}
+			var kind string
+			switch {
+			case m[3] == "Full GC":
+				kind = "Full"
+			case strings.HasPrefix(rest, "remark"):
+				kind = "Remark"
+			case strings.HasPrefix(rest, "cleanup"):
+				kind = "Cleanup"
+			default:
+				kind = "Young"
+			}
+			// only look at the description before any nested phases or sizes
+			desc := rest
+			if loc := legacyDescEnd.FindStringIndex(desc); loc != nil {
+				desc = desc[:loc[0]]
+			}
+			kind, cause, toSpace := classify(kind, groupsOf(desc))
+			e := Event{
+				Type:             kind,
+				Cause:            cause,
+				PauseMillis:      pause * 1000,
+				ToSpaceExhausted: toSpace,
+			}
+			if t, ok := parseTime(m[1]); ok {
+				e.Time = t
+			}
+			if v, err := strconv.ParseFloat(m[2], 64); err == nil {
+				e.UptimeSeconds = v
+			}
+			if h := legacyHeapInline.FindStringSubmatch(legacyGenerations.ReplaceAllString(rest, "")); h != nil {
+				e.HeapBeforeMB = parseSize(h[1])
+				e.HeapAfterMB = parseSize(h[2])
+				e.HeapTotalMB = parseSize(h[3])
+			}
+			events = append(events, e)
+			pendingLegacy = len(events) - 1
+			continue
+		}
+	}
+	return events, scanner.Err()
+}
+
+// parseUnified handles a unified logging line, ok is false when the line is not in that format.
+// A nil event with ok set means the line was consumed without producing a pause.
+func parseUnified(line string, toSpaceIDs map[string]bool) (*Event, bool) {
+	m := unifiedDecorators.FindStringSubmatch(line)
+	if m == nil {
+		return nil, false
+	}
+	msg := m[2]
+	if ts := unifiedToSpace.FindStringSubmatch(msg); ts != nil {
+		toSpaceIDs[ts[1]] = true
+		return nil, true
+	}
+	if !strings.HasPrefix(msg, "GC(") {
+		// either another unified line we are not interested in, or a legacy line with no date or uptime
+		return nil, !strings.HasPrefix(line, "[GC") && !strings.HasPrefix(line, "[Full GC")
+	}
+	p := unifiedPause.FindStringSubmatch(msg)
+	if p == nil {
+		return nil, true
+	}
+	pause, err := strconv.ParseFloat(p[7], 64)
+	if err != nil {
+		return nil, true
+	}
+	kind, cause, toSpace := classify(p[2], groupsOf(p[3]))
+	e := &Event{
+		Type:             kind,
+		Cause:            cause,
+		PauseMillis:      pause,
+		HeapBeforeMB:     parseSize(p[4]),
+		HeapAfterMB:      parseSize(p[5]),
+		HeapTotalMB:      parseSize(p[6]),
+		ToSpaceExhausted: toSpace || toSpaceIDs[p[1]],
+	}
+	delete(toSpaceIDs, p[1])
+	for _, d := range strings.Split(strings.Trim(m[1], "[]"), "][") {
+		d = strings.TrimSpace(d)
+		if t, ok := parseTime(d); ok {
+			e.Time = t
+		} else if strings.HasSuffix(d, "ms") {
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(d, "ms"), 64); err == nil {
+				e.UptimeSeconds = v / 1000
+			}
+		} else if strings.HasSuffix(d, "s") {
+			if v, err := strconv.ParseFloat(strings.TrimSuffix(d, "s"), 64); err == nil {
+				e.UptimeSeconds = v
+			}
+		}
+	}
+	return e, true
+}
+
+// ParseFile parses a single gc log, rotated logs that have been gzipped are read as well
+func ParseFile(fileName string) ([]Event, error) {
+	f, err := os.Open(filepath.Clean(fileName))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", fileName, err)
+		}
+	}()
+	var r io.Reader = f
+	if strings.HasSuffix(fileName, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read gzip file %v due to error %w", fileName, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return Parse(r)
+}
+
+// ParseFiles reads all the files and returns the pauses in the order they happened, gc
+// logs rotate in a ring (gc.0.log, gc.1.log, ...) so the file names say nothing about order
+func ParseFiles(fileNames []string) ([]Event, error) {
+	var events []Event
+	var errs []string
+	for _, f := range fileNames {
+		e, err := ParseFile(f)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", f, err))
+		}
+		events = append(events, e...)
+	}
+	SortEvents(events)
+	if len(errs) > 0 {
+		return events, fmt.Errorf("unable to parse gc logs: %v", strings.Join(errs, ", "))
+	}
+	return events, nil
+}
+
+// SortEvents orders by wall clock time when every event has one, otherwise by jvm uptime
+func SortEvents(events []Event) {
+	haveTimes := true
+	for _, e := range events {
+		if e.Time.IsZero() {
+			haveTimes = false
+			break
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if haveTimes {
+			return events[i].Time.Before(events[j].Time)
+		}
+		return events[i].UptimeSeconds < events[j].UptimeSeconds
+	})
+}
@@ -0,0 +1,140 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gclog_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/gclog"
+)
+
+func TestParseUnified(t *testing.T) {
+	events, err := gclog.ParseFile(filepath.Join("testdata", "gc-unified.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedTypes := []string{"Young (Normal)", "Young (Concurrent Start)", "Remark", "Cleanup", "Young (Mixed)", "Full"}
+	if len(events) != len(expectedTypes) {
+		t.Fatalf("expected %v pauses but was %v: %#v", len(expectedTypes), len(events), events)
+	}
+	for i, e := range events {
+		if e.Type != expectedTypes[i] {
+			t.Errorf("pause %v expected type %v but was %v", i, expectedTypes[i], e.Type)
+		}
+	}
+	first := events[0]
+	if first.Cause != "G1 Evacuation Pause" || first.PauseMillis != 10 || first.HeapBeforeMB != 1024 || first.HeapAfterMB != 256 || first.HeapTotalMB != 4096 {
+		t.Errorf("unexpected first pause %#v", first)
+	}
+	if first.UptimeSeconds != 10.01 || first.Time.IsZero() {
+		t.Errorf("expected decorators to be read but was %#v", first)
+	}
+	if !events[4].ToSpaceExhausted {
+		t.Error("expected the mixed pause to be marked to-space exhausted")
+	}
+	if events[5].HeapAfterMB != 2048 {
+		t.Errorf("expected 2G to be read as 2048 MB but was %v", events[5].HeapAfterMB)
+	}
+}
+
+func TestParseLegacyG1(t *testing.T) {
+	events, err := gclog.ParseFile(filepath.Join("testdata", "gc-legacy-g1.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("expected 4 pauses but was %v: %#v", len(events), events)
+	}
+	young := events[0]
+	if young.Type != "Young (Normal)" || young.Cause != "G1 Evacuation Pause" || young.PauseMillis != 10 || young.HeapAfterMB != 256 {
+		t.Errorf("unexpected young pause %#v", young)
+	}
+	mixed := events[1]
+	if mixed.Type != "Young (Mixed)" || !mixed.ToSpaceExhausted || mixed.HeapTotalMB != 4096 {
+		t.Errorf("unexpected mixed pause %#v", mixed)
+	}
+	if events[2].Type != "Remark" || events[2].PauseMillis != 5 {
+		t.Errorf("expected the outer remark time but was %#v", events[2])
+	}
+	full := events[3]
+	if !full.IsFull() || full.Cause != "Allocation Failure" || full.PauseMillis != 2000 || full.HeapAfterMB != 3000 {
+		t.Errorf("unexpected full gc %#v", full)
+	}
+}
+
+func TestParseLegacyParallel(t *testing.T) {
+	events, err := gclog.ParseFile(filepath.Join("testdata", "gc-legacy-parallel.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("expected 2 pauses but was %v: %#v", len(events), events)
+	}
+	if events[0].HeapBeforeMB != 4 || events[0].HeapAfterMB != 2 || events[0].UptimeSeconds != 1.234 {
+		t.Errorf("expected whole heap sizes not the young gen but was %#v", events[0])
+	}
+	if !events[1].IsFull() || events[1].HeapTotalMB != 8 || events[1].PauseMillis != 50 {
+		t.Errorf("expected the metaspace sizes to be ignored but was %#v", events[1])
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	events, err := gclog.ParseFiles([]string{filepath.Join("testdata", "gc-unified.log")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := gclog.Summarize("node1", events, 2)
+	if s.Pauses != 6 || s.FullGCs != 1 || s.ToSpaceExhausted != 1 {
+		t.Errorf("unexpected counts %#v", s)
+	}
+	if s.MaxPauseMillis != 1500 || s.TotalPauseMillis != 1836 {
+		t.Errorf("unexpected pause totals %#v", s)
+	}
+	if len(s.LongestPauses) != 2 || s.LongestPauses[0].PauseMillis != 1500 || s.LongestPauses[1].PauseMillis != 300 {
+		t.Errorf("unexpected longest pauses %#v", s.LongestPauses)
+	}
+	// growth between each pause and the one before it, starting from the first pause at 10.01s
+	expectedRate := (1024.0 + 88 + 0 + 3400 + 100) / (31 - 10.01)
+	if diff := s.AllocationRateMBPerSec - expectedRate; diff > 0.01 || diff < -0.01 {
+		t.Errorf("expected allocation rate %v but was %v", expectedRate, s.AllocationRateMBPerSec)
+	}
+	if s.MaxHeapAfterGCMB != 3900 || s.MaxHeapTotalMB != 4096 {
+		t.Errorf("unexpected heap occupancy %#v", s)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	events, err := gclog.ParseFile(filepath.Join("testdata", "gc-legacy-parallel.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := gclog.WriteCSV(&b, events); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected a header and 2 rows but was %v", rows)
+	}
+	if rows[2][2] != "Full" || rows[2][4] != "50.000" {
+		t.Errorf("unexpected row %v", rows[2])
+	}
+}
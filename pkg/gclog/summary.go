@@ -0,0 +1,163 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gclog
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/stats"
+)
+
+const (
+	SummaryFileName = "gc-summary.json"
+	PausesFileName  = "gc-pauses.csv"
+)
+
+// Summary is what is written to gc-summary.json for each node
+type Summary struct {
+	Node                   string    `json:"node"`
+	Files                  []string  `json:"files"`
+	FirstEvent             time.Time `json:"firstEvent"`
+	LastEvent              time.Time `json:"lastEvent"`
+	Pauses                 int       `json:"pauses"`
+	TotalPauseMillis       float64   `json:"totalPauseMillis"`
+	P50PauseMillis         float64   `json:"p50PauseMillis"`
+	P90PauseMillis         float64   `json:"p90PauseMillis"`
+	P99PauseMillis         float64   `json:"p99PauseMillis"`
+	MaxPauseMillis         float64   `json:"maxPauseMillis"`
+	FullGCs                int       `json:"fullGCs"`
+	ToSpaceExhausted       int       `json:"toSpaceExhausted"`
+	AllocationRateMBPerSec float64   `json:"allocationRateMBPerSec"`
+	AvgHeapAfterGCMB       float64   `json:"avgHeapAfterGCMB"`
+	MaxHeapAfterGCMB       float64   `json:"maxHeapAfterGCMB"`
+	MaxHeapTotalMB         float64   `json:"maxHeapTotalMB"`
+	MaxOccupancyPercent    float64   `json:"maxOccupancyPercent"`
+	LongestPauses          []Event   `json:"longestPauses"`
+	FullGCEvents           []Event   `json:"fullGCEvents"`
+}
+
+// elapsed returns the seconds between two events, false when they are from different jvm runs
+func elapsed(prev, next Event) (float64, bool) {
+	var secs float64
+	if !prev.Time.IsZero() && !next.Time.IsZero() {
+		secs = next.Time.Sub(prev.Time).Seconds()
+	} else {
+		secs = next.UptimeSeconds - prev.UptimeSeconds
+	}
+	return secs, secs > 0
+}
+
+// Summarize builds the statistics for events which must already be in order, see SortEvents.
+// longest limits how many of the longest pauses are kept.
+func Summarize(node string, events []Event, longest int) Summary {
+	s := Summary{
+		Node:          node,
+		Pauses:        len(events),
+		LongestPauses: []Event{},
+		FullGCEvents:  []Event{},
+	}
+	if len(events) == 0 {
+		return s
+	}
+	s.FirstEvent = events[0].Time
+	s.LastEvent = events[len(events)-1].Time
+
+	var pauses []float64
+	var heapAfter []float64
+	var allocatedMB, allocatedSecs float64
+	for i, e := range events {
+		pauses = append(pauses, e.PauseMillis)
+		if e.IsFull() {
+			s.FullGCs++
+			s.FullGCEvents = append(s.FullGCEvents, e)
+		}
+		if e.ToSpaceExhausted {
+			s.ToSpaceExhausted++
+		}
+		if e.HeapTotalMB > 0 {
+			heapAfter = append(heapAfter, e.HeapAfterMB)
+			if e.HeapTotalMB > s.MaxHeapTotalMB {
+				s.MaxHeapTotalMB = e.HeapTotalMB
+			}
+			if pct := e.HeapAfterMB / e.HeapTotalMB * 100; pct > s.MaxOccupancyPercent {
+				s.MaxOccupancyPercent = pct
+			}
+		}
+		// whatever the heap grew by between two collections was allocated by the application
+		if i > 0 && e.HeapBeforeMB > 0 {
+			prev := events[i-1]
+			if secs, ok := elapsed(prev, e); ok && e.HeapBeforeMB >= prev.HeapAfterMB {
+				allocatedMB += e.HeapBeforeMB - prev.HeapAfterMB
+				allocatedSecs += secs
+			}
+		}
+	}
+	s.TotalPauseMillis = stats.Sum(pauses)
+	s.P50PauseMillis = stats.Percentile(pauses, 50)
+	s.P90PauseMillis = stats.Percentile(pauses, 90)
+	s.P99PauseMillis = stats.Percentile(pauses, 99)
+	s.MaxPauseMillis = stats.Max(pauses)
+	if allocatedSecs > 0 {
+		s.AllocationRateMBPerSec = allocatedMB / allocatedSecs
+	}
+	if len(heapAfter) > 0 {
+		s.AvgHeapAfterGCMB = stats.Sum(heapAfter) / float64(len(heapAfter))
+		s.MaxHeapAfterGCMB = stats.Max(heapAfter)
+	}
+
+	sorted := append([]Event{}, events...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].PauseMillis > sorted[j].PauseMillis
+	})
+	if longest < len(sorted) {
+		sorted = sorted[:longest]
+	}
+	s.LongestPauses = append(s.LongestPauses, sorted...)
+	return s
+}
+
+// WriteCSV writes one row per pause
+func WriteCSV(w io.Writer, events []Event) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "uptime_seconds", "type", "cause", "pause_ms", "heap_before_mb", "heap_after_mb", "heap_total_mb", "to_space_exhausted"}); err != nil {
+		return err
+	}
+	for _, e := range events {
+		var ts string
+		if !e.Time.IsZero() {
+			ts = e.Time.Format(time.RFC3339Nano)
+		}
+		if err := cw.Write([]string{
+			ts,
+			strconv.FormatFloat(e.UptimeSeconds, 'f', 3, 64),
+			e.Type,
+			e.Cause,
+			strconv.FormatFloat(e.PauseMillis, 'f', 3, 64),
+			strconv.FormatFloat(e.HeapBeforeMB, 'f', 1, 64),
+			strconv.FormatFloat(e.HeapAfterMB, 'f', 1, 64),
+			strconv.FormatFloat(e.HeapTotalMB, 'f', 1, 64),
+			strconv.FormatBool(e.ToSpaceExhausted),
+		}); err != nil {
+			return fmt.Errorf("unable to write gc pause row due to error %w", err)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
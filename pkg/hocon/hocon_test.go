@@ -0,0 +1,164 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package hocon parses the HOCON files Dremio is configured with, such as dremio.conf, resolving their
+// includes and substitutions and remembering where each setting was written so it can be masked in place
+package hocon
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func resolveJSON(t *testing.T, doc *Document, vars map[string]string) (string, []string) {
+	t.Helper()
+	resolved, unresolved, err := doc.Resolve(vars)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err := json.Marshal(resolved)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return string(b), unresolved
+}
+
+func TestParseFileResolvesIncludesAndSubstitutions(t *testing.T) {
+	doc, err := ParseFile(filepath.Join("testdata", "dremio.conf"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	actual, unresolved := resolveJSON(t, doc, map[string]string{"DREMIO_HOME": "/opt/dremio"})
+	expected := `{"debug":{"addons":["one","two","three"]},` +
+		`"paths":{"db":"/opt/dremio/data/db","dist":"pdfs:///opt/dremio/data/pdfs","local":"/opt/dremio/data"},` +
+		`"provisioning":{"yarn":{"secret":{"key":"abc"}}},` +
+		`"registration":{"publish-host":"multi\nline"},` +
+		`"services":{"coordinator":{"enabled":true,"master":{"enabled":true}},"executor":{"enabled":false},"web":{"port":9047,"ssl":{"enabled":true,"keyStorePassword":"changeit"}}}}`
+	if actual != expected {
+		t.Errorf("expected\n%v\nbut was\n%v", expected, actual)
+	}
+	if len(unresolved) != 0 {
+		t.Errorf("expected everything to resolve but was %v", unresolved)
+	}
+	if len(doc.Includes) != 1 || !strings.HasSuffix(doc.Includes[0], "extra.conf") {
+		t.Errorf("unexpected includes %v", doc.Includes)
+	}
+}
+
+func TestAssignmentsPointAtTheValues(t *testing.T) {
+	data := []byte("a {\n  b.c = \"x\" # comment\n  d: [1, 2]\n}\ne: ${a.b.c} tail\n")
+	doc, err := Parse(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var actual []string
+	for _, a := range doc.Assignments {
+		actual = append(actual, strings.Join(a.Path, ".")+"="+string(data[a.Start:a.End]))
+	}
+	expected := []string{`a.b.c="x"`, "a.d=[1, 2]", "e=${a.b.c} tail"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v but was %v", expected, actual)
+	}
+	resolved, _ := resolveJSON(t, doc, nil)
+	if resolved != `{"a":{"b":{"c":"x"},"d":[1,2]},"e":"x tail"}` {
+		t.Errorf("unexpected resolution %v", resolved)
+	}
+}
+
+func TestParseWithoutFileNameSkipsIncludes(t *testing.T) {
+	doc, err := Parse([]byte("include \"other.conf\"\na = 1\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(doc.Includes) != 1 || doc.Includes[0] != "other.conf skipped" {
+		t.Errorf("unexpected includes %v", doc.Includes)
+	}
+}
+
+func TestRequiredIncludeMustExist(t *testing.T) {
+	if _, err := ParseFile(filepath.Join("testdata", "required.conf")); err == nil {
+		t.Error("expected an error for the missing file")
+	}
+}
+
+func TestUnresolvedSubstitutionsAreKept(t *testing.T) {
+	doc, err := Parse([]byte("a = ${NOT_SET_ANYWHERE_1234}/x\nb = ${?NOT_SET_ANYWHERE_1234}\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	actual, unresolved := resolveJSON(t, doc, nil)
+	if actual != `{"a":"${NOT_SET_ANYWHERE_1234}/x"}` {
+		t.Errorf("unexpected resolution %v", actual)
+	}
+	if !reflect.DeepEqual(unresolved, []string{"NOT_SET_ANYWHERE_1234"}) {
+		t.Errorf("unexpected unresolved %v", unresolved)
+	}
+}
+
+func TestResolveMaskingEnv(t *testing.T) {
+	t.Setenv("DDC_HOCON_TEST_TOKEN", "abc123")
+	doc, err := Parse([]byte("a = ${?DDC_HOCON_TEST_TOKEN}\nb = ${HOME_DIR}/x\nc = ${DDC_HOCON_TEST_TOKEN}/y\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	resolved, _, err := doc.ResolveMaskingEnv(map[string]string{"HOME_DIR": "/home"}, "masked")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	b, err := json.Marshal(resolved)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if string(b) != `{"a":"masked","b":"/home/x","c":"masked/y"}` {
+		t.Errorf("unexpected resolution %s", b)
+	}
+}
+
+func TestSelfReferenceAndCycles(t *testing.T) {
+	doc, err := Parse([]byte("path = /a\npath = ${path}\":/b\"\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if actual, _ := resolveJSON(t, doc, nil); actual != `{"path":"/a:/b"}` {
+		t.Errorf("unexpected resolution %v", actual)
+	}
+	doc, err = Parse([]byte("a = ${b}\nb = ${a}\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, _, err := doc.Resolve(nil); err == nil {
+		t.Error("expected an error for a cycle")
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{"a {\n b = 1\n", "a = [1, 2\n", "a = \"open\n", "a\n"} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	config := map[string]interface{}{"paths": map[string]interface{}{"local": "/data"}}
+	if v, ok := Lookup(config, "paths.local"); !ok || v != "/data" {
+		t.Errorf("unexpected lookup %v", v)
+	}
+	if _, ok := Lookup(config, "paths.local.more"); ok {
+		t.Error("expected nothing below a string")
+	}
+}
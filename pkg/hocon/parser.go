@@ -0,0 +1,669 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package hocon parses the HOCON files Dremio is configured with, such as dremio.conf, resolving their
+// includes and substitutions and remembering where each setting was written so it can be masked in place
+package hocon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type kind int
+
+const (
+	kindObject kind = iota
+	kindArray
+	kindString
+	kindNumber
+	kindBool
+	kindNull
+	kindConcat
+	kindSubst
+	// kindSpace is whitespace between concatenated values, it only counts when strings are concatenated
+	kindSpace
+)
+
+type value struct {
+	kind     kind
+	str      string
+	object   *object
+	array    []*value
+	parts    []*value
+	path     []string
+	optional bool
+}
+
+// object keeps the order fields were first set in
+type object struct {
+	keys   []string
+	fields map[string]*value
+}
+
+func newObject() *object {
+	return &object{fields: make(map[string]*value)}
+}
+
+// set assigns v to key, objects are merged with an object already there and anything else replaces it
+func (o *object) set(key string, v *value) {
+	existing, ok := o.fields[key]
+	if !ok {
+		o.keys = append(o.keys, key)
+		o.fields[key] = v
+		return
+	}
+	if existing.kind == kindObject && v.kind == kindObject {
+		for _, k := range v.object.keys {
+			existing.object.set(k, v.object.fields[k])
+		}
+		return
+	}
+	o.fields[key] = v
+}
+
+// setPath assigns v under a key path, creating the objects in between
+func (o *object) setPath(path []string, v *value) {
+	for len(path) > 1 {
+		child, ok := o.fields[path[0]]
+		if !ok || child.kind != kindObject {
+			child = &value{kind: kindObject, object: newObject()}
+			o.set(path[0], child)
+		}
+		o = child.object
+		path = path[1:]
+	}
+	o.set(path[0], v)
+}
+
+func (o *object) lookup(path []string) (*value, bool) {
+	for i, key := range path {
+		v, ok := o.fields[key]
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			return v, true
+		}
+		if v.kind != kindObject {
+			return nil, false
+		}
+		o = v.object
+	}
+	return nil, false
+}
+
+// Assignment is where a setting with a value other than an object was written in the parsed file,
+// Start and End are byte offsets of the value
+type Assignment struct {
+	Path  []string
+	Start int
+	End   int
+}
+
+// Document is a parsed HOCON file
+type Document struct {
+	root *object
+	// Assignments lists the settings of the file itself, not of the files it includes
+	Assignments []Assignment
+	// Includes lists the files that were included, or skipped when the document was parsed without a file name
+	Includes []string
+}
+
+type parser struct {
+	data     []byte
+	pos      int
+	fileName string
+	doc      *Document
+	// record is false while parsing included files
+	record bool
+	depth  int
+}
+
+// maxIncludeDepth guards against files including each other
+const maxIncludeDepth = 10
+
+// ParseFile parses a HOCON file, includes are read relative to it
+func ParseFile(fileName string) (*Document, error) {
+	data, err := os.ReadFile(filepath.Clean(fileName))
+	if err != nil {
+		return nil, err
+	}
+	return parse(data, fileName, 0)
+}
+
+// Parse parses HOCON text without reading the files it includes
+func Parse(data []byte) (*Document, error) {
+	return parse(data, "", 0)
+}
+
+func parse(data []byte, fileName string, depth int) (*Document, error) {
+	doc := &Document{root: newObject()}
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	p := &parser{data: data, fileName: fileName, doc: doc, record: depth == 0, depth: depth}
+	p.skipSpace(true)
+	if p.peek() == '{' {
+		p.pos++
+		if err := p.parseFields(doc.root, nil, '}'); err != nil {
+			return nil, err
+		}
+		p.pos++
+		p.skipSpace(true)
+		if p.pos < len(p.data) {
+			return nil, p.errorf("unexpected %q after the root object", p.data[p.pos])
+		}
+	} else if err := p.parseFields(doc.root, nil, 0); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	line := 1 + strings.Count(string(p.data[:min(p.pos, len(p.data))]), "\n")
+	name := p.fileName
+	if name == "" {
+		name = "hocon"
+	}
+	return fmt.Errorf("%v line %v: %v", name, line, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) peek() byte {
+	if p.pos >= len(p.data) {
+		return 0
+	}
+	return p.data[p.pos]
+}
+
+func (p *parser) startsWith(s string) bool {
+	return strings.HasPrefix(string(p.data[p.pos:min(p.pos+len(s), len(p.data))]), s)
+}
+
+func (p *parser) atComment() bool {
+	return p.peek() == '#' || p.startsWith("//")
+}
+
+func (p *parser) skipComment() {
+	for p.pos < len(p.data) && p.data[p.pos] != '\n' {
+		p.pos++
+	}
+}
+
+// skipSpace skips whitespace and comments, newlines only when newlines is set
+func (p *parser) skipSpace(newlines bool) {
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			p.pos++
+		case c == '\n' && newlines:
+			p.pos++
+		case newlines && p.atComment():
+			p.skipComment()
+		default:
+			return
+		}
+	}
+}
+
+// skipSeparators skips whitespace, comments, newlines and commas between fields or elements
+func (p *parser) skipSeparators() {
+	for {
+		p.skipSpace(true)
+		if p.peek() != ',' {
+			return
+		}
+		p.pos++
+	}
+}
+
+// parseFields reads fields into o until the closing byte, 0 means the end of the file
+func (p *parser) parseFields(o *object, prefix []string, closing byte) error {
+	for {
+		p.skipSeparators()
+		if p.pos >= len(p.data) {
+			if closing != 0 {
+				return p.errorf("missing %q", closing)
+			}
+			return nil
+		}
+		if p.peek() == closing {
+			return nil
+		}
+		if p.startsWith("include") && p.isInclude() {
+			if err := p.parseInclude(o); err != nil {
+				return err
+			}
+			continue
+		}
+		key, err := p.parseKey()
+		if err != nil {
+			return err
+		}
+		path := append(append([]string{}, prefix...), key...)
+		p.skipSpace(false)
+		appendTo := false
+		switch {
+		case p.peek() == ':' || p.peek() == '=':
+			p.pos++
+		case p.startsWith("+="):
+			p.pos += 2
+			appendTo = true
+		case p.peek() == '{':
+		default:
+			return p.errorf("expected ':', '=' or '{' after %v", strings.Join(path, "."))
+		}
+		p.skipSpace(true)
+		start := p.pos
+		v, err := p.parseValue(path)
+		if err != nil {
+			return err
+		}
+		if v == nil {
+			return p.errorf("missing value for %v", strings.Join(path, "."))
+		}
+		if p.record && v.kind != kindObject {
+			p.doc.Assignments = append(p.doc.Assignments, Assignment{Path: path, Start: start, End: p.trimmedEnd(start)})
+		}
+		// the value a key refers to in its own setting is the one it had before
+		previous, _ := o.lookup(key)
+		v = replaceSelfReference(v, path, previous)
+		if appendTo {
+			v = appendValue(previous, v)
+		}
+		o.setPath(key, v)
+	}
+}
+
+// trimmedEnd is the current position without the trailing whitespace of the value
+func (p *parser) trimmedEnd(start int) int {
+	end := p.pos
+	for end > start && strings.ContainsRune(" \t\r", rune(p.data[end-1])) {
+		end--
+	}
+	return end
+}
+
+func (p *parser) isInclude() bool {
+	rest := p.data[p.pos+len("include"):]
+	if len(rest) == 0 || (rest[0] != ' ' && rest[0] != '\t') {
+		return false
+	}
+	trimmed := strings.TrimLeft(string(rest[:min(len(rest), 64)]), " \t")
+	for _, start := range []string{`"`, "file(", "required(", "url(", "classpath("} {
+		if strings.HasPrefix(trimmed, start) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInclude reads include "f", include file("f") and include required(...), url and classpath
+// includes cannot be read from a collected node and are skipped
+func (p *parser) parseInclude(o *object) error {
+	p.pos += len("include")
+	p.skipSpace(false)
+	required := false
+	kindOf := "file"
+	var closers int
+	for {
+		switch {
+		case p.startsWith("required("):
+			required = true
+			p.pos += len("required(")
+			closers++
+			continue
+		case p.startsWith("file("), p.startsWith("url("), p.startsWith("classpath("):
+			i := strings.IndexByte(string(p.data[p.pos:]), '(')
+			kindOf = string(p.data[p.pos : p.pos+i])
+			p.pos += i + 1
+			closers++
+			continue
+		}
+		break
+	}
+	p.skipSpace(false)
+	if p.peek() != '"' {
+		return p.errorf("expected a quoted file name after include")
+	}
+	name, err := p.parseQuoted()
+	if err != nil {
+		return err
+	}
+	for ; closers > 0; closers-- {
+		p.skipSpace(false)
+		if p.peek() != ')' {
+			return p.errorf("missing ')' after include %v", name)
+		}
+		p.pos++
+	}
+	if kindOf != "file" {
+		p.doc.Includes = append(p.doc.Includes, fmt.Sprintf("%v(%v) skipped", kindOf, name))
+		return nil
+	}
+	if p.fileName == "" {
+		p.doc.Includes = append(p.doc.Includes, name+" skipped")
+		return nil
+	}
+	includePath := name
+	if !filepath.IsAbs(includePath) {
+		includePath = filepath.Join(filepath.Dir(p.fileName), name)
+	}
+	if p.depth >= maxIncludeDepth {
+		return p.errorf("includes are nested more than %v deep at %v", maxIncludeDepth, name)
+	}
+	data, err := os.ReadFile(filepath.Clean(includePath))
+	if errors.Is(err, os.ErrNotExist) && !required {
+		p.doc.Includes = append(p.doc.Includes, includePath+" missing")
+		return nil
+	}
+	if err != nil {
+		return p.errorf("unable to include %v due to error %v", name, err)
+	}
+	included, err := parse(data, includePath, p.depth+1)
+	if err != nil {
+		return err
+	}
+	p.doc.Includes = append(p.doc.Includes, includePath)
+	p.doc.Includes = append(p.doc.Includes, included.Includes...)
+	for _, k := range included.root.keys {
+		o.set(k, included.root.fields[k])
+	}
+	return nil
+}
+
+// parseKey reads a key path such as a.b."c.d"
+func (p *parser) parseKey() ([]string, error) {
+	var path []string
+	var current strings.Builder
+	started := false
+	for p.pos < len(p.data) {
+		c := p.peek()
+		switch {
+		case c == '"':
+			s, err := p.parseQuoted()
+			if err != nil {
+				return nil, err
+			}
+			current.WriteString(s)
+			started = true
+			continue
+		case c == '.':
+			path = append(path, current.String())
+			current.Reset()
+			p.pos++
+			continue
+		case c == ' ' || c == '\t':
+			// whitespace inside a key is kept, around it is not
+			end := p.pos
+			p.skipSpace(false)
+			next := p.peek()
+			if next == ':' || next == '=' || next == '{' || p.startsWith("+=") || next == '\n' || next == 0 {
+				return finishKey(path, current.String(), started)
+			}
+			current.Write(p.data[end:p.pos])
+			continue
+		case c == ':' || c == '=' || c == '{' || p.startsWith("+="):
+			return finishKey(path, current.String(), started)
+		case strings.IndexByte("\n,}[]$#", c) >= 0 || p.startsWith("//"):
+			return nil, p.errorf("unexpected %q in key", c)
+		}
+		current.WriteByte(c)
+		started = true
+		p.pos++
+	}
+	return nil, p.errorf("unexpected end of file in key")
+}
+
+func finishKey(path []string, last string, started bool) ([]string, error) {
+	if !started && last == "" {
+		return nil, fmt.Errorf("empty key")
+	}
+	return append(path, last), nil
+}
+
+// parseQuoted reads a "string" or a """multi-line string"""
+func (p *parser) parseQuoted() (string, error) {
+	if p.startsWith(`"""`) {
+		p.pos += 3
+		end := strings.Index(string(p.data[p.pos:]), `"""`)
+		if end < 0 {
+			return "", p.errorf("missing closing \"\"\"")
+		}
+		end += p.pos
+		// extra quotes before the closing ones belong to the string
+		for end+3 < len(p.data) && p.data[end+3] == '"' {
+			end++
+		}
+		s := string(p.data[p.pos:end])
+		p.pos = end + 3
+		return s, nil
+	}
+	p.pos++
+	var b strings.Builder
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		switch c {
+		case '"':
+			p.pos++
+			return b.String(), nil
+		case '\n':
+			return "", p.errorf("newline in quoted string")
+		case '\\':
+			p.pos++
+			if p.pos >= len(p.data) {
+				return "", p.errorf("unfinished escape")
+			}
+			switch e := p.data[p.pos]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'u':
+				if p.pos+4 >= len(p.data) {
+					return "", p.errorf("unfinished unicode escape")
+				}
+				var r rune
+				if _, err := fmt.Sscanf(string(p.data[p.pos+1:p.pos+5]), "%04x", &r); err != nil {
+					return "", p.errorf("invalid unicode escape")
+				}
+				b.WriteRune(r)
+				p.pos += 4
+			default:
+				b.WriteByte(e)
+			}
+			p.pos++
+		default:
+			b.WriteByte(c)
+			p.pos++
+		}
+	}
+	return "", p.errorf("missing closing quote")
+}
+
+// parseValue reads the values on the rest of the line, several values next to each other are concatenated.
+// nil is returned when there is no value
+func (p *parser) parseValue(path []string) (*value, error) {
+	var parts []*value
+	for p.pos < len(p.data) {
+		c := p.peek()
+		if c == '\n' || c == ',' || c == '}' || c == ']' || p.atComment() {
+			break
+		}
+		var v *value
+		var err error
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			start := p.pos
+			p.skipSpace(false)
+			v = &value{kind: kindSpace, str: string(p.data[start:p.pos])}
+		case c == '{':
+			p.pos++
+			o := newObject()
+			if err := p.parseFields(o, path, '}'); err != nil {
+				return nil, err
+			}
+			p.pos++
+			v = &value{kind: kindObject, object: o}
+		case c == '[':
+			v, err = p.parseArray(path)
+		case c == '"':
+			var s string
+			s, err = p.parseQuoted()
+			v = &value{kind: kindString, str: s}
+		case p.startsWith("${"):
+			v, err = p.parseSubstitution()
+		default:
+			v = p.parseUnquoted()
+		}
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, v)
+	}
+	// whitespace around the values does not count
+	for len(parts) > 0 && parts[len(parts)-1].kind == kindSpace {
+		parts = parts[:len(parts)-1]
+	}
+	for len(parts) > 0 && parts[0].kind == kindSpace {
+		parts = parts[1:]
+	}
+	switch len(parts) {
+	case 0:
+		return nil, nil
+	case 1:
+		return parts[0], nil
+	}
+	return &value{kind: kindConcat, parts: parts}, nil
+}
+
+func (p *parser) parseArray(path []string) (*value, error) {
+	p.pos++
+	v := &value{kind: kindArray}
+	for {
+		p.skipSeparators()
+		if p.pos >= len(p.data) {
+			return nil, p.errorf("missing ']'")
+		}
+		if p.peek() == ']' {
+			p.pos++
+			return v, nil
+		}
+		element, err := p.parseValue(path)
+		if err != nil {
+			return nil, err
+		}
+		if element == nil {
+			return nil, p.errorf("unexpected %q in array", p.peek())
+		}
+		v.array = append(v.array, element)
+	}
+}
+
+func (p *parser) parseSubstitution() (*value, error) {
+	p.pos += 2
+	v := &value{kind: kindSubst}
+	if p.peek() == '?' {
+		v.optional = true
+		p.pos++
+	}
+	end := strings.IndexByte(string(p.data[p.pos:]), '}')
+	if end < 0 {
+		return nil, p.errorf("missing '}' in substitution")
+	}
+	inner := strings.TrimSpace(string(p.data[p.pos : p.pos+end]))
+	p.pos += end + 1
+	sub := &parser{data: []byte(inner + ":"), fileName: p.fileName}
+	path, err := sub.parseKey()
+	if err != nil || len(path) == 0 {
+		return nil, p.errorf("invalid substitution ${%v}", inner)
+	}
+	v.path = path
+	return v, nil
+}
+
+// parseUnquoted reads text up to the next character that ends an unquoted string, true, false, null and
+// numbers are typed when they make up the whole value
+func (p *parser) parseUnquoted() *value {
+	start := p.pos
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+		if strings.IndexByte(" \t\r\n,{}[]\"", c) >= 0 || p.startsWith("${") || p.atComment() {
+			break
+		}
+		p.pos++
+	}
+	if p.pos == start {
+		// a lone character such as $ that starts nothing
+		p.pos++
+	}
+	s := string(p.data[start:p.pos])
+	switch {
+	case s == "true" || s == "false":
+		return &value{kind: kindBool, str: s}
+	case s == "null":
+		return &value{kind: kindNull, str: s}
+	case isNumber(s):
+		return &value{kind: kindNumber, str: s}
+	}
+	return &value{kind: kindString, str: s}
+}
+
+func isNumber(s string) bool {
+	var f float64
+	_, err := fmt.Sscanf(s, "%g", &f)
+	if err != nil {
+		return false
+	}
+	return strings.Trim(s, "-+0123456789.eE") == ""
+}
+
+// replaceSelfReference swaps substitutions of path in a value being assigned to path for the value it had before
+func replaceSelfReference(v *value, path []string, previous *value) *value {
+	switch v.kind {
+	case kindSubst:
+		if strings.Join(v.path, ".") != strings.Join(path, ".") {
+			return v
+		}
+		if previous != nil {
+			return previous
+		}
+		return &value{kind: kindSubst, path: v.path, optional: true}
+	case kindConcat:
+		parts := make([]*value, len(v.parts))
+		for i, part := range v.parts {
+			parts[i] = replaceSelfReference(part, path, previous)
+		}
+		return &value{kind: kindConcat, parts: parts}
+	}
+	return v
+}
+
+// appendValue is a += b, which appends b to the array a
+func appendValue(previous, v *value) *value {
+	element := &value{kind: kindArray, array: []*value{v}}
+	if previous == nil {
+		return element
+	}
+	return &value{kind: kindConcat, parts: []*value{previous, element}}
+}
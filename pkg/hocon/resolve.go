@@ -0,0 +1,253 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package hocon parses the HOCON files Dremio is configured with, such as dremio.conf, resolving their
+// includes and substitutions and remembering where each setting was written so it can be masked in place
+package hocon
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type resolver struct {
+	root       *object
+	vars       map[string]string
+	resolving  map[*value]bool
+	paths      map[string]bool
+	unresolved map[string]bool
+	// envMask replaces the values found in the environment when it is set
+	envMask *string
+}
+
+// undefined is the result of an optional substitution that found nothing
+var undefined = &value{kind: kindNull, str: "undefined"}
+
+// Resolve substitutes ${path} and ${?path} and returns the effective configuration as json values:
+// map[string]interface{}, []interface{}, string, json.Number, bool and nil. A substitution not found in the
+// document is looked up in vars and then the environment, the ones found nowhere are left as written and listed
+func (d *Document) Resolve(vars map[string]string) (map[string]interface{}, []string, error) {
+	return d.resolve(&resolver{vars: vars})
+}
+
+// ResolveMaskingEnv is Resolve with every value taken from the environment replaced by mask, the environment
+// ddc runs in can hold credentials that are not written in the document
+func (d *Document) ResolveMaskingEnv(vars map[string]string, mask string) (map[string]interface{}, []string, error) {
+	return d.resolve(&resolver{vars: vars, envMask: &mask})
+}
+
+func (d *Document) resolve(r *resolver) (map[string]interface{}, []string, error) {
+	r.root = d.root
+	r.resolving = make(map[*value]bool)
+	r.paths = make(map[string]bool)
+	r.unresolved = make(map[string]bool)
+	resolved, err := r.object(d.root)
+	if err != nil {
+		return nil, nil, err
+	}
+	var unresolved []string
+	for k := range r.unresolved {
+		unresolved = append(unresolved, k)
+	}
+	sort.Strings(unresolved)
+	return resolved, unresolved, nil
+}
+
+func (r *resolver) object(o *object) (map[string]interface{}, error) {
+	out := make(map[string]interface{}, len(o.keys))
+	for _, k := range o.keys {
+		v, err := r.resolve(o.fields[k])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", k, err)
+		}
+		if v == undefined {
+			continue
+		}
+		j, err := r.toJSON(v)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", k, err)
+		}
+		out[k] = j
+	}
+	return out, nil
+}
+
+func (r *resolver) toJSON(v *value) (interface{}, error) {
+	switch v.kind {
+	case kindObject:
+		return r.object(v.object)
+	case kindArray:
+		out := make([]interface{}, 0, len(v.array))
+		for _, e := range v.array {
+			resolved, err := r.resolve(e)
+			if err != nil {
+				return nil, err
+			}
+			if resolved == undefined {
+				continue
+			}
+			j, err := r.toJSON(resolved)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, j)
+		}
+		return out, nil
+	case kindNumber:
+		return json.Number(v.str), nil
+	case kindBool:
+		return v.str == "true", nil
+	case kindNull:
+		return nil, nil
+	}
+	return v.str, nil
+}
+
+// resolve returns v with its substitutions and concatenations replaced, nested objects and arrays are
+// resolved when they are turned into json
+func (r *resolver) resolve(v *value) (*value, error) {
+	switch v.kind {
+	case kindSubst:
+		return r.substitute(v)
+	case kindConcat:
+		if r.resolving[v] {
+			return nil, fmt.Errorf("substitution cycle")
+		}
+		r.resolving[v] = true
+		defer delete(r.resolving, v)
+		var parts []*value
+		for _, part := range v.parts {
+			resolved, err := r.resolve(part)
+			if err != nil {
+				return nil, err
+			}
+			if resolved != undefined {
+				parts = append(parts, resolved)
+			}
+		}
+		return concatenate(parts)
+	}
+	return v, nil
+}
+
+func (r *resolver) substitute(v *value) (*value, error) {
+	name := strings.Join(v.path, ".")
+	if target, ok := r.root.lookup(v.path); ok {
+		if r.paths[name] {
+			return nil, fmt.Errorf("substitution cycle through ${%v}", name)
+		}
+		r.paths[name] = true
+		defer delete(r.paths, name)
+		return r.resolve(target)
+	}
+	if s, ok := r.vars[name]; ok {
+		return &value{kind: kindString, str: s}, nil
+	}
+	if s, ok := os.LookupEnv(name); ok {
+		if r.envMask != nil {
+			return &value{kind: kindString, str: *r.envMask}, nil
+		}
+		return &value{kind: kindString, str: s}, nil
+	}
+	if v.optional {
+		return undefined, nil
+	}
+	r.unresolved[name] = true
+	return &value{kind: kindString, str: "${" + name + "}"}, nil
+}
+
+// concatenate joins resolved values, strings and other simple values become one string, arrays are appended
+// and objects merged
+func concatenate(parts []*value) (*value, error) {
+	var values []*value
+	for _, p := range parts {
+		if p.kind != kindSpace {
+			values = append(values, p)
+		}
+	}
+	if len(values) == 0 {
+		if len(parts) == 0 {
+			return undefined, nil
+		}
+		return &value{kind: kindString, str: joinText(parts)}, nil
+	}
+	switch values[0].kind {
+	case kindArray:
+		out := &value{kind: kindArray}
+		for _, v := range values {
+			if v.kind != kindArray {
+				return nil, fmt.Errorf("cannot concatenate an array with a %v", describe(v))
+			}
+			out.array = append(out.array, v.array...)
+		}
+		return out, nil
+	case kindObject:
+		out := &value{kind: kindObject, object: newObject()}
+		for _, v := range values {
+			if v.kind != kindObject {
+				return nil, fmt.Errorf("cannot concatenate an object with a %v", describe(v))
+			}
+			for _, k := range v.object.keys {
+				out.object.set(k, v.object.fields[k])
+			}
+		}
+		return out, nil
+	}
+	if len(values) == 1 && len(parts) == 1 {
+		return values[0], nil
+	}
+	for _, v := range values {
+		if v.kind == kindArray || v.kind == kindObject {
+			return nil, fmt.Errorf("cannot concatenate a string with a %v", describe(v))
+		}
+	}
+	return &value{kind: kindString, str: joinText(parts)}, nil
+}
+
+func joinText(parts []*value) string {
+	var b strings.Builder
+	for _, p := range parts {
+		b.WriteString(p.str)
+	}
+	return b.String()
+}
+
+func describe(v *value) string {
+	switch v.kind {
+	case kindArray:
+		return "array"
+	case kindObject:
+		return "object"
+	}
+	return "string"
+}
+
+// Lookup finds a dotted path such as paths.local in a resolved configuration
+func Lookup(config map[string]interface{}, path string) (interface{}, bool) {
+	keys := strings.Split(path, ".")
+	var current interface{} = config
+	for _, k := range keys {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[k]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
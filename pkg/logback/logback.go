@@ -0,0 +1,175 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package logback reads the file appenders of a logback.xml or logback-access.xml so the logs
+// Dremio writes, and the archives they roll into, can be found wherever they were configured
+package logback
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// LogPathProperty is the system property Dremio sets to its log directory
+const LogPathProperty = "dremio.log.path"
+
+// Appender is an appender writing to a file, with the variables in its settings substituted
+type Appender struct {
+	Name  string
+	Class string
+	// File is the file being written to, it is empty when the rolling policy names the active file
+	File string
+	// FileNamePattern is the fileNamePattern of the rolling policy, empty when the file does not roll
+	FileNamePattern string
+	// Pattern is the layout of each line, empty when the encoder is not a pattern layout
+	Pattern string
+	// Undefined lists the variables of File and FileNamePattern that could not be resolved
+	Undefined []string
+}
+
+type appenderElement struct {
+	Name          string `xml:"name,attr"`
+	Class         string `xml:"class,attr"`
+	File          string `xml:"file"`
+	RollingPolicy struct {
+		FileNamePattern string `xml:"fileNamePattern"`
+	} `xml:"rollingPolicy"`
+	Encoder struct {
+		Pattern string `xml:"pattern"`
+		Layout  struct {
+			Pattern string `xml:"pattern"`
+		} `xml:"layout"`
+	} `xml:"encoder"`
+	Layout struct {
+		Pattern string `xml:"pattern"`
+	} `xml:"layout"`
+}
+
+type propertyElement struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+var variable = regexp.MustCompile(`\$\{([^}:]+)(?::-([^}]*))?\}`)
+
+// substitute replaces ${name} and ${name:-default} like logback does, looking in vars and then the
+// environment. The names that could not be resolved are returned
+func substitute(s string, vars map[string]string) (string, []string) {
+	var missing []string
+	out := variable.ReplaceAllStringFunc(s, func(m string) string {
+		parts := variable.FindStringSubmatch(m)
+		if v, ok := vars[parts[1]]; ok {
+			return v
+		}
+		if v, ok := os.LookupEnv(parts[1]); ok {
+			return v
+		}
+		if strings.Contains(m, ":-") {
+			return parts[2]
+		}
+		missing = append(missing, parts[1])
+		return parts[1] + "_IS_UNDEFINED"
+	})
+	return out, missing
+}
+
+// Parse finds the appenders of a logback configuration that write to files, wherever they are nested.
+// vars holds the system properties such as dremio.log.path, the <property> elements of the file are added
+// to them in order
+func Parse(data []byte, vars map[string]string) ([]Appender, error) {
+	props := make(map[string]string)
+	for k, v := range vars {
+		props[k] = v
+	}
+	var appenders []Appender
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to read logback configuration due to error %w", err)
+		}
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		switch start.Name.Local {
+		case "property", "variable":
+			var p propertyElement
+			if err := decoder.DecodeElement(&p, &start); err != nil {
+				return nil, fmt.Errorf("unable to read logback property due to error %w", err)
+			}
+			if p.Name != "" {
+				props[p.Name], _ = substitute(p.Value, props)
+			}
+		case "appender":
+			var e appenderElement
+			if err := decoder.DecodeElement(&e, &start); err != nil {
+				return nil, fmt.Errorf("unable to read logback appender due to error %w", err)
+			}
+			file, missingFile := substitute(strings.TrimSpace(e.File), props)
+			fileNamePattern, missingPattern := substitute(strings.TrimSpace(e.RollingPolicy.FileNamePattern), props)
+			if file == "" && fileNamePattern == "" {
+				// console, syslog and async appenders
+				continue
+			}
+			if file != "" {
+				file = filepath.Clean(file)
+			}
+			pattern := e.Encoder.Pattern
+			if pattern == "" {
+				pattern = e.Encoder.Layout.Pattern
+			}
+			if pattern == "" {
+				pattern = e.Layout.Pattern
+			}
+			appenders = append(appenders, Appender{
+				Name:            e.Name,
+				Class:           e.Class,
+				File:            file,
+				FileNamePattern: fileNamePattern,
+				Pattern:         strings.TrimSpace(pattern),
+				Undefined:       append(missingFile, missingPattern...),
+			})
+		}
+	}
+	return appenders, nil
+}
+
+// ParseFile is Parse for a logback.xml on disk
+func ParseFile(fileName string, vars map[string]string) ([]Appender, error) {
+	data, err := os.ReadFile(filepath.Clean(fileName))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, vars)
+}
+
+// FindByFile returns the appender writing to a file with the given base name such as server.log
+func FindByFile(appenders []Appender, baseName string) (Appender, bool) {
+	for _, a := range appenders {
+		if a.File != "" && filepath.Base(a.File) == baseName {
+			return a, true
+		}
+	}
+	return Appender{}, false
+}
@@ -0,0 +1,152 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logback
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseFile(t *testing.T) {
+	appenders, err := ParseFile(filepath.Join("testdata", "logback.xml"), map[string]string{LogPathProperty: "/var/log/dremio"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := []Appender{
+		{
+			Name:            "text",
+			Class:           "ch.qos.logback.core.rolling.RollingFileAppender",
+			File:            "/var/log/dremio/server.log",
+			FileNamePattern: "/var/log/dremio/rolled/server.%d{yyyy-MM-dd}.%i.log.gz",
+			Pattern:         "%date{ISO8601} [%thread] %-5level %logger{36} - %msg%n",
+		},
+		{
+			Name:            "query",
+			Class:           "ch.qos.logback.core.rolling.RollingFileAppender",
+			File:            "/var/log/dremio/queries.json",
+			FileNamePattern: "/var/log/dremio/archive/queries.%d{yyyy-MM-dd}.json.gz",
+			Pattern:         "%msg%n",
+		},
+		{
+			Name:            "tracker",
+			Class:           "ch.qos.logback.core.rolling.RollingFileAppender",
+			FileNamePattern: "/opt/tracker/tracker.%d{yyyy-MM-dd_HH, UTC}.log",
+			Pattern:         "%d %-5level %msg%n",
+		},
+		{
+			Name:      "sifted",
+			Class:     "ch.qos.logback.core.FileAppender",
+			File:      "/var/log/dremio/queryId_IS_UNDEFINED.log",
+			Undefined: []string{"queryId"},
+		},
+	}
+	if !reflect.DeepEqual(appenders, expected) {
+		t.Errorf("expected\n%#v\nbut was\n%#v", expected, appenders)
+	}
+	if a, ok := FindByFile(appenders, "queries.json"); !ok || a.Name != "query" {
+		t.Errorf("expected to find the query appender but was %#v", a)
+	}
+	if _, ok := FindByFile(appenders, "reflection.log"); ok {
+		t.Error("expected no appender for reflection.log")
+	}
+}
+
+func TestParseInvalidXML(t *testing.T) {
+	if _, err := Parse([]byte("<configuration><appender>"), nil); err == nil {
+		t.Error("expected an error for a truncated file")
+	}
+}
+
+func TestFileNamePatternPeriod(t *testing.T) {
+	p, err := CompileFileNamePattern("/var/log/dremio/archive/server.%d{yyyy-MM-dd}.%i.log.gz")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	start, end, ok := p.Period("/var/log/dremio/archive/server.2024-01-02.3.log.gz")
+	if !ok {
+		t.Fatal("expected the archive to match")
+	}
+	if !start.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)) || !end.Equal(time.Date(2024, 1, 3, 0, 0, 0, 0, time.Local)) {
+		t.Errorf("unexpected period %v to %v", start, end)
+	}
+	for _, name := range []string{"/var/log/dremio/archive/server.2024-01-02.log.gz", "/var/log/dremio/archive/server.2024-01-02.x.log.gz", "/var/log/dremio/archive/reflection.2024-01-02.1.log.gz"} {
+		if p.Match(name) {
+			t.Errorf("expected %v not to match", name)
+		}
+	}
+	if p.Dir() != "/var/log/dremio/archive" {
+		t.Errorf("unexpected dir %v", p.Dir())
+	}
+}
+
+func TestFileNamePatternHourlyWithTimeZoneAndAux(t *testing.T) {
+	p, err := CompileFileNamePattern("/logs/%d{yyyy/MM, aux}/tracker.%d{yyyy-MM-dd_HH, UTC}.log")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	start, end, ok := p.Period("/logs/2024/01/tracker.2024-01-02_13.log")
+	if !ok {
+		t.Fatal("expected the archive to match")
+	}
+	if !start.Equal(time.Date(2024, 1, 2, 13, 0, 0, 0, time.UTC)) || end.Sub(start) != time.Hour {
+		t.Errorf("unexpected period %v to %v", start, end)
+	}
+	if p.Dir() != "/logs" {
+		t.Errorf("unexpected dir %v", p.Dir())
+	}
+}
+
+func TestFileNamePatternWithoutDate(t *testing.T) {
+	p, err := CompileFileNamePattern("/logs/server.%i.log.gz")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !p.Match("/logs/server.12.log.gz") {
+		t.Error("expected the archive to match")
+	}
+	if _, _, ok := p.Period("/logs/server.12.log.gz"); ok {
+		t.Error("expected no period without a date")
+	}
+}
+
+func TestFileNamePatternGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"server.2024-01-02.1.log.gz", "server.2024-01-02.2.log.gz", "server.log", "notes.txt"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := CompileFileNamePattern(filepath.Join(dir, "server.%d.%i.log.gz"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	candidates, err := p.Glob()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var matched []string
+	for _, c := range candidates {
+		if p.Match(c) {
+			matched = append(matched, filepath.Base(c))
+		}
+	}
+	expected := []string{"server.2024-01-02.1.log.gz", "server.2024-01-02.2.log.gz"}
+	if !reflect.DeepEqual(matched, expected) {
+		t.Errorf("expected %v but was %v", expected, matched)
+	}
+}
@@ -0,0 +1,210 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logback
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// java SimpleDateFormat tokens to the go layout and a regex that matches them, longest first
+var dateTokens = []struct {
+	java  string
+	local string
+	re    string
+}{
+	{"yyyy", "2006", `\d{4}`},
+	{"yy", "06", `\d{2}`},
+	{"MM", "01", `\d{2}`},
+	{"dd", "02", `\d{2}`},
+	{"HH", "15", `\d{2}`},
+	{"mm", "04", `\d{2}`},
+	{"ss", "05", `\d{2}`},
+	{"SSS", "000", `\d{3}`},
+	{"XXX", "Z07:00", `(?:Z|[+-]\d{2}:\d{2})`},
+	{"Z", "-0700", `[+-]\d{4}`},
+}
+
+// DateFormat converts a java SimpleDateFormat, or the ISO8601 and ABSOLUTE names logback accepts,
+// to a go time layout and a regex matching it
+func DateFormat(format string) (string, string) {
+	format = strings.TrimSpace(format)
+	switch format {
+	case "", "ISO8601":
+		format = "yyyy-MM-dd HH:mm:ss,SSS"
+	case "ABSOLUTE":
+		format = "HH:mm:ss,SSS"
+	}
+	format = strings.Trim(format, `"'`)
+	var layout, re strings.Builder
+	for i := 0; i < len(format); {
+		matched := false
+		for _, t := range dateTokens {
+			if strings.HasPrefix(format[i:], t.java) {
+				layout.WriteString(t.local)
+				re.WriteString(t.re)
+				i += len(t.java)
+				matched = true
+				break
+			}
+		}
+		if matched {
+			continue
+		}
+		c := format[i : i+1]
+		if c == "'" {
+			i++
+			continue
+		}
+		layout.WriteString(c)
+		re.WriteString(regexp.QuoteMeta(c))
+		i++
+	}
+	return layout.String(), re.String()
+}
+
+// FileNamePattern is a compiled rolling policy fileNamePattern such as
+// /var/log/dremio/archive/server.%d{yyyy-MM-dd}.%i.log.gz
+type FileNamePattern struct {
+	glob     string
+	re       *regexp.Regexp
+	layout   string
+	location *time.Location
+	period   func(time.Time) time.Time
+}
+
+var fileNameToken = regexp.MustCompile(`%(d|i)(?:\{([^}]*)\})?`)
+
+// periodOf finds the rollover period from the finest unit of a go layout
+func periodOf(layout string) func(time.Time) time.Time {
+	switch {
+	case strings.Contains(layout, "05"):
+		return func(t time.Time) time.Time { return t.Add(time.Second) }
+	case strings.Contains(layout, "04"):
+		return func(t time.Time) time.Time { return t.Add(time.Minute) }
+	case strings.Contains(layout, "15"):
+		return func(t time.Time) time.Time { return t.Add(time.Hour) }
+	case strings.Contains(layout, "02"):
+		return func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+	case strings.Contains(layout, "01"):
+		return func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	default:
+		return func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }
+	}
+}
+
+// CompileFileNamePattern understands %d{format[, timezone]}, where only the first %d without the aux
+// option names the period, and the %i index of size based rolling. A * matches anything which lets
+// callers describe archives that have no appender
+func CompileFileNamePattern(pattern string) (*FileNamePattern, error) {
+	pattern = filepath.Clean(pattern)
+	p := &FileNamePattern{location: time.Local}
+	var glob, re strings.Builder
+	re.WriteString("^")
+	last := 0
+	literal := func(s string) {
+		glob.WriteString(s)
+		re.WriteString(strings.ReplaceAll(regexp.QuoteMeta(s), `\*`, ".*"))
+	}
+	for _, loc := range fileNameToken.FindAllStringSubmatchIndex(pattern, -1) {
+		literal(pattern[last:loc[0]])
+		last = loc[1]
+		glob.WriteString("*")
+		if pattern[loc[2]:loc[3]] == "i" {
+			re.WriteString(`\d+`)
+			continue
+		}
+		var args []string
+		if loc[4] >= 0 {
+			args = strings.Split(pattern[loc[4]:loc[5]], ",")
+		}
+		format := ""
+		var options []string
+		if len(args) > 0 {
+			format, options = args[0], args[1:]
+		}
+		aux := false
+		location := time.Local
+		for _, option := range options {
+			option = strings.TrimSpace(option)
+			if option == "aux" {
+				aux = true
+			} else if l, err := time.LoadLocation(option); err == nil {
+				location = l
+			} else {
+				return nil, fmt.Errorf("unknown time zone %v in %v", option, pattern)
+			}
+		}
+		if strings.TrimSpace(format) == "" {
+			format = "yyyy-MM-dd"
+		}
+		layout, dateRe := DateFormat(format)
+		if aux || p.layout != "" {
+			re.WriteString(dateRe)
+			continue
+		}
+		p.layout = layout
+		p.location = location
+		p.period = periodOf(layout)
+		re.WriteString("(" + dateRe + ")")
+	}
+	literal(pattern[last:])
+	re.WriteString("$")
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile file name pattern %v due to error %w", pattern, err)
+	}
+	p.re = compiled
+	p.glob = glob.String()
+	return p, nil
+}
+
+// Glob lists the candidates for the pattern, Match must still be checked for each
+func (p *FileNamePattern) Glob() ([]string, error) {
+	return filepath.Glob(p.glob)
+}
+
+// Dir is the directory the files are rolled into, or its first fixed parent when the directory names hold the date
+func (p *FileNamePattern) Dir() string {
+	static := p.glob
+	if i := strings.Index(static, "*"); i >= 0 {
+		static = static[:i]
+	}
+	return filepath.Dir(static)
+}
+
+// Match reports whether fileName was written by the pattern
+func (p *FileNamePattern) Match(fileName string) bool {
+	return p.re.MatchString(fileName)
+}
+
+// Period returns the time range a rolled file covers, false when the pattern has no date
+func (p *FileNamePattern) Period(fileName string) (time.Time, time.Time, bool) {
+	if p.layout == "" {
+		return time.Time{}, time.Time{}, false
+	}
+	m := p.re.FindStringSubmatch(fileName)
+	if m == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start, err := time.ParseInLocation(p.layout, m[1], p.location)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, p.period(start), true
+}
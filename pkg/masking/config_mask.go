@@ -17,13 +17,17 @@ package masking
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/dremio/dremio-diagnostic-collector/cmd/local/conf"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/hocon"
 	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
 )
 
@@ -96,47 +100,175 @@ func MaskPAT(line string) string {
 	return line
 }
 
+// DremioConfResolvedFileName is the masked json view of dremio.conf with includes and substitutions resolved
+const DremioConfResolvedFileName = "dremio.conf.resolved.json"
+
+const removedSecret = "<REMOVED_POTENTIAL_SECRET>"
+
+// secretSettingKeywords mark a single setting as a secret, unlike secretKeywords they do not mask a whole
+// object as objects such as auth.personal-access-tokens hold settings that are not secret
+var secretSettingKeywords = []string{"token", "credential"}
+
+// isSecretSetting is true when the name of a setting such as provisioning.token looks like it holds a
+// credential, names such as tokenType or credentialMode that tell the kind of credential are kept
+func isSecretSetting(key string) bool {
+	lower := strings.ToLower(key)
+	for _, suffix := range secretCatalogSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return false
+		}
+	}
+	for _, keyword := range secretSettingKeywords {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSecretPath is true when any key on the way to a setting looks like it holds a secret, so every
+// setting of an object such as javax.net.ssl.keyStorePassword or secrets { aws: ... } is masked
+func isSecretPath(path []string) bool {
+	for _, key := range path {
+		if checkStringForSecret(key) {
+			return true
+		}
+	}
+	return len(path) > 0 && isSecretSetting(path[len(path)-1])
+}
+
+// maskHocon replaces the values of the secret settings in dremio.conf and leaves the rest of the
+// file, comments and layout included, as it was
+func maskHocon(data []byte) ([]byte, error) {
+	doc, err := hocon.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	var spans []hocon.Assignment
+	for _, a := range doc.Assignments {
+		if isSecretPath(a.Path) {
+			spans = append(spans, a)
+		}
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i].Start < spans[j].Start
+	})
+	var masked bytes.Buffer
+	last := 0
+	for _, a := range spans {
+		if a.Start < last {
+			continue
+		}
+		masked.Write(data[last:a.Start])
+		masked.WriteString(`"` + removedSecret + `"`)
+		last = a.End
+	}
+	masked.Write(data[last:])
+	return masked.Bytes(), nil
+}
+
+// maskLines is the line based masking used when dremio.conf cannot be parsed
+func maskLines(data []byte) []byte {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	// This slice will hold all the lines from the file, after potentially modifying them
+	cleansedData := []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		// If the line contains a potential secret, mask the secret
+		if checkStringForSecret(line) {
+			line = maskConfigSecret(line)
+		}
+		cleansedData = append(cleansedData, line)
+	}
+	return []byte(strings.Join(cleansedData, "\n"))
+}
+
 // RemoveSecretsFromDremioConf takes a configuration file as an input and masks any potential secrets.
 // It returns an error if it encounters any issue during the process.
 func RemoveSecretsFromDremioConf(configFile string) error {
 	// Check if the input file is a Dremio configuration file
-	if strings.HasSuffix(configFile, "dremio.conf") {
-		simplelog.Debugf("... Removing potential secrets from %s\n", configFile)
-
-		// Open the file. Clean the configFile path before opening to remove any relative or redundant path elements.
-		// If there is an issue opening the file, an error is returned.
-		file, err := os.Open(path.Clean(configFile))
-		if err != nil {
-			return fmt.Errorf("unable to open file %v with error %v", configFile, err)
-		}
-		scanner := bufio.NewScanner(file)
-
-		// This slice will hold all the lines from the file, after potentially modifying them
-		cleansedData := []string{}
+	if !strings.HasSuffix(configFile, "dremio.conf") {
+		return fmt.Errorf("expected file with name '%s', got '%s' instead", "dremio.conf", configFile)
+	}
+	simplelog.Debugf("... Removing potential secrets from %s\n", configFile)
+	data, err := os.ReadFile(path.Clean(configFile))
+	if err != nil {
+		return fmt.Errorf("unable to open file %v with error %v", configFile, err)
+	}
+	cleansedData, err := maskHocon(data)
+	if err != nil {
+		simplelog.Warningf("unable to parse %v, falling back to masking line by line due to error %v", configFile, err)
+		cleansedData = maskLines(data)
+	}
+	if err := os.WriteFile(configFile, cleansedData, 0600); err != nil {
+		return fmt.Errorf("unable to write new file %v due to error %v", configFile, err)
+	}
+	return nil
+}
 
-		for scanner.Scan() {
-			line := scanner.Text()
-			// If the line contains a potential secret, mask the secret
-			if checkStringForSecret(line) {
-				line = maskConfigSecret(line)
+// maskResolved masks the secret settings of a resolved configuration in place, including the ones of
+// objects in arrays such as services.coordinator.web.auth.configs
+func maskResolved(v interface{}) {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, child := range value {
+			if checkStringForSecret(k) {
+				value[k] = removedSecret
+				continue
 			}
-			cleansedData = append(cleansedData, line)
+			if _, ok := child.(string); ok && isSecretSetting(k) {
+				value[k] = removedSecret
+				continue
+			}
+			maskResolved(child)
 		}
-
-		// Close the file and check for any errors. If there is an issue closing the file, an error is returned.
-		if err := file.Close(); err != nil {
-			return fmt.Errorf("unable to close file %v due to error %v", configFile, err)
+	case []interface{}:
+		for _, child := range value {
+			maskResolved(child)
 		}
+	}
+}
 
-		// Write the contents of cleansedData back into the file.
-		// If there is an issue writing to the file, an error is returned.
-		if err := os.WriteFile(configFile, []byte(strings.Join(cleansedData, "\n")), 0600); err != nil {
-			return fmt.Errorf("unable to write new file %v due to error %v", configFile, err)
-		}
-	} else {
-		// If the configFile does not end with "dremio.conf", an error is returned.
-		return fmt.Errorf("expected file with name '%s', got '%s' instead", "dremio.conf", configFile)
+// WriteResolvedDremioConf reads confFile with its includes, resolves the substitutions with vars and
+// the environment and writes the effective configuration with the secrets and the values taken from the
+// environment masked to outFile as json
+func WriteResolvedDremioConf(confFile, outFile string, vars map[string]string) error {
+	doc, err := hocon.ParseFile(confFile)
+	if err != nil {
+		return fmt.Errorf("unable to parse %v due to error %v", confFile, err)
+	}
+	config, unresolved, err := doc.ResolveMaskingEnv(vars, removedSecret)
+	if err != nil {
+		return fmt.Errorf("unable to resolve %v due to error %v", confFile, err)
+	}
+	maskResolved(config)
+	if unresolved == nil {
+		unresolved = []string{}
+	}
+	includes := doc.Includes
+	if includes == nil {
+		includes = []string{}
+	}
+	resolved := struct {
+		Source     string                 `json:"source"`
+		Includes   []string               `json:"includes"`
+		Unresolved []string               `json:"unresolved"`
+		Config     map[string]interface{} `json:"config"`
+	}{
+		Source:     confFile,
+		Includes:   includes,
+		Unresolved: unresolved,
+		Config:     config,
+	}
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(resolved); err != nil {
+		return fmt.Errorf("unable to marshal %v due to error %v", outFile, err)
+	}
+	if err := os.WriteFile(path.Clean(outFile), data.Bytes(), 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", outFile, err)
 	}
-	// If all steps complete without error, return nil to indicate success
 	return nil
 }
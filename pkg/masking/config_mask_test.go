@@ -15,6 +15,7 @@
 package masking_test
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
@@ -113,3 +114,152 @@ func TestPATMask(t *testing.T) {
 		t.Errorf("\nexpected %v\nreturned %v\n", expected, returned)
 	}
 }
+
+func writeDremioConf(t *testing.T, conf string) string {
+	t.Helper()
+	tmpfile := filepath.Join(t.TempDir(), "dremio.conf")
+	if err := os.WriteFile(tmpfile, []byte(conf), 0600); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return tmpfile
+}
+
+func TestConfig_WhenRemoveSecretsFromDremioConfWithHoconSyntax(t *testing.T) {
+	conf := `# a comment about the secret: keep me
+services.coordinator.web.ssl.keyStorePassword = "hunter2"
+secrets {
+  aws {
+    access_key: AKIAEXAMPLE
+    region = us-west-2
+  }
+}
+paths.local = "/var/lib/dremio"
+store.password = """multi
+line secret"""
+store.users: [ "a", "b" ]
+`
+	tmpfile := writeDremioConf(t, conf)
+	if err := masking.RemoveSecretsFromDremioConf(tmpfile); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	cleaned, err := os.ReadFile(tmpfile)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := `# a comment about the secret: keep me
+services.coordinator.web.ssl.keyStorePassword = "<REMOVED_POTENTIAL_SECRET>"
+secrets {
+  aws {
+    access_key: "<REMOVED_POTENTIAL_SECRET>"
+    region = "<REMOVED_POTENTIAL_SECRET>"
+  }
+}
+paths.local = "/var/lib/dremio"
+store.password = "<REMOVED_POTENTIAL_SECRET>"
+store.users: [ "a", "b" ]
+`
+	if string(cleaned) != expected {
+		t.Errorf("\nexpected\n%v\nreturned\n%v", expected, string(cleaned))
+	}
+}
+
+func TestConfig_WhenRemoveSecretsFromDremioConfCannotParse(t *testing.T) {
+	tmpfile := writeDremioConf(t, "services {\n  keyStorePassword: \"why\"\n")
+	if err := masking.RemoveSecretsFromDremioConf(tmpfile); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	cleaned, err := os.ReadFile(tmpfile)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if strings.Contains(string(cleaned), "why") {
+		t.Errorf("password was not masked in %v", string(cleaned))
+	}
+}
+
+func TestWriteResolvedDremioConf(t *testing.T) {
+	t.Setenv("DDC_TEST_STORE_PASSWORD", "from the env")
+	conf := `paths {
+  local: ${DREMIO_HOME}"/data"
+  dist: "pdfs://"${paths.local}"/pdfs"
+}
+services.coordinator.web.ssl.trustStorePassword: ${?DDC_TEST_STORE_PASSWORD}
+services.executor.enabled = false
+debug.token = ${NOT_SET_ANYWHERE}
+`
+	tmpfile := writeDremioConf(t, conf)
+	out := filepath.Join(t.TempDir(), masking.DremioConfResolvedFileName)
+	if err := masking.WriteResolvedDremioConf(tmpfile, out, map[string]string{"DREMIO_HOME": "/opt/dremio"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var resolved struct {
+		Source     string                 `json:"source"`
+		Unresolved []string               `json:"unresolved"`
+		Config     map[string]interface{} `json:"config"`
+	}
+	if err := json.Unmarshal(data, &resolved); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if resolved.Source != tmpfile {
+		t.Errorf("expected source %v but was %v", tmpfile, resolved.Source)
+	}
+	paths := resolved.Config["paths"].(map[string]interface{})
+	if paths["dist"] != "pdfs:///opt/dremio/data/pdfs" {
+		t.Errorf("expected paths.dist to be resolved but was %v", paths["dist"])
+	}
+	if strings.Contains(string(data), "from the env") {
+		t.Errorf("trustStorePassword was not masked in %v", string(data))
+	}
+	if !strings.Contains(string(data), `"trustStorePassword": "<REMOVED_POTENTIAL_SECRET>"`) {
+		t.Errorf("trustStorePassword missing from %v", string(data))
+	}
+	if len(resolved.Unresolved) != 1 || resolved.Unresolved[0] != "NOT_SET_ANYWHERE" {
+		t.Errorf("expected NOT_SET_ANYWHERE to be unresolved but was %v", resolved.Unresolved)
+	}
+}
+
+func TestWriteResolvedDremioConfMasksArraysAndTheEnvironment(t *testing.T) {
+	t.Setenv("DDC_TEST_PROVISIONING_TOKEN", "tok-from-env")
+	t.Setenv("DDC_TEST_UPLOAD_DIR", "/mnt/from-env")
+	conf := `services.coordinator.web.auth.configs = [ { type: oauth, clientSecret: "s3cr3t" } ]
+provisioning.token = ${?DDC_TEST_PROVISIONING_TOKEN}
+provisioning.tokenType = "PAT"
+paths.uploads = ${?DDC_TEST_UPLOAD_DIR}"/uploads"
+paths.local = ${DREMIO_HOME}"/data"
+`
+	tmpfile := writeDremioConf(t, conf)
+	out := filepath.Join(t.TempDir(), masking.DremioConfResolvedFileName)
+	if err := masking.WriteResolvedDremioConf(tmpfile, out, map[string]string{"DREMIO_HOME": "/opt/dremio"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, secret := range []string{"s3cr3t", "tok-from-env", "/mnt/from-env"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("expected %v to be masked in %v", secret, string(data))
+		}
+	}
+	for _, kept := range []string{`"type": "oauth"`, `"tokenType": "PAT"`, `"uploads": "<REMOVED_POTENTIAL_SECRET>/uploads"`, `"local": "/opt/dremio/data"`} {
+		if !strings.Contains(string(data), kept) {
+			t.Errorf("expected %v in %v", kept, string(data))
+		}
+	}
+
+	// the masked dremio.conf agrees with the resolved view on the token
+	if err := masking.RemoveSecretsFromDremioConf(tmpfile); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	masked, err := os.ReadFile(tmpfile)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if strings.Contains(string(masked), "DDC_TEST_PROVISIONING_TOKEN") || strings.Contains(string(masked), "s3cr3t") {
+		t.Errorf("expected the token and client secret to be masked in %v", string(masked))
+	}
+}
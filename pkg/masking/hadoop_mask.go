@@ -0,0 +1,148 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// masking hides secrets in files and replaces them with redacted text
+package masking
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// secretHadoopKeywords are parts of Hadoop property names that hold credentials, on top of the
+// keywords used for dremio.conf, e.g. fs.azure.account.key.<account>, fs.azure.sas.<container> or
+// hadoop.security.credential.provider.path
+var secretHadoopKeywords = []string{
+	"access.key",
+	"account.key",
+	"credential.provider",
+	"token",
+}
+
+// IsSecretHadoopProperty is true when the Hadoop property name looks like it holds a credential, properties
+// naming an implementation class are kept as they are needed to tell how a filesystem authenticates
+func IsSecretHadoopProperty(name string) bool {
+	if strings.HasSuffix(name, ".impl") || strings.HasSuffix(name, ".class") {
+		return false
+	}
+	if checkStringForSecret(name) {
+		return true
+	}
+	lower := strings.ToLower(name)
+	for _, keyword := range secretHadoopKeywords {
+		if strings.Contains(lower, keyword) {
+			return true
+		}
+	}
+	for _, part := range strings.Split(lower, ".") {
+		if part == "sas" {
+			return true
+		}
+	}
+	return false
+}
+
+// span is the byte range of the text of a <value> element
+type span struct {
+	start int
+	end   int
+}
+
+// MaskHadoopXML replaces the values of the secret properties of a Hadoop style configuration
+// (core-site.xml, hive-site.xml and so on), the rest of the document is left as it was
+func MaskHadoopXML(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = false
+	var elements []string
+	var name strings.Builder
+	var value span
+	var valueStart int
+	var masks []span
+	for {
+		offset := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			elements = append(elements, t.Name.Local)
+			switch t.Name.Local {
+			case "property":
+				name.Reset()
+				value = span{}
+			case "value":
+				valueStart = int(decoder.InputOffset())
+			}
+		case xml.EndElement:
+			if len(elements) > 0 {
+				elements = elements[:len(elements)-1]
+			}
+			switch t.Name.Local {
+			case "value":
+				value = span{start: valueStart, end: offset}
+			case "property":
+				if value.end > value.start && IsSecretHadoopProperty(strings.TrimSpace(name.String())) {
+					masks = append(masks, value)
+				}
+			}
+		case xml.CharData:
+			if len(elements) >= 2 && elements[len(elements)-1] == "name" && elements[len(elements)-2] == "property" {
+				name.Write(t)
+			}
+		}
+	}
+	if len(elements) > 0 {
+		return nil, fmt.Errorf("unexpected end of document inside <%v>", elements[len(elements)-1])
+	}
+	var masked bytes.Buffer
+	last := 0
+	for _, m := range masks {
+		masked.Write(data[last:m.start])
+		if err := xml.EscapeText(&masked, []byte(removedSecret)); err != nil {
+			return nil, err
+		}
+		last = m.end
+	}
+	masked.Write(data[last:])
+	return masked.Bytes(), nil
+}
+
+// RemoveSecretsFromHadoopXML masks the secret properties of a Hadoop style xml configuration in place
+func RemoveSecretsFromHadoopXML(configFile string) error {
+	simplelog.Debugf("... Removing potential secrets from %s", configFile)
+	data, err := os.ReadFile(path.Clean(configFile))
+	if err != nil {
+		return fmt.Errorf("unable to open file %v with error %v", configFile, err)
+	}
+	masked, err := MaskHadoopXML(data)
+	if err != nil {
+		return fmt.Errorf("unable to parse %v due to error %v", configFile, err)
+	}
+	if err := os.WriteFile(configFile, masked, 0600); err != nil {
+		return fmt.Errorf("unable to write new file %v due to error %v", configFile, err)
+	}
+	return nil
+}
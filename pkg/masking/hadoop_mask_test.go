@@ -0,0 +1,82 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package masking_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/masking"
+)
+
+func TestMaskHadoopXML(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "core-site.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	masked, err := masking.MaskHadoopXML(data)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	text := string(masked)
+	for _, secret := range []string{"AKIAEXAMPLE", "abc&def", "sig=abc", "creds.jceks"} {
+		if strings.Contains(text, secret) {
+			t.Errorf("expected %v to be masked in\n%v", secret, text)
+		}
+	}
+	for _, kept := range []string{
+		"<!-- fs.s3a.secret.key is set below -->",
+		"<value>hdfs://namenode:8020</value>",
+		"<value>3</value>",
+		"<value/>",
+		"<description>the sas token</description>",
+		"<value>&lt;REMOVED_POTENTIAL_SECRET&gt;</value>\n    <name>fs.s3a.secret.key</name>",
+	} {
+		if !strings.Contains(text, kept) {
+			t.Errorf("expected %q in\n%v", kept, text)
+		}
+	}
+	if strings.Count(text, "REMOVED_POTENTIAL_SECRET") != 4 {
+		t.Errorf("expected 4 masked values in\n%v", text)
+	}
+}
+
+func TestMaskHadoopXMLWithBrokenXML(t *testing.T) {
+	if _, err := masking.MaskHadoopXML([]byte("<configuration><property><name>a.password</name>")); err == nil {
+		t.Error("expected an error for a truncated document")
+	}
+}
+
+func TestIsSecretHadoopProperty(t *testing.T) {
+	tests := map[string]bool{
+		"fs.s3a.secret.key": true,
+		"fs.s3a.access.key": true,
+		"fs.azure.account.key.acct.dfs.core.windows.net": true,
+		"fs.azure.sas.c.acct.blob.core.windows.net":      true,
+		"hive.metastore.sasl.enabled":                    false,
+		"hadoop.security.credential.provider.path":       true,
+		"ssl.client.truststore.password":                 true,
+		"fs.gs.auth.access.token.provider.impl":          false,
+		"fs.defaultFS":                                   false,
+		"dfs.replication":                                false,
+	}
+	for name, expected := range tests {
+		if actual := masking.IsSecretHadoopProperty(name); actual != expected {
+			t.Errorf("%v: expected %v but was %v", name, expected, actual)
+		}
+	}
+}
@@ -34,3 +34,22 @@ func PromptForPAT() (string, error) {
 
 	return result, nil
 }
+
+// PromptForPassword asks for the password the dremio-username logs in to the REST api with
+func PromptForPassword(username string) (string, error) {
+	label := "Enter Dremio password"
+	if username != "" {
+		label = fmt.Sprintf("Enter Dremio password for %v", username)
+	}
+	prompt := promptui.Prompt{
+		Label: label,
+		Mask:  '*',
+	}
+
+	result, err := prompt.Run()
+	if err != nil {
+		return "", fmt.Errorf("prompt failed %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,221 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package parquet writes flat tables of nullable columns to Apache Parquet files
+package parquet
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+	"github.com/parquet-go/parquet-go/encoding"
+)
+
+// Type is the type of a column
+type Type int
+
+const (
+	String Type = iota
+	Int32
+	Int64
+	Float
+	Double
+	Boolean
+	// TimestampMillis is written as milliseconds since the epoch in UTC
+	TimestampMillis
+	// Date is written as days since the epoch
+	Date
+)
+
+// DefaultRowGroupSize is how many rows are buffered before they are written as a row group
+const DefaultRowGroupSize = 10000
+
+// Column is a nullable column of the table
+type Column struct {
+	Name string
+	Type Type
+}
+
+func (c Column) node() pq.Node {
+	switch c.Type {
+	case Int32:
+		return pq.Optional(pq.Leaf(pq.Int32Type))
+	case Int64:
+		return pq.Optional(pq.Leaf(pq.Int64Type))
+	case Float:
+		return pq.Optional(pq.Leaf(pq.FloatType))
+	case Double:
+		return pq.Optional(pq.Leaf(pq.DoubleType))
+	case Boolean:
+		return pq.Optional(pq.Leaf(pq.BooleanType))
+	case TimestampMillis:
+		return pq.Optional(pq.Timestamp(pq.Millisecond))
+	case Date:
+		return pq.Optional(pq.Date())
+	default:
+		return pq.Optional(pq.String())
+	}
+}
+
+// orderedGroup is the root of the schema, unlike pq.Group which sorts its fields by name it keeps the
+// columns in the order of the table and allows the same name twice as sql results do
+type orderedGroup []pq.Field
+
+type orderedField struct {
+	pq.Node
+	name string
+}
+
+func (f orderedField) Name() string { return f.name }
+
+// Value is only used to write go structs and maps, rows are written as values
+func (f orderedField) Value(reflect.Value) reflect.Value { return reflect.Value{} }
+
+func (g orderedGroup) ID() int                     { return 0 }
+func (g orderedGroup) Type() pq.Type               { return pq.Group{}.Type() }
+func (g orderedGroup) Optional() bool              { return false }
+func (g orderedGroup) Repeated() bool              { return false }
+func (g orderedGroup) Required() bool              { return true }
+func (g orderedGroup) Leaf() bool                  { return false }
+func (g orderedGroup) Fields() []pq.Field          { return g }
+func (g orderedGroup) Encoding() encoding.Encoding { return nil }
+func (g orderedGroup) Compression() compress.Codec { return nil }
+
+func (g orderedGroup) String() string {
+	names := make([]string, len(g))
+	for i, f := range g {
+		names[i] = f.Name()
+	}
+	return "group{" + strings.Join(names, ", ") + "}"
+}
+
+func (g orderedGroup) GoType() reflect.Type {
+	fields := make([]reflect.StructField, len(g))
+	for i, f := range g {
+		fields[i] = reflect.StructField{Name: fmt.Sprintf("Column%v", i), Type: f.GoType()}
+	}
+	return reflect.StructOf(fields)
+}
+
+// Writer writes rows to a parquet file with gzip compressed pages, every RowGroupSize rows become a row
+// group so memory stays bounded for large tables
+type Writer struct {
+	w       *pq.Writer
+	columns []Column
+	row     pq.Row
+	rows    int64
+	closed  bool
+}
+
+// NewWriter starts a parquet file with the columns on w
+func NewWriter(w io.Writer, columns []Column) (*Writer, error) {
+	return NewWriterWithRowGroupSize(w, columns, DefaultRowGroupSize)
+}
+
+// NewWriterWithRowGroupSize is NewWriter with row groups of rowGroupSize rows
+func NewWriterWithRowGroupSize(w io.Writer, columns []Column, rowGroupSize int) (*Writer, error) {
+	if len(columns) == 0 {
+		return nil, errors.New("a parquet file needs at least one column")
+	}
+	root := make(orderedGroup, len(columns))
+	for i, c := range columns {
+		root[i] = orderedField{Node: c.node(), name: c.Name}
+	}
+	schema := pq.NewSchema("schema", root)
+	return &Writer{
+		w:       pq.NewWriter(w, schema, pq.Compression(&pq.Gzip), pq.MaxRowsPerRowGroup(int64(rowGroupSize))),
+		columns: columns,
+		row:     make(pq.Row, len(columns)),
+	}, nil
+}
+
+// Write adds a row, values are in the order of the columns and nil is null. Strings take a string or
+// []byte, Int32 and Date an int32, Int64 an int64, Float a float32, Double a float64, Boolean a bool and
+// TimestampMillis and Date may also be given a time.Time
+func (p *Writer) Write(row []any) error {
+	if p.closed {
+		return errors.New("parquet writer is closed")
+	}
+	if len(row) != len(p.columns) {
+		return fmt.Errorf("row has %v values but there are %v columns", len(row), len(p.columns))
+	}
+	for i, v := range row {
+		if v == nil {
+			p.row[i] = pq.NullValue().Level(0, 0, i)
+			continue
+		}
+		value, ok := columnValue(p.columns[i].Type, v)
+		if !ok {
+			return fmt.Errorf("column %v cannot hold %T", p.columns[i].Name, v)
+		}
+		p.row[i] = value.Level(0, 1, i)
+	}
+	if _, err := p.w.WriteRows([]pq.Row{p.row}); err != nil {
+		return err
+	}
+	p.rows++
+	return nil
+}
+
+// columnValue converts v to the physical value of a column of type t, it is false when t cannot hold v
+func columnValue(t Type, v any) (pq.Value, bool) {
+	switch value := v.(type) {
+	case string:
+		return pq.ByteArrayValue([]byte(value)), t == String
+	case []byte:
+		return pq.ByteArrayValue(value), t == String
+	case int32:
+		return pq.Int32Value(value), t == Int32 || t == Date
+	case int64:
+		return pq.Int64Value(value), t == Int64 || t == TimestampMillis
+	case float32:
+		return pq.FloatValue(value), t == Float
+	case float64:
+		return pq.DoubleValue(value), t == Double
+	case bool:
+		return pq.BooleanValue(value), t == Boolean
+	case time.Time:
+		switch t {
+		case Date:
+			days := value.UTC().Unix() / 86400
+			if value.UTC().Unix() < 0 && value.UTC().Unix()%86400 != 0 {
+				days--
+			}
+			return pq.Int32Value(int32(days)), true
+		case TimestampMillis:
+			return pq.Int64Value(value.UnixMilli()), true
+		}
+	}
+	return pq.Value{}, false
+}
+
+// Rows is the number of rows written so far
+func (p *Writer) Rows() int64 {
+	return p.rows
+}
+
+// Close writes the last row group and the footer, it does not close the underlying writer
+func (p *Writer) Close() error {
+	if p.closed {
+		return nil
+	}
+	p.closed = true
+	return p.w.Close()
+}
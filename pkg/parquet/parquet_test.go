@@ -0,0 +1,172 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package parquet_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	pq "github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/format"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/parquet"
+)
+
+// readRows opens the file with the parquet-go reader and returns the rows as go values, nil for null
+func readRows(t *testing.T, file []byte) (*pq.File, [][]any) {
+	t.Helper()
+	f, err := pq.OpenFile(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("unable to open the parquet file: %v", err)
+	}
+	reader := pq.NewReader(f)
+	defer reader.Close()
+	var rows [][]any
+	buf := make([]pq.Row, 1)
+	for {
+		n, err := reader.ReadRows(buf)
+		if n == 1 {
+			row := make([]any, len(buf[0]))
+			for i, v := range buf[0] {
+				if v.IsNull() {
+					continue
+				}
+				switch v.Kind() {
+				case pq.ByteArray:
+					row[i] = string(v.ByteArray())
+				case pq.Int32:
+					row[i] = v.Int32()
+				case pq.Int64:
+					row[i] = v.Int64()
+				case pq.Float:
+					row[i] = v.Float()
+				case pq.Double:
+					row[i] = v.Double()
+				case pq.Boolean:
+					row[i] = v.Boolean()
+				}
+			}
+			rows = append(rows, row)
+		}
+		if errors.Is(err, io.EOF) {
+			return f, rows
+		}
+		if err != nil {
+			t.Fatalf("unable to read the parquet file: %v", err)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	columns := []parquet.Column{
+		{Name: "name", Type: parquet.String},
+		{Name: "count", Type: parquet.Int64},
+		{Name: "small", Type: parquet.Int32},
+		{Name: "ratio", Type: parquet.Double},
+		{Name: "f", Type: parquet.Float},
+		{Name: "ok", Type: parquet.Boolean},
+		{Name: "ts", Type: parquet.TimestampMillis},
+		{Name: "day", Type: parquet.Date},
+	}
+	var out bytes.Buffer
+	// small row groups so the rows are spread over several of them
+	w, err := parquet.NewWriterWithRowGroupSize(&out, columns, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := time.Date(2024, 4, 25, 8, 24, 18, 6000000, time.UTC)
+	rows := [][]any{
+		{"a", int64(1), int32(-2), 1.5, float32(0.25), true, ts, ts},
+		{nil, nil, nil, nil, nil, nil, nil, nil},
+		{"ccc", int64(-3), int32(7), -2.25, float32(4), false, int64(1000), int32(1)},
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Write([]any{1, nil, nil, nil, nil, nil, nil, nil}); err == nil {
+		t.Error("expected an int in a string column to be rejected")
+	}
+	if w.Rows() != 3 {
+		t.Errorf("expected 3 rows but was %v", w.Rows())
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, actual := readRows(t, out.Bytes())
+	if f.NumRows() != 3 || len(f.RowGroups()) != 2 {
+		t.Errorf("expected 3 rows in 2 row groups but was %v rows in %v", f.NumRows(), len(f.RowGroups()))
+	}
+	var names []string
+	for _, c := range f.Schema().Fields() {
+		names = append(names, c.Name())
+	}
+	if !reflect.DeepEqual(names, []string{"name", "count", "small", "ratio", "f", "ok", "ts", "day"}) {
+		t.Errorf("expected the columns in the order they were given but was %v", names)
+	}
+	fields := f.Schema().Fields()
+	if fields[0].Type().LogicalType().UTF8 == nil || !fields[0].Optional() {
+		t.Errorf("expected name to be an optional utf8 string but was %v", fields[0].Type())
+	}
+	if ts := fields[6].Type().LogicalType().Timestamp; ts == nil || ts.Unit.Millis == nil {
+		t.Errorf("expected ts to be a timestamp in millis but was %v", fields[6].Type())
+	}
+	if fields[7].Type().LogicalType().Date == nil {
+		t.Errorf("expected day to be a date but was %v", fields[7].Type())
+	}
+	for _, c := range f.Metadata().RowGroups[0].Columns {
+		if c.MetaData.Codec != format.Gzip {
+			t.Errorf("expected gzip compressed column chunks but was %v", c.MetaData.Codec)
+		}
+	}
+
+	expected := [][]any{
+		{"a", int64(1), int32(-2), 1.5, float32(0.25), true, ts.UnixMilli(), int32(19838)},
+		{nil, nil, nil, nil, nil, nil, nil, nil},
+		{"ccc", int64(-3), int32(7), -2.25, float32(4), false, int64(1000), int32(1)},
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected rows\n%v\nbut was\n%v", expected, actual)
+	}
+}
+
+func TestWriterAllowsTheSameColumnNameTwice(t *testing.T) {
+	var out bytes.Buffer
+	w, err := parquet.NewWriter(&out, []parquet.Column{{Name: "x", Type: parquet.String}, {Name: "x", Type: parquet.Int64}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write([]any{"a", int64(2)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, rows := readRows(t, out.Bytes()); !reflect.DeepEqual(rows, [][]any{{"a", int64(2)}}) {
+		t.Errorf("unexpected rows %v", rows)
+	}
+}
+
+func TestWriterNeedsColumns(t *testing.T) {
+	if _, err := parquet.NewWriter(io.Discard, nil); err == nil {
+		t.Error("expected an error without columns")
+	}
+}
@@ -0,0 +1,259 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package pgzip provides a block parallel gzip writer. The input is split into blocks that are
+// deflated on separate goroutines, each primed with the tail of the previous block, and the
+// results are stitched back together into a single gzip member so any standard gzip reader
+// can decompress the output.
+package pgzip
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// DefaultBlockSize is the amount of uncompressed data handed to each worker
+const DefaultBlockSize = 1024 * 1024
+
+// dictSize is the deflate window, the most of the previous block that is useful as a dictionary
+const dictSize = 32 * 1024
+
+var defaultWorkers = DefaultWorkers()
+var defaultWorkersMut sync.RWMutex
+
+// DefaultWorkers is a quarter of the available cpus, we are usually running next to a busy
+// Dremio process so we do not want to take every core for compression
+func DefaultWorkers() int {
+	workers := runtime.NumCPU() / 4
+	if workers < 1 {
+		return 1
+	}
+	return workers
+}
+
+// SetWorkers changes the number of workers used by NewWriter, anything less than 1 resets
+// it back to DefaultWorkers
+func SetWorkers(workers int) {
+	defaultWorkersMut.Lock()
+	defer defaultWorkersMut.Unlock()
+	if workers < 1 {
+		defaultWorkers = DefaultWorkers()
+		return
+	}
+	defaultWorkers = workers
+}
+
+// Workers returns the number of workers NewWriter will use
+func Workers() int {
+	defaultWorkersMut.RLock()
+	defer defaultWorkersMut.RUnlock()
+	return defaultWorkers
+}
+
+var ErrClosed = errors.New("pgzip: write to closed writer")
+
+type block struct {
+	data []byte
+	dict []byte
+	last bool
+	out  chan blockResult
+}
+
+type blockResult struct {
+	compressed []byte
+	err        error
+}
+
+// Writer is an io.WriteCloser, writes are buffered into blocks and Close must be called to
+// flush the final block and the gzip trailer. Like gzip.Writer, Close does not close the
+// underlying writer.
+type Writer struct {
+	w         io.Writer
+	level     int
+	blockSize int
+	buf       []byte
+	dict      []byte
+	crc       uint32
+	size      uint32
+	closed    bool
+
+	sem     chan struct{}
+	pending chan *block
+	done    chan struct{}
+	errMut  sync.Mutex
+	err     error
+}
+
+// NewWriter returns a writer using the default compression level and Workers() goroutines
+func NewWriter(w io.Writer) *Writer {
+	return NewWriterLevel(w, gzip.DefaultCompression, Workers())
+}
+
+// NewWriterLevel returns a writer at the given compression level using the given number of
+// goroutines for compression, workers less than 1 uses DefaultWorkers
+func NewWriterLevel(w io.Writer, level int, workers int) *Writer {
+	if workers < 1 {
+		workers = DefaultWorkers()
+	}
+	z := &Writer{
+		w:         w,
+		level:     level,
+		blockSize: DefaultBlockSize,
+		sem:       make(chan struct{}, workers),
+		// blocks queued for writing, bounding this bounds the memory used to roughly
+		// two blocks per worker
+		pending: make(chan *block, workers),
+		done:    make(chan struct{}),
+	}
+	go z.writeBlocks()
+	return z
+}
+
+func (z *Writer) setErr(err error) {
+	z.errMut.Lock()
+	defer z.errMut.Unlock()
+	if z.err == nil {
+		z.err = err
+	}
+}
+
+func (z *Writer) getErr() error {
+	z.errMut.Lock()
+	defer z.errMut.Unlock()
+	return z.err
+}
+
+// writeBlocks writes the gzip header then each compressed block in the order they were submitted
+func (z *Writer) writeBlocks() {
+	defer close(z.done)
+	header := []byte{0x1f, 0x8b, 8, 0, 0, 0, 0, 0, 0, 255}
+	if _, err := z.w.Write(header); err != nil {
+		z.setErr(err)
+	}
+	for b := range z.pending {
+		result := <-b.out
+		if z.getErr() != nil {
+			continue
+		}
+		if result.err != nil {
+			z.setErr(result.err)
+			continue
+		}
+		if _, err := z.w.Write(result.compressed); err != nil {
+			z.setErr(err)
+		}
+	}
+}
+
+func (z *Writer) compress(b *block) {
+	defer func() { <-z.sem }()
+	var out bytes.Buffer
+	fw, err := flate.NewWriterDict(&out, z.level, b.dict)
+	if err != nil {
+		b.out <- blockResult{err: err}
+		return
+	}
+	if _, err := fw.Write(b.data); err != nil {
+		b.out <- blockResult{err: err}
+		return
+	}
+	// a sync flush ends the block on a byte boundary without marking it final, so the
+	// next block's output can be appended directly after it
+	if b.last {
+		err = fw.Close()
+	} else {
+		err = fw.Flush()
+	}
+	b.out <- blockResult{compressed: out.Bytes(), err: err}
+}
+
+func (z *Writer) submit(last bool) {
+	b := &block{
+		data: z.buf,
+		dict: z.dict,
+		last: last,
+		out:  make(chan blockResult, 1),
+	}
+	if len(z.buf) >= dictSize {
+		z.dict = z.buf[len(z.buf)-dictSize:]
+	} else {
+		z.dict = append(z.dict, z.buf...)
+		if len(z.dict) > dictSize {
+			z.dict = z.dict[len(z.dict)-dictSize:]
+		}
+		// do not share the backing array with the block we just submitted
+		z.dict = append([]byte(nil), z.dict...)
+	}
+	z.buf = nil
+	z.sem <- struct{}{}
+	z.pending <- b
+	go z.compress(b)
+}
+
+func (z *Writer) Write(p []byte) (int, error) {
+	if z.closed {
+		return 0, ErrClosed
+	}
+	if err := z.getErr(); err != nil {
+		return 0, err
+	}
+	z.crc = crc32.Update(z.crc, crc32.IEEETable, p)
+	z.size += uint32(len(p)) // #nosec G115 -- gzip ISIZE is the size modulo 2^32
+	written := 0
+	for len(p) > 0 {
+		if z.buf == nil {
+			z.buf = make([]byte, 0, z.blockSize)
+		}
+		n := z.blockSize - len(z.buf)
+		if n > len(p) {
+			n = len(p)
+		}
+		z.buf = append(z.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(z.buf) == z.blockSize {
+			z.submit(false)
+		}
+	}
+	return written, nil
+}
+
+// Close compresses any remaining data, waits on the workers and writes the gzip trailer
+func (z *Writer) Close() error {
+	if z.closed {
+		return z.getErr()
+	}
+	z.closed = true
+	z.submit(true)
+	close(z.pending)
+	<-z.done
+	if err := z.getErr(); err != nil {
+		return err
+	}
+	trailer := make([]byte, 8)
+	binary.LittleEndian.PutUint32(trailer[:4], z.crc)
+	binary.LittleEndian.PutUint32(trailer[4:], z.size)
+	if _, err := z.w.Write(trailer); err != nil {
+		z.setErr(err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pgzip_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pgzip"
+)
+
+// logLikeData generates something that compresses roughly like a server.log
+func logLikeData(size int) []byte {
+	r := rand.New(rand.NewSource(42)) // #nosec G404
+	levels := []string{"INFO", "WARN", "ERROR", "DEBUG"}
+	var b bytes.Buffer
+	for b.Len() < size {
+		fmt.Fprintf(&b, "2024-04-25 10:%02d:%02d,%03d [qtp-%d] %v c.d.e.s.SomeService - query %x took %dms\n",
+			r.Intn(60), r.Intn(60), r.Intn(1000), r.Intn(200), levels[r.Intn(len(levels))], r.Int63(), r.Intn(100000))
+	}
+	return b.Bytes()[:size]
+}
+
+func roundTrip(t *testing.T, data []byte, workers int, writeSize int) {
+	t.Helper()
+	var out bytes.Buffer
+	w := pgzip.NewWriterLevel(&out, gzip.DefaultCompression, workers)
+	for i := 0; i < len(data); i += writeSize {
+		end := i + writeSize
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := w.Write(data[i:end]); err != nil {
+			t.Fatalf("unexpected write error %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("unexpected close error %v", err)
+	}
+	r, err := gzip.NewReader(&out)
+	if err != nil {
+		t.Fatalf("standard gzip reader did not accept the header: %v", err)
+	}
+	// only a single member is expected, so turn off multistream to prove it
+	r.Multistream(false)
+	actual, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("standard gzip reader failed: %v", err)
+	}
+	if !bytes.Equal(data, actual) {
+		t.Errorf("expected %v bytes back but got %v bytes that did not match", len(data), len(actual))
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	roundTrip(t, []byte{}, 4, 1)
+}
+
+func TestWriterSmallerThanBlock(t *testing.T) {
+	roundTrip(t, logLikeData(1000), 4, 100)
+}
+
+func TestWriterExactBlock(t *testing.T) {
+	roundTrip(t, logLikeData(pgzip.DefaultBlockSize), 4, 4096)
+}
+
+func TestWriterManyBlocks(t *testing.T) {
+	roundTrip(t, logLikeData(5*pgzip.DefaultBlockSize+123), 3, 64*1024)
+}
+
+func TestWriterSingleWorker(t *testing.T) {
+	roundTrip(t, logLikeData(2*pgzip.DefaultBlockSize+7), 1, 3*pgzip.DefaultBlockSize)
+}
+
+func TestWriteAfterClose(t *testing.T) {
+	var out bytes.Buffer
+	w := pgzip.NewWriter(&out)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("test")); err != pgzip.ErrClosed {
+		t.Errorf("expected %v but got %v", pgzip.ErrClosed, err)
+	}
+}
+
+func TestSetWorkers(t *testing.T) {
+	defer pgzip.SetWorkers(0)
+	pgzip.SetWorkers(7)
+	if pgzip.Workers() != 7 {
+		t.Errorf("expected 7 workers but got %v", pgzip.Workers())
+	}
+	pgzip.SetWorkers(-1)
+	if pgzip.Workers() != pgzip.DefaultWorkers() {
+		t.Errorf("expected %v workers but got %v", pgzip.DefaultWorkers(), pgzip.Workers())
+	}
+}
+
+const benchSize = 64 * 1024 * 1024
+
+func BenchmarkStandardGzip(b *testing.B) {
+	data := logLikeData(benchSize)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := gzip.NewWriter(io.Discard)
+		if _, err := w.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func benchmarkPgzip(b *testing.B, workers int) {
+	data := logLikeData(benchSize)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := pgzip.NewWriterLevel(io.Discard, gzip.DefaultCompression, workers)
+		if _, err := w.Write(data); err != nil {
+			b.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkPgzip1Worker(b *testing.B)  { benchmarkPgzip(b, 1) }
+func BenchmarkPgzip4Workers(b *testing.B) { benchmarkPgzip(b, 4) }
+func BenchmarkPgzip8Workers(b *testing.B) { benchmarkPgzip(b, 8) }
@@ -0,0 +1,509 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package pseudonym replaces the host names, pod names and ip addresses of a cluster with stable
+// aliases such as coordinator-1, executor-7 and ip-004 so a bundle does not show the topology
+package pseudonym
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/rewrite"
+)
+
+// Mapper hands out the aliases and rewrites text with them, the same name always gets the same alias
+// so the nodes can still be correlated across every file of the bundle
+type Mapper struct {
+	mu sync.Mutex
+	// aliases are keyed by the lower cased name or the ip address
+	aliases map[string]string
+	// shortAliases are the first labels of the fully qualified names, they only match a whole run of name
+	// characters so dremio in dremio.corp.example.com does not turn up in com.dremio.exec
+	shortAliases map[string]string
+	// maxParts is the most dot and dash separated parts of any name in aliases
+	maxParts     int
+	coordinators int
+	executors    int
+	pods         int
+	k8sNodes     int
+	ips          int
+}
+
+// New returns a Mapper that only knows about ip addresses until nodes are added
+func New() *Mapper {
+	return &Mapper{aliases: make(map[string]string), shortAliases: make(map[string]string)}
+}
+
+// AddNodes gives the coordinators and executors their aliases, coordinator-1, executor-1 and so on in
+// the order given. A node already known keeps its alias
+func (m *Mapper) AddNodes(coordinators, executors []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range coordinators {
+		if _, ok := m.aliases[strings.ToLower(c)]; ok {
+			continue
+		}
+		m.coordinators++
+		m.add(c, fmt.Sprintf("coordinator-%v", m.coordinators))
+	}
+	for _, e := range executors {
+		if _, ok := m.aliases[strings.ToLower(e)]; ok {
+			continue
+		}
+		m.executors++
+		m.add(e, fmt.Sprintf("executor-%v", m.executors))
+	}
+}
+
+// AddName gives name the alias of node, it is used for the host name a node reports when ddc reached
+// it by ip address or a different name. Names of unknown nodes are ignored
+func (m *Mapper) AddName(node, name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	alias, ok := m.aliases[strings.ToLower(node)]
+	if !ok || name == "" {
+		return
+	}
+	if _, ok := m.aliases[strings.ToLower(name)]; ok {
+		return
+	}
+	m.add(name, alias)
+}
+
+// commonLabels are never taken as the short name of a host, they are everywhere in logs, paths and class names
+var commonLabels = map[string]bool{
+	"dremio": true, "master": true, "node": true, "coordinator": true, "executor": true, "server": true,
+	"host": true, "localhost": true, "worker": true, "data": true, "db": true, "api": true, "app": true,
+	"www": true, "local": true, "internal": true, "default": true, "cluster": true, "ip": true, "com": true,
+	"org": true, "net": true, "io": true,
+}
+
+// add registers name and, for a fully qualified name, its short name
+func (m *Mapper) add(name, alias string) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return
+	}
+	m.aliases[name] = alias
+	if parts := len(splitParts(name)); parts > m.maxParts {
+		m.maxParts = parts
+	}
+	if net.ParseIP(name) != nil {
+		return
+	}
+	if short, _, found := strings.Cut(name, "."); found && len(short) > 2 && !commonLabels[short] && !isNumber(short) {
+		if _, ok := m.aliases[short]; !ok {
+			if _, ok := m.shortAliases[short]; !ok {
+				m.shortAliases[short] = alias
+			}
+		}
+	}
+}
+
+// versionWords come before a version rather than an address, version 24.3.2.1 or "dremioVersion":"24.3.2.1"
+func versionWord(word string) bool {
+	word = strings.ToLower(word)
+	return strings.HasSuffix(word, "version") || word == "ver" || word == "v" || word == "release" || word == "build"
+}
+
+// versionBefore is true when the word before i, past spaces, quotes and separators, is a version word
+func versionBefore(s string, i int) bool {
+	j := i
+	for j > 0 && strings.IndexByte(" \t\"':=(", s[j-1]) != -1 {
+		j--
+	}
+	k := j
+	for k > 0 && (s[k-1] >= 'a' && s[k-1] <= 'z' || s[k-1] >= 'A' && s[k-1] <= 'Z') {
+		k--
+	}
+	return k < j && versionWord(s[k:j])
+}
+
+// ipAlias returns the alias of an ip address, handing out the next ip-NNN the first time it is seen
+func (m *Mapper) ipAlias(ip string) string {
+	if alias, ok := m.aliases[ip]; ok {
+		return alias
+	}
+	m.ips++
+	alias := fmt.Sprintf("ip-%03d", m.ips)
+	m.aliases[ip] = alias
+	return alias
+}
+
+// Text replaces the known names and every ipv4 and ipv6 address in s with their aliases. Names only match
+// whole, dremio-executor-1 is not found in dremio-executor-10. Loopback, unspecified and netmask addresses are kept
+func (m *Mapper) Text(s string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var b strings.Builder
+	changed := false
+	last := 0
+	replace := func(i, j int, rewritten string) {
+		if !changed {
+			b.Grow(len(s))
+			changed = true
+		}
+		b.WriteString(s[last:i])
+		b.WriteString(rewritten)
+		last = j
+	}
+	for i := 0; i < len(s); {
+		if j, ip, ok := ipv6At(s, i); ok {
+			// only the address is replaced, a %zone or the brackets and port around it are kept
+			if !keepIP(ip) {
+				replace(i, j, m.ipAlias(ip))
+			}
+			i = j
+			continue
+		}
+		if !isNameChar(s[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(s) && isNameChar(s[j]) {
+			j++
+		}
+		if rewritten, ok := m.rewriteRun(s[i:j], versionBefore(s, i)); ok {
+			replace(i, j, rewritten)
+		}
+		i = j
+	}
+	if !changed {
+		return s
+	}
+	b.WriteString(s[last:])
+	return b.String()
+}
+
+func isHexChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
+
+// ipv6At matches an ipv6 address starting at i and returns where it ends. It has to start at a
+// boundary, which includes a single colon after a word as in addr:fe80::1, and may not run into a
+// name so a time such as 12:30:00 or a mac address is not taken for one
+func ipv6At(s string, i int) (int, string, bool) {
+	if !isHexChar(s[i]) && s[i] != ':' {
+		return 0, "", false
+	}
+	if i > 0 {
+		prev := s[i-1]
+		if prev == ':' {
+			if i > 1 && (isHexChar(s[i-2]) || s[i-2] == ':' || s[i-2] == '.') {
+				return 0, "", false
+			}
+		} else if isNameChar(prev) {
+			return 0, "", false
+		}
+	}
+	j := i
+	for j < len(s) && (isHexChar(s[j]) || s[j] == ':' || s[j] == '.') {
+		j++
+	}
+	if j < len(s) && isNameChar(s[j]) {
+		return 0, "", false
+	}
+	// a sentence or a key may end right after the address
+	for j > i {
+		candidate := s[i:j]
+		if strings.Count(candidate, ":") >= 2 && net.ParseIP(candidate) != nil {
+			return j, normalizeIP(candidate), true
+		}
+		if s[j-1] != ':' && s[j-1] != '.' {
+			break
+		}
+		j--
+	}
+	return 0, "", false
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_'
+}
+
+// part is a piece of a run of name characters between dots and dashes
+type part struct {
+	start, end int
+}
+
+func splitParts(run string) []part {
+	var parts []part
+	start := 0
+	for k := 0; k <= len(run); k++ {
+		if k == len(run) || run[k] == '.' || run[k] == '-' {
+			parts = append(parts, part{start, k})
+			start = k + 1
+		}
+	}
+	return parts
+}
+
+// rewriteRun replaces the names and addresses found in a run of name characters such as
+// dremio-executor-0.dremio-cluster-pod or 10.0.0.1-C, afterVersion is set when a version word comes before it
+func (m *Mapper) rewriteRun(run string, afterVersion bool) (string, bool) {
+	// a short name is the whole run, a sentence may end right after it
+	whole := strings.TrimRight(run, ".")
+	if alias, ok := m.shortAliases[strings.ToLower(whole)]; ok {
+		if _, known := m.aliases[strings.ToLower(whole)]; !known {
+			return alias + run[len(whole):], true
+		}
+	}
+	parts := splitParts(run)
+	var b strings.Builder
+	pos := 0
+	changed := false
+	replace := func(i, j int, alias string) {
+		b.WriteString(run[pos:parts[i].start])
+		b.WriteString(alias)
+		pos = parts[j].end
+		changed = true
+	}
+	for i := 0; i < len(parts); i++ {
+		if j, alias, ok := m.knownName(run, parts, i); ok {
+			replace(i, j, alias)
+			i = j
+			continue
+		}
+		if ip, ok := dottedIP(run, parts, i, afterVersion); ok {
+			if !keepIP(ip) {
+				replace(i, i+3, m.ipAlias(ip))
+			}
+			i += 3
+			continue
+		}
+		if ip, ok := dashedIP(run, parts, i); ok {
+			// ip-10-0-1-2 is how cloud providers name hosts after their address
+			if !keepIP(ip) {
+				replace(i, i+4, m.ipAlias(ip))
+			}
+			i += 4
+		}
+	}
+	if !changed {
+		return "", false
+	}
+	b.WriteString(run[pos:])
+	return b.String(), true
+}
+
+// knownName finds the longest known name starting at part i and returns its last part and alias
+func (m *Mapper) knownName(run string, parts []part, i int) (int, string, bool) {
+	last := i + m.maxParts - 1
+	if last >= len(parts) {
+		last = len(parts) - 1
+	}
+	for j := last; j >= i; j-- {
+		if alias, ok := m.aliases[strings.ToLower(run[parts[i].start:parts[j].end])]; ok {
+			return j, alias, true
+		}
+	}
+	return 0, "", false
+}
+
+func isOctet(s string) bool {
+	if len(s) == 0 || len(s) > 3 {
+		return false
+	}
+	n, err := strconv.Atoi(s)
+	return err == nil && n <= 255
+}
+
+func isNumber(s string) bool {
+	_, err := strconv.Atoi(s)
+	return err == nil
+}
+
+// separator returns the character between part i and the next one
+func separator(run string, parts []part, i int) byte {
+	if i+1 >= len(parts) {
+		return 0
+	}
+	return run[parts[i].end]
+}
+
+// dottedIP matches four octets separated by dots starting at part i that are not part of a longer
+// dotted number or a version, such as one after a version word or followed by a build suffix
+func dottedIP(run string, parts []part, i int, afterVersion bool) (string, bool) {
+	if i+3 >= len(parts) {
+		return "", false
+	}
+	if i == 0 && afterVersion || i > 0 && versionWord(run[parts[i-1].start:parts[i-1].end]) {
+		return "", false
+	}
+	if separator(run, parts, i+3) == '-' && versionSuffix(run[parts[i+4].start:parts[i+4].end]) {
+		return "", false
+	}
+	for k := i; k <= i+3; k++ {
+		if !isOctet(run[parts[k].start:parts[k].end]) {
+			return "", false
+		}
+		if k < i+3 && separator(run, parts, k) != '.' {
+			return "", false
+		}
+	}
+	if i > 0 && separator(run, parts, i-1) == '.' && isNumber(run[parts[i-1].start:parts[i-1].end]) {
+		return "", false
+	}
+	if separator(run, parts, i+3) == '.' && isNumber(run[parts[i+4].start:parts[i+4].end]) {
+		return "", false
+	}
+	return normalizeIP(run[parts[i].start:parts[i+3].end]), true
+}
+
+// versionSuffix is true for what follows a version after a dash, a build timestamp or a release name
+func versionSuffix(s string) bool {
+	return len(s) > 3 && isNumber(s) || strings.EqualFold(s, "snapshot") || strings.EqualFold(s, "release")
+}
+
+// dashedIP matches ip-a-b-c-d starting at part i and returns it as a.b.c.d
+func dashedIP(run string, parts []part, i int) (string, bool) {
+	if i+4 >= len(parts) || !strings.EqualFold(run[parts[i].start:parts[i].end], "ip") {
+		return "", false
+	}
+	if i > 0 && separator(run, parts, i-1) == '-' {
+		return "", false
+	}
+	octets := make([]string, 0, 4)
+	for k := i + 1; k <= i+4; k++ {
+		octet := run[parts[k].start:parts[k].end]
+		if separator(run, parts, k-1) != '-' || !isOctet(octet) {
+			return "", false
+		}
+		octets = append(octets, octet)
+	}
+	if separator(run, parts, i+4) == '-' && isNumber(run[parts[i+5].start:parts[i+5].end]) {
+		return "", false
+	}
+	return normalizeIP(strings.Join(octets, ".")), true
+}
+
+// normalizeIP drops leading zeros so 010.000.000.001 and 10.0.0.1 get the same alias, ipv6 addresses are
+// compressed and lower cased and an ipv4 mapped address gets the alias of its ipv4 address
+func normalizeIP(ip string) string {
+	if parsed := net.ParseIP(ip); parsed != nil {
+		return parsed.String()
+	}
+	octets := strings.Split(ip, ".")
+	for k, o := range octets {
+		n, _ := strconv.Atoi(o)
+		octets[k] = strconv.Itoa(n)
+	}
+	return strings.Join(octets, ".")
+}
+
+// keepIP is true for the addresses that say nothing about the topology
+func keepIP(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return true
+	}
+	return parsed.IsLoopback() || parsed.IsUnspecified() || strings.HasPrefix(ip, "255.")
+}
+
+// Name returns the name of an archive entry with the names and addresses in its path replaced
+func (m *Mapper) Name(name string) string {
+	return m.Text(name)
+}
+
+// File rewrites the text file at path in place, gzipped files and the entries of zip files are rewritten
+// too. Binary files are left as they are, name is the name of the file in the archive
+func (m *Mapper) File(name, path string) error {
+	_, err := rewrite.File(path, func(entry string, in io.Reader, out io.Writer) (bool, error) {
+		reader := bufio.NewReaderSize(in, 64*1024)
+		head, err := reader.Peek(8000)
+		if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+			return false, err
+		}
+		if bytes.IndexByte(head, 0) != -1 {
+			if entry != "" {
+				return false, rewrite.ErrKeep
+			}
+			return false, nil
+		}
+		return m.lines(reader, out)
+	})
+	if err != nil {
+		return fmt.Errorf("unable to pseudonymize %v due to error %w", name, err)
+	}
+	return nil
+}
+
+func (m *Mapper) lines(reader *bufio.Reader, out io.Writer) (bool, error) {
+	changed := false
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			rewritten := m.Text(line)
+			changed = changed || rewritten != line
+			if _, err := io.WriteString(out, rewritten); err != nil {
+				return false, err
+			}
+		}
+		if err == io.EOF {
+			return changed, nil
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+}
+
+// Mapping returns the original names and addresses of each alias
+func (m *Mapper) Mapping() map[string][]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mapping := make(map[string][]string)
+	for name, alias := range m.aliases {
+		mapping[alias] = append(mapping[alias], name)
+	}
+	for name, alias := range m.shortAliases {
+		if _, ok := m.aliases[name]; !ok {
+			mapping[alias] = append(mapping[alias], name)
+		}
+	}
+	for _, names := range mapping {
+		sort.Strings(names)
+	}
+	return mapping
+}
+
+// MappingFileName is where the mapping of the bundle at outputLoc is written, next to it and never in it
+func MappingFileName(outputLoc string) string {
+	base := strings.TrimSuffix(strings.TrimSuffix(outputLoc, ".tgz"), ".tar.gz")
+	return base + "-pseudonyms.json"
+}
+
+// WriteMapping writes the mapping to fileName so the aliases in the bundle can be traced back locally
+func (m *Mapper) WriteMapping(fileName string) error {
+	b, err := json.MarshalIndent(m.Mapping(), "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Clean(fileName), b, 0600); err != nil {
+		return fmt.Errorf("unable to write pseudonym mapping %v due to error %w", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package pseudonym replaces the host names, pod names and ip addresses of a cluster with stable
+// aliases such as coordinator-1, executor-7 and ip-004 so a bundle does not show the topology
+package pseudonym
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestMapper() *Mapper {
+	m := New()
+	m.AddNodes([]string{"dremio-master-0"}, []string{"dremio-executor-0", "dremio-executor-1", "10.0.0.12"})
+	m.AddName("10.0.0.12", "worker-3.corp.example.com")
+	return m
+}
+
+func TestText(t *testing.T) {
+	m := newTestMapper()
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"node dremio-master-0 started", "node coordinator-1 started"},
+		{"configuration/dremio-executor-1/dremio.conf", "configuration/executor-2/dremio.conf"},
+		{"dremio-executor-10 is not a node", "dremio-executor-10 is not a node"},
+		{"DREMIO-EXECUTOR-0 joined", "executor-1 joined"},
+		{"dremio-executor-0.dremio-cluster-pod.svc", "executor-1.dremio-cluster-pod.svc"},
+		{"logs/10.0.0.12-E/server.log", "logs/executor-3-E/server.log"},
+		{"host worker-3.corp.example.com and worker-3", "host executor-3 and executor-3"},
+		{"connected to 192.168.1.20:45678", "connected to ip-001:45678"},
+		{"again 192.168.1.20 and 192.168.1.21", "again ip-001 and ip-002"},
+		{"node ip-192-168-1-21.ec2.internal", "node ip-002.ec2.internal"},
+		{"localhost 127.0.0.1 listens on 0.0.0.0 mask 255.255.255.0", "localhost 127.0.0.1 listens on 0.0.0.0 mask 255.255.255.0"},
+		{"java 1.8.0.392.1 and 300.1.1.1", "java 1.8.0.392.1 and 300.1.1.1"},
+		{`{"podIP":"10.0.0.12","hostIP":"172.16.0.4"}`, `{"podIP":"executor-3","hostIP":"ip-003"}`},
+	}
+	for _, tt := range tests {
+		if actual := m.Text(tt.in); actual != tt.expected {
+			t.Errorf("expected '%v' to become '%v' but was '%v'", tt.in, tt.expected, actual)
+		}
+	}
+}
+
+func TestTextKeepsClassNamesAndPathsWithTheShortName(t *testing.T) {
+	m := New()
+	m.AddNodes([]string{"dremio.corp.example.com"}, []string{"exec.corp.example.com", "node.corp.example.com"})
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"\tat com.dremio.exec.work.foreman.Foreman.run(Foreman.java:123)", "\tat com.dremio.exec.work.foreman.Foreman.run(Foreman.java:123)"},
+		{"data in /opt/dremio/data and dremio-env", "data in /opt/dremio/data and dremio-env"},
+		{"executors exec-1 and exec.corp and node-2", "executors exec-1 and exec.corp and node-2"},
+		{"coordinator dremio.corp.example.com and exec", "coordinator coordinator-1 and executor-1"},
+		{"logs/exec/server.log from exec.", "logs/executor-1/server.log from executor-1."},
+		{"a node called node", "a node called node"},
+	}
+	for _, tt := range tests {
+		if actual := m.Text(tt.in); actual != tt.expected {
+			t.Errorf("expected '%v' to become '%v' but was '%v'", tt.in, tt.expected, actual)
+		}
+	}
+}
+
+func TestTextKeepsVersions(t *testing.T) {
+	m := newTestMapper()
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"dremio version 24.3.2.1 on 10.1.2.3", "dremio version 24.3.2.1 on ip-001"},
+		{`{"dremioVersion":"24.3.2.1","ip":"10.1.2.3"}`, `{"dremioVersion":"24.3.2.1","ip":"ip-001"}`},
+		{"Version: 24.3.2.1 and v 25.0.1.2", "Version: 24.3.2.1 and v 25.0.1.2"},
+		{"dremio-version-24.3.2.1 and 24.3.2.1-202405011234-abcdef", "dremio-version-24.3.2.1 and 24.3.2.1-202405011234-abcdef"},
+		{"build 24.3.2.1-SNAPSHOT", "build 24.3.2.1-SNAPSHOT"},
+		{"logs/10.1.2.3-C/server.log", "logs/ip-001-C/server.log"},
+	}
+	for _, tt := range tests {
+		if actual := m.Text(tt.in); actual != tt.expected {
+			t.Errorf("expected '%v' to become '%v' but was '%v'", tt.in, tt.expected, actual)
+		}
+	}
+}
+
+func TestTextIPv6(t *testing.T) {
+	m := newTestMapper()
+	tests := []struct {
+		in       string
+		expected string
+	}{
+		{"connected to 2001:db8::17 and 2001:0DB8:0:0:0:0:0:17", "connected to ip-001 and ip-001"},
+		{"link fe80::1c2d:3eff:fe4f:5a6b%eth0 up", "link ip-002%eth0 up"},
+		{"url https://[2001:db8:0:1::5]:9047/apiv2", "url https://[ip-003]:9047/apiv2"},
+		{"addr:2001:db8::17.", "addr:ip-001."},
+		{"mapped ::ffff:192.168.1.20 and 192.168.1.20", "mapped ip-004 and ip-004"},
+		{"loopback ::1 and any ::", "loopback ::1 and any ::"},
+		{"at 2024-01-02 12:30:00.123 mac 00:1a:2b:3c:4d:5e", "at 2024-01-02 12:30:00.123 mac 00:1a:2b:3c:4d:5e"},
+		{"std::vector and a::b::c", "std::vector and a::b::c"},
+		{"dremio-master-0 at 10.0.0.12:45678", "coordinator-1 at executor-3:45678"},
+	}
+	for _, tt := range tests {
+		if actual := m.Text(tt.in); actual != tt.expected {
+			t.Errorf("expected '%v' to become '%v' but was '%v'", tt.in, tt.expected, actual)
+		}
+	}
+}
+
+func TestAddKubernetes(t *testing.T) {
+	m := newTestMapper()
+	nodes := `{"items":[{"metadata":{"name":"ip-192-168-1-130.eu-west-2.compute.internal"},
+		"status":{"addresses":[{"type":"InternalIP","address":"192.168.1.130"},{"type":"Hostname","address":"node-a.internal"}]}}]}`
+	if err := m.AddKubernetesNodes([]byte(nodes)); err != nil {
+		t.Fatal(err)
+	}
+	pods := `{"items":[
+		{"metadata":{"name":"dremio-executor-0"},"spec":{"nodeName":"ip-192-168-1-130.eu-west-2.compute.internal","hostname":"dremio-executor-0"}},
+		{"metadata":{"name":"zk-0"},"spec":{"nodeName":"ip-192-168-68-4.eu-west-2.compute.internal","hostname":"zk-0"}}]}`
+	if err := m.AddKubernetesPods([]byte(pods)); err != nil {
+		t.Fatal(err)
+	}
+	in := "zk-0 on ip-192-168-68-4.eu-west-2.compute.internal, dremio-executor-0 on node-a.internal at 192.168.1.130"
+	expected := "pod-1 on k8s-node-2, executor-1 on k8s-node-1 at ip-001"
+	if actual := m.Text(in); actual != expected {
+		t.Errorf("expected '%v' but was '%v'", expected, actual)
+	}
+	if err := m.AddKubernetesPods([]byte("not json")); err == nil {
+		t.Error("expected an error for a list that is not json")
+	}
+}
+
+func TestAddSysNodes(t *testing.T) {
+	m := newTestMapper()
+	rows := `{"name":"dremio-master-0.dremio-cluster-pod","hostname":"dremio-master-0.dremio-cluster-pod","ip":"10.0.0.2","is_coordinator":true}
+{"name":"worker-9","hostname":"worker-9.corp.example.com","ip":"10.0.0.12","is_coordinator":false}
+
+{"name":"dremio-executor-5","hostname":"dremio-executor-5","ip":"10.0.0.15","is_coordinator":false}
+{"name":"dremio-master-1","hostname":"dremio-master-1","ip":"10.0.0.3","is_coordinator":true}
+`
+	if err := m.AddSysNodes(strings.NewReader(rows)); err != nil {
+		t.Fatal(err)
+	}
+	in := "dremio-master-0.dremio-cluster-pod worker-9.corp.example.com dremio-executor-5 dremio-master-1"
+	expected := "coordinator-1 executor-3 executor-4 coordinator-2"
+	if actual := m.Text(in); actual != expected {
+		t.Errorf("expected '%v' but was '%v'", expected, actual)
+	}
+	if err := m.AddSysNodes(strings.NewReader("{bad")); err == nil {
+		t.Error("expected an error for a row that is not json")
+	}
+}
+
+func TestAddNodesKeepsAliases(t *testing.T) {
+	m := newTestMapper()
+	m.AddNodes([]string{"dremio-master-0"}, []string{"dremio-executor-2"})
+	if actual := m.Text("dremio-master-0 dremio-executor-2"); actual != "coordinator-1 executor-4" {
+		t.Errorf("expected known nodes to keep their alias but got '%v'", actual)
+	}
+	m.AddName("unknown", "some-host")
+	if actual := m.Text("some-host"); actual != "some-host" {
+		t.Errorf("expected a name of an unknown node to be ignored but got '%v'", actual)
+	}
+}
+
+func TestFile(t *testing.T) {
+	m := newTestMapper()
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "server.log")
+	if err := os.WriteFile(plain, []byte("a dremio-executor-0\nb 10.1.2.3\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.File("server.log", plain); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "a executor-1\nb ip-001\n" {
+		t.Errorf("unexpected rewritten file '%v'", string(b))
+	}
+
+	gzFile := filepath.Join(dir, "server.log.gz")
+	var gzData bytes.Buffer
+	gzWriter := gzip.NewWriter(&gzData)
+	if _, err := gzWriter.Write([]byte("from dremio-master-0\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(gzFile, gzData.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.File("server.log.gz", gzFile); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(gzFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gzReader, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err = io.ReadAll(gzReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "from coordinator-1\n" {
+		t.Errorf("unexpected rewritten gz file '%v'", string(b))
+	}
+
+	binary := filepath.Join(dir, "node.jfr")
+	binaryData := []byte("dremio-master-0\x00\x01")
+	if err := os.WriteFile(binary, binaryData, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.File("node.jfr", binary); err != nil {
+		t.Fatal(err)
+	}
+	b, err = os.ReadFile(binary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, binaryData) {
+		t.Errorf("expected binary file to be left as it was but got '%q'", b)
+	}
+}
+
+func TestWriteMapping(t *testing.T) {
+	m := newTestMapper()
+	m.Text("10.1.2.3")
+	fileName := filepath.Join(t.TempDir(), "diag-pseudonyms.json")
+	if err := m.WriteMapping(fileName); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mapping map[string][]string
+	if err := json.Unmarshal(b, &mapping); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string][]string{
+		"coordinator-1": {"dremio-master-0"},
+		"executor-1":    {"dremio-executor-0"},
+		"executor-2":    {"dremio-executor-1"},
+		"executor-3":    {"10.0.0.12", "worker-3", "worker-3.corp.example.com"},
+		"ip-001":        {"10.1.2.3"},
+	}
+	if !reflect.DeepEqual(expected, mapping) {
+		t.Errorf("expected mapping %v but was %v", expected, mapping)
+	}
+}
+
+func TestMappingFileName(t *testing.T) {
+	for in, expected := range map[string]string{
+		"diag.tgz":         "diag-pseudonyms.json",
+		"/tmp/diag.tar.gz": "/tmp/diag-pseudonyms.json",
+	} {
+		if actual := MappingFileName(in); actual != expected {
+			t.Errorf("expected %v but was %v", expected, actual)
+		}
+	}
+}
@@ -0,0 +1,196 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pseudonym
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+)
+
+// k8sList is the part of a kubernetes list of pods or nodes the names are read from
+type k8sList struct {
+	Items []struct {
+		Metadata struct {
+			Name string `json:"name"`
+		} `json:"metadata"`
+		Spec struct {
+			NodeName string `json:"nodeName"`
+			Hostname string `json:"hostname"`
+		} `json:"spec"`
+		Status struct {
+			Addresses []struct {
+				Type    string `json:"type"`
+				Address string `json:"address"`
+			} `json:"addresses"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+// AddKubernetesPods reads a kubernetes list of pods. The dremio pods are already known as nodes, the other
+// pods such as zookeeper become pod-1, pod-2 and so on and the nodes they run on k8s-node-1, k8s-node-2
+func (m *Mapper) AddKubernetesPods(data []byte) error {
+	var list k8sList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("unable to read the list of pods due to error %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, pod := range list.Items {
+		alias, ok := m.nodeAlias(pod.Metadata.Name)
+		if !ok && pod.Metadata.Name != "" {
+			m.pods++
+			alias = fmt.Sprintf("pod-%v", m.pods)
+			m.add(pod.Metadata.Name, alias)
+		}
+		if _, known := m.aliases[strings.ToLower(pod.Spec.Hostname)]; !known && alias != "" {
+			m.add(pod.Spec.Hostname, alias)
+		}
+		m.addK8sNode([]string{pod.Spec.NodeName})
+	}
+	return nil
+}
+
+// AddKubernetesNodes reads a kubernetes list of nodes, each node gets a k8s-node alias for its name and
+// the host names and dns names of its addresses. The addresses themselves are left to the ip aliases
+func (m *Mapper) AddKubernetesNodes(data []byte) error {
+	var list k8sList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("unable to read the list of nodes due to error %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, node := range list.Items {
+		names := []string{node.Metadata.Name}
+		for _, a := range node.Status.Addresses {
+			switch a.Type {
+			case "Hostname", "InternalDNS", "ExternalDNS":
+				names = append(names, a.Address)
+			}
+		}
+		m.addK8sNode(names)
+	}
+	return nil
+}
+
+// addK8sNode gives the names of one kubernetes node the alias of the first one already known or the next
+// k8s-node alias
+func (m *Mapper) addK8sNode(names []string) {
+	alias := ""
+	for _, name := range names {
+		if a, ok := m.nodeAlias(name); ok {
+			alias = a
+			break
+		}
+	}
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			continue
+		}
+		if _, ok := m.aliases[strings.ToLower(name)]; ok {
+			continue
+		}
+		if alias == "" {
+			m.k8sNodes++
+			alias = fmt.Sprintf("k8s-node-%v", m.k8sNodes)
+		}
+		m.add(name, alias)
+	}
+}
+
+// sysNode is a row of the sys.nodes export
+type sysNode struct {
+	Name          string `json:"name"`
+	Hostname      string `json:"hostname"`
+	IP            string `json:"ip"`
+	IsCoordinator bool   `json:"is_coordinator"`
+}
+
+// AddSysNodes reads the rows of the sys.nodes export, one json object per line. The names a node reports
+// get the alias of the node when its name, host name or ip address is already known, the nodes ddc did not
+// collect from become the next coordinator or executor
+func (m *Mapper) AddSysNodes(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var node sysNode
+		if err := json.Unmarshal(line, &node); err != nil {
+			return fmt.Errorf("unable to read sys.nodes row due to error %w", err)
+		}
+		names := []string{node.Name, node.Hostname}
+		keys := names
+		if node.IP != "" {
+			keys = append([]string{normalizeIP(node.IP)}, names...)
+		}
+		alias := ""
+		for _, key := range keys {
+			if a, ok := m.nodeAlias(key); ok {
+				alias = a
+				break
+			}
+		}
+		for _, name := range names {
+			if strings.TrimSpace(name) == "" {
+				continue
+			}
+			if _, ok := m.aliases[strings.ToLower(name)]; ok {
+				continue
+			}
+			if alias == "" {
+				if node.IsCoordinator {
+					m.coordinators++
+					alias = fmt.Sprintf("coordinator-%v", m.coordinators)
+				} else {
+					m.executors++
+					alias = fmt.Sprintf("executor-%v", m.executors)
+				}
+			}
+			m.add(name, alias)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read sys.nodes due to error %w", err)
+	}
+	return nil
+}
+
+// nodeAlias returns the alias of a known name or of the short name of a fully qualified one, the ip-NNN
+// aliases handed out for addresses seen in the text are not the alias of a node
+func (m *Mapper) nodeAlias(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return "", false
+	}
+	alias, ok := m.aliases[name]
+	if short, _, found := strings.Cut(name, "."); !ok && found && net.ParseIP(name) == nil {
+		if alias, ok = m.aliases[short]; !ok {
+			alias, ok = m.shortAliases[short]
+		}
+	}
+	if !ok || strings.HasPrefix(alias, "ip-") {
+		return "", false
+	}
+	return alias, true
+}
@@ -0,0 +1,199 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package redaction applies the user defined redaction rules of ddc.yaml to the collected files
+package redaction
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/rewrite"
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+// ReportFileName is written to the root of the redacted directory
+const ReportFileName = "redaction-report.json"
+
+// SkippedBinary is the reason of the files that were kept as they are not text
+const SkippedBinary = "binary"
+
+// NodeReportFileName is the report of the files collected on one node
+func NodeReportFileName(node string) string {
+	return fmt.Sprintf("redaction-report-%v.json", node)
+}
+
+// sniffSize is how much of a file is checked for NUL bytes to tell text from binary files
+const sniffSize = 8000
+
+// RuleReport is a rule with the number of matches it had over all files
+type RuleReport struct {
+	Rule
+	Matches int `json:"matches"`
+}
+
+// FileReport lists the matches per rule of one file, paths are relative to the redacted directory
+type FileReport struct {
+	File    string `json:"file"`
+	Matches Counts `json:"matches"`
+}
+
+// SkippedFile is a file that was not redacted and why
+type SkippedFile struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+// Report is written to ReportFileName once a directory is redacted
+type Report struct {
+	Rules   []RuleReport  `json:"rules"`
+	Files   []FileReport  `json:"files"`
+	Skipped []SkippedFile `json:"skipped"`
+}
+
+// errBinary marks a file, or zip entry, that is not text
+var errBinary = errors.New("binary content")
+
+// Dir redacts every text file under dir in place with the given number of workers, gzipped files and the
+// text entries of zip files (job profiles) are redacted too. Binary files are kept and files that fail are
+// removed, both are listed in the report
+func (r *Redactor) Dir(dir string, workers int) (Report, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("unable to list the files of %v due to error %v", dir, err)
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	report := Report{Files: []FileReport{}, Skipped: []SkippedFile{}}
+	totals := make(Counts)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	paths := make(chan string)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				counts, err := r.File(path)
+				rel, relErr := filepath.Rel(dir, path)
+				if relErr != nil {
+					rel = path
+				}
+				rel = filepath.ToSlash(rel)
+				mu.Lock()
+				switch {
+				case errors.Is(err, errBinary):
+					report.Skipped = append(report.Skipped, SkippedFile{File: rel, Reason: SkippedBinary})
+				case err != nil:
+					// a file the rules could not be applied to is not shipped
+					simplelog.Errorf("unable to redact %v, removing it due to error %v", path, err)
+					reason := fmt.Sprintf("removed as it could not be redacted: %v", err)
+					if rmErr := os.Remove(path); rmErr != nil {
+						reason = fmt.Sprintf("could not be redacted (%v) or removed (%v)", err, rmErr)
+					}
+					report.Skipped = append(report.Skipped, SkippedFile{File: rel, Reason: reason})
+				case counts.total() > 0:
+					report.Files = append(report.Files, FileReport{File: rel, Matches: counts})
+					totals.add(counts)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, f := range files {
+		paths <- f
+	}
+	close(paths)
+	wg.Wait()
+	sort.Slice(report.Files, func(i, j int) bool { return report.Files[i].File < report.Files[j].File })
+	sort.Slice(report.Skipped, func(i, j int) bool { return report.Skipped[i].File < report.Skipped[j].File })
+	for _, rule := range r.Rules() {
+		report.Rules = append(report.Rules, RuleReport{Rule: rule, Matches: totals[rule.Name]})
+	}
+	return report, nil
+}
+
+// File redacts one file in place, the file is only rewritten when a rule matched
+func (r *Redactor) File(path string) (Counts, error) {
+	counts := make(Counts)
+	_, err := rewrite.File(path, func(name string, in io.Reader, out io.Writer) (bool, error) {
+		err := r.stream(in, out, counts)
+		if name != "" && errors.Is(err, errBinary) {
+			// binary entries of a zip file are copied as they are
+			return false, rewrite.ErrKeep
+		}
+		return counts.total() > 0, err
+	})
+	return counts, err
+}
+
+// stream redacts in line by line, keeping the line endings
+func (r *Redactor) stream(in io.Reader, out io.Writer, counts Counts) error {
+	reader := bufio.NewReaderSize(in, 64*1024)
+	head, err := reader.Peek(sniffSize)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, bufio.ErrBufferFull) {
+		return err
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return errBinary
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if len(line) > 0 {
+			if _, werr := io.WriteString(out, r.Text(line, counts)); werr != nil {
+				return werr
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// WriteReport writes the report as indented json
+func WriteReport(report Report, fileName string) error {
+	var data bytes.Buffer
+	encoder := json.NewEncoder(&data)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return fmt.Errorf("unable to marshal the redaction report due to error %v", err)
+	}
+	if err := os.WriteFile(filepath.Clean(fileName), data.Bytes(), 0600); err != nil {
+		return fmt.Errorf("unable to write %v due to error %v", fileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package redaction applies the user defined redaction rules of ddc.yaml to the collected files
+package redaction
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Rule is one named redaction rule, every match of Pattern is replaced by Replacement which can refer
+// to the groups of the pattern as $1 or ${name}
+type Rule struct {
+	Name        string `yaml:"name" json:"name"`
+	Pattern     string `yaml:"pattern" json:"pattern"`
+	Replacement string `yaml:"replacement" json:"replacement"`
+}
+
+// DefaultReplacement is used for a rule without a replacement
+func DefaultReplacement(name string) string {
+	return "<REDACTED_" + strings.ToUpper(name) + ">"
+}
+
+type compiledRule struct {
+	Rule
+	re *regexp.Regexp
+}
+
+// Redactor applies a list of rules in order
+type Redactor struct {
+	rules []compiledRule
+}
+
+// New compiles the rules, names must be unique so the report can tell them apart
+func New(rules []Rule) (*Redactor, error) {
+	r := &Redactor{}
+	names := make(map[string]bool)
+	for i, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("redaction rule %v has no name", i+1)
+		}
+		if names[rule.Name] {
+			return nil, fmt.Errorf("redaction rule '%v' is listed more than once", rule.Name)
+		}
+		names[rule.Name] = true
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("redaction rule '%v' has no pattern", rule.Name)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("redaction rule '%v' has an invalid pattern due to error %v", rule.Name, err)
+		}
+		if re.MatchString("") {
+			return nil, fmt.Errorf("redaction rule '%v' matches empty text", rule.Name)
+		}
+		if rule.Replacement == "" {
+			rule.Replacement = DefaultReplacement(rule.Name)
+		}
+		r.rules = append(r.rules, compiledRule{Rule: rule, re: re})
+	}
+	return r, nil
+}
+
+// Rules returns the rules with their default replacements filled in
+func (r *Redactor) Rules() []Rule {
+	var rules []Rule
+	for _, rule := range r.rules {
+		rules = append(rules, rule.Rule)
+	}
+	return rules
+}
+
+// Counts is the number of matches of each rule by name
+type Counts map[string]int
+
+func (c Counts) add(other Counts) {
+	for k, v := range other {
+		c[k] += v
+	}
+}
+
+func (c Counts) total() int {
+	var total int
+	for _, v := range c {
+		total += v
+	}
+	return total
+}
+
+// Text applies every rule to s in order and adds the matches to counts
+func (r *Redactor) Text(s string, counts Counts) string {
+	for _, rule := range r.rules {
+		matches := rule.re.FindAllStringSubmatchIndex(s, -1)
+		if len(matches) == 0 {
+			continue
+		}
+		counts[rule.Name] += len(matches)
+		var b []byte
+		last := 0
+		for _, m := range matches {
+			b = append(b, s[last:m[0]]...)
+			b = rule.re.ExpandString(b, rule.Replacement, s, m)
+			last = m[1]
+		}
+		b = append(b, s[last:]...)
+		s = string(b)
+	}
+	return s
+}
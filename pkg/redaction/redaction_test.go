@@ -0,0 +1,215 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package redaction applies the user defined redaction rules of ddc.yaml to the collected files
+package redaction
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testRules = []Rule{
+	{Name: "email", Pattern: `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	{Name: "aws-account", Pattern: `(arn:aws:[a-z0-9-]*:[a-z0-9-]*:)\d{12}`, Replacement: "${1}<ACCOUNT>"},
+}
+
+func newTestRedactor(t *testing.T) *Redactor {
+	t.Helper()
+	r, err := New(testRules)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return r
+}
+
+func TestText(t *testing.T) {
+	r := newTestRedactor(t)
+	counts := make(Counts)
+	actual := r.Text("user bob@example.com and amy@example.org assumed arn:aws:iam::123456789012:role/dremio\n", counts)
+	expected := "user <REDACTED_EMAIL> and <REDACTED_EMAIL> assumed arn:aws:iam::<ACCOUNT>:role/dremio\n"
+	if actual != expected {
+		t.Errorf("\nexpected %q\nactual   %q", expected, actual)
+	}
+	if !reflect.DeepEqual(counts, Counts{"email": 2, "aws-account": 1}) {
+		t.Errorf("unexpected counts %v", counts)
+	}
+}
+
+func TestNewRejectsBadRules(t *testing.T) {
+	tests := map[string][]Rule{
+		"has no name":              {{Pattern: "a"}},
+		"has no pattern":           {{Name: "a"}},
+		"has an invalid pattern":   {{Name: "a", Pattern: "("}},
+		"matches empty text":       {{Name: "a", Pattern: "a*"}},
+		"is listed more than once": {{Name: "a", Pattern: "a"}, {Name: "a", Pattern: "b"}},
+	}
+	for expected, rules := range tests {
+		_, err := New(rules)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected an error containing '%v' but was %v", expected, err)
+		}
+	}
+}
+
+func writeFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func gzipped(t *testing.T, text string) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write([]byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func gunzipped(t *testing.T, name string) string {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	serverLog := "2024-03-01 10:00:00,000 [main] INFO  c.d.Login - login bob@example.com\nno match here"
+	writeFile(t, filepath.Join(dir, "logs", "server.log"), []byte(serverLog))
+	writeFile(t, filepath.Join(dir, "logs", "archive", "server.2024-02-29.log.gz"), gzipped(t, "from amy@example.org\n"))
+	writeFile(t, filepath.Join(dir, "logs", "broken.log.gz"), []byte("not gzipped bob@example.com"))
+	writeFile(t, filepath.Join(dir, "heap.hprof"), []byte("JAVA PROFILE\x00bob@example.com"))
+	writeFile(t, filepath.Join(dir, "untouched.json"), []byte(`{"a": 1}`))
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	for name, content := range map[string]string{"header.json": `{"user":"bob@example.com"}`, "profile.bin": "\x00\x01bob@example.com"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(dir, "job-profiles", "1b9b9629.zip"), zipped.Bytes())
+
+	report, err := newTestRedactor(t).Dir(dir, 3)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "logs", "server.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := strings.Replace(serverLog, "bob@example.com", "<REDACTED_EMAIL>", 1); string(data) != expected {
+		t.Errorf("\nexpected %q\nactual   %q", expected, string(data))
+	}
+	if actual := gunzipped(t, filepath.Join(dir, "logs", "archive", "server.2024-02-29.log.gz")); actual != "from <REDACTED_EMAIL>\n" {
+		t.Errorf("unexpected gzipped log %q", actual)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logs", "broken.log.gz")); err == nil {
+		t.Error("expected the file that could not be redacted to be removed")
+	}
+
+	zr, err := zip.OpenReader(filepath.Join(dir, "job-profiles", "1b9b9629.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	entries := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+		entries[f.Name] = string(content)
+	}
+	if entries["header.json"] != `{"user":"<REDACTED_EMAIL>"}` {
+		t.Errorf("unexpected header.json %q", entries["header.json"])
+	}
+	if entries["profile.bin"] != "\x00\x01bob@example.com" {
+		t.Errorf("expected the binary entry to be copied as it was but was %q", entries["profile.bin"])
+	}
+
+	expectedFiles := []FileReport{
+		{File: "job-profiles/1b9b9629.zip", Matches: Counts{"email": 1}},
+		{File: "logs/archive/server.2024-02-29.log.gz", Matches: Counts{"email": 1}},
+		{File: "logs/server.log", Matches: Counts{"email": 1}},
+	}
+	if !reflect.DeepEqual(expectedFiles, report.Files) {
+		t.Errorf("\nexpected %v\nactual   %v", expectedFiles, report.Files)
+	}
+	if len(report.Skipped) != 2 || report.Skipped[0].File != "heap.hprof" || report.Skipped[0].Reason != "binary" ||
+		report.Skipped[1].File != "logs/broken.log.gz" || !strings.HasPrefix(report.Skipped[1].Reason, "removed") {
+		t.Errorf("unexpected skipped files %v", report.Skipped)
+	}
+	if report.Rules[0].Matches != 3 || report.Rules[1].Matches != 0 || report.Rules[0].Replacement != "<REDACTED_EMAIL>" {
+		t.Errorf("unexpected rules %v", report.Rules)
+	}
+
+	reportFile := filepath.Join(dir, ReportFileName)
+	if err := WriteReport(report, reportFile); err != nil {
+		t.Fatal(err)
+	}
+	var written Report
+	b, err := os.ReadFile(reportFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(b, &written); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(written, report) {
+		t.Errorf("\nexpected %v\nactual   %v", report, written)
+	}
+}
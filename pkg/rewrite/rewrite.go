@@ -0,0 +1,152 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package rewrite replaces collected files in place with a transformed copy, looking inside
+// gzipped files and zip archives such as job profiles
+package rewrite
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/pgzip"
+)
+
+// ErrKeep is returned by a Transform for a zip entry that is to be copied as it was
+var ErrKeep = errors.New("keep the content as it was")
+
+// Transform writes the transformed in to out and reports whether anything changed. name is empty for
+// plain and gzipped files and the entry name for the entries of a zip file
+type Transform func(name string, in io.Reader, out io.Writer) (bool, error)
+
+// File applies fn to path, or to the content of a .gz file or each entry of a .zip file, and replaces
+// path with the result when fn changed something. An error leaves path as it was
+func File(path string, fn Transform) (bool, error) {
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		return replace(path, func(in *os.File, out io.Writer) (bool, error) {
+			return zipEntries(in, out, fn)
+		})
+	case strings.HasSuffix(path, ".gz"):
+		return replace(path, func(in *os.File, out io.Writer) (bool, error) {
+			gz, err := gzip.NewReader(in)
+			if err != nil {
+				return false, err
+			}
+			w := pgzip.NewWriter(out)
+			changed, err := fn("", gz, w)
+			if err != nil {
+				return false, err
+			}
+			return changed, w.Close()
+		})
+	default:
+		return replace(path, func(in *os.File, out io.Writer) (bool, error) {
+			return fn("", in, out)
+		})
+	}
+}
+
+// replace writes the new content of path to a temporary file next to it and renames it over path
+// when something changed
+func replace(path string, write func(in *os.File, out io.Writer) (bool, error)) (bool, error) {
+	in, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return false, err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return false, err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".rewriting-*")
+	if err != nil {
+		return false, err
+	}
+	tmpName := tmp.Name()
+	defer func() {
+		// a no-op once the file was renamed
+		_ = os.Remove(tmpName)
+	}()
+	out := bufio.NewWriter(tmp)
+	changed, err := write(in, out)
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := tmp.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := os.Chmod(tmpName, info.Mode().Perm()); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmpName, path)
+}
+
+// zipEntries applies fn to every file of a zip archive, entries fn keeps are copied as they were
+func zipEntries(in *os.File, out io.Writer, fn Transform) (bool, error) {
+	info, err := in.Stat()
+	if err != nil {
+		return false, err
+	}
+	zr, err := zip.NewReader(in, info.Size())
+	if err != nil {
+		return false, err
+	}
+	zw := zip.NewWriter(out)
+	var changed bool
+	for _, entry := range zr.File {
+		header := entry.FileHeader
+		w, err := zw.CreateHeader(&header)
+		if err != nil {
+			return false, err
+		}
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		rc, err := entry.Open()
+		if err != nil {
+			return false, err
+		}
+		data, err := io.ReadAll(rc)
+		if closeErr := rc.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return false, err
+		}
+		var transformed bytes.Buffer
+		entryChanged, err := fn(entry.Name, bytes.NewReader(data), &transformed)
+		switch {
+		case errors.Is(err, ErrKeep):
+			_, err = w.Write(data)
+		case err == nil:
+			changed = changed || entryChanged
+			_, err = w.Write(transformed.Bytes())
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return changed, zw.Close()
+}
@@ -0,0 +1,250 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverlog
+
+import (
+	"compress/gzip"
+	"crypto/sha1" // #nosec G505 only used to name fingerprints
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/simplelog"
+)
+
+const (
+	SummaryFileName = "server-log-errors.json"
+	// DefaultFrames is how many frames from the top of the stack are used in a fingerprint
+	DefaultFrames = 3
+	// sampleLines limits how much of the first event is kept as a sample
+	sampleLines = 40
+)
+
+// Fingerprint is a group of events that share the same exception and top stack frames,
+// or the same logger and message when there is no stack trace
+type Fingerprint struct {
+	ID             string    `json:"id"`
+	Level          string    `json:"level"`
+	Logger         string    `json:"logger"`
+	ExceptionClass string    `json:"exceptionClass"`
+	RootCause      string    `json:"rootCause"`
+	Frames         []string  `json:"frames"`
+	Message        string    `json:"message"`
+	Count          int       `json:"count"`
+	FirstSeen      time.Time `json:"firstSeen"`
+	LastSeen       time.Time `json:"lastSeen"`
+	Nodes          []string  `json:"nodes"`
+	Sample         string    `json:"sample"`
+}
+
+// Summary is what is written to server-log-errors.json for each node
+type Summary struct {
+	Node         string        `json:"node"`
+	Files        []string      `json:"files"`
+	LinesRead    int           `json:"linesRead"`
+	Fingerprints []Fingerprint `json:"fingerprints"`
+}
+
+var (
+	// used to collapse ids, numbers and durations so the same message groups together
+	variableParts   = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|0x[0-9a-fA-F]+|\d+`)
+	exceptionHeader = regexp.MustCompile(`^(?:Caused by: |Suppressed: )?((?:[a-zA-Z_$][\w$]*\.)+[\w$]*(?:Exception|Error|Throwable)[\w$]*)(?::|$)`)
+	frameLineNumber = regexp.MustCompile(`:\d+\)$`)
+	// lambdas, proxies and reflection accessors get a new number on every jvm start
+	generatedNames = regexp.MustCompile(`\$\$Lambda\$\d+/(?:0x)?[0-9a-fA-F]+|\$Proxy\d+|GeneratedMethodAccessor\d+|GeneratedConstructorAccessor\d+|\$\d+`)
+)
+
+// NormalizeMessage collapses the parts of a message that change between occurrences
+func NormalizeMessage(msg string) string {
+	return variableParts.ReplaceAllString(msg, "#")
+}
+
+// normalizeFrame drops the line number and generated names from "at a.b.C.m(C.java:12)"
+func normalizeFrame(frame string) string {
+	frame = strings.TrimPrefix(strings.TrimSpace(frame), "at ")
+	frame = frameLineNumber.ReplaceAllString(frame, ")")
+	return generatedNames.ReplaceAllStringFunc(frame, NormalizeMessage)
+}
+
+// fingerprint returns the exception class, root cause and the top frames of where the
+// root cause was thrown, all empty when the event has no stack trace
+func fingerprint(e Event, frames int) (string, string, []string) {
+	var exceptionClass, rootCause string
+	var sectionFrames []string
+	for _, line := range e.Stack {
+		trimmed := strings.TrimSpace(line)
+		if m := exceptionHeader.FindStringSubmatch(trimmed); m != nil {
+			if strings.HasPrefix(trimmed, "Suppressed: ") {
+				continue
+			}
+			if exceptionClass == "" {
+				exceptionClass = m[1]
+			} else {
+				rootCause = m[1]
+			}
+			sectionFrames = nil
+			continue
+		}
+		if strings.HasPrefix(trimmed, "at ") && exceptionClass != "" && len(sectionFrames) < frames {
+			sectionFrames = append(sectionFrames, normalizeFrame(trimmed))
+		}
+	}
+	return exceptionClass, rootCause, sectionFrames
+}
+
+// Aggregator groups ERROR and WARN events from any number of files and nodes
+type Aggregator struct {
+	pattern *Pattern
+	frames  int
+	byID    map[string]*Fingerprint
+	nodes   map[string]map[string]bool
+}
+
+// NewAggregator uses pattern to split the logs into events and frames top stack frames to fingerprint them
+func NewAggregator(pattern *Pattern, frames int) *Aggregator {
+	return &Aggregator{
+		pattern: pattern,
+		frames:  frames,
+		byID:    make(map[string]*Fingerprint),
+		nodes:   make(map[string]map[string]bool),
+	}
+}
+
+func (a *Aggregator) record(fp Fingerprint, node string) {
+	existing, ok := a.byID[fp.ID]
+	if !ok {
+		copied := fp
+		copied.Nodes = nil
+		a.byID[fp.ID] = &copied
+		a.nodes[fp.ID] = make(map[string]bool)
+		existing = &copied
+	} else {
+		existing.Count += fp.Count
+		if !fp.FirstSeen.IsZero() && (existing.FirstSeen.IsZero() || fp.FirstSeen.Before(existing.FirstSeen)) {
+			existing.FirstSeen = fp.FirstSeen
+		}
+		if fp.LastSeen.After(existing.LastSeen) {
+			existing.LastSeen = fp.LastSeen
+		}
+	}
+	if node != "" {
+		a.nodes[fp.ID][node] = true
+	}
+	for _, n := range fp.Nodes {
+		a.nodes[fp.ID][n] = true
+	}
+}
+
+// Add records a single event, anything other than ERROR and WARN is ignored
+func (a *Aggregator) Add(node string, e Event) {
+	if e.Level != "ERROR" && e.Level != "WARN" {
+		return
+	}
+	exceptionClass, rootCause, frames := fingerprint(e, a.frames)
+	message := NormalizeMessage(e.Message)
+	var key string
+	if exceptionClass != "" {
+		key = strings.Join(append([]string{e.Level, e.Logger, exceptionClass, rootCause}, frames...), "|")
+	} else {
+		key = strings.Join([]string{e.Level, e.Logger, message}, "|")
+	}
+	sum := sha1.Sum([]byte(key)) // #nosec G401 not used for security
+	id := hex.EncodeToString(sum[:])[:12]
+	if _, ok := a.byID[id]; ok {
+		a.record(Fingerprint{ID: id, Count: 1, FirstSeen: e.Time, LastSeen: e.Time}, node)
+		return
+	}
+	sample := append([]string{e.Message}, e.Stack...)
+	if len(sample) > sampleLines {
+		sample = append(sample[:sampleLines], fmt.Sprintf("... %v more lines", len(e.Stack)+1-sampleLines))
+	}
+	a.record(Fingerprint{
+		ID:             id,
+		Level:          e.Level,
+		Logger:         e.Logger,
+		ExceptionClass: exceptionClass,
+		RootCause:      rootCause,
+		Frames:         append([]string{}, frames...),
+		Message:        message,
+		Count:          1,
+		FirstSeen:      e.Time,
+		LastSeen:       e.Time,
+		Sample:         strings.Join(sample, "\n"),
+	}, node)
+}
+
+// AddReader reads every event in r and returns how many lines were read
+func (a *Aggregator) AddReader(node string, r io.Reader) (int, error) {
+	return a.pattern.Events(r, func(e Event) {
+		a.Add(node, e)
+	})
+}
+
+// AddFile reads a server.log, files ending with .gz such as the archives are decompressed
+func (a *Aggregator) AddFile(node, fileName string) (int, error) {
+	f, err := os.Open(filepath.Clean(fileName))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			simplelog.Debugf("optional close of %v failed %v", fileName, err)
+		}
+	}()
+	var r io.Reader = f
+	if strings.HasSuffix(fileName, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return 0, fmt.Errorf("unable to read gzip file %v due to error %w", fileName, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return a.AddReader(node, r)
+}
+
+// Merge folds in fingerprints computed elsewhere, such as the summary of another node
+func (a *Aggregator) Merge(fingerprints []Fingerprint) {
+	for _, fp := range fingerprints {
+		a.record(fp, "")
+	}
+}
+
+// Results returns the fingerprints with the most frequent first
+func (a *Aggregator) Results() []Fingerprint {
+	results := make([]Fingerprint, 0, len(a.byID))
+	for id, fp := range a.byID {
+		result := *fp
+		result.Nodes = []string{}
+		for n := range a.nodes[id] {
+			result.Nodes = append(result.Nodes, n)
+		}
+		sort.Strings(result.Nodes)
+		results = append(results, result)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Count == results[j].Count {
+			return results[i].ID < results[j].ID
+		}
+		return results[i].Count > results[j].Count
+	})
+	return results
+}
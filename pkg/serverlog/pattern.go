@@ -0,0 +1,208 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package serverlog reads Dremio's logback based server.log files and groups the errors and
+// warnings in them by exception and stack so the same problem shows up once with a count
+package serverlog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/logback"
+)
+
+// DefaultPattern is the encoder pattern Dremio ships for server.log
+const DefaultPattern = "%date{ISO8601} [%thread] %-5level %logger{36} - %msg%n"
+
+// Event is one log statement with any stack trace lines that followed it
+type Event struct {
+	Time    time.Time
+	Thread  string
+	Level   string
+	Logger  string
+	Message string
+	Stack   []string
+}
+
+// Pattern matches the first line of each event written with a logback pattern layout
+type Pattern struct {
+	re         *regexp.Regexp
+	timeLayout string
+	timeGroup  int
+	thread     int
+	level      int
+	logger     int
+	message    int
+}
+
+var conversion = regexp.MustCompile(`%(-?\d*(?:\.-?\d+)?)([a-zA-Z]+)((?:\{[^}]*\})*)`)
+
+// CompilePattern turns a logback pattern layout into a Pattern, conversion words that are
+// not understood match anything so a customised pattern still finds the level and message
+func CompilePattern(pattern string) (*Pattern, error) {
+	p := &Pattern{}
+	var re strings.Builder
+	re.WriteString("^")
+	group := 0
+	last := 0
+	pattern = strings.ReplaceAll(pattern, "%%", "\x00")
+	for _, loc := range conversion.FindAllStringSubmatchIndex(pattern, -1) {
+		re.WriteString(regexp.QuoteMeta(strings.ReplaceAll(pattern[last:loc[0]], "\x00", "%")))
+		last = loc[1]
+		padded := pattern[loc[2]:loc[3]] != ""
+		word := pattern[loc[4]:loc[5]]
+		arg := strings.Trim(pattern[loc[6]:loc[7]], "{}")
+		var part string
+		switch word {
+		case "d", "date":
+			layout, dateRe := logback.DateFormat(strings.Split(arg, ",")[0])
+			p.timeLayout = layout
+			group++
+			p.timeGroup = group
+			part = "(" + dateRe + ")"
+		case "t", "thread":
+			group++
+			p.thread = group
+			part = "(.*?)"
+		case "p", "le", "level":
+			group++
+			p.level = group
+			part = `([A-Z]+)`
+		case "c", "lo", "logger":
+			group++
+			p.logger = group
+			part = `(\S+)`
+		case "m", "msg", "message":
+			group++
+			p.message = group
+			part = "(.*)"
+		case "n":
+			part = ""
+		case "ex", "exception", "throwable", "xEx", "xException", "xThrowable", "rEx", "rootException", "nopex", "nopexception":
+			part = ""
+		default:
+			part = ".*?"
+		}
+		if padded && part != "" {
+			part = " *" + part + " *"
+		}
+		re.WriteString(part)
+	}
+	re.WriteString(regexp.QuoteMeta(strings.ReplaceAll(pattern[last:], "\x00", "%")))
+	re.WriteString("$")
+	if p.level == 0 || p.message == 0 {
+		return nil, fmt.Errorf("pattern %q has no level or message so events cannot be found", pattern)
+	}
+	compiled, err := regexp.Compile(re.String())
+	if err != nil {
+		return nil, fmt.Errorf("unable to compile pattern %q due to error %w", pattern, err)
+	}
+	p.re = compiled
+	return p, nil
+}
+
+// MustDefaultPattern returns the compiled DefaultPattern
+func MustDefaultPattern() *Pattern {
+	p, err := CompilePattern(DefaultPattern)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// match parses the first line of an event, false means the line is a continuation
+func (p *Pattern) match(line string) (Event, bool) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return Event{}, false
+	}
+	e := Event{
+		Level:   m[p.level],
+		Message: m[p.message],
+	}
+	if p.thread > 0 {
+		e.Thread = m[p.thread]
+	}
+	if p.logger > 0 {
+		e.Logger = m[p.logger]
+	}
+	if p.timeGroup > 0 {
+		if t, err := time.Parse(p.timeLayout, m[p.timeGroup]); err == nil {
+			e.Time = t
+		}
+	}
+	return e, true
+}
+
+// EventTime reports whether line starts an event and when it was logged. Dates without a zone are
+// read in the local time of the node as that is what logback writes, the time is zero when the
+// pattern has no %date
+func (p *Pattern) EventTime(line string) (time.Time, bool) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return time.Time{}, false
+	}
+	if p.timeGroup == 0 {
+		return time.Time{}, true
+	}
+	t, err := time.ParseInLocation(p.timeLayout, m[p.timeGroup], time.Local)
+	if err != nil {
+		return time.Time{}, true
+	}
+	return t, true
+}
+
+// Events calls fn for each event in r and returns the number of lines read
+func (p *Pattern) Events(r io.Reader, fn func(Event)) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	var lines int
+	var current *Event
+	for scanner.Scan() {
+		lines++
+		line := scanner.Text()
+		if e, ok := p.match(line); ok {
+			if current != nil {
+				fn(*current)
+			}
+			current = &e
+			continue
+		}
+		if current != nil {
+			current.Stack = append(current.Stack, line)
+		}
+	}
+	if current != nil {
+		fn(*current)
+	}
+	return lines, scanner.Err()
+}
+
+// PatternFromLogback finds the pattern of the appender writing server.log in a logback.xml,
+// an empty string is returned when there is no such appender
+func PatternFromLogback(data []byte) (string, error) {
+	appenders, err := logback.Parse(data, nil)
+	if err != nil {
+		return "", fmt.Errorf("unable to read logback.xml due to error %w", err)
+	}
+	if a, ok := logback.FindByFile(appenders, "server.log"); ok {
+		return a.Pattern, nil
+	}
+	return "", nil
+}
@@ -0,0 +1,157 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serverlog_test
+
+import (
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/serverlog"
+)
+
+func TestAggregateGroupsByStack(t *testing.T) {
+	a := serverlog.NewAggregator(serverlog.MustDefaultPattern(), serverlog.DefaultFrames)
+	lines, err := a.AddFile("node1", filepath.Join("testdata", "server.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines != 21 {
+		t.Errorf("expected 21 lines read but was %v", lines)
+	}
+	results := a.Results()
+	if len(results) != 2 {
+		t.Fatalf("expected 2 fingerprints but was %v: %#v", len(results), results)
+	}
+	hive := results[0]
+	if hive.Count != 2 || hive.ExceptionClass != "java.lang.RuntimeException" || hive.RootCause != "java.net.ConnectException" {
+		t.Errorf("unexpected fingerprint %#v", hive)
+	}
+	expectedFrames := []string{
+		"java.base/sun.nio.ch.Net.connect0(Native Method)",
+		"java.base/sun.nio.ch.Net.connect(Net.java)",
+		"com.dremio.exec.store.hive.HiveClient$#.run(HiveClient.java)",
+	}
+	if !reflect.DeepEqual(hive.Frames, expectedFrames) {
+		t.Errorf("expected frames %v but was %v", expectedFrames, hive.Frames)
+	}
+	if !hive.FirstSeen.Equal(time.Date(2024, 1, 1, 11, 0, 1, 0, time.UTC)) || !hive.LastSeen.Equal(time.Date(2024, 1, 1, 11, 0, 2, 0, time.UTC)) {
+		t.Errorf("unexpected first and last seen %v %v", hive.FirstSeen, hive.LastSeen)
+	}
+	if !strings.Contains(hive.Sample, "Caused by: java.net.ConnectException") {
+		t.Errorf("expected the stack in the sample but was %v", hive.Sample)
+	}
+	warn := results[1]
+	if warn.Count != 2 || warn.Message != "reflection # refresh is late" || warn.ExceptionClass != "" {
+		t.Errorf("unexpected fingerprint %#v", warn)
+	}
+}
+
+func TestAggregateGzipAndMerge(t *testing.T) {
+	gzFile := filepath.Join(t.TempDir(), "server.2024-01-01.0.log.gz")
+	data, err := os.ReadFile(filepath.Join("testdata", "server.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(gzFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	if _, err := gz.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	node2 := serverlog.NewAggregator(serverlog.MustDefaultPattern(), serverlog.DefaultFrames)
+	if _, err := node2.AddFile("node2", gzFile); err != nil {
+		t.Fatal(err)
+	}
+	all := serverlog.NewAggregator(serverlog.MustDefaultPattern(), serverlog.DefaultFrames)
+	if _, err := all.AddFile("node1", filepath.Join("testdata", "server.log")); err != nil {
+		t.Fatal(err)
+	}
+	all.Merge(node2.Results())
+	results := all.Results()
+	if len(results) != 2 || results[0].Count != 4 {
+		t.Fatalf("expected the counts of both nodes to be added but was %#v", results)
+	}
+	if !reflect.DeepEqual(results[0].Nodes, []string{"node1", "node2"}) {
+		t.Errorf("expected both nodes but was %v", results[0].Nodes)
+	}
+}
+
+func TestPatternFromLogback(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "logback.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pattern, err := serverlog.PatternFromLogback(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "%d{yyyy-MM-dd'T'HH:mm:ss.SSSXXX} %-5level [%thread] %logger - %X{queryId} %msg%n"
+	if pattern != expected {
+		t.Fatalf("expected the server.log appender pattern %v but was %v", expected, pattern)
+	}
+	p, err := serverlog.CompilePattern(pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := serverlog.NewAggregator(p, serverlog.DefaultFrames)
+	if _, err := a.AddFile("node1", filepath.Join("testdata", "server-custom.log")); err != nil {
+		t.Fatal(err)
+	}
+	results := a.Results()
+	if len(results) != 1 {
+		t.Fatalf("expected only the error but was %#v", results)
+	}
+	r := results[0]
+	if r.Logger != "com.dremio.Foo" || r.ExceptionClass != "java.lang.IllegalStateException" || r.Frames[0] != "com.dremio.Foo.run(Foo.java)" {
+		t.Errorf("unexpected fingerprint %#v", r)
+	}
+	if !r.FirstSeen.Equal(time.Date(2024, 1, 1, 10, 0, 1, 0, time.UTC)) {
+		t.Errorf("expected the offset to be applied but was %v", r.FirstSeen)
+	}
+}
+
+func TestCompilePatternNeedsLevelAndMessage(t *testing.T) {
+	if _, err := serverlog.CompilePattern("%date %thread%n"); err == nil {
+		t.Error("expected an error for a pattern without a level or message")
+	}
+}
+
+func TestEventTime(t *testing.T) {
+	p := serverlog.MustDefaultPattern()
+	at, ok := p.EventTime("2024-01-02 10:15:32,410 [main] ERROR c.d.dac.server.DremioServer - failed")
+	if !ok {
+		t.Fatal("expected the line to start an event")
+	}
+	expected := time.Date(2024, 1, 2, 10, 15, 32, 410000000, time.Local)
+	if !at.Equal(expected) {
+		t.Errorf("expected %v but was %v", expected, at)
+	}
+	if _, ok := p.EventTime("\tat java.lang.Thread.run(Thread.java:750)"); ok {
+		t.Error("expected a stack frame not to start an event")
+	}
+}
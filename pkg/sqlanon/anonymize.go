@@ -0,0 +1,378 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package sqlanon replaces the literals of sql text and query plans with typed placeholders so
+// queries.json and job profiles can be shared without the values customers query for
+package sqlanon
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Placeholders written in place of the literals
+const (
+	StringPlaceholder  = "'<STRING>'"
+	IntegerPlaceholder = "<INTEGER>"
+	DecimalPlaceholder = "<DECIMAL>"
+	CommentPlaceholder = "<COMMENT>"
+)
+
+// typedStrings are the keywords that turn the string after them into a typed literal, DATE '2024-01-01'
+// becomes DATE '<DATE>'
+var typedStrings = map[string]string{
+	"DATE":      "'<DATE>'",
+	"TIME":      "'<TIME>'",
+	"TIMESTAMP": "'<TIMESTAMP>'",
+	"INTERVAL":  "'<INTERVAL>'",
+	"X":         "'<BINARY>'",
+}
+
+// typeNames are the types whose precision and scale are kept, VARCHAR(255) is structure not data
+var typeNames = map[string]bool{
+	"CHAR": true, "CHARACTER": true, "VARCHAR": true, "BINARY": true, "VARBINARY": true,
+	"DECIMAL": true, "DEC": true, "NUMERIC": true, "FLOAT": true, "TIME": true, "TIMESTAMP": true,
+}
+
+// positionKeywords are followed by a row count or offset that is kept
+var positionKeywords = map[string]bool{
+	"LIMIT": true, "OFFSET": true, "FIRST": true, "NEXT": true, "TOP": true,
+}
+
+// maxOrdinal is the largest column position kept in ORDER BY and GROUP BY, a larger number is a literal
+const maxOrdinal = 999
+
+// orderingWords may follow a column position in ORDER BY without ending the list of positions
+var orderingWords = map[string]bool{
+	"ASC": true, "DESC": true, "NULLS": true, "FIRST": true, "LAST": true,
+}
+
+// tableKeywords are followed by the name of a table, view or source path
+var tableKeywords = map[string]bool{
+	"FROM": true, "JOIN": true, "INTO": true, "UPDATE": true, "TABLE": true,
+}
+
+// endOfFrom are the keywords ending a from clause and its comma separated tables
+var endOfFrom = map[string]bool{
+	"WHERE": true, "GROUP": true, "ORDER": true, "HAVING": true, "LIMIT": true, "OFFSET": true, "FETCH": true,
+	"UNION": true, "EXCEPT": true, "INTERSECT": true, "MINUS": true, "ON": true, "USING": true, "QUALIFY": true,
+	"WINDOW": true, "SET": true, "VALUES": true, "SELECT": true, "AT": true,
+}
+
+// fromFunctions take FROM as part of their arguments, EXTRACT(YEAR FROM col)
+var fromFunctions = map[string]bool{
+	"EXTRACT": true, "SUBSTRING": true, "TRIM": true, "OVERLAY": true, "POSITION": true,
+}
+
+// notTables can follow FROM or JOIN without being a table
+var notTables = map[string]bool{
+	"LATERAL": true, "UNNEST": true, "SELECT": true, "VALUES": true, "TABLE": true,
+}
+
+// Options changes what is anonymized on top of the literals
+type Options struct {
+	// HashTableNames replaces every part of the paths of the tables, views and sources queried with a
+	// hash of it, the same name always gets the same hash so joins and repeated queries still line up
+	HashTableNames bool
+}
+
+// Anonymizer rewrites sql, plans and the json documents holding them
+type Anonymizer struct {
+	opts Options
+}
+
+// New returns an Anonymizer for the options
+func New(opts Options) *Anonymizer {
+	return &Anonymizer{opts: opts}
+}
+
+type mode int
+
+const (
+	modeSQL mode = iota
+	modePlan
+)
+
+// SQL replaces the string and numeric literals and the comments of sql with typed placeholders. The
+// numbers that are part of the structure, LIMIT 10, VARCHAR(255) and the column positions of ORDER BY 1
+// and GROUP BY 1, 2, are kept
+func (a *Anonymizer) SQL(sql string) string {
+	return a.rewrite(sql, modeSQL)
+}
+
+// Plan replaces the literals of a text query plan. Plans carry row counts and costs outside of the
+// operator attributes so only the numbers inside the brackets, condition=[=($0, 42)], are replaced
+func (a *Anonymizer) Plan(plan string) string {
+	return a.rewrite(plan, modePlan)
+}
+
+// DatasetPath hashes each part of a dataset path such as Samples."samples.dremio.com"."zips.json" the
+// same way as the table names of sql, it is returned as it was when table names are not hashed
+func (a *Anonymizer) DatasetPath(path string) string {
+	if !a.opts.HashTableNames {
+		return path
+	}
+	var b strings.Builder
+	for _, t := range tokenize(path) {
+		switch t.kind {
+		case kindWord, kindQuotedIdent:
+			b.WriteString(hashIdent(t))
+		default:
+			b.WriteString(t.text)
+		}
+	}
+	return b.String()
+}
+
+// hashIdent hashes one part of a path, names are compared without case and quotes so "Samples" and
+// samples give the same hash
+func hashIdent(t token) string {
+	name := t.text
+	quote := ""
+	if t.kind == kindQuotedIdent {
+		quote = name[:1]
+		name = strings.Trim(name, quote)
+		name = strings.ReplaceAll(name, quote+quote, quote)
+	}
+	sum := sha256.Sum256([]byte(strings.ToLower(name)))
+	return quote + "t_" + hex.EncodeToString(sum[:])[:10] + quote
+}
+
+// significant returns the index of the next token that is not a space or comment, or len(tokens)
+func significant(tokens []token, i int) int {
+	for i < len(tokens) && (tokens[i].kind == kindSpace || tokens[i].kind == kindComment) {
+		i++
+	}
+	return i
+}
+
+// paren is an open parenthesis, fn is the upper cased word before it
+type paren struct {
+	fn string
+}
+
+func (a *Anonymizer) rewrite(text string, m mode) string {
+	tokens := tokenize(text)
+	out := make([]string, len(tokens))
+	// the last significant token, upper cased when it is a word
+	prev := ""
+	prevKind := kindSpace
+	// ordinals is set while reading the column positions of ORDER BY or GROUP BY
+	ordinals := false
+	var parens []paren
+	// the paren depths of the from clauses being read, subqueries nest them
+	var froms []int
+	inFrom := func() bool {
+		return len(froms) > 0 && froms[len(froms)-1] == len(parens)
+	}
+	brackets := 0
+	tableBrackets := -1
+	expectTable := false
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		out[i] = t.text
+		kept := false
+		switch t.kind {
+		case kindSpace:
+			continue
+		case kindComment:
+			if strings.HasPrefix(t.text, "--") {
+				out[i] = "-- " + CommentPlaceholder
+			} else {
+				out[i] = "/* " + CommentPlaceholder + " */"
+			}
+			continue
+		case kindString:
+			out[i] = StringPlaceholder
+			if typed, ok := typedStrings[prev]; ok && prevKind == kindWord {
+				out[i] = typed
+			}
+		case kindNumber:
+			inType := len(parens) > 0 && typeNames[parens[len(parens)-1].fn]
+			ordinal := ordinals && (prev == "BY" || prev == ",") && isOrdinal(t.text)
+			position := prevKind == kindWord && positionKeywords[prev] || ordinal
+			switch {
+			case inType, m == modeSQL && position, m == modePlan && brackets == 0:
+				kept = true
+			case strings.ContainsAny(t.text, ".eE"):
+				out[i] = DecimalPlaceholder
+			default:
+				out[i] = IntegerPlaceholder
+			}
+		case kindPunct:
+			switch t.text {
+			case "(":
+				fn := ""
+				if prevKind == kindWord {
+					fn = prev
+				}
+				parens = append(parens, paren{fn: fn})
+			case ")":
+				if len(parens) > 0 {
+					parens = parens[:len(parens)-1]
+				}
+				for len(froms) > 0 && froms[len(froms)-1] > len(parens) {
+					froms = froms[:len(froms)-1]
+				}
+			case "[":
+				brackets++
+				if m == modePlan && a.opts.HashTableNames && tableBefore(tokens, i) {
+					tableBrackets = brackets
+				}
+			case "]":
+				if brackets == tableBrackets {
+					tableBrackets = -1
+				}
+				if brackets > 0 {
+					brackets--
+				}
+			case ",":
+				if m == modeSQL && inFrom() {
+					expectTable = true
+					prev, prevKind = t.text, t.kind
+					continue
+				}
+			}
+		case kindWord, kindQuotedIdent:
+			upper := strings.ToUpper(t.text)
+			isWord := t.kind == kindWord
+			if upper == "BY" && (prev == "ORDER" || prev == "GROUP") {
+				ordinals = true
+			} else if !isWord || !orderingWords[upper] {
+				ordinals = false
+			}
+			switch {
+			case tableBrackets > 0:
+				out[i] = hashIdent(t)
+			case m != modeSQL:
+			case isWord && endOfFrom[upper] && inFrom():
+				froms = froms[:len(froms)-1]
+			case isWord && tableKeywords[upper] && !(len(parens) > 0 && fromFunctions[parens[len(parens)-1].fn]):
+				if upper == "FROM" || upper == "JOIN" {
+					if !inFrom() {
+						froms = append(froms, len(parens))
+					}
+				}
+				prev, prevKind = upper, t.kind
+				expectTable = true
+				continue
+			case expectTable && a.opts.HashTableNames && !(isWord && notTables[upper]):
+				i = a.hashPath(tokens, i, out)
+				t = tokens[i]
+				upper = strings.ToUpper(t.text)
+			}
+			if t.kind == kindWord {
+				prev = upper
+			} else {
+				prev = t.text
+			}
+			prevKind, expectTable = t.kind, false
+			continue
+		}
+		expectTable = false
+		// 1, 2 in ORDER BY 1, 2 are both positions, anything else ends the list
+		ordinals = ordinals && (kept || t.text == ",")
+		prev, prevKind = t.text, t.kind
+	}
+	return strings.Join(out, "")
+}
+
+// isOrdinal is true for a column position, a whole number from 1 to maxOrdinal
+func isOrdinal(number string) bool {
+	n, err := strconv.Atoi(number)
+	return err == nil && n >= 1 && n <= maxOrdinal
+}
+
+// tableBefore is true when the bracket at i follows table=, as in the scans of a plan
+func tableBefore(tokens []token, i int) bool {
+	j := i - 1
+	for j >= 0 && tokens[j].kind == kindSpace {
+		j--
+	}
+	if j < 0 || tokens[j].text != "=" {
+		return false
+	}
+	j--
+	for j >= 0 && tokens[j].kind == kindSpace {
+		j--
+	}
+	return j >= 0 && strings.EqualFold(tokens[j].text, "table")
+}
+
+// hashPath hashes the dotted path starting at i unless it is a function call such as FROM flatten(...),
+// it returns the index of the last token of the path
+func (a *Anonymizer) hashPath(tokens []token, i int, out []string) int {
+	end := i
+	for {
+		next := end + 1
+		if next+1 < len(tokens) && tokens[next].text == "." && (tokens[next+1].kind == kindWord || tokens[next+1].kind == kindQuotedIdent) {
+			end = next + 1
+			continue
+		}
+		break
+	}
+	if after := significant(tokens, end+1); after < len(tokens) && tokens[after].text == "(" {
+		for j := i; j <= end; j++ {
+			out[j] = tokens[j].text
+		}
+		return end
+	}
+	for j := i; j <= end; j++ {
+		out[j] = tokens[j].text
+		if tokens[j].kind == kindWord || tokens[j].kind == kindQuotedIdent {
+			out[j] = hashIdent(tokens[j])
+		}
+	}
+	return end
+}
+
+var repeatedPlaceholders = regexp.MustCompile(`\?(\s*,\s*\?)+`)
+
+// Fingerprint identifies the shape of a query: the literals, comments, spacing and keyword case are
+// ignored and IN lists of any length are the same, so it is the same before and after anonymization
+// as long as table names are not hashed
+func Fingerprint(sql string) string {
+	var b strings.Builder
+	space := false
+	for _, t := range tokenize(sql) {
+		var s string
+		switch t.kind {
+		case kindSpace, kindComment:
+			space = b.Len() > 0
+			continue
+		case kindString, kindNumber:
+			s = "?"
+		case kindWord:
+			s = strings.ToUpper(t.text)
+		default:
+			s = t.text
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteString(s)
+	}
+	normalized := placeholderText.ReplaceAllString(b.String(), "?")
+	normalized = repeatedPlaceholders.ReplaceAllString(normalized, "?")
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// placeholderText matches the number placeholders of SQL once normalized, so anonymized text has the
+// same fingerprint as the original
+var placeholderText = regexp.MustCompile(`<(INTEGER|DECIMAL)>`)
@@ -0,0 +1,308 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package sqlanon replaces the literals of sql text and query plans with typed placeholders so
+// queries.json and job profiles can be shared without the values customers query for
+package sqlanon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/rewrite"
+)
+
+// FingerprintKey is added after each anonymized query so identical queries can still be grouped
+const FingerprintKey = "queryFingerprint"
+
+// RemovedPlaceholder replaces values that cannot be anonymized
+const RemovedPlaceholder = "<REMOVED_BY_SQL_ANONYMIZATION>"
+
+// sqlKeys hold sql text: queryText in queries.json, query in job profiles and the job history exports and
+// sql in the dataset profiles
+var sqlKeys = map[string]bool{
+	"queryText": true,
+	"query":     true,
+	"sql":       true,
+}
+
+// errorKeys hold error messages and reasons that Dremio often writes the whole sql into, outcomeReason in
+// queries.json, error_msg in the job history exports and error and verboseError in job profiles
+var errorKeys = map[string]bool{
+	"outcomeReason": true,
+	"error_msg":     true,
+	"error":         true,
+	"verboseError":  true,
+}
+
+// planKeys hold text plans, directly or as lists
+var planKeys = map[string]bool{
+	"plan":                 true,
+	"textPlan":             true,
+	"normalizedPlans":      true,
+	"normalizedQueryPlans": true,
+}
+
+// removedKeys hold plans as json where literals cannot be told apart from names
+var removedKeys = map[string]bool{
+	"jsonPlan": true,
+}
+
+// datasetKeys hold dataset paths that are hashed with the table names, the snake case ones are the
+// columns of the sys.jobs_recent and sys.project.history.jobs exports
+var datasetKeys = map[string]bool{
+	"scannedDatasets":  true,
+	"queriedDatasets":  true,
+	"scanned_datasets": true,
+	"queried_datasets": true,
+	"parentsList":      true,
+	"datasetPath":      true,
+	"datasetPathList":  true,
+}
+
+// Stats counts what was anonymized
+type Stats struct {
+	Queries  int `json:"queries"`
+	Errors   int `json:"errors"`
+	Plans    int `json:"plans"`
+	Datasets int `json:"datasets"`
+	Removed  int `json:"removed"`
+	// Dropped counts the lines of a json lines file that were not valid json and left out
+	Dropped int `json:"dropped"`
+}
+
+func (s Stats) total() int {
+	return s.Queries + s.Errors + s.Plans + s.Datasets + s.Removed + s.Dropped
+}
+
+// Add adds the counts of other to s
+func (s *Stats) Add(other Stats) {
+	s.Queries += other.Queries
+	s.Errors += other.Errors
+	s.Plans += other.Plans
+	s.Datasets += other.Datasets
+	s.Removed += other.Removed
+	s.Dropped += other.Dropped
+}
+
+type frame struct {
+	object bool
+	// key is the field being read in an object, or the field the array is the value of
+	key       string
+	count     int
+	dataset   bool
+	valueNext bool
+}
+
+// JSON copies the json values of r to w, one per line as in queries.json, with the sql, plans and dataset
+// paths anonymized. The order of the fields is kept, numbers are written as they were read
+func (a *Anonymizer) JSON(r io.Reader, w io.Writer) (Stats, error) {
+	var stats Stats
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	out := bufio.NewWriter(w)
+	var stack []*frame
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+		var parent *frame
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1]
+		}
+		if d, ok := tok.(json.Delim); ok && (d == '}' || d == ']') {
+			if err := out.WriteByte(byte(d)); err != nil {
+				return stats, err
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				if err := out.WriteByte('\n'); err != nil {
+					return stats, err
+				}
+			}
+			continue
+		}
+		// an object key
+		if parent != nil && parent.object && !parent.valueNext {
+			key, ok := tok.(string)
+			if !ok {
+				return stats, fmt.Errorf("expected an object key but found %v", tok)
+			}
+			if parent.count > 0 {
+				if err := out.WriteByte(','); err != nil {
+					return stats, err
+				}
+			}
+			parent.count++
+			parent.key = key
+			parent.valueNext = true
+			if err := writeString(out, key); err != nil {
+				return stats, err
+			}
+			if err := out.WriteByte(':'); err != nil {
+				return stats, err
+			}
+			continue
+		}
+		key := ""
+		dataset := false
+		if parent != nil {
+			key = parent.key
+			dataset = parent.dataset || datasetKeys[key]
+			if parent.object {
+				parent.valueNext = false
+			} else {
+				if parent.count > 0 {
+					if err := out.WriteByte(','); err != nil {
+						return stats, err
+					}
+				}
+				parent.count++
+			}
+		}
+		switch v := tok.(type) {
+		case json.Delim:
+			stack = append(stack, &frame{object: v == '{', key: key, dataset: dataset})
+			err = out.WriteByte(byte(v))
+		case string:
+			err = a.writeValue(out, parent, key, dataset, v, &stats)
+		case json.Number:
+			_, err = out.WriteString(v.String())
+		case bool:
+			_, err = fmt.Fprint(out, v)
+		case nil:
+			_, err = out.WriteString("null")
+		}
+		if err != nil {
+			return stats, err
+		}
+		if parent == nil {
+			if _, ok := tok.(json.Delim); !ok {
+				if err := out.WriteByte('\n'); err != nil {
+					return stats, err
+				}
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return stats, io.ErrUnexpectedEOF
+	}
+	return stats, out.Flush()
+}
+
+// writeValue writes one string value, anonymized according to the field it is the value of
+func (a *Anonymizer) writeValue(out *bufio.Writer, parent *frame, key string, dataset bool, v string, stats *Stats) error {
+	inObject := parent != nil && parent.object
+	switch {
+	case inObject && sqlKeys[key]:
+		stats.Queries++
+		if err := writeString(out, a.SQL(v)); err != nil {
+			return err
+		}
+		// the fingerprint of the original text is the same as the one of the anonymized text unless
+		// the table names are hashed, it is written so queries can be grouped either way
+		if _, err := out.WriteString(`,"` + FingerprintKey + `":`); err != nil {
+			return err
+		}
+		parent.count++
+		return writeString(out, Fingerprint(v))
+	case inObject && errorKeys[key]:
+		// the literals of the sql quoted in the message are replaced as they are in the sql itself
+		stats.Errors++
+		return writeString(out, a.SQL(v))
+	case planKeys[key]:
+		stats.Plans++
+		return writeString(out, a.Plan(v))
+	case removedKeys[key]:
+		stats.Removed++
+		return writeString(out, RemovedPlaceholder)
+	case dataset && a.opts.HashTableNames:
+		stats.Datasets++
+		return writeString(out, a.DatasetPath(v))
+	}
+	return writeString(out, v)
+}
+
+// writeString writes s as a json string without escaping <, > and & so the placeholders stay readable
+func writeString(out *bufio.Writer, s string) error {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	_, err := out.Write(bytes.TrimSuffix(b.Bytes(), []byte("\n")))
+	return err
+}
+
+// Lines anonymizes a json lines file such as queries.json, a line that is not valid json, typically the
+// last one of a file that was still being written, is dropped as its literals cannot be found
+func (a *Anonymizer) Lines(r io.Reader, w io.Writer) (Stats, error) {
+	var stats Stats
+	reader := bufio.NewReaderSize(r, 64*1024)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			var out bytes.Buffer
+			s, jsonErr := a.JSON(bytes.NewReader(line), &out)
+			if jsonErr != nil {
+				stats.Dropped++
+			} else {
+				stats.Add(s)
+				if _, err := w.Write(out.Bytes()); err != nil {
+					return stats, err
+				}
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return stats, nil
+		}
+		if err != nil {
+			return stats, err
+		}
+	}
+}
+
+// File anonymizes a json lines file, gzipped or not, or the json entries of a job profile zip in place
+func (a *Anonymizer) File(fileName string) (Stats, error) {
+	var stats Stats
+	_, err := rewrite.File(fileName, func(name string, in io.Reader, out io.Writer) (bool, error) {
+		var s Stats
+		var err error
+		switch {
+		case name == "":
+			s, err = a.Lines(in, out)
+		case strings.HasSuffix(path.Base(name), ".json"):
+			s, err = a.JSON(in, out)
+		default:
+			return false, rewrite.ErrKeep
+		}
+		if err != nil {
+			return false, err
+		}
+		stats.Add(s)
+		return s.total() > 0, nil
+	})
+	return stats, err
+}
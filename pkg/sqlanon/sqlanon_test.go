@@ -0,0 +1,276 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package sqlanon replaces the literals of sql text and query plans with typed placeholders so
+// queries.json and job profiles can be shared without the values customers query for
+package sqlanon
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSQL(t *testing.T) {
+	a := New(Options{})
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			"SELECT name, 42 FROM customers WHERE id = 1234 AND email = 'bob@example.com' -- find bob",
+			"SELECT name, <INTEGER> FROM customers WHERE id = <INTEGER> AND email = '<STRING>' -- <COMMENT>",
+		},
+		{
+			"select * from t where d >= DATE '2024-01-01' and ts < timestamp '2024-01-02 00:00:00' and x in (1.5, -2e3, 'it''s')",
+			"select * from t where d >= DATE '<DATE>' and ts < timestamp '<TIMESTAMP>' and x in (<DECIMAL>, -<DECIMAL>, '<STRING>')",
+		},
+		{
+			"SELECT CAST(a AS VARCHAR(255)), CAST(b AS DECIMAL(10, 2)) FROM t1 /* batch 7 */ GROUP BY 1, 2 ORDER BY 2 DESC LIMIT 10 OFFSET 5",
+			"SELECT CAST(a AS VARCHAR(255)), CAST(b AS DECIMAL(10, 2)) FROM t1 /* <COMMENT> */ GROUP BY 1, 2 ORDER BY 2 DESC LIMIT 10 OFFSET 5",
+		},
+		{
+			"SELECT a, b FROM t GROUP BY 5000 , 123456789 ORDER BY 1, 4242",
+			"SELECT a, b FROM t GROUP BY <INTEGER> , <INTEGER> ORDER BY 1, <INTEGER>",
+		},
+		{
+			"SELECT RANK() OVER (PARTITION BY 77 ORDER BY 2 DESC, 3) FROM t ORDER BY 1 NULLS LAST, 2 LIMIT 5",
+			"SELECT RANK() OVER (PARTITION BY <INTEGER> ORDER BY 2 DESC, 3) FROM t ORDER BY 1 NULLS LAST, 2 LIMIT 5",
+		},
+		{
+			"SELECT * FROM t WHERE x IN (1, 2) ORDER BY 0, 1000",
+			"SELECT * FROM t WHERE x IN (<INTEGER>, <INTEGER>) ORDER BY <INTEGER>, <INTEGER>",
+		},
+		{
+			`SELECT "col 1", $0 FROM "my space"."Sales" WHERE note = 'unterminated`,
+			`SELECT "col 1", $0 FROM "my space"."Sales" WHERE note = '<STRING>'`,
+		},
+	}
+	for _, tt := range tests {
+		if actual := a.SQL(tt.sql); actual != tt.expected {
+			t.Errorf("\nsql      %v\nexpected %v\nactual   %v", tt.sql, tt.expected, actual)
+		}
+	}
+}
+
+func TestSQLHashesTableNames(t *testing.T) {
+	a := New(Options{HashTableNames: true})
+	sales := hashIdent(token{kind: kindWord, text: "sales"})
+	space := hashIdent(token{kind: kindQuotedIdent, text: `"My Space"`})
+	orders := hashIdent(token{kind: kindWord, text: "orders"})
+	items := hashIdent(token{kind: kindWord, text: "items"})
+	tests := []struct {
+		sql      string
+		expected string
+	}{
+		{
+			`SELECT s.id FROM "My Space".Sales s JOIN orders o ON s.id = o.id WHERE EXTRACT(YEAR FROM s.d) = 2024`,
+			`SELECT s.id FROM ` + space + `.` + sales + ` s JOIN ` + orders + ` o ON s.id = o.id WHERE EXTRACT(YEAR FROM s.d) = <INTEGER>`,
+		},
+		{
+			"select * from (select a, b from SALES) x, orders, items where x.a = 1",
+			"select * from (select a, b from " + sales + ") x, " + orders + ", " + items + " where x.a = <INTEGER>",
+		},
+		{
+			"SELECT * FROM TABLE(flatten(x)) INSERT INTO orders VALUES (1)",
+			"SELECT * FROM TABLE(flatten(x)) INSERT INTO " + orders + " VALUES (<INTEGER>)",
+		},
+	}
+	for _, tt := range tests {
+		if actual := a.SQL(tt.sql); actual != tt.expected {
+			t.Errorf("\nsql      %v\nexpected %v\nactual   %v", tt.sql, tt.expected, actual)
+		}
+	}
+	if actual := a.DatasetPath(`"my space".sales`); actual != `"`+strings.Trim(space, `"`)+`".`+sales {
+		t.Errorf("expected the dataset path to hash like the sql but was %v", actual)
+	}
+}
+
+func TestPlan(t *testing.T) {
+	plan := `00-00    Screen : rowType = RecordType(VARCHAR(65536) name): rowcount = 1.0E8, cumulative cost = {1.1E8 rows, 2.0E9 cpu}, id = 1234
+00-01      Filter(condition=[AND(=($0, 'bob':VARCHAR(3)), >($1, 42))]) : rowcount = 15.0, id = 1233
+00-02        ScanCrel(table=[Samples."samples.dremio.com".customers], columns=[$0, $1], splits=[1])`
+	expected := `00-00    Screen : rowType = RecordType(VARCHAR(65536) name): rowcount = 1.0E8, cumulative cost = {1.1E8 rows, 2.0E9 cpu}, id = 1234
+00-01      Filter(condition=[AND(=($0, '<STRING>':VARCHAR(3)), >($1, <INTEGER>))]) : rowcount = 15.0, id = 1233
+00-02        ScanCrel(table=[Samples."samples.dremio.com".customers], columns=[$0, $1], splits=[<INTEGER>])`
+	if actual := New(Options{}).Plan(plan); actual != expected {
+		t.Errorf("\nexpected %v\nactual   %v", expected, actual)
+	}
+	hashed := New(Options{HashTableNames: true}).Plan(plan)
+	if strings.Contains(hashed, "customers") || strings.Contains(hashed, "samples.dremio.com") {
+		t.Errorf("expected the table to be hashed in %v", hashed)
+	}
+	if !strings.Contains(hashed, "columns=[$0, $1]") {
+		t.Errorf("expected only the table to be hashed in %v", hashed)
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	a := New(Options{})
+	original := "select * from t where id in (1, 2, 3) and name = 'bob' -- note"
+	same := []string{
+		"SELECT *   FROM t WHERE id IN (42) AND name = 'amy'",
+		a.SQL(original),
+	}
+	for _, sql := range same {
+		if Fingerprint(sql) != Fingerprint(original) {
+			t.Errorf("expected %q to have the fingerprint of %q", sql, original)
+		}
+	}
+	if Fingerprint("select * from u where id in (1)") == Fingerprint(original) {
+		t.Error("expected a different table to change the fingerprint")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	queries := `{"queryId":"1","queryText":"SELECT * FROM t WHERE id = 7","start":1709280000000,"scannedDatasets":["a.b"],"accelerated":false,"x":null}
+{"queryId":"2","queryText":"select 'a<b>'","queryCost":1.5e3}
+`
+	var out bytes.Buffer
+	stats, err := New(Options{HashTableNames: true}).JSON(strings.NewReader(queries), &out)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	a := hashIdent(token{kind: kindWord, text: "a"})
+	b := hashIdent(token{kind: kindWord, text: "b"})
+	tbl := hashIdent(token{kind: kindWord, text: "t"})
+	expected := `{"queryId":"1","queryText":"SELECT * FROM ` + tbl + ` WHERE id = <INTEGER>","queryFingerprint":"` + Fingerprint("SELECT * FROM t WHERE id = 7") + `","start":1709280000000,"scannedDatasets":["` + a + `.` + b + `"],"accelerated":false,"x":null}
+{"queryId":"2","queryText":"select '<STRING>'","queryFingerprint":"` + Fingerprint("select 'a<b>'") + `","queryCost":1.5e3}
+`
+	if out.String() != expected {
+		t.Errorf("\nexpected %v\nactual   %v", expected, out.String())
+	}
+	if stats != (Stats{Queries: 2, Datasets: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if _, err := New(Options{}).JSON(strings.NewReader(`{"queryText":"select 1"`), io.Discard); err == nil {
+		t.Error("expected an error for truncated json")
+	}
+}
+
+func TestJSONJobHistoryExport(t *testing.T) {
+	row := `{"job_id":"1a","query":"SELECT * FROM t WHERE name = 'bob'","queried_datasets":["a.b"],"status":"COMPLETED"}` + "\n"
+	var out bytes.Buffer
+	stats, err := New(Options{HashTableNames: true}).JSON(strings.NewReader(row), &out)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if strings.Contains(out.String(), "bob") || strings.Contains(out.String(), `"a.b"`) {
+		t.Errorf("expected the query and the queried datasets to be anonymized but was %v", out.String())
+	}
+	if stats != (Stats{Queries: 1, Datasets: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestJSONErrorFields(t *testing.T) {
+	message := "SQL Query SELECT * FROM t WHERE name = 'John Smith' AND ssn = '123-45-6789' AND card = 4111111111111111"
+	for _, key := range []string{"outcomeReason", "error_msg", "error", "verboseError"} {
+		line := `{"queryId":"1","` + key + `":"` + message + `"}` + "\n"
+		var out bytes.Buffer
+		stats, err := New(Options{}).Lines(strings.NewReader(line), &out)
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		for _, literal := range []string{"John Smith", "123-45-6789", "4111111111111111"} {
+			if strings.Contains(out.String(), literal) {
+				t.Errorf("expected %v to be removed from %v but was %v", literal, key, out.String())
+			}
+		}
+		expected := `{"queryId":"1","` + key + `":"SQL Query SELECT * FROM t WHERE name = '<STRING>' AND ssn = '<STRING>' AND card = <INTEGER>"}` + "\n"
+		if out.String() != expected {
+			t.Errorf("\nexpected %v\nactual   %v", expected, out.String())
+		}
+		if stats != (Stats{Errors: 1}) {
+			t.Errorf("unexpected stats %+v for %v", stats, key)
+		}
+	}
+}
+
+func TestFileRewritesJobProfileZips(t *testing.T) {
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	entries := map[string]string{
+		"profile_attempt_0.json": `{"query":"select * from t where id = 99","plan":"Filter(condition=[=($0, 99)])","jsonPlan":"{\"value\": 99}"}`,
+		"notes.txt":              "id = 99",
+	}
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fileName := filepath.Join(t.TempDir(), "1b9b9629.zip")
+	if err := os.WriteFile(fileName, zipped.Bytes(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := New(Options{}).File(fileName)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if stats != (Stats{Queries: 1, Plans: 1, Removed: 1}) {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	zr, err := zip.OpenReader(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch f.Name {
+		case "notes.txt":
+			if string(content) != entries["notes.txt"] {
+				t.Errorf("expected notes.txt to be kept but was %q", content)
+			}
+		default:
+			if strings.Contains(string(content), "99") {
+				t.Errorf("expected the literals to be replaced in %s", content)
+			}
+		}
+	}
+}
+
+func TestLinesDropsInvalidLines(t *testing.T) {
+	queries := "{\"queryText\":\"select 1\"}\n{\"queryText\":\"select 'trunc\n"
+	var out bytes.Buffer
+	stats, err := New(Options{}).Lines(strings.NewReader(queries), &out)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if stats.Queries != 1 || stats.Dropped != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+	if strings.Contains(out.String(), "trunc") {
+		t.Errorf("expected the invalid line to be dropped in %v", out.String())
+	}
+}
@@ -0,0 +1,145 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package sqlanon replaces the literals of sql text and query plans with typed placeholders so
+// queries.json and job profiles can be shared without the values customers query for
+package sqlanon
+
+type kind int
+
+const (
+	kindSpace kind = iota
+	kindComment
+	kindString
+	kindQuotedIdent
+	kindNumber
+	kindWord
+	kindPunct
+)
+
+type token struct {
+	kind kind
+	text string
+}
+
+func isWordStart(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordPart(c byte) bool {
+	return isWordStart(c) || isDigit(c)
+}
+
+// tokenize splits sql into tokens, concatenating the text of the tokens gives back sql. Unterminated
+// strings, identifiers and comments run to the end of the text
+func tokenize(sql string) []token {
+	var tokens []token
+	i := 0
+	for i < len(sql) {
+		start := i
+		c := sql[i]
+		var k kind
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			k = kindSpace
+			for i < len(sql) && (sql[i] == ' ' || sql[i] == '\t' || sql[i] == '\n' || sql[i] == '\r' || sql[i] == '\f') {
+				i++
+			}
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			k = kindComment
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			k = kindComment
+			i += 2
+			for i < len(sql) && !(sql[i] == '*' && i+1 < len(sql) && sql[i+1] == '/') {
+				i++
+			}
+			i += 2
+			if i > len(sql) {
+				i = len(sql)
+			}
+		case c == '\'':
+			k = kindString
+			i = endOfQuoted(sql, i, '\'')
+		case c == '"' || c == '`':
+			k = kindQuotedIdent
+			i = endOfQuoted(sql, i, c)
+		case isDigit(c) || c == '.' && i+1 < len(sql) && isDigit(sql[i+1]):
+			var word bool
+			i, word = endOfNumber(sql, i)
+			k = kindNumber
+			if word {
+				k = kindWord
+			}
+		case isWordStart(c):
+			k = kindWord
+			for i < len(sql) && isWordPart(sql[i]) {
+				i++
+			}
+		default:
+			k = kindPunct
+			i++
+		}
+		tokens = append(tokens, token{kind: k, text: sql[start:i]})
+	}
+	return tokens
+}
+
+// endOfQuoted finds the end of a quoted string or identifier, a doubled quote is an escaped quote
+func endOfQuoted(sql string, i int, quote byte) int {
+	i++
+	for i < len(sql) {
+		if sql[i] == quote {
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+// endOfNumber finds the end of a number, word is true when letters follow the digits as in 12abc
+// which most dialects read as a name
+func endOfNumber(sql string, i int) (int, bool) {
+	for i < len(sql) && (isDigit(sql[i]) || sql[i] == '.') {
+		i++
+	}
+	if i < len(sql) && (sql[i] == 'e' || sql[i] == 'E') {
+		j := i + 1
+		if j < len(sql) && (sql[j] == '+' || sql[j] == '-') {
+			j++
+		}
+		if j < len(sql) && isDigit(sql[j]) {
+			i = j
+			for i < len(sql) && isDigit(sql[i]) {
+				i++
+			}
+		}
+	}
+	word := false
+	for i < len(sql) && isWordPart(sql[i]) {
+		word = true
+		i++
+	}
+	return i, word
+}
@@ -0,0 +1,108 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats
+
+import "math"
+
+// HistogramAccuracy is how far a percentile of a Histogram may be from the real value, relative to it
+const HistogramAccuracy = 0.01
+
+// histogramMaxValue is the largest value given its own bucket, larger values count in the last one
+const histogramMaxValue = 1e12
+
+var (
+	histogramGamma    = (1 + HistogramAccuracy) / (1 - HistogramAccuracy)
+	histogramLogGamma = math.Log(histogramGamma)
+	histogramBuckets  = int(math.Ceil(math.Log(histogramMaxValue)/histogramLogGamma)) + 2
+)
+
+// Histogram counts values in buckets whose bounds grow by a fixed ratio, so the percentiles of any
+// number of values are within HistogramAccuracy of the real ones in a fixed amount of memory. Values
+// below 1, such as the milliseconds of a query that did not plan, share the first bucket
+type Histogram struct {
+	counts   []int64
+	count    int64
+	min, max float64
+}
+
+// NewHistogram returns an empty Histogram
+func NewHistogram() *Histogram {
+	return &Histogram{counts: make([]int64, histogramBuckets)}
+}
+
+// Add counts v
+func (h *Histogram) Add(v float64) {
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.counts[histogramIndex(v)]++
+}
+
+// histogramIndex is 0 below 1, bucket k above holds (gamma^(k-2), gamma^(k-1)]
+func histogramIndex(v float64) int {
+	if v < 1 {
+		return 0
+	}
+	i := 1 + int(math.Ceil(math.Log(v)/histogramLogGamma))
+	if i >= histogramBuckets {
+		return histogramBuckets - 1
+	}
+	return i
+}
+
+// Count is the number of values added
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// Max returns the largest value or 0 when there are no values
+func (h *Histogram) Max() float64 {
+	return h.max
+}
+
+// Percentile returns the nearest rank percentile p (0-100) as Percentile does for the values, the
+// minimum and maximum are exact
+func (h *Histogram) Percentile(p float64) float64 {
+	if h.count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.min
+	}
+	if p >= 100 {
+		return h.max
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return math.Min(math.Max(histogramValue(i), h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// histogramValue is the value of bucket i that is within HistogramAccuracy of all of the bucket
+func histogramValue(i int) float64 {
+	if i == 0 {
+		return 0
+	}
+	return 2 * math.Pow(histogramGamma, float64(i-1)) / (histogramGamma + 1)
+}
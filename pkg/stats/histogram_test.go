@@ -0,0 +1,68 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/stats"
+)
+
+func TestHistogram(t *testing.T) {
+	h := stats.NewHistogram()
+	r := rand.New(rand.NewSource(1))
+	var values []float64
+	for i := 0; i < 100000; i++ {
+		// query times spread over several orders of magnitude
+		v := math.Floor(math.Exp(r.Float64() * 15))
+		values = append(values, v)
+		h.Add(v)
+	}
+	if h.Count() != int64(len(values)) {
+		t.Errorf("expected %v values but was %v", len(values), h.Count())
+	}
+	for _, p := range []float64{0, 1, 50, 90, 95, 99, 99.9, 100} {
+		expected := stats.Percentile(values, p)
+		actual := h.Percentile(p)
+		if math.Abs(actual-expected) > expected*stats.HistogramAccuracy {
+			t.Errorf("p%v expected %v within %v but got %v", p, expected, stats.HistogramAccuracy, actual)
+		}
+	}
+	if h.Max() != stats.Max(values) {
+		t.Errorf("expected max %v but got %v", stats.Max(values), h.Max())
+	}
+}
+
+func TestHistogramSmallValues(t *testing.T) {
+	h := stats.NewHistogram()
+	for _, v := range []float64{0, 0, 0, 0.5, 3} {
+		h.Add(v)
+	}
+	tests := map[float64]float64{0: 0, 50: 0, 80: 0, 100: 3}
+	for p, expected := range tests {
+		if actual := h.Percentile(p); actual != expected {
+			t.Errorf("p%v expected %v but got %v", p, expected, actual)
+		}
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	h := stats.NewHistogram()
+	if h.Percentile(50) != 0 || h.Max() != 0 || h.Count() != 0 {
+		t.Errorf("expected an empty histogram to report 0 but got p50 %v, max %v and %v values", h.Percentile(50), h.Max(), h.Count())
+	}
+}
@@ -0,0 +1,50 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package stats_test
+
+import (
+	"testing"
+
+	"github.com/dremio/dremio-diagnostic-collector/pkg/stats"
+)
+
+func TestPercentile(t *testing.T) {
+	values := []float64{10, 1, 9, 2, 8, 3, 7, 4, 6, 5}
+	tests := map[float64]float64{0: 1, 50: 5, 90: 9, 95: 10, 99: 10, 100: 10}
+	for p, expected := range tests {
+		if actual := stats.Percentile(values, p); actual != expected {
+			t.Errorf("p%v expected %v but got %v", p, expected, actual)
+		}
+	}
+}
+
+func TestPercentileEmpty(t *testing.T) {
+	if actual := stats.Percentile([]float64{}, 50); actual != 0 {
+		t.Errorf("expected 0 but got %v", actual)
+	}
+}
+
+func TestSumAndMax(t *testing.T) {
+	values := []float64{1.5, 3, 2}
+	if actual := stats.Sum(values); actual != 6.5 {
+		t.Errorf("expected 6.5 but got %v", actual)
+	}
+	if actual := stats.Max(values); actual != 3 {
+		t.Errorf("expected 3 but got %v", actual)
+	}
+	if actual := stats.Max(nil); actual != 0 {
+		t.Errorf("expected 0 but got %v", actual)
+	}
+}
@@ -0,0 +1,115 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package timewindow describes the absolute time range set by --since and --until that a collection is limited to
+package timewindow
+
+import (
+	"fmt"
+	"time"
+)
+
+// layouts accepted for --since and --until, times without an offset are UTC
+var layouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// Window is a time range where either end may be open, the zero Window contains everything
+type Window struct {
+	Since time.Time
+	Until time.Time
+}
+
+func parseTime(name, value string) (time.Time, error) {
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid %v '%v', expected a time like 2024-01-02T14:05:00Z", name, value)
+}
+
+// Parse reads the --since and --until values, either may be empty
+func Parse(since, until string) (Window, error) {
+	var w Window
+	var err error
+	if since != "" {
+		if w.Since, err = parseTime("since", since); err != nil {
+			return Window{}, err
+		}
+	}
+	if until != "" {
+		if w.Until, err = parseTime("until", until); err != nil {
+			return Window{}, err
+		}
+	}
+	if !w.Since.IsZero() && !w.Until.IsZero() && !w.Until.After(w.Since) {
+		return Window{}, fmt.Errorf("until %v must be after since %v", until, since)
+	}
+	return w, nil
+}
+
+// IsSet is true when either end of the window is set
+func (w Window) IsSet() bool {
+	return !w.Since.IsZero() || !w.Until.IsZero()
+}
+
+// Contains reports whether t is inside the window, both ends are inclusive
+func (w Window) Contains(t time.Time) bool {
+	if !w.Since.IsZero() && t.Before(w.Since) {
+		return false
+	}
+	if !w.Until.IsZero() && t.After(w.Until) {
+		return false
+	}
+	return true
+}
+
+// ContainsMillis is Contains for epoch milliseconds as found in queries.json
+func (w Window) ContainsMillis(ms int64) bool {
+	return w.Contains(time.UnixMilli(ms))
+}
+
+// Overlaps reports whether any part of [start, end] is inside the window
+func (w Window) Overlaps(start, end time.Time) bool {
+	if !w.Since.IsZero() && end.Before(w.Since) {
+		return false
+	}
+	if !w.Until.IsZero() && start.After(w.Until) {
+		return false
+	}
+	return true
+}
+
+// OverlapsDay reports whether the calendar day of t, in the location of t, overlaps the window.
+// Log archives are named after the local day they cover
+func (w Window) OverlapsDay(t time.Time) bool {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return w.Overlaps(start, start.AddDate(0, 0, 1).Add(-time.Nanosecond))
+}
+
+func (w Window) String() string {
+	format := func(t time.Time) string {
+		if t.IsZero() {
+			return "*"
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	return fmt.Sprintf("%v to %v", format(w.Since), format(w.Until))
+}
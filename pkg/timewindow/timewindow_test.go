@@ -0,0 +1,109 @@
+//	Copyright 2023 Dremio Corporation
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// package timewindow describes the absolute time range set by --since and --until that a collection is limited to
+package timewindow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseLayouts(t *testing.T) {
+	expected := time.Date(2024, 1, 2, 14, 5, 0, 0, time.UTC)
+	for _, value := range []string{"2024-01-02T14:05:00Z", "2024-01-02T15:05:00+01:00", "2024-01-02T14:05:00", "2024-01-02 14:05:00", "2024-01-02T14:05", "2024-01-02 14:05"} {
+		w, err := Parse(value, "")
+		if err != nil {
+			t.Fatalf("unexpected error for %v: %v", value, err)
+		}
+		if !w.Since.Equal(expected) {
+			t.Errorf("expected %v for %v but was %v", expected, value, w.Since)
+		}
+		if !w.Until.IsZero() {
+			t.Errorf("expected until to be unset but was %v", w.Until)
+		}
+	}
+	w, err := Parse("", "2024-01-02")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !w.Until.Equal(time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected until %v", w.Until)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse("yesterday", ""); err == nil {
+		t.Error("expected an error for an invalid since")
+	}
+	if _, err := Parse("", "01/02/2024"); err == nil {
+		t.Error("expected an error for an invalid until")
+	}
+	if _, err := Parse("2024-01-02T15:00:00Z", "2024-01-02T14:00:00Z"); err == nil {
+		t.Error("expected an error when until is before since")
+	}
+	if _, err := Parse("2024-01-02T15:00:00Z", "2024-01-02T15:00:00Z"); err == nil {
+		t.Error("expected an error when until equals since")
+	}
+}
+
+func TestEmptyWindowContainsEverything(t *testing.T) {
+	w, err := Parse("", "")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if w.IsSet() {
+		t.Error("expected an empty window not to be set")
+	}
+	if !w.Contains(time.Time{}) || !w.Contains(time.Now()) {
+		t.Error("expected an empty window to contain everything")
+	}
+	if w.String() != "* to *" {
+		t.Errorf("unexpected string %v", w.String())
+	}
+}
+
+func TestContains(t *testing.T) {
+	w, err := Parse("2024-01-02T14:00:00Z", "2024-01-02T15:00:00Z")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	since := time.Date(2024, 1, 2, 14, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 1, 2, 15, 0, 0, 0, time.UTC)
+	if !w.Contains(since) || !w.Contains(until) {
+		t.Error("expected both ends to be inclusive")
+	}
+	if w.Contains(since.Add(-time.Second)) || w.Contains(until.Add(time.Second)) {
+		t.Error("expected times outside the window to be excluded")
+	}
+	if !w.ContainsMillis(since.Add(30 * time.Minute).UnixMilli()) {
+		t.Error("expected millis inside the window to be included")
+	}
+	if w.String() != "2024-01-02T14:00:00Z to 2024-01-02T15:00:00Z" {
+		t.Errorf("unexpected string %v", w.String())
+	}
+}
+
+func TestOverlapsDay(t *testing.T) {
+	w, err := Parse("2024-01-02T23:30:00Z", "2024-01-03T00:30:00Z")
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for day, expected := range map[int]bool{1: false, 2: true, 3: true, 4: false} {
+		d := time.Date(2024, 1, day, 12, 0, 0, 0, time.UTC)
+		if actual := w.OverlapsDay(d); actual != expected {
+			t.Errorf("expected day %v to overlap %v but was %v", day, expected, actual)
+		}
+	}
+}